@@ -2,6 +2,7 @@ package godb
 
 import (
 	"fmt"
+	"hash/fnv"
 )
 
 type Aggregator struct {
@@ -14,8 +15,34 @@ type Aggregator struct {
 	newAggState []AggState
 
 	child Operator // the child operator for the inputs to aggregate
+
+	// If true, groups are formed by sorting the child's tuples on the group by
+	// fields, rather than by hashing them. If inputSorted is also true, the
+	// child's tuples are already sorted, so the sort is skipped.
+	sortGroups  bool
+	inputSorted bool
+
+	// The maximum number of groups a hash aggregation holds in memory, and the
+	// number of times the tuples being aggregated have been spilled (see
+	// [Aggregator.Iterator]).
+	maxGroups  int
+	spillLevel int
 }
 
+// The default maximum number of groups whose aggregation states a hash
+// aggregation holds in memory. The tuples of further groups are spilled to
+// temporary files and aggregated once the groups in memory have been returned.
+var AggBufferSize int = 100000
+
+// The number of temporary files the tuples of groups that don't fit in memory
+// are partitioned into, and the number of times they may be repartitioned
+// before all of a partition's groups are held in memory regardless of
+// maxGroups.
+const (
+	aggSpillPartitions = 16
+	aggMaxSpillLevel   = 8
+)
+
 type AggType int
 
 const (
@@ -25,14 +52,32 @@ const (
 
 const DefaultGroup int = 0 // for handling the case of no group-by
 
-// Construct an aggregator with a group-by.
+// Construct an aggregator with a group-by. Groups are formed by hashing, with
+// the aggregation states of at most [AggBufferSize] groups held in memory.
 func NewGroupedAggregator(emptyAggState []AggState, groupByFields []Expr, child Operator) *Aggregator {
-	return &Aggregator{groupByFields, emptyAggState, child}
+	return &Aggregator{groupByFields: groupByFields, newAggState: emptyAggState, child: child, maxGroups: AggBufferSize}
+}
+
+// Construct an aggregator with a group-by that sorts the child's tuples on the
+// group-by fields (externally, if they don't fit in [SortBufferSize] bytes),
+// and then aggregates each group as it is read, so that only one
+// group's aggregation state is held in memory at a time. The groups are
+// returned in sorted order.
+func NewSortGroupedAggregator(emptyAggState []AggState, groupByFields []Expr, child Operator) *Aggregator {
+	return &Aggregator{groupByFields: groupByFields, newAggState: emptyAggState, child: child, sortGroups: true}
+}
+
+// Construct an aggregator with a group-by over a child whose tuples are already
+// sorted on the group-by fields (in either direction), so that the tuples of
+// each group are adjacent. Each group is aggregated as it is read, as with
+// [NewSortGroupedAggregator], but without sorting.
+func NewPresortedGroupedAggregator(emptyAggState []AggState, groupByFields []Expr, child Operator) *Aggregator {
+	return &Aggregator{groupByFields: groupByFields, newAggState: emptyAggState, child: child, sortGroups: true, inputSorted: true}
 }
 
 // Construct an aggregator with no group-by.
 func NewAggregator(emptyAggState []AggState, child Operator) *Aggregator {
-	return &Aggregator{nil, emptyAggState, child}
+	return &Aggregator{newAggState: emptyAggState, child: child}
 }
 
 // Return a TupleDescriptor for this aggregation.
@@ -66,10 +111,7 @@ func (a *Aggregator) Descriptor() *TupleDesc {
 		Fields: make([]FieldType, len(a.groupByFields)),
 	}
 	for i, expr := range a.groupByFields {
-		groupByDesc.Fields[i] = FieldType{
-			Fname: fmt.Sprintf("groupby_%d", i),
-			Ftype: expr.GetExprType().Ftype,
-		}
+		groupByDesc.Fields[i] = expr.GetExprType()
 	}
 
 	// Then merge with aggregation state descriptors
@@ -92,6 +134,11 @@ func (a *Aggregator) Descriptor() *TupleDesc {
 // iterate through each group's result. In the case where there is no group-by,
 // the iterator simply iterates through only one tuple, representing the
 // aggregation of all child tuples.
+//
+// If there are more than maxGroups groups, the tuples of groups that are not in
+// memory when they are read are partitioned, by the hash of their group, into
+// temporary files, and the groups of each partition are aggregated (and, if
+// necessary, partitioned again) after those in memory have been returned.
 func (a *Aggregator) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 	// the child iterator
 	childIter, err := a.child.Iterator(tid)
@@ -101,6 +148,9 @@ func (a *Aggregator) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 	if childIter == nil {
 		return nil, GoDBError{MalformedDataError, "child iter unexpectedly nil"}
 	}
+	if a.sortGroups && a.groupByFields != nil {
+		return a.sortedGroupsIterator(childIter)
+	}
 
 	// the map that stores the aggregation state of each group
 	aggState := make(map[any]*[]AggState)
@@ -119,6 +169,8 @@ func (a *Aggregator) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 
 	// the list of group key tuples
 	var groupByList []*Tuple
+	// the temporary files of the tuples of groups that didn't fit in memory
+	var partitions []*tempFile
 	// the iterator for iterating thru the finalized aggregation results for each group
 	var finalizedIter func() (*Tuple, error)
 
@@ -143,6 +195,18 @@ func (a *Aggregator) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 				}
 
 				key := keygenTup.tupleKey()
+				// tuples that can't be written to temporary files are kept
+				// in memory
+				if aggState[key] == nil && a.maxGroups > 0 && len(groupByList) >= a.maxGroups && a.spillLevel < aggMaxSpillLevel && checkTempFileDesc(&t.Desc) == nil {
+					if partitions == nil {
+						partitions = make([]*tempFile, aggSpillPartitions)
+					}
+					if err := a.spill(partitions, key, t); err != nil {
+						closeTempFiles(partitions)
+						return nil, err
+					}
+					continue
+				}
 				if aggState[key] == nil {
 					asNew := make([]AggState, len(a.newAggState))
 					aggState[key] = &asNew
@@ -157,19 +221,170 @@ func (a *Aggregator) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 			if a.groupByFields == nil {
 				var tup *Tuple
 				for i := 0; i < len(a.newAggState); i++ {
-					newTup := (*aggState[DefaultGroup])[i].Finalize()
+					newTup, err := finalizeAggState((*aggState[DefaultGroup])[i])
+					if err != nil {
+						return nil, err
+					}
 					tup = joinTuples(tup, newTup)
 				}
 				finalizedIter = func() (*Tuple, error) { return nil, nil }
 				return tup, nil
 			} else {
 				finalizedIter = getFinalizedTuplesIterator(a, groupByList, aggState)
+				if partitions != nil {
+					finalizedIter, err = a.spilledGroupsIterator(tid, finalizedIter, partitions)
+					if err != nil {
+						return nil, err
+					}
+				}
 			}
 		}
 		return finalizedIter()
 	}, nil
 }
 
+// Write t, a tuple of the group with the given key, to the partition of
+// partitions for the key, creating the partition's file if necessary.
+func (a *Aggregator) spill(partitions []*tempFile, key any, t *Tuple) error {
+	// hash differently at each level, so that the groups of a partition that
+	// is spilled again are spread across partitions
+	h := fnv.New64a()
+	h.Write([]byte{byte(a.spillLevel)})
+	h.Write([]byte(key.(string)))
+	p := h.Sum64() % uint64(len(partitions))
+	if partitions[p] == nil {
+		var err error
+		partitions[p], err = newTempFile(&t.Desc)
+		if err != nil {
+			return err
+		}
+	}
+	return partitions[p].append(t)
+}
+
+// Close all of the non-nil temporary files.
+func closeTempFiles(files []*tempFile) {
+	for _, f := range files {
+		if f != nil {
+			f.close()
+		}
+	}
+}
+
+// Return an iterator over the results of inMemory followed by the aggregates of
+// the groups of the tuples in each of the spilled partitions, each of which is
+// closed once its groups have been returned.
+func (a *Aggregator) spilledGroupsIterator(tid TransactionID, inMemory func() (*Tuple, error), partitions []*tempFile) (func() (*Tuple, error), error) {
+	for _, p := range partitions {
+		if p == nil {
+			continue
+		}
+		if err := p.finish(); err != nil {
+			closeTempFiles(partitions)
+			return nil, err
+		}
+	}
+	iter := inMemory
+	next := 0 // the next partition to aggregate
+	return func() (*Tuple, error) {
+		for {
+			t, err := iter()
+			if err != nil {
+				closeTempFiles(partitions)
+				return nil, err
+			}
+			if t != nil {
+				return t, nil
+			}
+			if next > 0 {
+				partitions[next-1].close()
+				partitions[next-1] = nil
+			}
+			for next < len(partitions) && partitions[next] == nil {
+				next++
+			}
+			if next == len(partitions) {
+				return nil, nil
+			}
+			sub := &Aggregator{
+				groupByFields: a.groupByFields,
+				newAggState:   a.newAggState,
+				child:         partitions[next],
+				maxGroups:     a.maxGroups,
+				spillLevel:    a.spillLevel + 1,
+			}
+			next++
+			if iter, err = sub.Iterator(tid); err != nil {
+				closeTempFiles(partitions)
+				return nil, err
+			}
+		}
+	}, nil
+}
+
+// Return an iterator over the aggregates of the groups of the tuples of
+// childIter, formed by sorting the tuples on their group by fields so that the
+// tuples of each group are adjacent (unless they are already sorted).
+func (a *Aggregator) sortedGroupsIterator(childIter func() (*Tuple, error)) (func() (*Tuple, error), error) {
+	ascs := make([]bool, len(a.groupByFields))
+	for i := range ascs {
+		ascs[i] = true
+	}
+	sortedIter := childIter
+	if !a.inputSorted {
+		var err error
+		sortedIter, err = externalSort(a.child.Descriptor(), childIter, func(t1, t2 *Tuple) (bool, error) {
+			return orderByLess(a.groupByFields, ascs, t1, t2)
+		}, SortBufferSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the first tuple of the next group
+	next, err := sortedIter()
+	if err != nil {
+		return nil, err
+	}
+	return func() (*Tuple, error) {
+		if next == nil {
+			return nil, nil
+		}
+		groupTup, err := extractGroupByKeyTuple(a, next)
+		if err != nil {
+			return nil, err
+		}
+		key := groupTup.tupleKey()
+		grpAggState := make([]AggState, len(a.newAggState))
+		for next != nil {
+			addTupleToGrpAggState(a, next, &grpAggState)
+			if next, err = sortedIter(); err != nil {
+				return nil, err
+			}
+			if next == nil {
+				break
+			}
+			nextTup, err := extractGroupByKeyTuple(a, next)
+			if err != nil {
+				return nil, err
+			}
+			if nextTup.tupleKey() != key {
+				break
+			}
+		}
+
+		result := groupTup
+		for _, as := range grpAggState {
+			t, err := finalizeAggState(as)
+			if err != nil {
+				return nil, err
+			}
+			result = joinTuples(result, t)
+		}
+		return result, nil
+	}, nil
+}
+
 // Given a tuple t from a child iterator, return a tuple that identifies t's
 // group. The returned tuple should contain the fields from the groupByFields
 // list passed into the aggregator constructor. The ith field can be extracted
@@ -191,7 +406,7 @@ func extractGroupByKeyTuple(a *Aggregator, t *Tuple) (*Tuple, error) {
 			return nil, err
 		}
 		keyFields[i] = val
-		newDesc[i] = FieldType{Fname: expr.GetExprType().Fname, Ftype: expr.GetExprType().Ftype}
+		newDesc[i] = expr.GetExprType()
 	}
 
 	return &Tuple{
@@ -246,7 +461,10 @@ func getFinalizedTuplesIterator(a *Aggregator, groupByList []*Tuple, aggState ma
 		// Finalize each aggregation state
 		var resultTuple *Tuple
 		for _, aggState := range *groupAggStates {
-			finalizedStateTuple := aggState.Finalize()
+			finalizedStateTuple, err := finalizeAggState(aggState)
+			if err != nil {
+				return nil, err
+			}
 
 			// Join the group by tuple with the finalized state tuple
 			if resultTuple == nil {
@@ -1,6 +1,9 @@
 package godb
 
 import (
+	"fmt"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -373,3 +376,384 @@ func TestAggRepeatedIteration(t *testing.T) {
 		t.Errorf("count changed on repeated iteration")
 	}
 }
+
+// check that grouping with more groups than fit in memory spills them to
+// temporary files, several times over, and still aggregates each group once
+func TestAggGbySpill(t *testing.T) {
+	useTempDirForTest(t)
+	td, mf := makeExternalSortVars(t, 2000)
+	gbys := []Expr{&FieldExpr{td.Fields[0]}, &FieldExpr{td.Fields[1]}}
+	countState := func() []AggState {
+		ca := CountAggState{}
+		if err := ca.Init("count", &FieldExpr{td.Fields[1]}); err != nil {
+			t.Fatalf(err.Error())
+		}
+		return []AggState{&ca}
+	}
+
+	expected := make(map[any]int64)
+	for _, tup := range collectTuplesForTest(t, &Aggregator{groupByFields: gbys, newAggState: countState(), child: mf}, 0) {
+		key := (&Tuple{Fields: tup.Fields[:2]}).tupleKey()
+		expected[key] = tup.Fields[2].(IntField).Value
+	}
+
+	oldSize := AggBufferSize
+	defer func() { AggBufferSize = oldSize }()
+	for _, bufSize := range []int{1, 5, 100, 5000} {
+		AggBufferSize = bufSize
+		got := collectTuplesForTest(t, NewGroupedAggregator(countState(), gbys, mf), 0)
+		if len(got) != len(expected) {
+			t.Errorf("buffer size %d: expected %d groups, got %d", bufSize, len(expected), len(got))
+		}
+		for _, tup := range got {
+			key := (&Tuple{Fields: tup.Fields[:2]}).tupleKey()
+			if n := tup.Fields[2].(IntField).Value; n != expected[key] {
+				t.Errorf("buffer size %d: expected count %d for group %v, got %d", bufSize, expected[key], tup.Fields[:2], n)
+			}
+		}
+	}
+}
+
+func TestAggGbyPresortedQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	explain := func(sql string) string {
+		_, plan, err := Parse(c, sql)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var sb strings.Builder
+		OutputPhysicalPlan(func(format string, args ...any) { fmt.Fprintf(&sb, format, args...) }, plan, "")
+		return sb.String()
+	}
+
+	for _, sql := range []string{
+		"select t.name, count(t2.age) from t join t2 on t.name = t2.name group by t.name",
+		"select t2.name, count(t2.age) from t join t2 on t.name = t2.name where t.age > 20 group by t2.name",
+	} {
+		if plan := explain(sql); !strings.Contains(plan, "Streaming Group By") {
+			t.Errorf("q=%s: expected a streaming aggregate on the join key, got\n%s", sql, plan)
+		}
+		tups := runQueryForTest(t, c, bp, sql)
+		if len(tups) != 10 {
+			t.Errorf("q=%s: expected 10 groups, got %d", sql, len(tups))
+		}
+		for _, tup := range tups {
+			name, cnt := tup.Fields[0].(StringField).Value, tup.Fields[1].(IntField).Value
+			expected := int64(1)
+			if name == "riza" || name == "sam" {
+				expected = 4
+			}
+			if cnt != expected {
+				t.Errorf("q=%s: expected count %d for %s, got %d", sql, expected, name, cnt)
+			}
+		}
+	}
+
+	sql := "select t.age, count(t2.age) from t join t2 on t.name = t2.name group by t.age"
+	if plan := explain(sql); strings.Contains(plan, "Streaming Group By") {
+		t.Errorf("q=%s: expected a hash aggregate when not grouping on the join key, got\n%s", sql, plan)
+	}
+}
+
+func TestAggGbySortQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	sql := "select age, count(name) from t group by age"
+	counts := func() map[int64]int64 {
+		counts := make(map[int64]int64)
+		for _, tup := range runQueryForTest(t, c, bp, sql) {
+			counts[tup.Fields[0].(IntField).Value] = tup.Fields[1].(IntField).Value
+		}
+		return counts
+	}
+	expected := counts()
+	if err := c.ComputeTableStats("t"); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// with more groups than fit in memory, the groups are formed by sorting
+	oldSize := AggBufferSize
+	defer func() { AggBufferSize = oldSize }()
+	AggBufferSize = 2
+	_, plan, err := Parse(c, sql)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var sb strings.Builder
+	OutputPhysicalPlan(func(format string, args ...any) { fmt.Fprintf(&sb, format, args...) }, plan, "")
+	if !strings.Contains(sb.String(), "Sort Group By") {
+		t.Errorf("expected a sort aggregate, got\n%s", sb.String())
+	}
+	got := counts()
+	if len(got) != len(expected) {
+		t.Errorf("expected %d groups, got %d", len(expected), len(got))
+	}
+	for age, n := range expected {
+		if got[age] != n {
+			t.Errorf("expected count %d for age %d, got %d", n, age, got[age])
+		}
+	}
+}
+
+// check that distinct aggregates over different fields are computed per group,
+// with and without spilling the distinct values to temporary files
+func TestAggDistinct(t *testing.T) {
+	useTempDirForTest(t)
+	td, mf := makeExternalSortVars(t, 2000)
+	name, age := &FieldExpr{td.Fields[0]}, &FieldExpr{td.Fields[1]}
+	aggStates := func() []AggState {
+		var states []AggState
+		for _, as := range []struct {
+			state AggState
+			expr  Expr
+		}{
+			{NewDistinctAggState(&CountAggState{}), age},
+			{NewDistinctAggState(&SumAggState{}), age},
+			{NewDistinctAggState(&CountAggState{}), name},
+			{&CountAggState{}, age},
+		} {
+			if err := as.state.Init(fmt.Sprintf("agg%d", len(states)), as.expr); err != nil {
+				t.Fatalf(err.Error())
+			}
+			states = append(states, as.state)
+		}
+		return states
+	}
+
+	// the expected distinct ages of each name
+	ages := make(map[string]map[int64]bool)
+	for _, tup := range collectTuplesForTest(t, mf, 0) {
+		n := tup.Fields[0].(StringField).Value
+		if ages[n] == nil {
+			ages[n] = make(map[int64]bool)
+		}
+		ages[n][tup.Fields[1].(IntField).Value] = true
+	}
+
+	oldSize := DistinctAggBufferSize
+	defer func() { DistinctAggBufferSize = oldSize }()
+	for _, bufSize := range []int{3, 100000} {
+		DistinctAggBufferSize = bufSize
+		got := collectTuplesForTest(t, NewGroupedAggregator(aggStates(), []Expr{name}, mf), 0)
+		if len(got) != len(ages) {
+			t.Errorf("buffer size %d: expected %d groups, got %d", bufSize, len(ages), len(got))
+		}
+		for _, tup := range got {
+			n := tup.Fields[0].(StringField).Value
+			var sum int64
+			for a := range ages[n] {
+				sum += a
+			}
+			expected := []int64{int64(len(ages[n])), sum, 1}
+			for i, e := range expected {
+				if v := tup.Fields[i+1].(IntField).Value; v != e {
+					t.Errorf("buffer size %d: expected %d for aggregate %d of group %s, got %d", bufSize, e, i, n, v)
+				}
+			}
+			if tup.Fields[4].(IntField).Value <= int64(len(ages[n])) {
+				t.Errorf("expected more values than distinct values for group %s", n)
+			}
+		}
+
+		tups := collectTuplesForTest(t, NewAggregator(aggStates(), mf), 0)
+		if cnt := tups[0].Fields[2].(IntField).Value; cnt != int64(len(ages)) {
+			t.Errorf("buffer size %d: expected %d distinct names, got %d", bufSize, len(ages), cnt)
+		}
+	}
+
+	// failing to spill the values is an error, not a wrong result
+	DistinctAggBufferSize = 3
+	TempDir = filepath.Join(t.TempDir(), "missing")
+	for _, agg := range []*Aggregator{NewGroupedAggregator(aggStates(), []Expr{name}, mf), NewAggregator(aggStates(), mf)} {
+		iter, err := agg.Iterator(0)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		for {
+			tup, err := iter()
+			if err != nil {
+				break
+			}
+			if tup == nil {
+				t.Errorf("expected an error spilling distinct values to a missing directory")
+				break
+			}
+		}
+	}
+}
+
+func TestAggDistinctQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	tups := runQueryForTest(t, c, bp, "select count(distinct name), count(name), sum(distinct age), count(distinct age) from t")
+	expected := []int64{10, 12, 452, 10}
+	for i, e := range expected {
+		if v := tups[0].Fields[i].(IntField).Value; v != e {
+			t.Errorf("expected %d for aggregate %d, got %d", e, i, v)
+		}
+	}
+
+	tups = runQueryForTest(t, c, bp, "select name, count(distinct age) as c from t group by name having count(distinct age) > 1")
+	if len(tups) != 2 {
+		t.Errorf("expected 2 names with several distinct ages, got %d", len(tups))
+	}
+	for _, tup := range tups {
+		if n := tup.Fields[0].(StringField).Value; n != "riza" && n != "sam" {
+			t.Errorf("unexpected name %s with several distinct ages", n)
+		}
+	}
+
+	if _, _, err := Parse(c, "select count(distinct *) from t"); err == nil {
+		t.Errorf("expected error for count(distinct *)")
+	}
+}
+
+// Aggregate the ages of the test tables' 12 tuples with as, returning the
+// result.
+func aggregateAgesForTest(t *testing.T, as AggState, expr func(td *TupleDesc) Expr) DBValue {
+	t.Helper()
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	hf, err := c.GetTable("t")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := as.Init("agg", expr(hf.Descriptor())); err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	defer bp.CommitTransaction(tid)
+	tups := collectTuplesForTest(t, NewAggregator([]AggState{as}, hf), tid)
+	return tups[0].Fields[0]
+}
+
+func TestAggStatistical(t *testing.T) {
+	age := func(td *TupleDesc) Expr { return &FieldExpr{td.Fields[1]} }
+	name := func(td *TupleDesc) Expr { return &FieldExpr{td.Fields[0]} }
+	median, _ := NewPercentileAggState(0.5)
+	p90, _ := NewPercentileAggState(0.9)
+	sorted := NewStringAggState(" ")
+	sorted.SetOrderBy([]Expr{&FieldExpr{FieldType{"name", "", StringType}}}, []bool{true})
+	tests := []struct {
+		as       AggState
+		expr     func(td *TupleDesc) Expr
+		expected DBValue
+	}{
+		// the ages are 22, 22, 25, 30, 38, 40, 43, 45, 50, 60, 99 and 99
+		{NewVarianceAggState(false, false), age, IntField{646}},
+		{NewVarianceAggState(true, false), age, IntField{704}},
+		{NewVarianceAggState(false, true), age, IntField{25}},
+		{NewVarianceAggState(true, true), age, IntField{26}},
+		{median, age, IntField{41}},
+		{p90, age, IntField{95}},
+		{NewBoolAggState(true), age, IntField{1}},
+		{NewBoolAggState(false), age, IntField{1}},
+		{&ModeAggState{}, age, IntField{22}},
+		{&ModeAggState{}, name, StringField{"riza"}},
+		{sorted, name, StringField{"ang bill bo joe kathy mark pat riza riza sam sam sarah"}},
+	}
+	for i, test := range tests {
+		if got := aggregateAgesForTest(t, test.as, test.expr); got != test.expected {
+			t.Errorf("test %d (%T): expected %v, got %v", i, test.as, test.expected, got)
+		}
+	}
+
+	if _, err := NewPercentileAggState(1.5); err == nil {
+		t.Errorf("expected error for percentile greater than 1")
+	}
+	if err := NewVarianceAggState(false, false).Init("v", &FieldExpr{FieldType{"name", "", StringType}}); err == nil {
+		t.Errorf("expected error for variance of strings")
+	}
+}
+
+func TestAggStatisticalQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	tups := runQueryForTest(t, c, bp, "select stddev_pop(age), var_samp(age), median(age), percentile_cont(age, 0.9), mode(age), bool_and(age - 22), bool_or(age - age) from t")
+	expected := []int64{25, 704, 41, 95, 22, 0, 0}
+	for i, e := range expected {
+		if v := tups[0].Fields[i].(IntField).Value; v != e {
+			t.Errorf("expected %d for aggregate %d, got %d", e, i, v)
+		}
+	}
+
+	tups = runQueryForTest(t, c, bp, "select name, group_concat(age order by age desc separator '|'), string_agg(name, '-'), group_concat(distinct name) from t group by name having count(age) > 1")
+	expected2 := map[string][]string{
+		"riza": {"43|22", "riza-riza", "riza"},
+		"sam":  {"99|25", "sam-sam", "sam"},
+	}
+	if len(tups) != len(expected2) {
+		t.Errorf("expected %d groups, got %d", len(expected2), len(tups))
+	}
+	for _, tup := range tups {
+		n := tup.Fields[0].(StringField).Value
+		for i, e := range expected2[n] {
+			if v := tup.Fields[i+1].(StringField).Value; v != e {
+				t.Errorf("expected %s for aggregate %d of group %s, got %s", e, i, n, v)
+			}
+		}
+	}
+
+	tups = runQueryForTest(t, c, bp, "select group_concat(name order by age, name) from t where age < 30")
+	if v := tups[0].Fields[0].(StringField).Value; v != "ang,riza,sam" {
+		t.Errorf("expected ang,riza,sam, got %s", v)
+	}
+
+	for _, sql := range []string{
+		"select string_agg(name) from t",
+		"select percentile_cont(age, name) from t",
+		"select percentile_cont(age, 2) from t",
+		"select group_concat(distinct name order by age) from t",
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("q=%s: expected error", sql)
+		}
+	}
+
+	//errors evaluating the aggregated expressions fail the query
+	for _, sql := range []string{
+		"select stddev(cast(name as int)) from t",
+		"select var_samp(age / 0) from t group by name",
+		"select median(age / 0) from t",
+		"select string_agg(cast(name as int), ',') from t",
+		"select group_concat(name order by age / 0) from t",
+		"select bool_or(age / 0) from t",
+		"select mode(cast(name as int)) from t",
+	} {
+		if err := queryErrorForTest(t, c, bp, sql); err == nil {
+			t.Errorf("q=%s: expected error", sql)
+		}
+	}
+}
+
+func TestAggBuiltinQueryErrors(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	//errors evaluating the aggregated expressions fail the query rather than
+	//skipping the tuples
+	for _, sql := range []string{
+		"select sum(cast(name as int)) from t",
+		"select sum(age / 0) from t group by name",
+		"select avg(cast(name as int)) from t",
+		"select max(age / 0) from t",
+		"select min(age / 0) from t group by name",
+	} {
+		if err := queryErrorForTest(t, c, bp, sql); err == nil {
+			t.Errorf("q=%s: expected error", sql)
+		}
+	}
+}
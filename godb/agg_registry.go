@@ -0,0 +1,161 @@
+package godb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// An AggregateFactory returns a new, uninitialized aggregation state for an
+// aggregate, given the values of the aggregate's constant arguments after the
+// aggregated expression (e.g., the separator of STRING_AGG). The state is
+// initialized with [AggState.Init] and then used as a template for the state
+// of each group, with [AggState.Copy].
+type AggregateFactory func(args []DBValue) (AggState, error)
+
+// A MergeableAggState is an aggregation state that supports partial
+// aggregation: the states of disjoint subsets of a group's tuples can be
+// combined into the state of all of them.
+type MergeableAggState interface {
+	AggState
+
+	// Adds the tuples aggregated by other, a state of the same aggregate
+	// initialized with the same expression, to this state.
+	Merge(other AggState) error
+}
+
+// A FallibleAggState is an aggregation state that may fail to aggregate its
+// tuples, e.g., because it writes them to temporary files. The aggregator
+// checks for an error after finalizing the state, since AddTuple and Finalize
+// can't return one.
+type FallibleAggState interface {
+	AggState
+
+	// Returns the first error that occurred adding tuples to or finalizing
+	// the state, if any, in which case the result of Finalize is meaningless.
+	Err() error
+}
+
+// Return the result of finalizing as, or the error that as failed with.
+func finalizeAggState(as AggState) (*Tuple, error) {
+	t := as.Finalize()
+	if f, ok := as.(FallibleAggState); ok {
+		if err := f.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// An aggregate function that queries may use. args is the number of arguments
+// after the aggregated expression, which must be constants.
+type aggFunc struct {
+	args     int
+	newState AggregateFactory
+}
+
+// Register a user-defined aggregate function, so that queries can use it as
+// name(expr, arg1, ..., argN), where nArgs is the number of constant arguments
+// after the aggregated expression. Names are case insensitive.
+//
+// Returns an error if name is not a valid identifier, or is already the name of
+// an aggregate or scalar function. Registering functions is not safe
+// concurrently with parsing queries.
+func RegisterAggregate(name string, nArgs int, factory AggregateFactory) error {
+	name = strings.ToLower(name)
+	if !isIdentifier(name) {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("invalid aggregate name %q", name)}
+	}
+	if _, ok := aggFuncs[name]; ok {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("aggregate %s is already registered", name)}
+	}
+	if _, ok := funcs[name]; ok || condFuncNames[name] {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("%s is already the name of a function", name)}
+	}
+	if nArgs < 0 || factory == nil {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("invalid arguments or factory for aggregate %s", name)}
+	}
+	aggFuncs[name] = aggFunc{nArgs, factory}
+	return nil
+}
+
+// Return true if name is a letter or underscore followed by letters, digits
+// and underscores.
+func isIdentifier(name string) bool {
+	for i, r := range name {
+		if !(r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// Return a list of the aggregate functions, one per line, in the same format as
+// [ListOfFunctions].
+func ListOfAggregates() string {
+	var names []string
+	for name := range aggFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fList := ""
+	for _, name := range names {
+		args := "(expr"
+		for i := 0; i < aggFuncs[name].args; i++ {
+			args = args + ",const"
+		}
+		fList = fList + "\t" + name + args + ")\n"
+	}
+	return fList
+}
+
+// The aggregate functions, by (lower case) name.
+var aggFuncs = map[string]aggFunc{
+	"count": {0, func([]DBValue) (AggState, error) { return &CountAggState{}, nil }},
+	"sum":   {0, func([]DBValue) (AggState, error) { return &SumAggState{}, nil }},
+	"avg":   {0, func([]DBValue) (AggState, error) { return &AvgAggState{}, nil }},
+	"min":   {0, func([]DBValue) (AggState, error) { return &MinAggState{}, nil }},
+	"max":   {0, func([]DBValue) (AggState, error) { return &MaxAggState{}, nil }},
+
+	"variance":    {0, func([]DBValue) (AggState, error) { return NewVarianceAggState(true, false), nil }},
+	"var_samp":    {0, func([]DBValue) (AggState, error) { return NewVarianceAggState(true, false), nil }},
+	"var_pop":     {0, func([]DBValue) (AggState, error) { return NewVarianceAggState(false, false), nil }},
+	"stddev":      {0, func([]DBValue) (AggState, error) { return NewVarianceAggState(true, true), nil }},
+	"stddev_samp": {0, func([]DBValue) (AggState, error) { return NewVarianceAggState(true, true), nil }},
+	"stddev_pop":  {0, func([]DBValue) (AggState, error) { return NewVarianceAggState(false, true), nil }},
+
+	"median": {0, func([]DBValue) (AggState, error) { return NewPercentileAggState(0.5) }},
+	"percentile_cont": {1, func(args []DBValue) (AggState, error) {
+		var fraction float64
+		var err error
+		switch v := args[0].(type) {
+		case IntField:
+			fraction = float64(v.Value)
+		case StringField:
+			fraction, err = strconv.ParseFloat(v.Value, 64)
+		}
+		if err != nil {
+			return nil, GoDBError{ParseError, fmt.Sprintf("expected a number as the percentile, got %v", args[0])}
+		}
+		return NewPercentileAggState(fraction)
+	}},
+
+	"string_agg": {1, func(args []DBValue) (AggState, error) {
+		sep, ok := args[0].(StringField)
+		if !ok {
+			return nil, GoDBError{TypeMismatchError, "expected a string separator for string_agg"}
+		}
+		return NewStringAggState(sep.Value), nil
+	}},
+	// GROUP_CONCAT(x [ORDER BY ...] [SEPARATOR s]) has its own syntax, from
+	// which the parser passes the separator (',' by default) as an argument
+	"group_concat": {1, func(args []DBValue) (AggState, error) {
+		return NewStringAggState(args[0].(StringField).Value), nil
+	}},
+
+	"bool_and": {0, func([]DBValue) (AggState, error) { return NewBoolAggState(true), nil }},
+	"bool_or":  {0, func([]DBValue) (AggState, error) { return NewBoolAggState(false), nil }},
+	"mode":     {0, func([]DBValue) (AggState, error) { return &ModeAggState{}, nil }},
+}
@@ -0,0 +1,156 @@
+package godb
+
+import (
+	"strings"
+	"testing"
+)
+
+// A user-defined aggregate computing the product of its values modulo a
+// constant argument.
+type productAggState struct {
+	alias   string
+	expr    Expr
+	modulus int64
+	product int64
+}
+
+func (a *productAggState) Copy() AggState {
+	c := *a
+	return &c
+}
+
+func (a *productAggState) Init(alias string, expr Expr) error {
+	a.alias = alias
+	a.expr = expr
+	a.product = 1
+	return nil
+}
+
+func (a *productAggState) AddTuple(t *Tuple) {
+	val, err := a.expr.EvalExpr(t)
+	if err != nil {
+		return
+	}
+	a.product = (a.product * val.(IntField).Value) % a.modulus
+}
+
+func (a *productAggState) Merge(other AggState) error {
+	a.product = (a.product * other.(*productAggState).product) % a.modulus
+	return nil
+}
+
+func (a *productAggState) GetTupleDesc() *TupleDesc {
+	return &TupleDesc{Fields: []FieldType{{Fname: a.alias, Ftype: IntType}}}
+}
+
+func (a *productAggState) Finalize() *Tuple {
+	return &Tuple{Desc: *a.GetTupleDesc(), Fields: []DBValue{IntField{a.product}}}
+}
+
+func registerAggregateForTest(t *testing.T, name string, nArgs int, factory AggregateFactory) {
+	t.Helper()
+	if err := RegisterAggregate(name, nArgs, factory); err != nil {
+		t.Fatalf(err.Error())
+	}
+	t.Cleanup(func() { delete(aggFuncs, strings.ToLower(name)) })
+}
+
+func TestRegisterAggregate(t *testing.T) {
+	registerAggregateForTest(t, "Product_Mod", 1, func(args []DBValue) (AggState, error) {
+		m, ok := args[0].(IntField)
+		if !ok || m.Value <= 0 {
+			return nil, GoDBError{IllegalOperationError, "expected a positive modulus"}
+		}
+		return &productAggState{modulus: m.Value}, nil
+	})
+
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	tups := runQueryForTest(t, c, bp, "select name, product_mod(age, 1000) from t group by name having count(age) > 1")
+	expected := map[string]int64{"riza": 22 * 43, "sam": 25 * 99 % 1000}
+	if len(tups) != len(expected) {
+		t.Errorf("expected %d groups, got %d", len(expected), len(tups))
+	}
+	for _, tup := range tups {
+		n := tup.Fields[0].(StringField).Value
+		if v := tup.Fields[1].(IntField).Value; v != expected[n] {
+			t.Errorf("expected product %d for %s, got %d", expected[n], n, v)
+		}
+	}
+	if tups := runQueryForTest(t, c, bp, "select product_mod(distinct age, 7) from t where age > 90"); tups[0].Fields[0].(IntField).Value != 99%7 {
+		t.Errorf("expected distinct product %d, got %v", 99%7, tups[0].Fields[0])
+	}
+	for _, sql := range []string{
+		"select product_mod(age) from t",
+		"select product_mod(age, 0) from t",
+	} {
+		if _, _, err := Parse(c, sql); err == nil {
+			t.Errorf("q=%s: expected error", sql)
+		}
+	}
+
+	if !strings.Contains(ListOfAggregates(), "product_mod(expr,const)") {
+		t.Errorf("expected product_mod in list of aggregates, got\n%s", ListOfAggregates())
+	}
+	factory := func([]DBValue) (AggState, error) { return &CountAggState{}, nil }
+	for _, name := range []string{"product_mod", "COUNT", "imax", "", "not a name"} {
+		if err := RegisterAggregate(name, 0, factory); err == nil {
+			t.Errorf("expected error registering aggregate %q", name)
+		}
+	}
+}
+
+// check that merging the states of two halves of the tuples gives the same
+// result as aggregating all of them
+func TestMergeAggStates(t *testing.T) {
+	td, mf := makeExternalSortVars(t, 100)
+	name, age := &FieldExpr{td.Fields[0]}, &FieldExpr{td.Fields[1]}
+	tups := collectTuplesForTest(t, mf, 0)
+	states := []struct {
+		name string
+		expr Expr
+		args []DBValue
+	}{
+		{"count", age, nil}, {"sum", age, nil}, {"avg", age, nil}, {"min", age, nil}, {"max", age, nil},
+		{"var_samp", age, nil}, {"stddev_pop", age, nil}, {"median", age, nil}, {"percentile_cont", age, []DBValue{StringField{"0.3"}}},
+		{"string_agg", name, []DBValue{StringField{","}}}, {"bool_and", age, nil}, {"bool_or", age, nil}, {"mode", name, nil},
+	}
+	for _, s := range states {
+		newState := func() AggState {
+			as, err := aggFuncs[s.name].newState(s.args)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if err := as.Init(s.name, s.expr); err != nil {
+				t.Fatalf(err.Error())
+			}
+			return as
+		}
+		all, first, second := newState(), newState(), newState()
+		for i, tup := range tups {
+			all.AddTuple(tup)
+			if i < 37 {
+				first.AddTuple(tup)
+			} else {
+				second.AddTuple(tup)
+			}
+		}
+		m, ok := first.(MergeableAggState)
+		if !ok {
+			t.Errorf("%s: expected a mergeable aggregation state", s.name)
+			continue
+		}
+		if err := m.Merge(second); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if want, got := all.Finalize().Fields[0], first.Finalize().Fields[0]; want != got {
+			t.Errorf("%s: expected %v after merging, got %v", s.name, want, got)
+		}
+	}
+
+	if err := (&SumAggState{}).Merge(&CountAggState{}); err == nil {
+		t.Errorf("expected error merging different aggregates")
+	}
+}
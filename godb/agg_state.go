@@ -2,6 +2,10 @@ package godb
 
 import (
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 // interface for an aggregation state
@@ -24,6 +28,38 @@ type AggState interface {
 	GetTupleDesc() *TupleDesc
 }
 
+// The first error evaluating the expression of an aggregation state on the
+// tuples added to it. Embedding it makes the state a [FallibleAggState].
+type aggEvalError struct {
+	err error
+}
+
+// Return the value of expr on t, or false, recording the error, if evaluating
+// it fails.
+func (e *aggEvalError) eval(expr Expr, t *Tuple) (DBValue, bool) {
+	if e.err != nil {
+		return nil, false
+	}
+	v, err := expr.EvalExpr(t)
+	if err != nil {
+		e.err = err
+		return nil, false
+	}
+	return v, true
+}
+
+// Record the error of other, a state merged into this one, unless this state
+// already has one.
+func (e *aggEvalError) merge(other *aggEvalError) {
+	if e.err == nil {
+		e.err = other.err
+	}
+}
+
+func (e *aggEvalError) Err() error {
+	return e.err
+}
+
 // Implements the aggregation state for COUNT
 // We are supplying the implementation of CountAggState as an example. You need to
 // implement the rest of the aggregation states.
@@ -56,6 +92,15 @@ func (a *CountAggState) Finalize() *Tuple {
 	return &t
 }
 
+func (a *CountAggState) Merge(other AggState) error {
+	o, ok := other.(*CountAggState)
+	if !ok {
+		return mergeTypeError(a, other)
+	}
+	a.count += o.count
+	return nil
+}
+
 func (a *CountAggState) GetTupleDesc() *TupleDesc {
 	ft := FieldType{a.alias, "", IntType}
 	fts := []FieldType{ft}
@@ -69,13 +114,16 @@ type SumAggState struct {
 	alias string
 	expr  Expr
 	sum   any // Can be int or float64
+
+	aggEvalError
 }
 
 func (a *SumAggState) Copy() AggState {
 	newState := &SumAggState{
-		alias: a.alias,
-		expr:  a.expr,
-		sum:   a.sum,
+		alias:        a.alias,
+		expr:         a.expr,
+		sum:          a.sum,
+		aggEvalError: a.aggEvalError,
 	}
 	return newState
 }
@@ -94,13 +142,13 @@ func (a *SumAggState) Init(alias string, expr Expr) error {
 	a.alias = alias
 	a.expr = expr
 	a.sum = int64(0)
+	a.err = nil
 	return nil
 }
 
 func (a *SumAggState) AddTuple(t *Tuple) {
-	val, err := a.expr.EvalExpr(t)
-	if err != nil {
-		fmt.Println("evaluation error")
+	val, ok := a.eval(a.expr, t)
+	if !ok {
 		return
 	}
 	if current, ok := a.sum.(int64); ok {
@@ -125,20 +173,33 @@ func (a *SumAggState) Finalize() *Tuple {
 	}
 }
 
+func (a *SumAggState) Merge(other AggState) error {
+	o, ok := other.(*SumAggState)
+	if !ok {
+		return mergeTypeError(a, other)
+	}
+	a.merge(&o.aggEvalError)
+	a.sum = a.sum.(int64) + o.sum.(int64)
+	return nil
+}
+
 // Implements the aggregation state for AVG
 type AvgAggState struct {
 	alias string
 	expr  Expr
 	sum   int64
 	count int64
+
+	aggEvalError
 }
 
 func (a *AvgAggState) Copy() AggState {
 	return &AvgAggState{
-		alias: a.alias,
-		expr:  a.expr,
-		sum:   a.sum,
-		count: a.count,
+		alias:        a.alias,
+		expr:         a.expr,
+		sum:          a.sum,
+		count:        a.count,
+		aggEvalError: a.aggEvalError,
 	}
 }
 
@@ -147,13 +208,13 @@ func (a *AvgAggState) Init(alias string, expr Expr) error {
 	a.expr = expr
 	a.sum = 0
 	a.count = 0
+	a.err = nil
 	return nil
 }
 
 func (a *AvgAggState) AddTuple(t *Tuple) {
-	val, err := a.expr.EvalExpr(t)
-	if err != nil {
-		fmt.Println("error evaluating")
+	val, ok := a.eval(a.expr, t)
+	if !ok {
 		return
 	}
 	a.sum += intAggGetter(val).(int64)
@@ -178,20 +239,34 @@ func (a *AvgAggState) Finalize() *Tuple {
 	}
 }
 
+func (a *AvgAggState) Merge(other AggState) error {
+	o, ok := other.(*AvgAggState)
+	if !ok {
+		return mergeTypeError(a, other)
+	}
+	a.merge(&o.aggEvalError)
+	a.sum += o.sum
+	a.count += o.count
+	return nil
+}
+
 // Implements the aggregation state for MAX
 type MaxAggState struct {
 	alias string
 	expr  Expr
 	max   int64
 	first bool
+
+	aggEvalError
 }
 
 func (a *MaxAggState) Copy() AggState {
 	return &MaxAggState{
-		alias: a.alias,
-		expr:  a.expr,
-		max:   a.max,
-		first: a.first,
+		alias:        a.alias,
+		expr:         a.expr,
+		max:          a.max,
+		first:        a.first,
+		aggEvalError: a.aggEvalError,
 	}
 }
 
@@ -199,13 +274,13 @@ func (a *MaxAggState) Init(alias string, expr Expr) error {
 	a.alias = alias
 	a.expr = expr
 	a.first = true
+	a.err = nil
 	return nil
 }
 
 func (a *MaxAggState) AddTuple(t *Tuple) {
-	val, err := a.expr.EvalExpr(t)
-	if err != nil {
-		fmt.Println("evalutation error")
+	val, ok := a.eval(a.expr, t)
+	if !ok {
 		return
 	}
 	if a.first {
@@ -237,20 +312,36 @@ func (a *MaxAggState) Finalize() *Tuple {
 	}
 }
 
+func (a *MaxAggState) Merge(other AggState) error {
+	o, ok := other.(*MaxAggState)
+	if !ok {
+		return mergeTypeError(a, other)
+	}
+	a.merge(&o.aggEvalError)
+	if !o.first && (a.first || o.max > a.max) {
+		a.max = o.max
+		a.first = false
+	}
+	return nil
+}
+
 // Implements the aggregation state for MIN
 type MinAggState struct {
 	alias string
 	expr  Expr
 	min   int64
 	first bool
+
+	aggEvalError
 }
 
 func (a *MinAggState) Copy() AggState {
 	return &MinAggState{
-		alias: a.alias,
-		expr:  a.expr,
-		min:   a.min,
-		first: a.first,
+		alias:        a.alias,
+		expr:         a.expr,
+		min:          a.min,
+		first:        a.first,
+		aggEvalError: a.aggEvalError,
 	}
 }
 
@@ -258,13 +349,13 @@ func (a *MinAggState) Init(alias string, expr Expr) error {
 	a.alias = alias
 	a.expr = expr
 	a.first = true
+	a.err = nil
 	return nil
 }
 
 func (a *MinAggState) AddTuple(t *Tuple) {
-	val, err := a.expr.EvalExpr(t)
-	if err != nil {
-		fmt.Println("evalutation error")
+	val, ok := a.eval(a.expr, t)
+	if !ok {
 		return
 	}
 	if a.first {
@@ -294,3 +385,650 @@ func (a *MinAggState) Finalize() *Tuple {
 		Desc:   *a.GetTupleDesc(),
 	}
 }
+
+func (a *MinAggState) Merge(other AggState) error {
+	o, ok := other.(*MinAggState)
+	if !ok {
+		return mergeTypeError(a, other)
+	}
+	a.merge(&o.aggEvalError)
+	if !o.first && (a.first || o.min < a.min) {
+		a.min = o.min
+		a.first = false
+	}
+	return nil
+}
+
+// The default maximum number of distinct values of a DISTINCT aggregate that
+// each group holds in memory. Once there are more, the values are written to a
+// temporary file and deduplicated by sorting them when the group is finalized.
+var DistinctAggBufferSize int = 100000
+
+// Implements the aggregation state for DISTINCT aggregates, e.g.,
+// COUNT(DISTINCT x), by passing each distinct value of its expression to
+// another aggregation state once, when the group is finalized.
+type DistinctAggState struct {
+	inner AggState
+	expr  Expr
+	// The descriptor of the single-field tuples of values that are passed to
+	// inner, which is initialized to aggregate their field.
+	valueDesc TupleDesc
+
+	seen   map[any]bool
+	values []DBValue // the values in seen, in the order they were first seen
+
+	// The values written to temporary files, if there have been more than
+	// DistinctAggBufferSize. The values are only deduplicated within each
+	// batch of DistinctAggBufferSize written to the file.
+	spilled *tempFile
+
+	finalized bool
+	err       error // the first error evaluating, spilling or deduplicating values
+}
+
+// Construct a DISTINCT aggregation state that aggregates the distinct values
+// with inner, which must not yet be initialized.
+func NewDistinctAggState(inner AggState) *DistinctAggState {
+	return &DistinctAggState{inner: inner}
+}
+
+func (a *DistinctAggState) Copy() AggState {
+	// copies are made of the empty states passed to the aggregator, so only
+	// the values in memory, if any, are copied
+	c := &DistinctAggState{
+		inner:     a.inner.Copy(),
+		expr:      a.expr,
+		valueDesc: a.valueDesc,
+		seen:      make(map[any]bool),
+		values:    append([]DBValue{}, a.values...),
+		finalized: a.finalized,
+		err:       a.err,
+	}
+	for k := range a.seen {
+		c.seen[k] = true
+	}
+	return c
+}
+
+func (a *DistinctAggState) Init(alias string, expr Expr) error {
+	a.expr = expr
+	a.valueDesc = TupleDesc{Fields: []FieldType{{Fname: "distinct", Ftype: expr.GetExprType().Ftype}}}
+	a.seen = make(map[any]bool)
+	a.values = nil
+	a.spilled = nil
+	a.finalized = false
+	a.err = nil
+	return a.inner.Init(alias, &FieldExpr{a.valueDesc.Fields[0]})
+}
+
+func (a *DistinctAggState) AddTuple(t *Tuple) {
+	if a.err != nil {
+		return
+	}
+	val, err := a.expr.EvalExpr(t)
+	if err != nil {
+		a.err = err
+		return
+	}
+	if a.seen[val] {
+		return
+	}
+	if len(a.values) >= DistinctAggBufferSize && checkTempFileDesc(&a.valueDesc) == nil {
+		if err := a.spill(); err != nil {
+			a.err = err
+			return
+		}
+	}
+	a.seen[val] = true
+	a.values = append(a.values, val)
+}
+
+// Write the values in memory to the temporary file, creating it if necessary.
+func (a *DistinctAggState) spill() error {
+	if a.spilled == nil {
+		f, err := newTempFile(&a.valueDesc)
+		if err != nil {
+			return err
+		}
+		a.spilled = f
+	}
+	for _, v := range a.values {
+		if err := a.spilled.append(&Tuple{Desc: a.valueDesc, Fields: []DBValue{v}}); err != nil {
+			return err
+		}
+	}
+	a.seen = make(map[any]bool)
+	a.values = nil
+	return nil
+}
+
+// Pass the distinct values to the inner aggregation state. If values were
+// spilled, they are passed in sorted order, and otherwise in the order they
+// were first seen.
+func (a *DistinctAggState) addDistinctValues() error {
+	if a.spilled == nil {
+		for _, v := range a.values {
+			a.inner.AddTuple(&Tuple{Desc: a.valueDesc, Fields: []DBValue{v}})
+		}
+		return nil
+	}
+	defer func() {
+		a.spilled.close()
+		a.spilled = nil
+	}()
+	if err := a.spill(); err != nil {
+		return err
+	}
+	if err := a.spilled.finish(); err != nil {
+		return err
+	}
+	exprs, ascs := []Expr{&FieldExpr{a.valueDesc.Fields[0]}}, []bool{true}
+	sorted, err := externalSort(&a.valueDesc, a.spilled.iterator(), func(t1, t2 *Tuple) (bool, error) {
+		return orderByLess(exprs, ascs, t1, t2)
+	}, SortBufferSize)
+	if err != nil {
+		return err
+	}
+	var last DBValue
+	for {
+		t, err := sorted()
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			return nil
+		}
+		if last == nil || !t.Fields[0].EvalPred(last, OpEq) {
+			a.inner.AddTuple(t)
+			last = t.Fields[0]
+		}
+	}
+}
+
+func (a *DistinctAggState) GetTupleDesc() *TupleDesc {
+	return a.inner.GetTupleDesc()
+}
+
+// Return the first error that occurred evaluating, spilling or deduplicating
+// the values, or aggregating them with the inner state, if any.
+func (a *DistinctAggState) Err() error {
+	if a.err != nil {
+		return a.err
+	}
+	if f, ok := a.inner.(FallibleAggState); ok {
+		return f.Err()
+	}
+	return nil
+}
+
+func (a *DistinctAggState) Finalize() *Tuple {
+	if !a.finalized {
+		if a.err == nil {
+			a.err = a.addDistinctValues()
+		} else if a.spilled != nil {
+			a.spilled.close()
+			a.spilled = nil
+		}
+		a.seen = nil
+		a.values = nil
+		a.finalized = true
+	}
+	return a.inner.Finalize()
+}
+
+// Implements the aggregation states for VARIANCE and STDDEV, of either the
+// population or a sample. Like AVG, the result is truncated to an integer.
+type VarianceAggState struct {
+	alias  string
+	expr   Expr
+	sample bool // if true, divide by n-1 rather than n
+	stddev bool // if true, return the square root of the variance
+
+	// the count, mean and sum of squared differences from the mean, updated
+	// incrementally using Welford's algorithm
+	count int64
+	mean  float64
+	m2    float64
+
+	aggEvalError
+}
+
+// Construct an empty aggregation state for the variance or standard deviation
+// of the population or of a sample.
+func NewVarianceAggState(sample bool, stddev bool) *VarianceAggState {
+	return &VarianceAggState{sample: sample, stddev: stddev}
+}
+
+func (a *VarianceAggState) Copy() AggState {
+	c := *a
+	return &c
+}
+
+func (a *VarianceAggState) Init(alias string, expr Expr) error {
+	if expr.GetExprType().Ftype != IntType {
+		return GoDBError{TypeMismatchError, fmt.Sprintf("cannot compute variance of non-integer expression for %s", alias)}
+	}
+	a.alias = alias
+	a.expr = expr
+	a.count = 0
+	a.mean = 0
+	a.m2 = 0
+	a.err = nil
+	return nil
+}
+
+func (a *VarianceAggState) AddTuple(t *Tuple) {
+	val, ok := a.eval(a.expr, t)
+	if !ok {
+		return
+	}
+	x := float64(intAggGetter(val).(int64))
+	a.count++
+	delta := x - a.mean
+	a.mean += delta / float64(a.count)
+	a.m2 += delta * (x - a.mean)
+}
+
+func (a *VarianceAggState) GetTupleDesc() *TupleDesc {
+	return &TupleDesc{
+		Fields: []FieldType{
+			{Fname: a.alias, Ftype: IntType},
+		},
+	}
+}
+
+func (a *VarianceAggState) Finalize() *Tuple {
+	n := a.count
+	if a.sample {
+		n--
+	}
+	v := 0.0
+	if n > 0 {
+		v = a.m2 / float64(n)
+	}
+	if a.stddev {
+		v = math.Sqrt(v)
+	}
+	return &Tuple{
+		Fields: []DBValue{IntField{int64(v)}},
+		Desc:   *a.GetTupleDesc(),
+	}
+}
+
+func (a *VarianceAggState) Merge(other AggState) error {
+	o, ok := other.(*VarianceAggState)
+	if !ok {
+		return mergeTypeError(a, other)
+	}
+	a.merge(&o.aggEvalError)
+	if o.count == 0 {
+		return nil
+	}
+	// Chan et al.'s formula for combining the moments of two sets
+	n := a.count + o.count
+	delta := o.mean - a.mean
+	a.m2 += o.m2 + delta*delta*float64(a.count)*float64(o.count)/float64(n)
+	a.mean += delta * float64(o.count) / float64(n)
+	a.count = n
+	return nil
+}
+
+// Implements the aggregation state for PERCENTILE_CONT and MEDIAN (the 0.5
+// percentile), which interpolate linearly between the values adjacent to the
+// percentile, truncating the result to an integer. All of a group's values are
+// held in memory.
+type PercentileAggState struct {
+	alias    string
+	expr     Expr
+	fraction float64
+	values   []int64
+
+	aggEvalError
+}
+
+// Construct an empty aggregation state for the given percentile, which must be
+// between 0 and 1.
+func NewPercentileAggState(fraction float64) (*PercentileAggState, error) {
+	if fraction < 0 || fraction > 1 || math.IsNaN(fraction) {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("percentile %v is not between 0 and 1", fraction)}
+	}
+	return &PercentileAggState{fraction: fraction}, nil
+}
+
+func (a *PercentileAggState) Copy() AggState {
+	return &PercentileAggState{
+		alias:        a.alias,
+		expr:         a.expr,
+		fraction:     a.fraction,
+		values:       append([]int64{}, a.values...),
+		aggEvalError: a.aggEvalError,
+	}
+}
+
+func (a *PercentileAggState) Init(alias string, expr Expr) error {
+	if expr.GetExprType().Ftype != IntType {
+		return GoDBError{TypeMismatchError, fmt.Sprintf("cannot compute percentile of non-integer expression for %s", alias)}
+	}
+	a.alias = alias
+	a.expr = expr
+	a.values = nil
+	a.err = nil
+	return nil
+}
+
+func (a *PercentileAggState) AddTuple(t *Tuple) {
+	val, ok := a.eval(a.expr, t)
+	if !ok {
+		return
+	}
+	a.values = append(a.values, intAggGetter(val).(int64))
+}
+
+func (a *PercentileAggState) GetTupleDesc() *TupleDesc {
+	return &TupleDesc{
+		Fields: []FieldType{
+			{Fname: a.alias, Ftype: IntType},
+		},
+	}
+}
+
+func (a *PercentileAggState) Finalize() *Tuple {
+	var result int64
+	if len(a.values) > 0 {
+		sort.Slice(a.values, func(i, j int) bool { return a.values[i] < a.values[j] })
+		pos := a.fraction * float64(len(a.values)-1)
+		lo, hi := int(math.Floor(pos)), int(math.Ceil(pos))
+		v := float64(a.values[lo]) + (pos-float64(lo))*float64(a.values[hi]-a.values[lo])
+		result = int64(v)
+	}
+	return &Tuple{
+		Fields: []DBValue{IntField{result}},
+		Desc:   *a.GetTupleDesc(),
+	}
+}
+
+func (a *PercentileAggState) Merge(other AggState) error {
+	o, ok := other.(*PercentileAggState)
+	if !ok {
+		return mergeTypeError(a, other)
+	}
+	a.merge(&o.aggEvalError)
+	a.values = append(a.values, o.values...)
+	return nil
+}
+
+// Implements the aggregation state for STRING_AGG and GROUP_CONCAT, which
+// concatenate the values of a group (converting integers to strings),
+// separated by a separator. The values are concatenated in the order they are
+// read, unless an order is set with [StringAggState.SetOrderBy].
+type StringAggState struct {
+	alias     string
+	expr      Expr
+	separator string
+
+	orderBy   []Expr
+	ascending []bool
+
+	values []string
+	tuples []*Tuple // if ordering, the tuples of values, to sort them by
+
+	// also records the first error comparing the tuples to sort them
+	aggEvalError
+}
+
+// Construct an empty aggregation state that separates values with separator.
+func NewStringAggState(separator string) *StringAggState {
+	return &StringAggState{separator: separator}
+}
+
+// Concatenate the values in the order of the tuples they come from sorted as
+// specified by orderBy and ascending, as for [NewOrderBy].
+func (a *StringAggState) SetOrderBy(orderBy []Expr, ascending []bool) error {
+	if len(orderBy) != len(ascending) {
+		return fmt.Errorf("length of orderBy and ascending must match")
+	}
+	a.orderBy = orderBy
+	a.ascending = ascending
+	return nil
+}
+
+func (a *StringAggState) Copy() AggState {
+	return &StringAggState{
+		alias:        a.alias,
+		expr:         a.expr,
+		separator:    a.separator,
+		orderBy:      a.orderBy,
+		ascending:    a.ascending,
+		values:       append([]string{}, a.values...),
+		tuples:       append([]*Tuple{}, a.tuples...),
+		aggEvalError: a.aggEvalError,
+	}
+}
+
+func (a *StringAggState) Init(alias string, expr Expr) error {
+	a.alias = alias
+	a.expr = expr
+	a.values = nil
+	a.tuples = nil
+	a.err = nil
+	return nil
+}
+
+func (a *StringAggState) AddTuple(t *Tuple) {
+	val, ok := a.eval(a.expr, t)
+	if !ok {
+		return
+	}
+	switch v := val.(type) {
+	case StringField:
+		a.values = append(a.values, v.Value)
+	case IntField:
+		a.values = append(a.values, strconv.FormatInt(v.Value, 10))
+	}
+	if a.orderBy != nil {
+		a.tuples = append(a.tuples, t)
+	}
+}
+
+func (a *StringAggState) GetTupleDesc() *TupleDesc {
+	return &TupleDesc{
+		Fields: []FieldType{
+			{Fname: a.alias, Ftype: StringType},
+		},
+	}
+}
+
+func (a *StringAggState) Finalize() *Tuple {
+	values := a.values
+	if a.orderBy != nil {
+		order := make([]int, len(values))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			less, err := orderByLess(a.orderBy, a.ascending, a.tuples[order[i]], a.tuples[order[j]])
+			if err != nil && a.err == nil {
+				a.err = err
+			}
+			return err == nil && less
+		})
+		values = make([]string, len(order))
+		for i, o := range order {
+			values[i] = a.values[o]
+		}
+	}
+	return &Tuple{
+		Fields: []DBValue{StringField{strings.Join(values, a.separator)}},
+		Desc:   *a.GetTupleDesc(),
+	}
+}
+
+func (a *StringAggState) Merge(other AggState) error {
+	o, ok := other.(*StringAggState)
+	if !ok {
+		return mergeTypeError(a, other)
+	}
+	a.merge(&o.aggEvalError)
+	a.values = append(a.values, o.values...)
+	a.tuples = append(a.tuples, o.tuples...)
+	return nil
+}
+
+// Implements the aggregation states for BOOL_AND and BOOL_OR. Integers are
+// treated as booleans, with zero false and anything else true, and the result
+// is 1 or 0. BOOL_AND of no values is true, and BOOL_OR of no values false.
+type BoolAggState struct {
+	alias  string
+	expr   Expr
+	and    bool // if true, BOOL_AND, otherwise BOOL_OR
+	result bool
+
+	aggEvalError
+}
+
+// Construct an empty aggregation state for BOOL_AND (if and is true) or
+// BOOL_OR.
+func NewBoolAggState(and bool) *BoolAggState {
+	return &BoolAggState{and: and}
+}
+
+func (a *BoolAggState) Copy() AggState {
+	c := *a
+	return &c
+}
+
+func (a *BoolAggState) Init(alias string, expr Expr) error {
+	if expr.GetExprType().Ftype != IntType {
+		return GoDBError{TypeMismatchError, fmt.Sprintf("cannot compute boolean aggregate of non-integer expression for %s", alias)}
+	}
+	a.alias = alias
+	a.expr = expr
+	a.result = a.and
+	a.err = nil
+	return nil
+}
+
+func (a *BoolAggState) AddTuple(t *Tuple) {
+	val, ok := a.eval(a.expr, t)
+	if !ok {
+		return
+	}
+	b := intAggGetter(val).(int64) != 0
+	if a.and {
+		a.result = a.result && b
+	} else {
+		a.result = a.result || b
+	}
+}
+
+func (a *BoolAggState) GetTupleDesc() *TupleDesc {
+	return &TupleDesc{
+		Fields: []FieldType{
+			{Fname: a.alias, Ftype: IntType},
+		},
+	}
+}
+
+func (a *BoolAggState) Finalize() *Tuple {
+	var result int64
+	if a.result {
+		result = 1
+	}
+	return &Tuple{
+		Fields: []DBValue{IntField{result}},
+		Desc:   *a.GetTupleDesc(),
+	}
+}
+
+func (a *BoolAggState) Merge(other AggState) error {
+	o, ok := other.(*BoolAggState)
+	if !ok {
+		return mergeTypeError(a, other)
+	}
+	a.merge(&o.aggEvalError)
+	if a.and {
+		a.result = a.result && o.result
+	} else {
+		a.result = a.result || o.result
+	}
+	return nil
+}
+
+// Implements the aggregation state for MODE, the most frequent value of a
+// group. Ties are broken by choosing the smallest value.
+type ModeAggState struct {
+	alias  string
+	expr   Expr
+	counts map[DBValue]int
+
+	aggEvalError
+}
+
+func (a *ModeAggState) Copy() AggState {
+	c := &ModeAggState{alias: a.alias, expr: a.expr, counts: make(map[DBValue]int), aggEvalError: a.aggEvalError}
+	for v, n := range a.counts {
+		c.counts[v] = n
+	}
+	return c
+}
+
+func (a *ModeAggState) Init(alias string, expr Expr) error {
+	a.alias = alias
+	a.expr = expr
+	a.counts = make(map[DBValue]int)
+	a.err = nil
+	return nil
+}
+
+func (a *ModeAggState) AddTuple(t *Tuple) {
+	val, ok := a.eval(a.expr, t)
+	if !ok {
+		return
+	}
+	a.counts[val]++
+}
+
+func (a *ModeAggState) GetTupleDesc() *TupleDesc {
+	return &TupleDesc{
+		Fields: []FieldType{
+			{Fname: a.alias, Ftype: a.expr.GetExprType().Ftype},
+		},
+	}
+}
+
+func (a *ModeAggState) Finalize() *Tuple {
+	var mode DBValue
+	for v, n := range a.counts {
+		if mode == nil || n > a.counts[mode] || (n == a.counts[mode] && v.EvalPred(mode, OpLt)) {
+			mode = v
+		}
+	}
+	if mode == nil {
+		// there's no NULL, so return the zero value of the type
+		mode = IntField{0}
+		if a.expr.GetExprType().Ftype == StringType {
+			mode = StringField{""}
+		}
+	}
+	return &Tuple{
+		Fields: []DBValue{mode},
+		Desc:   *a.GetTupleDesc(),
+	}
+}
+
+func (a *ModeAggState) Merge(other AggState) error {
+	o, ok := other.(*ModeAggState)
+	if !ok {
+		return mergeTypeError(a, other)
+	}
+	a.merge(&o.aggEvalError)
+	for v, n := range o.counts {
+		a.counts[v] += n
+	}
+	return nil
+}
+
+// Return the error for merging aggregation states of different aggregates.
+func mergeTypeError(a AggState, other AggState) error {
+	return GoDBError{TypeMismatchError, fmt.Sprintf("cannot merge aggregation state %T into %T", other, a)}
+}
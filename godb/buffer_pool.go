@@ -7,6 +7,7 @@ package godb
 
 import (
 	"fmt"
+	"sync"
 )
 
 // Permissions used to when reading / locking pages
@@ -20,16 +21,31 @@ const (
 type BufferPool struct {
 	numPages int                  // Capacity of the buffer pool
 	pages    map[interface{}]Page // Map to store pages by key (e.g., DBFile.pageKey)
+
+	fetched int // Number of pages retrieved with GetPage
+	read    int // Number of those pages that were read from disk
+
+	// The number of tuples of each table modified by each transaction that
+	// has yet to commit or abort
+	modifications      map[TransactionID]map[*Table]int64
+	modificationsMutex sync.Mutex
 }
 
 // Create a new BufferPool with the specified number of pages
 func NewBufferPool(numPages int) (*BufferPool, error) {
 	return &BufferPool{
-		numPages: numPages,
-		pages:    make(map[interface{}]Page),
+		numPages:      numPages,
+		pages:         make(map[interface{}]Page),
+		modifications: make(map[TransactionID]map[*Table]int64),
 	}, nil
 }
 
+// Return the number of pages retrieved from the buffer pool since it was
+// created, and the number of them that weren't cached and were read from disk.
+func (bp *BufferPool) PageCounts() (fetched int, read int) {
+	return bp.fetched, bp.read
+}
+
 // Testing method -- iterate through all pages in the buffer pool
 // and flush them using [DBFile.flushPage]. Does not need to be thread/transaction safe.
 // Mark pages as not dirty after flushing them.
@@ -50,8 +66,12 @@ func (bp *BufferPool) FlushAllPages() error {
 // Abort the transaction, releasing locks. Because GoDB is FORCE/NO STEAL, none
 // of the pages tid has dirtied will be on disk so it is sufficient to just
 // release locks to abort. You do not need to implement this for lab 1.
+//
+// The counts of the tuples tid modified (see recordModifications) are
+// discarded.
 func (bp *BufferPool) AbortTransaction(tid TransactionID) {
 	// TODO: some code goes here
+	bp.endModifications(tid, false)
 }
 
 // Commit the transaction, releasing locks. Because GoDB is FORCE/NO STEAL, none
@@ -59,8 +79,44 @@ func (bp *BufferPool) AbortTransaction(tid TransactionID) {
 // should iterate through pages and write them to disk.  In GoDB lab3 we assume
 // that the system will not crash while doing this, allowing us to avoid using a
 // WAL. You do not need to implement this for lab 1.
+//
+// The tuples tid modified are recorded in the statistics of their tables (see
+// recordModifications).
 func (bp *BufferPool) CommitTransaction(tid TransactionID) {
 	// TODO: some code goes here
+	bp.endModifications(tid, true)
+}
+
+// Record that an operator modified count tuples of table, if it was set, as
+// part of tid. The modifications are recorded in the table's statistics if
+// and when tid commits (see endModifications).
+func (bp *BufferPool) recordModifications(table *Table, tid TransactionID, count int64) {
+	if bp == nil || table == nil || count == 0 {
+		return
+	}
+	bp.modificationsMutex.Lock()
+	defer bp.modificationsMutex.Unlock()
+	if bp.modifications[tid] == nil {
+		bp.modifications[tid] = make(map[*Table]int64)
+	}
+	bp.modifications[tid][table] += count
+}
+
+// Record the tuples modified by tid in the statistics of their tables if
+// committed is true, or discard them if tid aborted.
+func (bp *BufferPool) endModifications(tid TransactionID, committed bool) {
+	bp.modificationsMutex.Lock()
+	tables := bp.modifications[tid]
+	delete(bp.modifications, tid)
+	bp.modificationsMutex.Unlock()
+	if !committed {
+		return
+	}
+	for table, count := range tables {
+		if table.stats != nil {
+			table.stats.recordModifications(int(count))
+		}
+	}
 }
 
 // Begin a new transaction. You do not need to implement this for lab 1.
@@ -85,6 +141,7 @@ func (bp *BufferPool) BeginTransaction(tid TransactionID) error {
 func (bp *BufferPool) GetPage(file DBFile, pageNo int, tid TransactionID, perm RWPerm) (Page, error) {
 
 	pageKey := file.pageKey(pageNo) // Unique key for the page
+	bp.fetched++
 
 	// Check if page is already in buffer pool
 	if page, exists := bp.pages[pageKey]; exists {
@@ -115,6 +172,7 @@ func (bp *BufferPool) GetPage(file DBFile, pageNo int, tid TransactionID, perm R
 	}
 
 	// Add the new page to the buffer pool
+	bp.read++
 	bp.pages[pageKey] = newPage
 	return newPage, nil
 }
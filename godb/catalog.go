@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -14,6 +15,12 @@ type Table struct {
 	name string
 	desc TupleDesc
 
+	// the DEFAULT value of each field, or nil for fields without one
+	defaults []DBValue
+
+	// the names of the fields of the PRIMARY KEY, if the table has one
+	primaryKey []string
+
 	// statistics
 	stats *TableStats
 
@@ -26,6 +33,10 @@ type Catalog struct {
 	bufferPool *BufferPool
 	rootPath   string
 	filePath   string
+
+	// whether tables were created, dropped or altered, or statistics
+	// computed, since the catalog was saved or loaded
+	changed bool
 }
 
 func (c *Catalog) SaveToFile(catalogFile string, rootPath string) error {
@@ -35,9 +46,28 @@ func (c *Catalog) SaveToFile(catalogFile string, rootPath string) error {
 	}
 	f.WriteString(c.String())
 	f.Close()
+	if err := c.saveStatsToFile(catalogFile, rootPath); err != nil {
+		return err
+	}
+	c.changed = false
 	return nil
 }
 
+// Return true if the catalog, or the statistics of its tables, changed since
+// it was last saved with SaveToFile or loaded, so that it needs to be saved
+// again; the statistics change as tuples are modified.
+func (c *Catalog) Unsaved() bool {
+	if c.changed {
+		return true
+	}
+	for _, t := range c.tableMap {
+		if t.stats != nil && t.stats.modified != t.stats.saved {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *Catalog) dropTable(tableName string) error {
 	_, ok := c.tableMap[tableName]
 	if !ok {
@@ -45,6 +75,7 @@ func (c *Catalog) dropTable(tableName string) error {
 	}
 
 	delete(c.tableMap, tableName)
+	c.changed = true
 	for cn, ts := range c.columnMap {
 		tsFiltered := make([]*Table, 0)
 		for _, t := range ts {
@@ -95,19 +126,35 @@ func (c *Catalog) parseCatalogFile() error {
 
 	for scanner.Scan() {
 		// code to read each line
-		line := strings.ToLower(scanner.Text())
-		sep := strings.Split(line, "(")
-		if len(sep) != 2 {
-			return GoDBError{ParseError, fmt.Sprintf("expected one paren in catalog entry, got %d (%s)", len(sep), line)}
+		line := scanner.Text()
+		tableName, rest, ok := strings.Cut(line, "(")
+		if !ok || !strings.HasSuffix(strings.TrimSpace(rest), ")") {
+			return GoDBError{ParseError, fmt.Sprintf("expected parenthesized field list in catalog entry (%s)", line)}
 		}
-		tableName := strings.TrimSpace(sep[0])
-		rest := strings.Trim(sep[1], "()")
-		fields := strings.Split(rest, ",")
+		tableName = strings.ToLower(strings.TrimSpace(tableName))
+		rest = strings.TrimSuffix(strings.TrimSpace(rest), ")")
+		fields := splitTopLevel(rest, ',')
 
 		var fieldArray []FieldType
+		var defaults []DBValue
+		var primaryKey []string
 		for _, f := range fields {
-			f := strings.TrimSpace(f)
-			nameType := strings.Split(f, " ")
+			if keyCols, isKey := strings.CutPrefix(strings.ToLower(strings.TrimSpace(f)), "primary key"); isKey {
+				for _, col := range strings.Split(strings.Trim(strings.TrimSpace(keyCols), "()"), ",") {
+					primaryKey = append(primaryKey, strings.TrimSpace(col))
+				}
+				continue
+			}
+
+			// string defaults are quoted and case sensitive, so only the
+			// declaration before them is lowercased
+			decl, defaultLit := strings.TrimSpace(f), ""
+			hasDefault := false
+			if i := strings.Index(strings.ToLower(decl), " default "); i >= 0 {
+				decl, defaultLit, hasDefault = decl[:i], decl[i+len(" default "):], true
+			}
+			decl = strings.ToLower(decl)
+			nameType := strings.Split(decl, " ")
 			if len(nameType) < 2 || len(nameType) > 4 {
 				return GoDBError{ParseError, fmt.Sprintf("malformed catalog entry %s (line %s)", nameType, line)}
 			}
@@ -129,18 +176,88 @@ func (c *Catalog) parseCatalogFile() error {
 				return GoDBError{ParseError, fmt.Sprintf("unknown type %s (line %s)", nameType[1], line)}
 			}
 			fieldArray = append(fieldArray, fieldType)
+
+			var defaultVal DBValue
+			if hasDefault {
+				defaultVal, err = parseDefaultLiteral(strings.TrimSpace(defaultLit), fieldType.Ftype)
+				if err != nil {
+					return err
+				}
+			}
+			defaults = append(defaults, defaultVal)
 		}
 
 		_, err := c.addTable(tableName, TupleDesc{fieldArray})
 		if err != nil {
 			return err
 		}
+		if err := c.setDefaults(tableName, defaults); err != nil {
+			return err
+		}
+		if primaryKey != nil {
+			if err := c.setPrimaryKey(tableName, primaryKey); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
+// Split s at each occurrence of sep that is not within a single quoted string
+// or parentheses.
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	inQuotes := false
+	depth := 0
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\'':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case s[i] == '(':
+			depth++
+		case s[i] == ')':
+			depth--
+		case s[i] == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Parse a default value of type t written by [formatDefaultLiteral].
+func parseDefaultLiteral(lit string, t DBType) (DBValue, error) {
+	switch t {
+	case IntType:
+		v, err := strconv.ParseInt(lit, 10, 64)
+		if err != nil {
+			return nil, GoDBError{ParseError, fmt.Sprintf("invalid int default value %s", lit)}
+		}
+		return IntField{v}, nil
+	case StringType:
+		if len(lit) < 2 || lit[0] != '\'' || lit[len(lit)-1] != '\'' {
+			return nil, GoDBError{ParseError, fmt.Sprintf("string default value %s must be quoted", lit)}
+		}
+		return StringField{strings.ReplaceAll(lit[1:len(lit)-1], "''", "'")}, nil
+	}
+	return nil, GoDBError{ParseError, fmt.Sprintf("unsupported default value %s", lit)}
+}
+
+// Format a default value so it can be stored in the catalog file.
+func formatDefaultLiteral(v DBValue) string {
+	switch v := v.(type) {
+	case StringField:
+		return "'" + strings.ReplaceAll(v.Value, "'", "''") + "'"
+	case IntField:
+		return strconv.FormatInt(v.Value, 10)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
 func NewCatalog(catalogFile string, bp *BufferPool, rootPath string) *Catalog {
-	return &Catalog{make(map[string]*Table), make(map[string][]*Table), bp, rootPath, catalogFile}
+	return &Catalog{make(map[string]*Table), make(map[string][]*Table), bp, rootPath, catalogFile, false}
 }
 
 func NewCatalogFromFile(catalogFile string, bp *BufferPool, rootPath string) (*Catalog, error) {
@@ -148,6 +265,11 @@ func NewCatalogFromFile(catalogFile string, bp *BufferPool, rootPath string) (*C
 	if err := c.parseCatalogFile(); err != nil {
 		return nil, err
 	}
+	if err := c.loadStatsFile(); err != nil {
+		return nil, err
+	}
+	//the tables added while parsing the file are already saved
+	c.changed = false
 	return c, nil
 }
 
@@ -165,8 +287,9 @@ func (c *Catalog) addTable(named string, desc TupleDesc) (DBFile, error) {
 		return nil, err
 	}
 
-	t := &Table{len(c.tableMap), named, desc, nil, hf}
+	t := &Table{len(c.tableMap), named, desc, nil, nil, nil, hf}
 	c.tableMap[named] = t
+	c.changed = true
 	for _, f := range desc.Fields {
 		mapList := c.columnMap[f.Fname]
 		if mapList == nil {
@@ -178,8 +301,97 @@ func (c *Catalog) addTable(named string, desc TupleDesc) (DBFile, error) {
 	return hf, nil
 }
 
-func (c *Catalog) ComputeTableStats() error {
-	// Dummy implementation, do not worry about it.
+// Set the DEFAULT values of the fields of a table, one per field, with nil for
+// fields without a default.
+//
+// Returns an error if the table does not exist or a default value has the wrong
+// type.
+func (c *Catalog) setDefaults(named string, defaults []DBValue) error {
+	t, err := c.GetTableInfo(named)
+	if err != nil {
+		return err
+	}
+	if len(defaults) != len(t.desc.Fields) {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("expected %d default values for table %s, got %d", len(t.desc.Fields), named, len(defaults))}
+	}
+	for i, v := range defaults {
+		if v == nil {
+			continue
+		}
+		if _, isInt := v.(IntField); isInt != (t.desc.Fields[i].Ftype == IntType) {
+			return GoDBError{TypeMismatchError, fmt.Sprintf("default value of field %s does not match its type", t.desc.Fields[i].Fname)}
+		}
+	}
+	t.defaults = defaults
+	c.changed = true
+	return nil
+}
+
+// Set the PRIMARY KEY of a table to the named fields.
+//
+// Returns an error if the table or one of the fields does not exist.
+func (c *Catalog) setPrimaryKey(named string, fields []string) error {
+	t, err := c.GetTableInfo(named)
+	if err != nil {
+		return err
+	}
+	keyFields := make([]int, len(fields))
+	for i, f := range fields {
+		keyFields[i], err = findFieldInTd(FieldType{f, "", UnknownType}, &t.desc)
+		if err != nil {
+			return GoDBError{ParseError, fmt.Sprintf("primary key field %s is not a field of table %s", f, named)}
+		}
+	}
+	t.primaryKey = fields
+	c.changed = true
+	//the heap file enforces the key on every insertion
+	if hf, ok := t.file.(*HeapFile); ok {
+		hf.setUniqueKey(keyFields)
+	}
+	return nil
+}
+
+// Return the DEFAULT value of the ith field of the table, or nil if it has
+// none.
+func (t *Table) defaultValue(i int) DBValue {
+	if t.defaults == nil {
+		return nil
+	}
+	return t.defaults[i]
+}
+
+// Compute the statistics of the named tables, or of every table if none are
+// named, by scanning them in a transaction of their own. The statistics are
+// used to estimate the cardinalities of plans until they are computed again.
+//
+// Returns an error if one of the tables does not exist.
+func (c *Catalog) ComputeTableStats(tables ...string) error {
+	if len(tables) == 0 {
+		for name := range c.tableMap {
+			tables = append(tables, name)
+		}
+		sort.Strings(tables)
+	}
+	for _, name := range tables {
+		if _, err := c.GetTableInfo(name); err != nil {
+			return err
+		}
+	}
+	tid := NewTID()
+	if err := c.bufferPool.BeginTransaction(tid); err != nil {
+		return err
+	}
+	for _, name := range tables {
+		t := c.tableMap[name]
+		stats, err := ComputeTableStats(c.bufferPool, t.file, tid)
+		if err != nil {
+			c.bufferPool.AbortTransaction(tid)
+			return err
+		}
+		t.stats = stats
+		c.changed = true
+	}
+	c.bufferPool.CommitTransaction(tid)
 	return nil
 }
 
@@ -232,6 +444,19 @@ func (c *Catalog) GetTableStats(named string) *TableStats {
 	return t.stats
 }
 
+// Return the names of the tables whose statistics are stale (see
+// [TableStats.Stale]), in order.
+func (c *Catalog) StaleTables() []string {
+	var stale []string
+	for name, t := range c.tableMap {
+		if t.stats != nil && t.stats.Stale() {
+			stale = append(stale, name)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
 func (c *Catalog) findTablesWithColumn(named string) []*Table {
 	return c.columnMap[named]
 }
@@ -251,6 +476,15 @@ func (t *Table) String() string {
 		buf.WriteString(f.Fname)
 		buf.WriteByte(' ')
 		buf.WriteString(f.Ftype.String())
+		if v := t.defaultValue(i); v != nil {
+			buf.WriteString(" default ")
+			buf.WriteString(formatDefaultLiteral(v))
+		}
+	}
+	if len(t.primaryKey) > 0 {
+		buf.WriteString(", primary key (")
+		buf.WriteString(strings.Join(t.primaryKey, ", "))
+		buf.WriteByte(')')
 	}
 	buf.WriteString(")\n")
 	return buf.String()
@@ -0,0 +1,343 @@
+package godb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Conditional expressions: CASE, COALESCE and NULLIF, along with the
+// conditions of CASE WHEN, and CAST.
+//
+// GoDB has no NULL, so where SQL would return NULL (e.g., from a CASE without
+// an ELSE), these return the zero value of their type, i.e., 0 or "", and
+// COALESCE and NULLIF treat the zero value as NULL. This matches the values
+// returned by window functions such as LAG for rows that don't exist. A 0 or
+// "" stored in a table is thus indistinguishable from a missing value: e.g.,
+// COALESCE(0, 5) is 5, and NULLIF(0, 1) is 0.
+
+// The kinds of [CondExpr].
+type CondKind int
+
+const (
+	CondCompare CondKind = iota
+	CondAnd     CondKind = iota
+	CondOr      CondKind = iota
+	CondNot     CondKind = iota
+)
+
+// A CondExpr is a condition, e.g., of a CASE WHEN: a comparison of two
+// expressions, or the conjunction, disjunction or negation of other
+// conditions. GoDB has no boolean type, so a condition evaluates to 1 if it
+// holds and 0 otherwise, and an integer is true if it's non-zero.
+type CondExpr struct {
+	kind    CondKind
+	op      BoolOp // the operator of a comparison
+	args    []Expr
+	matcher *patternMatcher // for comparisons with pattern matching operators
+}
+
+// Construct a condition of the given kind. A comparison args[0] op args[1]
+// needs two arguments of the same type, a negation one integer argument, and
+// a conjunction or disjunction at least two integer arguments.
+func NewCondExpr(kind CondKind, op BoolOp, args []Expr) (*CondExpr, error) {
+	switch kind {
+	case CondCompare:
+		if len(args) != 2 {
+			return nil, GoDBError{ParseError, "expected two arguments to comparison"}
+		}
+		t1, t2 := args[0].GetExprType().Ftype, args[1].GetExprType().Ftype
+		if t1 != t2 && t1 != UnknownType && t2 != UnknownType {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("cannot compare %v to %v", t1, t2)}
+		}
+		if op.isPattern() {
+			if t1 == IntType || t2 == IntType {
+				return nil, GoDBError{TypeMismatchError, "pattern matching requires string arguments"}
+			}
+			return &CondExpr{kind, op, args, &patternMatcher{op: op}}, nil
+		}
+	case CondAnd, CondOr, CondNot:
+		if kind == CondNot && len(args) != 1 {
+			return nil, GoDBError{ParseError, "expected one argument to not"}
+		}
+		if kind != CondNot && len(args) < 2 {
+			return nil, GoDBError{ParseError, "expected at least two arguments to and/or"}
+		}
+		for _, arg := range args {
+			if arg.GetExprType().Ftype == StringType {
+				return nil, GoDBError{TypeMismatchError, "expected a condition, got a string"}
+			}
+		}
+	default:
+		return nil, GoDBError{ParseError, "unknown kind of condition"}
+	}
+	return &CondExpr{kind, op, args, nil}, nil
+}
+
+func (c *CondExpr) GetExprType() FieldType {
+	return FieldType{"cond", "", IntType}
+}
+
+// Return true if the value v of a condition is true, i.e., a non-zero integer.
+func isTrue(v DBValue) (bool, error) {
+	i, ok := v.(IntField)
+	if !ok {
+		return false, GoDBError{TypeMismatchError, fmt.Sprintf("expected a condition, got %v", v)}
+	}
+	return i.Value != 0, nil
+}
+
+// Return true if the condition holds for t. Conjunctions and disjunctions
+// only evaluate their arguments until the result is known.
+func (c *CondExpr) holds(t *Tuple) (bool, error) {
+	switch c.kind {
+	case CondCompare:
+		left, err := c.args[0].EvalExpr(t)
+		if err != nil {
+			return false, err
+		}
+		right, err := c.args[1].EvalExpr(t)
+		if err != nil {
+			return false, err
+		}
+		if c.matcher != nil {
+			return c.matcher.match(left, right)
+		}
+		return left.EvalPred(right, c.op), nil
+	case CondNot:
+		v, err := c.args[0].EvalExpr(t)
+		if err != nil {
+			return false, err
+		}
+		holds, err := isTrue(v)
+		return !holds, err
+	default:
+		for _, arg := range c.args {
+			v, err := arg.EvalExpr(t)
+			if err != nil {
+				return false, err
+			}
+			holds, err := isTrue(v)
+			if err != nil {
+				return false, err
+			}
+			if holds == (c.kind == CondOr) {
+				return holds, nil
+			}
+		}
+		return c.kind == CondAnd, nil
+	}
+}
+
+func (c *CondExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	holds, err := c.holds(t)
+	if err != nil {
+		return nil, err
+	}
+	if holds {
+		return IntField{1}, nil
+	}
+	return IntField{0}, nil
+}
+
+// Return true if v is the zero value of its type, which COALESCE and NULLIF
+// treat as NULL.
+func isZeroValue(v DBValue) bool {
+	switch v := v.(type) {
+	case IntField:
+		return v.Value == 0
+	case StringField:
+		return v.Value == ""
+	}
+	return false
+}
+
+// Return the common type of exprs, which must all be of the same type, or of
+// UnknownType (e.g., the fields of subqueries).
+func commonType(name string, exprs []Expr) (DBType, error) {
+	t := UnknownType
+	for _, e := range exprs {
+		switch et := e.GetExprType().Ftype; {
+		case et == UnknownType:
+		case t == UnknownType:
+			t = et
+		case et != t:
+			return UnknownType, GoDBError{TypeMismatchError, fmt.Sprintf("%s of values of different types %v and %v", name, t, et)}
+		}
+	}
+	return t, nil
+}
+
+// A CaseExpr is CASE WHEN conds[0] THEN results[0] ... ELSE elseExpr END. (A
+// simple CASE x WHEN v ..., is a CaseExpr whose conditions are x = v.)
+type CaseExpr struct {
+	conds    []Expr
+	results  []Expr
+	elseExpr Expr // may be nil, in which case the zero value of the type is returned, as SQL would NULL
+	ftype    DBType
+}
+
+// Construct a CASE expression. The results and else expression must all be of
+// the same type, and the conditions integers (e.g., [CondExpr]s).
+func NewCaseExpr(conds []Expr, results []Expr, elseExpr Expr) (*CaseExpr, error) {
+	if len(conds) == 0 || len(conds) != len(results) {
+		return nil, GoDBError{ParseError, "expected a result for each condition of case"}
+	}
+	for _, cond := range conds {
+		if cond.GetExprType().Ftype == StringType {
+			return nil, GoDBError{TypeMismatchError, "expected a condition in case when, got a string"}
+		}
+	}
+	values := results
+	if elseExpr != nil {
+		values = append(append([]Expr{}, results...), elseExpr)
+	}
+	ftype, err := commonType("case", values)
+	if err != nil {
+		return nil, err
+	}
+	return &CaseExpr{conds, results, elseExpr, ftype}, nil
+}
+
+func (c *CaseExpr) GetExprType() FieldType {
+	return FieldType{"case", "", c.ftype}
+}
+
+func (c *CaseExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	for i, cond := range c.conds {
+		v, err := cond.EvalExpr(t)
+		if err != nil {
+			return nil, err
+		}
+		holds, err := isTrue(v)
+		if err != nil {
+			return nil, err
+		}
+		if holds {
+			return c.results[i].EvalExpr(t)
+		}
+	}
+	if c.elseExpr == nil {
+		return zeroValue(c.ftype), nil
+	}
+	return c.elseExpr.EvalExpr(t)
+}
+
+// A CoalesceExpr is COALESCE(args...), the first of args whose value isn't the
+// zero value of its type (or the zero value, if none are). Unlike SQL's, it
+// skips arguments that are 0 or "", which stand in for NULL.
+type CoalesceExpr struct {
+	args  []Expr
+	ftype DBType
+}
+
+// Construct a COALESCE expression, whose arguments must be of the same type.
+func NewCoalesceExpr(args []Expr) (*CoalesceExpr, error) {
+	if len(args) == 0 {
+		return nil, GoDBError{ParseError, "expected at least one argument to coalesce"}
+	}
+	ftype, err := commonType("coalesce", args)
+	if err != nil {
+		return nil, err
+	}
+	return &CoalesceExpr{args, ftype}, nil
+}
+
+func (c *CoalesceExpr) GetExprType() FieldType {
+	return FieldType{"coalesce", "", c.ftype}
+}
+
+func (c *CoalesceExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	var v DBValue
+	for _, arg := range c.args {
+		var err error
+		if v, err = arg.EvalExpr(t); err != nil {
+			return nil, err
+		}
+		if !isZeroValue(v) {
+			return v, nil
+		}
+	}
+	return v, nil
+}
+
+// A NullIfExpr is NULLIF(left, right): the zero value of the type, which
+// stands in for NULL, if left and right are equal, and left otherwise. So a
+// left that is the zero value is returned as is, whatever right is.
+type NullIfExpr struct {
+	left, right Expr
+	ftype       DBType
+}
+
+// Construct a NULLIF expression, whose arguments must be of the same type.
+func NewNullIfExpr(left, right Expr) (*NullIfExpr, error) {
+	ftype, err := commonType("nullif", []Expr{left, right})
+	if err != nil {
+		return nil, err
+	}
+	return &NullIfExpr{left, right, ftype}, nil
+}
+
+func (n *NullIfExpr) GetExprType() FieldType {
+	return FieldType{"nullif", "", n.ftype}
+}
+
+func (n *NullIfExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	left, err := n.left.EvalExpr(t)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.EvalExpr(t)
+	if err != nil {
+		return nil, err
+	}
+	if left.EvalPred(right, OpEq) {
+		return zeroValue(n.ftype), nil
+	}
+	return left, nil
+}
+
+// A CastExpr is CAST(expr AS to). Casting a string to an int fails if it isn't
+// an integer (ignoring surrounding whitespace).
+type CastExpr struct {
+	expr Expr
+	to   DBType
+}
+
+// Construct a cast of expr to the type to, which must be IntType or
+// StringType.
+func NewCastExpr(expr Expr, to DBType) (*CastExpr, error) {
+	if to != IntType && to != StringType {
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("cannot cast to type %v", to)}
+	}
+	return &CastExpr{expr, to}, nil
+}
+
+func (c *CastExpr) GetExprType() FieldType {
+	ft := c.expr.GetExprType()
+	return FieldType{ft.Fname, ft.TableQualifier, c.to}
+}
+
+func (c *CastExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	v, err := c.expr.EvalExpr(t)
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case IntField:
+		if c.to == StringType {
+			return StringField{strconv.FormatInt(v.Value, 10)}, nil
+		}
+		return v, nil
+	case StringField:
+		if c.to == IntType {
+			i, err := strconv.ParseInt(strings.TrimSpace(v.Value), 10, 64)
+			if err != nil {
+				return nil, GoDBError{TypeMismatchError, fmt.Sprintf("cannot cast '%s' to an int", v.Value)}
+			}
+			return IntField{i}, nil
+		}
+		return v, nil
+	}
+	return nil, GoDBError{TypeMismatchError, fmt.Sprintf("cannot cast %v", v)}
+}
@@ -0,0 +1,200 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestCondExprs(t *testing.T) {
+	td, t1, t2, _, _, _ := makeTestVars(t)
+	name, age := &FieldExpr{td.Fields[0]}, &FieldExpr{td.Fields[1]}
+	intConst := func(i int64) Expr { return &ConstExpr{IntField{i}, IntType} }
+	strConst := func(s string) Expr { return &ConstExpr{StringField{s}, StringType} }
+	mustExpr := func(e Expr, err error) Expr {
+		t.Helper()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		return e
+	}
+
+	// t1 is sam, 25 and t2 is george jones, 999
+	old := mustExpr(NewCondExpr(CondCompare, OpGt, []Expr{age, intConst(100)}))
+	isSam := mustExpr(NewCondExpr(CondCompare, OpEq, []Expr{name, strConst("sam")}))
+	exprs := []struct {
+		expr     Expr
+		ftype    DBType
+		expected [2]DBValue
+	}{
+		{old, IntType, [2]DBValue{IntField{0}, IntField{1}}},
+		{mustExpr(NewCondExpr(CondOr, 0, []Expr{old, isSam})), IntType, [2]DBValue{IntField{1}, IntField{1}}},
+		{mustExpr(NewCondExpr(CondAnd, 0, []Expr{old, isSam})), IntType, [2]DBValue{IntField{0}, IntField{0}}},
+		{mustExpr(NewCondExpr(CondNot, 0, []Expr{isSam})), IntType, [2]DBValue{IntField{0}, IntField{1}}},
+		{mustExpr(NewCaseExpr([]Expr{old, isSam}, []Expr{strConst("old"), strConst("sam")}, strConst("other"))), StringType,
+			[2]DBValue{StringField{"sam"}, StringField{"old"}}},
+		{mustExpr(NewCaseExpr([]Expr{isSam}, []Expr{age}, nil)), IntType, [2]DBValue{IntField{25}, IntField{0}}},
+		{mustExpr(NewNullIfExpr(name, strConst("sam"))), StringType, [2]DBValue{StringField{""}, StringField{"george jones"}}},
+		{mustExpr(NewCoalesceExpr([]Expr{mustExpr(NewNullIfExpr(name, strConst("sam"))), strConst("nobody")})), StringType,
+			[2]DBValue{StringField{"nobody"}, StringField{"george jones"}}},
+		// 0 and "" stand in for NULL
+		{mustExpr(NewCoalesceExpr([]Expr{intConst(0), age})), IntType, [2]DBValue{IntField{25}, IntField{999}}},
+		{mustExpr(NewCoalesceExpr([]Expr{strConst(""), strConst("")})), StringType, [2]DBValue{StringField{""}, StringField{""}}},
+		{mustExpr(NewNullIfExpr(intConst(0), age)), IntType, [2]DBValue{IntField{0}, IntField{0}}},
+		{mustExpr(NewCaseExpr([]Expr{isSam}, []Expr{name}, nil)), StringType, [2]DBValue{StringField{"sam"}, StringField{""}}},
+		{mustExpr(NewCastExpr(age, StringType)), StringType, [2]DBValue{StringField{"25"}, StringField{"999"}}},
+		{mustExpr(NewCastExpr(mustExpr(NewCastExpr(age, StringType)), IntType)), IntType, [2]DBValue{IntField{25}, IntField{999}}},
+	}
+	for i, e := range exprs {
+		if ftype := e.expr.GetExprType().Ftype; ftype != e.ftype {
+			t.Errorf("expression %d: expected type %v, got %v", i, e.ftype, ftype)
+		}
+		for j, tup := range []*Tuple{&t1, &t2} {
+			v, err := e.expr.EvalExpr(tup)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if v != e.expected[j] {
+				t.Errorf("expression %d: expected %v for tuple %d, got %v", i, e.expected[j], j, v)
+			}
+		}
+	}
+
+	if _, err := mustExpr(NewCastExpr(name, IntType)).EvalExpr(&t1); err == nil {
+		t.Errorf("expected error casting a non-integer string to an int")
+	}
+	if _, err := NewCondExpr(CondCompare, OpEq, []Expr{name, age}); err == nil {
+		t.Errorf("expected error comparing a string to an int")
+	}
+	if _, err := NewCondExpr(CondAnd, 0, []Expr{old, name}); err == nil {
+		t.Errorf("expected error for a conjunction of a string")
+	}
+	if _, err := NewCaseExpr([]Expr{old}, []Expr{name}, age); err == nil {
+		t.Errorf("expected error for case with results of different types")
+	}
+	if _, err := NewCaseExpr([]Expr{name}, []Expr{age}, nil); err == nil {
+		t.Errorf("expected error for case with a string condition")
+	}
+	if _, err := NewCoalesceExpr([]Expr{name, age}); err == nil {
+		t.Errorf("expected error for coalesce of different types")
+	}
+	if _, err := NewCastExpr(age, UnknownType); err == nil {
+		t.Errorf("expected error for cast to an unknown type")
+	}
+}
+
+func TestCastRewrite(t *testing.T) {
+	queries := []struct{ query, expected string }{
+		{"select cast(a as int) from t", "select cast(a as signed) from t"},
+		{"select CAST(a AS VARCHAR(10)), cast(b as text) from t", "select CAST(a AS char), cast(b as char) from t"},
+		{"select cast(cast(a as int) as string) from t", "select cast(cast(a as signed) as char) from t"},
+		{"select cast(f(a) as integer) as x from t", "select cast(f(a) as signed) as x from t"},
+		// types sqlparser can parse, and strings, aren't rewritten
+		{"select cast(a as signed), convert(a, char) from t", "select cast(a as signed), convert(a, char) from t"},
+		{"select 'cast(a as int)' from t", "select 'cast(a as int)' from t"},
+	}
+	for _, q := range queries {
+		if got := rewriteCasts(q.query); got != q.expected {
+			t.Errorf("rewriting %s: expected %s, got %s", q.query, q.expected, got)
+		}
+	}
+}
+
+func TestCondExprQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+
+	tups := runQueryForTest(t, c, bp, "select name, age, case when age < 30 then 'young' when age < 50 and name <> 'joe' then 'mid' else 'old' end as band, case name when 'sam' then 1 when 'riza' then 2 end from t")
+	for _, tup := range tups {
+		name, age := tup.Fields[0].(StringField).Value, tup.Fields[1].(IntField).Value
+		band, code := tup.Fields[2].(StringField).Value, tup.Fields[3].(IntField).Value
+		expectedBand := "old"
+		if age < 30 {
+			expectedBand = "young"
+		} else if age < 50 && name != "joe" {
+			expectedBand = "mid"
+		}
+		expectedCode := map[string]int64{"sam": 1, "riza": 2}[name]
+		if band != expectedBand || code != expectedCode {
+			t.Errorf("expected %s and %d for %s %d, got %s and %d", expectedBand, expectedCode, name, age, band, code)
+		}
+	}
+
+	tups = runQueryForTest(t, c, bp, "select coalesce(nullif(name, 'sam'), 'nobody'), cast(age as varchar) from t where cast(cast(age as char) as int) = 99")
+	if len(tups) != 2 {
+		t.Fatalf("expected 2 tuples, got %d", len(tups))
+	}
+	for _, tup := range tups {
+		if n := tup.Fields[0].(StringField).Value; n != "nobody" && n != "bo" {
+			t.Errorf("unexpected name %s", n)
+		}
+		if a := tup.Fields[1].(StringField).Value; a != "99" {
+			t.Errorf("expected age '99', got '%s'", a)
+		}
+	}
+
+	//zero values are treated as NULL, whether constants, computed or stored
+	tups = runQueryForTest(t, c, bp, "select coalesce(0, age), coalesce(age - age, -1), coalesce('', name), nullif(age, 25), nullif(age - age, 1), coalesce(nullif(age, 25), 0), case when age > 1000 then name end from t where name = 'sam' and age = 25")
+	if len(tups) != 1 {
+		t.Fatalf("expected 1 tuple, got %d", len(tups))
+	}
+	expected := []DBValue{IntField{25}, IntField{-1}, StringField{"sam"}, IntField{0}, IntField{0}, IntField{0}, StringField{""}}
+	for i, e := range expected {
+		if v := tups[0].Fields[i]; v != e {
+			t.Errorf("expected %v for expression %d, got %v", e, i, v)
+		}
+	}
+
+	// in predicates, group by and order by
+	tups = runQueryForTest(t, c, bp, "select name from t where case when age > 40 then 1 else 0 end = 1")
+	if len(tups) != 6 {
+		t.Errorf("expected 6 tuples older than 40, got %d", len(tups))
+	}
+	tups = runQueryForTest(t, c, bp, "select case when age > 40 then 'old' else 'young' end as b, count(*), sum(case when name = 'sam' then 1 else 0 end) from t group by case when age > 40 then 'old' else 'young' end")
+	if len(tups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(tups))
+	}
+	for _, tup := range tups {
+		if n := tup.Fields[1].(IntField).Value; n != 6 {
+			t.Errorf("expected 6 tuples in group %s, got %d", tup.Fields[0].(StringField).Value, n)
+		}
+		if n := tup.Fields[2].(IntField).Value; n != 1 {
+			t.Errorf("expected 1 sam in group %s, got %d", tup.Fields[0].(StringField).Value, n)
+		}
+	}
+	tups = runQueryForTest(t, c, bp, "select name, age from t order by case when name = 'sam' then 0 else 1 end, age")
+	for i, tup := range tups {
+		if isSam := tup.Fields[0].(StringField).Value == "sam"; isSam != (i < 2) {
+			t.Errorf("expected sam first, got %s at %d", tup.Fields[0].(StringField).Value, i)
+		}
+	}
+
+	// grouping on an expression returns its value, rather than evaluating it
+	// over the value
+	tups = runQueryForTest(t, c, bp, "select age + 1, count(*) from t group by age + 1")
+	for _, tup := range tups {
+		if a := tup.Fields[0].(IntField).Value; a != 23 && a != 26 && a != 31 && a != 39 && a != 41 && a != 44 && a != 46 && a != 51 && a != 61 && a != 100 {
+			t.Errorf("unexpected age + 1 %d", a)
+		}
+	}
+
+	for _, q := range []string{
+		"select case when age > 1 then 'x' else 2 end from t",
+		"select case when name then 1 end from t",
+		"select coalesce(name, age) from t",
+		"select nullif(age) from t",
+		"select cast(age as date) from t",
+	} {
+		if _, _, err := Parse(c, q); err == nil {
+			t.Errorf("expected error for %s", q)
+		}
+	}
+	if err := queryErrorForTest(t, c, bp, "select cast(name as int) from t"); err == nil {
+		t.Errorf("expected error casting names to ints")
+	}
+	if err := RegisterFunction("coalesce", FunctionSignature{ArgTypes: []DBType{IntType}, OutType: IntType}, func(args []DBValue) (DBValue, error) {
+		return args[0], nil
+	}); err == nil {
+		t.Errorf("expected error registering a function named coalesce")
+	}
+}
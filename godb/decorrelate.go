@@ -0,0 +1,253 @@
+package godb
+
+import "fmt"
+
+// Methods to plan correlated subqueries, i.e., subqueries in a WHERE clause or
+// select list that refer to tables of the enclosing query, such as
+//
+//	SELECT station_id FROM rail_ridership r
+//	WHERE total_ons > (SELECT avg(total_ons) FROM rail_ridership r2
+//	                   WHERE r2.line_id = r.line_id)
+//
+// After a query is parsed, bindOuterRefs finds the predicates of each of its
+// subqueries that refer to the enclosing query, and records them in the
+// subquery's correlated list, with the enclosing query's side of each
+// predicate represented by an ExprOuterRef node.
+//
+// Before a query is planned, decorrelate rewrites the common patterns into
+// plans that run each subquery once:
+//   - IN and EXISTS subqueries correlated by equalities become semi-joins on the
+//     correlated columns, in addition to the IN column.
+//   - Scalar subqueries in the WHERE clause that compute an aggregate and are
+//     correlated by equalities become a subquery in the FROM clause, grouped by
+//     the correlated columns and outer joined to the enclosing query. Tuples of
+//     the enclosing query with no group are joined with the value of the
+//     aggregate over no tuples, which the subquery returns when re-run for them.
+//
+// Subqueries that can't be rewritten are re-run for each tuple of the
+// enclosing query, with their outer references bound to that tuple.
+
+// Return true if table names a table or FROM subquery of p.
+func (p *LogicalPlan) hasTable(table string) bool {
+	if table == "" {
+		return false
+	}
+	for _, t := range p.tables {
+		if t.tableName == table || t.alias == table {
+			return true
+		}
+	}
+	for _, sq := range p.subqueries {
+		if sq.alias == table {
+			return true
+		}
+	}
+	return false
+}
+
+// If n is a field of a table of p but not of sub, return that table's name.
+func (p *LogicalPlan) outerTableOf(c *Catalog, sub *LogicalPlan, n *LogicalSelectNode) (string, error) {
+	if n.exprType != ExprField {
+		return "", nil
+	}
+	table, _, err := n.getTableField(c, sub.subqueries, sub.tables)
+	if err != nil || sub.hasTable(table) {
+		return "", err
+	}
+	if table == "" {
+		table, err = checkNameInTablesOrSubqueries("", n.field, c, p.subqueries, p.tables)
+		if err != nil {
+			return "", err
+		}
+	}
+	if !p.hasTable(table) {
+		return "", nil
+	}
+	return table, nil
+}
+
+// Find predicates of the subquery sub that refer to tables of p, and record
+// them as correlation predicates of sub.
+func (p *LogicalPlan) bindOuterRefs(c *Catalog, sub *LogicalPlan) error {
+	var correlated []*LogicalFilterNode
+	var joins []*LogicalJoinNode
+	for _, j := range sub.joins {
+		lOuter, err := p.outerTableOf(c, sub, j.left)
+		if err != nil {
+			return err
+		}
+		rOuter, err := p.outerTableOf(c, sub, j.right)
+		if err != nil {
+			return err
+		}
+		switch {
+		case lOuter == "" && rOuter != "":
+			ref := NewOuterRefSelectNode(rOuter, j.right.field)
+			correlated = append(correlated, &LogicalFilterNode{*j.left, ref, j.predOp})
+		case lOuter != "" && rOuter == "":
+			ref := NewOuterRefSelectNode(lOuter, j.left.field)
+			correlated = append(correlated, &LogicalFilterNode{*j.right, ref, j.predOp.flip()})
+		default:
+			joins = append(joins, j)
+		}
+	}
+
+	var filters []*LogicalFilterNode
+	for _, f := range sub.filters {
+		outer, err := p.outerTableOf(c, sub, &f.constExpr)
+		if err != nil {
+			return err
+		}
+		if outer == "" {
+			filters = append(filters, f)
+			continue
+		}
+		ref := NewOuterRefSelectNode(outer, f.constExpr.field)
+		correlated = append(correlated, &LogicalFilterNode{f.fieldExpr, ref, f.predOp})
+	}
+
+	if len(correlated) == 0 {
+		return nil
+	}
+	sub.outer = &outerTuple{}
+	for _, f := range correlated {
+		f.constExpr.outer = sub.outer
+	}
+	sub.joins = joins
+	sub.filters = filters
+	sub.correlated = correlated
+	return nil
+}
+
+// Return the subqueries of the select node n, including those nested in the
+// arguments of functions.
+func subqueriesOf(n *LogicalSelectNode) []*LogicalPlan {
+	if n.exprType == ExprSubquery {
+		return []*LogicalPlan{n.subplan}
+	}
+	var subplans []*LogicalPlan
+	for _, arg := range n.args {
+		subplans = append(subplans, subqueriesOf(arg)...)
+	}
+	return subplans
+}
+
+// Return true if n contains a correlated subquery.
+func hasCorrelatedSubquery(n *LogicalSelectNode) bool {
+	for _, sub := range subqueriesOf(n) {
+		if sub.outer != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Find the outer references of all of the subqueries of p.
+func (p *LogicalPlan) bindAllOuterRefs(c *Catalog) error {
+	var subplans []*LogicalPlan
+	for _, f := range p.filters {
+		subplans = append(subplans, subqueriesOf(&f.fieldExpr)...)
+		subplans = append(subplans, subqueriesOf(&f.constExpr)...)
+	}
+	for _, sj := range p.semiJoins {
+		subplans = append(subplans, sj.subplan)
+	}
+	for _, s := range p.selects {
+		subplans = append(subplans, subqueriesOf(s)...)
+	}
+	for _, sub := range subplans {
+		if err := p.bindOuterRefs(c, sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return true if every correlation predicate of p is an equality, so that the
+// correlation can be expressed as a join.
+func (p *LogicalPlan) equiCorrelated() bool {
+	for _, f := range p.correlated {
+		if f.predOp != OpEq {
+			return false
+		}
+	}
+	return true
+}
+
+// Return true if the correlated subquery p of an IN or EXISTS predicate can be
+// rewritten as a semi-join.
+func (p *LogicalPlan) canDecorrelateSemiJoin() bool {
+	return p.equiCorrelated() && len(p.aggs) == 0 && len(p.groupByFields) == 0 && p.limit == nil
+}
+
+// Return true if the correlated scalar subquery p can be rewritten as a grouped
+// aggregate outer joined to the enclosing query.
+func (p *LogicalPlan) canDecorrelateScalar() bool {
+	return p.equiCorrelated() && len(p.selects) == 1 && len(p.aggs) > 0 && len(p.groupByFields) == 0 && len(p.having) == 0 && p.limit == nil
+}
+
+// Remove the correlation predicates from the subquery p, adding the subquery's
+// side of each to its select list, and returning the enclosing query's side of
+// each as field nodes.
+func (p *LogicalPlan) extractCorrelationKeys() (inner []*LogicalSelectNode, outer []*LogicalSelectNode) {
+	for i, f := range p.correlated {
+		key := f.fieldExpr
+		key.alias = fmt.Sprintf("__k%d", i)
+		inner = append(inner, &key)
+		ref := NewFieldSelectNode(f.constExpr.table, f.constExpr.field, "")
+		outer = append(outer, &ref)
+	}
+	p.correlated = nil
+	p.outer = nil
+	return inner, outer
+}
+
+// Rewrite the correlated subqueries of p into joins and semi-joins where
+// possible (see the comment at the top of this file).
+func (p *LogicalPlan) decorrelate() {
+	for _, sj := range p.semiJoins {
+		sub := sj.subplan
+		if sub.outer == nil || !sub.canDecorrelateSemiJoin() {
+			continue
+		}
+		inner, outer := sub.extractCorrelationKeys()
+		if sj.expr == nil {
+			sub.selects = inner
+		} else {
+			sub.selects = append(sub.selects, inner...)
+		}
+		sj.outerKeys = outer
+	}
+
+	var filters []*LogicalFilterNode
+	for _, f := range p.filters {
+		sub := f.constExpr.subplan
+		if f.constExpr.exprType != ExprSubquery || sub.outer == nil || !sub.canDecorrelateScalar() {
+			if hasCorrelatedSubquery(&f.fieldExpr) || hasCorrelatedSubquery(&f.constExpr) {
+				// the subquery may refer to any table, so evaluate it after joins
+				p.joinFilters = append(p.joinFilters, f)
+			} else {
+				filters = append(filters, f)
+			}
+			continue
+		}
+
+		alias := fmt.Sprintf("__sq%d", len(p.subqueries))
+		inner, outer := sub.extractCorrelationKeys()
+		for _, key := range inner {
+			sub.groupByFields = append(sub.groupByFields, &GroupBy{key})
+		}
+		// the aggregate node is shared with sub.aggs, so rename it in place
+		val := sub.selects[0]
+		val.alias = "__v"
+		sub.selects = append(inner, val)
+		sub.alias = alias
+		sub.hidden = true
+		sub.outerKeys = outer
+		p.subqueries = append(p.subqueries, sub)
+
+		v := NewFieldSelectNode(alias, "__v", "")
+		p.joinFilters = append(p.joinFilters, &LogicalFilterNode{f.fieldExpr, v, f.predOp})
+	}
+	p.filters = filters
+}
@@ -0,0 +1,117 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCorrelatedSubqueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	queries := []struct {
+		sql      string
+		expected int
+	}{
+		// decorrelated into a join with a grouped aggregate
+		{"select name from t where age > (select avg(age) from t2 where t2.name = t.name)", 2},
+		{"select * from t where age > (select avg(t2.age) from t2 where t.name = t2.name)", 2},
+		// decorrelated into semi- and anti-joins
+		{"select name from t where age in (select age from t2 where t2.name = t.name and t2.age > 30)", 8},
+		{"select name from t where not exists (select name from t2 where t2.name = t.name and t2.age > 40)", 4},
+		{"select name from t where exists (select name from t2 where t2.name = t.name)", 12},
+		{"select name from t where (select count(name) from t2 where t2.name = t.name) = 2", 4},
+		// re-run for each outer tuple
+		{"select name from t where exists (select name from t2 where t2.name = t.name and t2.age > t.age)", 2},
+	}
+	for _, q := range queries {
+		tups := runQueryForTest(t, c, bp, q.sql)
+		if len(tups) != q.expected {
+			t.Errorf("q=%s: expected %d results, got %d", q.sql, q.expected, len(tups))
+		}
+	}
+
+	tups := runQueryForTest(t, c, bp, "select * from t where age > (select avg(age) from t2 where t2.name = t.name)")
+	if len(tups) > 0 && len(tups[0].Fields) != 2 {
+		t.Errorf("select * should not include decorrelated subquery columns, got %d fields", len(tups[0].Fields))
+	}
+}
+
+func TestCorrelatedSubqueryInSelectList(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	tups := runQueryForTest(t, c, bp, "select name, age, (select max(age) from t2 where t2.name = t.name) as m from t")
+	if len(tups) != 12 {
+		t.Fatalf("expected 12 results, got %d", len(tups))
+	}
+	for _, tup := range tups {
+		name := tup.Fields[0].(StringField).Value
+		age := tup.Fields[1].(IntField).Value
+		m := tup.Fields[2].(IntField).Value
+		expected := age
+		switch name {
+		case "riza":
+			expected = 43
+		case "sam":
+			expected = 99
+		}
+		if m != expected {
+			t.Errorf("expected max age %d for %s, got %d", expected, name, m)
+		}
+	}
+}
+
+func TestDecorrelatedScalarSubqueryWithoutMatches(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	//only some tuples of t have tuples of t2 with the same name and age > 40,
+	//so the rest are compared with the aggregate over no tuples
+	for _, agg := range []string{"sum(age)", "count(age)", "max(age)", "avg(age)", "sum(age) + 1"} {
+		sub := fmt.Sprintf("(select %s from t2 where t2.name = t.name and t2.age > 40)", agg)
+		expected := 0
+		for _, tup := range runQueryForTest(t, c, bp, "select age, "+sub+" from t") {
+			if tup.Fields[0].(IntField).Value > tup.Fields[1].(IntField).Value {
+				expected++
+			}
+		}
+		sql := "select name from t where age > " + sub
+		if tups := runQueryForTest(t, c, bp, sql); len(tups) != expected {
+			t.Errorf("q=%s: expected %d results, as when re-run for each tuple, got %d", sql, expected, len(tups))
+		}
+	}
+}
+
+func TestDecorrelatedPlan(t *testing.T) {
+	_, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	planFor := func(sql string) string {
+		_, plan, err := Parse(c, sql)
+		if err != nil {
+			t.Fatalf("failed to parse, q=%s, %s", sql, err.Error())
+		}
+		var sb strings.Builder
+		OutputPhysicalPlan(func(format string, a ...any) { sb.WriteString(fmt.Sprintf(format, a...)) }, plan, "")
+		return sb.String()
+	}
+
+	plan := planFor("select name from t where age > (select avg(age) from t2 where t2.name = t.name)")
+	if !strings.Contains(plan, "Left Outer Join") || strings.Contains(plan, "Correlated") {
+		t.Errorf("expected scalar subquery to be rewritten as an outer join, got plan:\n%s", plan)
+	}
+	plan = planFor("select name from t where exists (select name from t2 where t2.name = t.name)")
+	if !strings.Contains(plan, "Semi Join") || strings.Contains(plan, "Correlated") {
+		t.Errorf("expected EXISTS to be rewritten as a semi-join, got plan:\n%s", plan)
+	}
+	plan = planFor("select name from t where exists (select name from t2 where t2.name = t.name and t2.age > t.age)")
+	if !strings.Contains(plan, "Correlated Semi Join") {
+		t.Errorf("expected non-equality correlation to be re-run per tuple, got plan:\n%s", plan)
+	}
+}
@@ -7,6 +7,9 @@ import (
 type DeleteOp struct {
 	deleteFile DBFile
 	child      Operator
+	returning  bool        // return the deleted tuples rather than their count
+	tableInfo  *Table      // the table of deleteFile, if set
+	bufPool    *BufferPool // holds the modifications until the transaction commits
 }
 
 // Construct a delete operator that deletes the records in the child Operator
@@ -18,18 +21,27 @@ func NewDeleteOp(deleteFile DBFile, child Operator) *DeleteOp {
 	}
 }
 
-// The delete TupleDesc is a one column descriptor with an integer field named "count"
+// Return the deleted tuples, rather than their count, from the iterator.
+func (i *DeleteOp) setReturning() {
+	i.returning = true
+}
+
+// Record the deleted tuples in the statistics of table, that of deleteFile.
+func (i *DeleteOp) setTable(table *Table, bp *BufferPool) {
+	i.tableInfo = table
+	i.bufPool = bp
+}
+
+// The delete TupleDesc is a one column descriptor with an integer field named
+// "count", or the DBFile's descriptor if returning the deleted tuples.
 func (i *DeleteOp) Descriptor() *TupleDesc {
-	return &TupleDesc{
-		Fields: []FieldType{
-			{Fname: "count", Ftype: IntType},
-		},
-	}
+	return dmlDescriptor(i.deleteFile, i.returning)
 }
 
 // Return an iterator that deletes all of the tuples from the child iterator
 // from the DBFile and then returns a one-field tuple with a "count"
-// field indicating the number of tuples that were deleted.
+// field indicating the number of tuples that were deleted (or, if returning,
+// each of the deleted tuples).
 func (dop *DeleteOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 	// Get iterator from child operator
 	childIter, err := dop.child.Iterator(tid)
@@ -38,13 +50,14 @@ func (dop *DeleteOp) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 	}
 
 	// Create closure to track state
-	var returned bool
+	var results func() (*Tuple, error)
 	var count int64 = 0
+	var deleted []*Tuple
 
 	return func() (*Tuple, error) {
-		// If we've already returned the count, we're done
-		if returned {
-			return nil, nil
+		// If we've already deleted the tuples, return the results
+		if results != nil {
+			return results()
 		}
 
 		// Delete all tuples from child iterator
@@ -65,19 +78,14 @@ func (dop *DeleteOp) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 				return nil, fmt.Errorf("failed to delete tuple: %v", err)
 			}
 			count++
+			if dop.returning {
+				deleted = append(deleted, &Tuple{Desc: *dop.Descriptor(), Fields: tuple.Fields})
+			}
 		}
 
-		// Create return tuple with count of deleted records
-		countTuple := &Tuple{
-			Fields: []DBValue{
-				IntField{Value: count},
-			},
-			Desc: *dop.Descriptor(),
-		}
-
-		// Mark as returned so next iteration returns nil
-		returned = true
-
-		return countTuple, nil
+		dop.bufPool.recordModifications(dop.tableInfo, tid, count)
+		// Return the count of deleted records or the records themselves
+		results = dmlResultIter(dop.returning, count, deleted)
+		return results()
 	}, nil
 }
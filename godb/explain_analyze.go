@@ -0,0 +1,141 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EXPLAIN ANALYZE runs a plan and records, for each of its operators, the
+// tuples it returned, the time spent in it and the pages it retrieved from the
+// buffer pool, so that they can be printed alongside the estimates in the
+// plan. While a transaction's plan is being analyzed, the iterators of the
+// plan's operators, which are all wrapped in OperatorCards, are instrumented.
+
+// What an operator did when its plan was run. The time and pages include those
+// of the operator's inputs.
+type operatorMetrics struct {
+	loops   int // number of times the operator's iterator was created
+	rows    int // tuples returned, over all loops
+	time    time.Duration
+	fetched int // pages retrieved from the buffer pool
+	read    int // pages of those that were read from disk
+}
+
+var analyzing = make(map[TransactionID]*BufferPool)
+var analyzingMutex sync.Mutex
+
+// Return the buffer pool of the plan being analyzed as part of tid, or nil if
+// none is.
+func analyzingBufferPool(tid TransactionID) *BufferPool {
+	analyzingMutex.Lock()
+	defer analyzingMutex.Unlock()
+	return analyzing[tid]
+}
+
+// Run plan as part of tid to completion, recording the metrics of each of its
+// operators, which OutputPhysicalPlan then prints; bp is the buffer pool from
+// which the plan's pages are retrieved. Returns the number of tuples the plan
+// returned.
+//
+// Operators that never ran, e.g., the inner input of a join whose outer input
+// is empty, have no metrics.
+func ExplainAnalyze(plan Operator, bp *BufferPool, tid TransactionID) (int, error) {
+	analyzingMutex.Lock()
+	analyzing[tid] = bp
+	analyzingMutex.Unlock()
+	defer func() {
+		analyzingMutex.Lock()
+		delete(analyzing, tid)
+		analyzingMutex.Unlock()
+	}()
+
+	iter, err := plan.Iterator(tid)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			return n, err
+		}
+		if tup == nil {
+			return n, nil
+		}
+		n++
+	}
+}
+
+// Return an iterator over the operator's tuples that records its metrics.
+func (o *OperatorCard) analyzedIterator(bp *BufferPool, tid TransactionID) (func() (*Tuple, error), error) {
+	if o.metrics == nil {
+		o.metrics = &operatorMetrics{}
+	}
+	m := o.metrics
+	m.loops++
+	//the time and pages of a call are those of the operator
+	measure := func() func() {
+		start := time.Now()
+		fetched, read := bp.PageCounts()
+		return func() {
+			m.time += time.Since(start)
+			f, r := bp.PageCounts()
+			m.fetched += f - fetched
+			m.read += r - read
+		}
+	}
+
+	done := measure()
+	iter, err := o.Op.Iterator(tid)
+	done()
+	if err != nil {
+		return nil, err
+	}
+	return func() (*Tuple, error) {
+		done := measure()
+		tup, err := iter()
+		done()
+		if tup != nil {
+			m.rows++
+		}
+		return tup, err
+	}, nil
+}
+
+// Return the actual cardinality of the operator, the average number of tuples
+// it returned per loop, which is what its estimated cardinality estimates.
+func (m *operatorMetrics) card() int {
+	if m.loops == 0 {
+		return 0
+	}
+	return (m.rows + m.loops/2) / m.loops
+}
+
+func (m *operatorMetrics) String() string {
+	return fmt.Sprintf("actual card:%d, loops:%d, time:%v, pages:%d, disk reads:%d", m.card(), m.loops, m.time.Round(time.Microsecond), m.fetched, m.read)
+}
+
+// Return a printf that adds the metrics to the end of the first line printed,
+// which is the operator's; the lines of its inputs are printed as they are.
+// Estimated cardinalities est that are off by more than a factor of 10 are
+// flagged.
+func (m *operatorMetrics) annotate(printf func(format string, a ...any), est int) func(format string, a ...any) {
+	annotated := false
+	return func(format string, a ...any) {
+		if annotated || !strings.HasSuffix(format, "\n") {
+			printf(format, a...)
+			return
+		}
+		annotated = true
+		suffix := m.String()
+		ratio := float64(max(m.card(), 1)) / float64(max(est, 1))
+		if ratio > 10 {
+			suffix += fmt.Sprintf(", underestimated %.0fx", ratio)
+		} else if ratio < 0.1 {
+			suffix += fmt.Sprintf(", overestimated %.0fx", 1/ratio)
+		}
+		printf(strings.TrimSuffix(format, "\n")+" (%s)\n", append(a, suffix)...)
+	}
+}
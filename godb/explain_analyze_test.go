@@ -0,0 +1,78 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExplainAnalyze(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	query := "select t.name, t2.age from t, t2 where t.name = t2.name and t2.age > 40"
+	expected := len(runQueryForTest(t, c, bp, query))
+	_, plan, err := Parse(c, query)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := BeginTransactionForTest(t, bp)
+	n, err := ExplainAnalyze(plan, bp, tid)
+	bp.CommitTransaction(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n != expected {
+		t.Errorf("expected %d tuples, got %d", expected, n)
+	}
+
+	var sb strings.Builder
+	OutputPhysicalPlan(func(format string, a ...any) {
+		sb.WriteString(fmt.Sprintf(format, a...))
+	}, plan, "")
+	lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+	for _, line := range lines {
+		if !strings.Contains(line, "actual card:") {
+			t.Errorf("expected metrics of each operator, got %s", line)
+		}
+	}
+	if root := plan.(*OperatorCard).metrics; root.rows != expected || root.loops != 1 || root.fetched < 2 {
+		t.Errorf("expected the root to return %d tuples in one loop, reading the pages of both tables, got %+v", expected, *root)
+	}
+
+	//the scan of t2 is estimated from its statistics
+	var scan string
+	for _, line := range lines {
+		if strings.Contains(line, "Filter") {
+			scan = line
+		}
+	}
+	if !strings.Contains(scan, "card:6 ") || !strings.Contains(scan, "actual card:6,") {
+		t.Errorf("expected the filter of t2 to be estimated and to return 6 tuples, got %s", scan)
+	}
+
+	//plans that weren't analyzed only have estimates
+	_, plan, _ = Parse(c, query)
+	sb.Reset()
+	OutputPhysicalPlan(func(format string, a ...any) {
+		sb.WriteString(fmt.Sprintf(format, a...))
+	}, plan, "")
+	if strings.Contains(sb.String(), "actual") {
+		t.Errorf("expected no metrics of a plan that wasn't analyzed, got\n%s", sb.String())
+	}
+
+	//estimates that are off by more than a factor of 10 are flagged
+	for _, e := range []struct {
+		est  int
+		flag string
+	}{{10, "underestimated 50x"}, {20000, "overestimated 40x"}, {100, ""}} {
+		m := &operatorMetrics{loops: 2, rows: 1000}
+		m.annotate(func(format string, a ...any) {
+			line := fmt.Sprintf(format, a...)
+			if e.flag != "" && !strings.Contains(line, e.flag) || e.flag == "" && strings.Contains(line, "estimated") {
+				t.Errorf("estimate %d of 500: expected %q, got %s", e.est, e.flag, line)
+			}
+		}, e.est)("Filter, card:%d\n", e.est)
+	}
+}
@@ -0,0 +1,198 @@
+package godb
+
+// Simplification of expressions before they are evaluated: subexpressions
+// whose arguments are all constants are evaluated once, when the plan is
+// made, rather than for each tuple (constant folding), conditions that are
+// always true or false are simplified, and comparisons are normalized so that
+// constants are on the right, as filters and selectivity estimation expect.
+//
+// Functions that may return different results for the same arguments (see
+// [FuncExpr.volatile]), such as rand and epoch, aren't folded. Neither are
+// expressions whose evaluation fails, e.g., 1 / 0, so that the error is
+// returned only if the expression is actually evaluated.
+
+// Return true if e is a constant.
+func isConstExpr(e Expr) bool {
+	_, ok := e.(*ConstExpr)
+	return ok
+}
+
+// Return the constant value of e, whose arguments are all constants, or e if
+// evaluating it fails.
+func evalConstant(e Expr) Expr {
+	v, err := e.EvalExpr(nil)
+	if err != nil {
+		return e
+	}
+	return &ConstExpr{v, e.GetExprType().Ftype}
+}
+
+// Return the constant 1 if holds and 0 otherwise, the values of conditions.
+func boolConst(holds bool) *ConstExpr {
+	if holds {
+		return &ConstExpr{IntField{1}, IntType}
+	}
+	return &ConstExpr{IntField{0}, IntType}
+}
+
+// Return the truth of the constant condition e, and whether e is a constant
+// condition.
+func constTruth(e Expr) (holds bool, ok bool) {
+	c, ok := e.(*ConstExpr)
+	if !ok {
+		return false, false
+	}
+	holds, err := isTrue(c.val)
+	return holds, err == nil
+}
+
+// Return the simplified equivalent of e. The arguments of e are simplified
+// first, so that, e.g., 1 + 2 * 3 is folded into 7.
+func simplifyExpr(e Expr) Expr {
+	switch e := e.(type) {
+	case *FuncExpr:
+		args := make([]*Expr, len(e.args))
+		allConst := true
+		for i, arg := range e.args {
+			simplified := simplifyExpr(*arg)
+			args[i] = &simplified
+			allConst = allConst && isConstExpr(simplified)
+		}
+		f := &FuncExpr{e.op, args}
+		if allConst && !f.volatile() {
+			return evalConstant(f)
+		}
+		return f
+	case *CondExpr:
+		return simplifyCond(e)
+	case *CaseExpr:
+		return simplifyCase(e)
+	case *CoalesceExpr:
+		args := simplifyExprs(e.args)
+		c := &CoalesceExpr{args, e.ftype}
+		//arguments after the first constant that isn't the zero value are
+		//never evaluated
+		for i, arg := range args {
+			if ce, ok := arg.(*ConstExpr); ok && !isZeroValue(ce.val) {
+				c.args = args[:i+1]
+				break
+			}
+		}
+		if allConstExprs(c.args) {
+			return evalConstant(c)
+		}
+		return c
+	case *NullIfExpr:
+		n := &NullIfExpr{simplifyExpr(e.left), simplifyExpr(e.right), e.ftype}
+		if isConstExpr(n.left) && isConstExpr(n.right) {
+			return evalConstant(n)
+		}
+		return n
+	case *CastExpr:
+		c := &CastExpr{simplifyExpr(e.expr), e.to}
+		if isConstExpr(c.expr) {
+			return evalConstant(c)
+		}
+		return c
+	}
+	return e
+}
+
+// Return the simplified equivalents of exprs.
+func simplifyExprs(exprs []Expr) []Expr {
+	simplified := make([]Expr, len(exprs))
+	for i, e := range exprs {
+		simplified[i] = simplifyExpr(e)
+	}
+	return simplified
+}
+
+// Return true if all of exprs are constants.
+func allConstExprs(exprs []Expr) bool {
+	for _, e := range exprs {
+		if !isConstExpr(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// Return the simplified equivalent of the condition c. Comparisons of
+// constants are evaluated, and comparisons of a constant to another
+// expression are flipped so that the constant is on the right. Conjunctions
+// and disjunctions drop their arguments that are always true (or false), and
+// are constant if any argument is always false (or true).
+func simplifyCond(c *CondExpr) Expr {
+	args := simplifyExprs(c.args)
+	switch c.kind {
+	case CondCompare:
+		if allConstExprs(args) {
+			return evalConstant(&CondExpr{c.kind, c.op, args, c.matcher})
+		}
+		//the operands of pattern matching can't be swapped
+		if isConstExpr(args[0]) && !c.op.isPattern() {
+			return &CondExpr{c.kind, c.op.flip(), []Expr{args[1], args[0]}, nil}
+		}
+	case CondNot:
+		if holds, ok := constTruth(args[0]); ok {
+			return boolConst(!holds)
+		}
+	case CondAnd, CondOr:
+		//a conjunction is false if any argument is false, and a disjunction
+		//true if any is true
+		decisive := c.kind == CondOr
+		var remaining []Expr
+		for _, arg := range args {
+			holds, ok := constTruth(arg)
+			if !ok {
+				remaining = append(remaining, arg)
+			} else if holds == decisive {
+				return boolConst(decisive)
+			}
+		}
+		switch {
+		case len(remaining) == 0:
+			return boolConst(!decisive)
+		case len(remaining) == 1:
+			//a condition is 0 or 1, as the conjunction or disjunction is,
+			//unlike other integers
+			if _, ok := remaining[0].(*CondExpr); ok {
+				return remaining[0]
+			}
+		case len(remaining) < len(args):
+			args = remaining
+		}
+	}
+	return &CondExpr{c.kind, c.op, args, c.matcher}
+}
+
+// Return the simplified equivalent of the CASE expression c, without the
+// conditions that are always false, and without those after the first that is
+// always true.
+func simplifyCase(c *CaseExpr) Expr {
+	var conds, results []Expr
+	elseExpr := c.elseExpr
+	if elseExpr != nil {
+		elseExpr = simplifyExpr(elseExpr)
+	}
+	for i, cond := range c.conds {
+		cond = simplifyExpr(cond)
+		holds, ok := constTruth(cond)
+		if ok && !holds {
+			continue
+		}
+		if ok && holds {
+			elseExpr = simplifyExpr(c.results[i])
+			break
+		}
+		conds = append(conds, cond)
+		results = append(results, simplifyExpr(c.results[i]))
+	}
+	if len(conds) == 0 {
+		if elseExpr == nil {
+			return &ConstExpr{zeroValue(c.ftype), c.ftype}
+		}
+		return elseExpr
+	}
+	return &CaseExpr{conds, results, elseExpr, c.ftype}
+}
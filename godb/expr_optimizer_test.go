@@ -0,0 +1,149 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSimplifyExpr(t *testing.T) {
+	td, t1, _, _, _, _ := makeTestVars(t)
+	var name, age Expr = &FieldExpr{td.Fields[0]}, &FieldExpr{td.Fields[1]}
+	intConst := func(i int64) Expr { return &ConstExpr{IntField{i}, IntType} }
+	strConst := func(s string) Expr { return &ConstExpr{StringField{s}, StringType} }
+	call := func(op string, args ...Expr) Expr {
+		ptrs := make([]*Expr, len(args))
+		for i := range args {
+			ptrs[i] = &args[i]
+		}
+		return &FuncExpr{op, ptrs}
+	}
+	mustExpr := func(e Expr, err error) Expr {
+		t.Helper()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		return e
+	}
+	compare := func(l Expr, op BoolOp, r Expr) Expr { return mustExpr(NewCondExpr(CondCompare, op, []Expr{l, r})) }
+	old := compare(age, OpGt, intConst(40))
+
+	exprs := []struct {
+		expr     Expr
+		expected string
+	}{
+		// constants are folded, even within expressions that aren't constant
+		{call("+", intConst(1), call("*", intConst(2), intConst(3))), "{7}"},
+		{call("+", age, call("*", intConst(2), intConst(3))), "+(age,{6},)"},
+		{call("upper", call("concat", strConst("a"), strConst("b"))), "{AB}"},
+		{mustExpr(NewCastExpr(intConst(7), StringType)), "{7}"},
+		{mustExpr(NewCoalesceExpr([]Expr{name, strConst("x"), name})), "coalesce(name,{x})"},
+		{mustExpr(NewNullIfExpr(strConst("x"), strConst("x"))), "{}"},
+		// volatile functions and expressions whose evaluation fails aren't
+		{call("rand"), "rand()"},
+		{call("+", call("epoch"), intConst(1)), "+(epoch(),{1},)"},
+		{call("/", intConst(1), intConst(0)), "/({1},{0},)"},
+		// comparisons of constants are evaluated, and constants are moved
+		// to the right of comparisons
+		{compare(intConst(1), OpEq, intConst(1)), "{1}"},
+		{compare(strConst("sam"), OpLike, strConst("s%")), "{1}"},
+		{compare(intConst(30), OpLt, age), "age > {30}"},
+		{compare(strConst("s%"), OpLike, name), "{s%}  LIKE  name"},
+		// conditions that are always true or false
+		{mustExpr(NewCondExpr(CondAnd, 0, []Expr{compare(intConst(1), OpEq, intConst(1)), old})), "age > {40}"},
+		{mustExpr(NewCondExpr(CondAnd, 0, []Expr{compare(intConst(1), OpEq, intConst(2)), old})), "{0}"},
+		{mustExpr(NewCondExpr(CondOr, 0, []Expr{old, compare(intConst(1), OpEq, intConst(1))})), "{1}"},
+		{mustExpr(NewCondExpr(CondOr, 0, []Expr{old, compare(intConst(1), OpEq, intConst(2)), compare(name, OpEq, strConst("sam"))})), "(age > {40}) or (name = {sam})"},
+		{mustExpr(NewCondExpr(CondNot, 0, []Expr{compare(intConst(1), OpEq, intConst(2))})), "{1}"},
+		{mustExpr(NewCaseExpr([]Expr{compare(intConst(1), OpEq, intConst(2)), old, intConst(1), compare(name, OpEq, strConst("sam"))}, []Expr{intConst(1), intConst(2), intConst(3), intConst(4)}, intConst(5))), "case when age > {40} then {2} else {3} end"},
+		{mustExpr(NewCaseExpr([]Expr{compare(intConst(1), OpEq, intConst(2))}, []Expr{age}, nil)), "{0}"},
+	}
+	for i, e := range exprs {
+		simplified := simplifyExpr(e.expr)
+		if got := exprToStr(simplified); got != e.expected {
+			t.Errorf("expression %d: expected %s, got %s", i, e.expected, got)
+		}
+		// simplifying doesn't change the value, unless evaluation fails
+		v1, err1 := e.expr.EvalExpr(&t1)
+		v2, err2 := simplified.EvalExpr(&t1)
+		if (err1 == nil) != (err2 == nil) || (err1 == nil && e.expected != "rand()" && v1 != v2) {
+			t.Errorf("expression %d: expected %v, got %v", i, v1, v2)
+		}
+	}
+}
+
+func TestConstantPredicates(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	explain := func(q string) string {
+		t.Helper()
+		_, plan, err := Parse(c, q)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %s", q, err.Error())
+		}
+		var sb strings.Builder
+		OutputPhysicalPlan(func(format string, a ...any) {
+			sb.WriteString(fmt.Sprintf(format, a...))
+		}, plan, "")
+		return sb.String()
+	}
+
+	queries := []struct {
+		query    string
+		expected int
+		// the operator in the plan, and whether it should be there
+		op      string
+		present bool
+	}{
+		{"select name from t where 1 = 1", 12, "Filter", false},
+		{"select name from t where age > 30 and 1 + 1 = 2", 8, "Filter", true},
+		{"select name from t where 1 = 0", 0, "Heap Scan", false},
+		{"select name from t where age > 30 and 'a' like 'b%'", 0, "Heap Scan", false},
+		{"select count(*) from t where 2 < 1", 1, "Heap Scan", false},
+		{"select name from t where case when 1 = 1 then 'x' else name end = 'x'", 12, "Filter", false},
+		{"select name from t where 30 < age", 8, "Filter", true},
+		{"select name from t where 10 * 3 >= age", 4, "Filter", true},
+		{"select name from t where 'sam' = name", 2, "Filter", true},
+	}
+	for _, q := range queries {
+		if tups := runQueryForTest(t, c, bp, q.query); len(tups) != q.expected {
+			t.Errorf("expected %d tuples for %s, got %d", q.expected, q.query, len(tups))
+		}
+		if plan := explain(q.query); strings.Contains(plan, q.op) != q.present {
+			t.Errorf("expected %s in the plan of %s to be %v, got\n%s", q.op, q.query, q.present, plan)
+		}
+	}
+
+	// constants are folded, and moved to the right of filters
+	plan := explain("select name, age + 2 * 3 from t where 10 + 20 < age limit 1 + 1")
+	for _, s := range []string{"t.age > {30}", "+(t.age,{6},)", "Limit {2}"} {
+		if !strings.Contains(plan, s) {
+			t.Errorf("expected %s in the plan, got\n%s", s, plan)
+		}
+	}
+	// volatile functions are evaluated for each tuple
+	tups := runQueryForTest(t, c, bp, "select rand() from t")
+	distinct := make(map[int64]bool)
+	for _, tup := range tups {
+		distinct[tup.Fields[0].(IntField).Value] = true
+	}
+	if len(distinct) < 2 {
+		t.Errorf("expected different random numbers for each tuple")
+	}
+
+	for _, q := range []string{
+		"select name from t where 1 / 0 = 1",
+		"select name from t where rand() = 1",
+	} {
+		if _, _, err := Parse(c, q); err == nil {
+			t.Errorf("expected error for %s", q)
+		}
+	}
+	// deleting with a predicate that never holds deletes nothing
+	runQueryForTest(t, c, bp, "delete from t where 1 = 2")
+	if tups := runQueryForTest(t, c, bp, "select name from t"); len(tups) != 12 {
+		t.Errorf("expected 12 tuples after deleting none, got %d", len(tups))
+	}
+}
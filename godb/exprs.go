@@ -3,6 +3,9 @@ package godb
 import (
 	"fmt"
 	"math/rand"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -53,10 +56,19 @@ type FuncExpr struct {
 	args []*Expr
 }
 
+// Return the types of the function's arguments.
+func (f *FuncExpr) argTypes() []DBType {
+	types := make([]DBType, len(f.args))
+	for i, arg := range f.args {
+		types[i] = (*arg).GetExprType().Ftype
+	}
+	return types
+}
+
 func (f *FuncExpr) GetExprType() FieldType {
-	fType, exists := funcs[f.op]
+	fType, err := lookupFunc(f.op, f.argTypes())
 	//todo return err
-	if !exists {
+	if err != nil {
 		return FieldType{f.op, "", IntType}
 	}
 	ft := FieldType{f.op, "", IntType}
@@ -70,130 +82,346 @@ func (f *FuncExpr) GetExprType() FieldType {
 
 }
 
+// Return true if the function may return different results for the same
+// arguments, e.g., rand, so that calls to it must not be evaluated only once.
+func (f *FuncExpr) volatile() bool {
+	fType, err := lookupFunc(f.op, f.argTypes())
+	return err != nil || fType.volatile
+}
+
+// A FunctionSignature describes the arguments and result of a function.
+type FunctionSignature struct {
+	ArgTypes []DBType
+	// If true, the last of ArgTypes may be repeated any number of times,
+	// including zero.
+	Variadic bool
+	OutType  DBType
+	// If true, the function may return different results when called with the
+	// same arguments (e.g., a random number or the current time), so calls to
+	// it must not be evaluated once and reused, e.g., by constant folding.
+	Volatile bool
+}
+
+// A ScalarFunction computes the value of a function given the values of its
+// arguments, which are of the types of the function's signature.
+type ScalarFunction func(args []DBValue) (DBValue, error)
+
+// One implementation (i.e., overload) of a function.
 type FuncType struct {
 	argTypes []DBType
+	variadic bool
 	outType  DBType
-	f        func([]any) any
+	volatile bool
+	f        ScalarFunction
+}
+
+// Return true if the function accepts arguments of the given types. Arguments
+// of UnknownType are accepted as any type.
+func (fType *FuncType) accepts(types []DBType) bool {
+	n := len(fType.argTypes)
+	if len(types) != n && !(fType.variadic && len(types) >= n-1) {
+		return false
+	}
+	for i, t := range types {
+		want := fType.argTypes[min(i, n-1)]
+		if t != want && t != UnknownType {
+			return false
+		}
+	}
+	return true
+}
+
+// Return the string describing the function's arguments, e.g., "(int,string...)".
+func (fType *FuncType) argString() string {
+	args := "("
+	for i, a := range fType.argTypes {
+		if i > 0 {
+			args = args + ","
+		}
+		switch a {
+		case IntType:
+			args = args + "int"
+		case StringType:
+			args = args + "string"
+		}
+	}
+	if fType.variadic {
+		args = args + "..."
+	}
+	return args + ")"
+}
+
+// Adapt a built-in function over the int64 and string values of its arguments
+// to a ScalarFunction with result type outType.
+func builtinFunc(outType DBType, f func([]any) (any, error)) ScalarFunction {
+	return func(args []DBValue) (DBValue, error) {
+		vals := make([]any, len(args))
+		for i, arg := range args {
+			switch arg := arg.(type) {
+			case IntField:
+				vals[i] = arg.Value
+			case StringField:
+				vals[i] = arg.Value
+			}
+		}
+		result, err := f(vals)
+		if err != nil {
+			return nil, err
+		}
+		switch outType {
+		case IntType:
+			if v, ok := result.(int64); ok {
+				return IntField{v}, nil
+			}
+		case StringType:
+			if v, ok := result.(string); ok {
+				return StringField{v}, nil
+			}
+		}
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("function returned %T, not %v", result, outType)}
+	}
+}
+
+// Return the implementation of a built-in function.
+func newBuiltin(argTypes []DBType, outType DBType, f func([]any) (any, error)) *FuncType {
+	return &FuncType{argTypes: argTypes, outType: outType, f: builtinFunc(outType, f)}
+}
+
+// Return the implementation of a built-in function that may return different
+// results for the same arguments.
+func newVolatileBuiltin(argTypes []DBType, outType DBType, f func([]any) (any, error)) *FuncType {
+	fType := newBuiltin(argTypes, outType, f)
+	fType.volatile = true
+	return fType
+}
+
+// Return the implementation of a built-in function whose last argument may be
+// repeated any number of times.
+func newVariadicBuiltin(argTypes []DBType, outType DBType, f func([]any) (any, error)) *FuncType {
+	fType := newBuiltin(argTypes, outType, f)
+	fType.variadic = true
+	return fType
 }
 
-var funcs = map[string]FuncType{
+// The implementations of each function, by name.
+var funcs = map[string][]*FuncType{
 	//note should all be lower case
-	"+":                     {[]DBType{IntType, IntType}, IntType, addFunc},
-	"-":                     {[]DBType{IntType, IntType}, IntType, minusFunc},
-	"*":                     {[]DBType{IntType, IntType}, IntType, timesFunc},
-	"/":                     {[]DBType{IntType, IntType}, IntType, divFunc},
-	"mod":                   {[]DBType{IntType, IntType}, IntType, modFunc},
-	"rand":                  {[]DBType{}, IntType, randIntFunc},
-	"sq":                    {[]DBType{IntType}, IntType, sqFunc},
-	"getsubstr":             {[]DBType{StringType, IntType, IntType}, StringType, subStrFunc},
-	"epoch":                 {[]DBType{}, IntType, epoch},
-	"datetimestringtoepoch": {[]DBType{StringType}, IntType, dateTimeToEpoch},
-	"datestringtoepoch":     {[]DBType{StringType}, IntType, dateToEpoch},
-	"epochtodatetimestring": {[]DBType{IntType}, StringType, dateString},
-	"imin":                  {[]DBType{IntType, IntType}, IntType, minFunc},
-	"imax":                  {[]DBType{IntType, IntType}, IntType, maxFunc},
+	"+":                     {newBuiltin([]DBType{IntType, IntType}, IntType, addFunc)},
+	"-":                     {newBuiltin([]DBType{IntType, IntType}, IntType, minusFunc)},
+	"*":                     {newBuiltin([]DBType{IntType, IntType}, IntType, timesFunc)},
+	"/":                     {newBuiltin([]DBType{IntType, IntType}, IntType, divFunc)},
+	"mod":                   {newBuiltin([]DBType{IntType, IntType}, IntType, modFunc)},
+	"rand":                  {newVolatileBuiltin([]DBType{}, IntType, randIntFunc)},
+	"sq":                    {newBuiltin([]DBType{IntType}, IntType, sqFunc)},
+	"getsubstr":             {newBuiltin([]DBType{StringType, IntType, IntType}, StringType, subStrFunc)},
+	"epoch":                 {newVolatileBuiltin([]DBType{}, IntType, epoch)},
+	"datetimestringtoepoch": {newBuiltin([]DBType{StringType}, IntType, dateTimeToEpoch)},
+	"datestringtoepoch":     {newBuiltin([]DBType{StringType}, IntType, dateToEpoch)},
+	"epochtodatetimestring": {newBuiltin([]DBType{IntType}, StringType, dateString)},
+	"imin":                  {newBuiltin([]DBType{IntType, IntType}, IntType, minFunc)},
+	"imax":                  {newBuiltin([]DBType{IntType, IntType}, IntType, maxFunc)},
+	// string functions (see string_funcs.go)
+	"upper":  {newBuiltin([]DBType{StringType}, StringType, upperFunc)},
+	"lower":  {newBuiltin([]DBType{StringType}, StringType, lowerFunc)},
+	"length": {newBuiltin([]DBType{StringType}, IntType, lengthFunc)},
+	"trim": {
+		newBuiltin([]DBType{StringType}, StringType, trimFunc),
+		newBuiltin([]DBType{StringType, StringType}, StringType, trimFunc),
+	},
+	"ltrim": {
+		newBuiltin([]DBType{StringType}, StringType, ltrimFunc),
+		newBuiltin([]DBType{StringType, StringType}, StringType, ltrimFunc),
+	},
+	"rtrim": {
+		newBuiltin([]DBType{StringType}, StringType, rtrimFunc),
+		newBuiltin([]DBType{StringType, StringType}, StringType, rtrimFunc),
+	},
+	"replace":    {newBuiltin([]DBType{StringType, StringType, StringType}, StringType, replaceFunc)},
+	"split_part": {newBuiltin([]DBType{StringType, StringType, IntType}, StringType, splitPartFunc)},
+	"concat":     {newVariadicBuiltin([]DBType{StringType}, StringType, concatFunc)},
+	"position":   {newBuiltin([]DBType{StringType, StringType}, IntType, positionFunc)},
+	"lpad": {
+		newBuiltin([]DBType{StringType, IntType}, StringType, lpadFunc),
+		newBuiltin([]DBType{StringType, IntType, StringType}, StringType, lpadFunc),
+	},
+	"rpad": {
+		newBuiltin([]DBType{StringType, IntType}, StringType, rpadFunc),
+		newBuiltin([]DBType{StringType, IntType, StringType}, StringType, rpadFunc),
+	},
+	"left":  {newBuiltin([]DBType{StringType, IntType}, StringType, leftFunc)},
+	"right": {newBuiltin([]DBType{StringType, IntType}, StringType, rightFunc)},
+}
+
+// The names of the conditional expressions that are called like functions
+// (see cond_exprs.go), which can't be the names of functions or aggregates.
+var condFuncNames = map[string]bool{"coalesce": true, "nullif": true}
+
+// Return the implementation of the function name that accepts arguments of the
+// given types. If several do, the first registered is returned.
+func lookupFunc(name string, types []DBType) (*FuncType, error) {
+	overloads, exists := funcs[name]
+	if !exists {
+		return nil, GoDBError{ParseError, fmt.Sprintf("unknown function %s", name)}
+	}
+	for _, fType := range overloads {
+		if fType.accepts(types) {
+			return fType, nil
+		}
+	}
+	sigs := ""
+	for i, fType := range overloads {
+		if i > 0 {
+			sigs = sigs + ", "
+		}
+		sigs = sigs + name + fType.argString()
+	}
+	return nil, GoDBError{TypeMismatchError, fmt.Sprintf("no function %s accepts the given arguments (expected %s)", name, sigs)}
+}
+
+// Register a user-defined scalar function, so that queries can call it as
+// name(arg1, ..., argN). A function may be registered several times with
+// different argument types (i.e., overloaded); calls use the first registered
+// implementation that accepts the types of the arguments. Names are case
+// insensitive.
+//
+// Returns an error if name is not a valid identifier or is the name of an
+// aggregate, if the signature has types other than IntType and StringType, or
+// if an implementation with the same argument types is already registered.
+// Registering functions is not safe concurrently with parsing or running
+// queries.
+func RegisterFunction(name string, sig FunctionSignature, f ScalarFunction) error {
+	name = strings.ToLower(name)
+	if !isIdentifier(name) {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("invalid function name %q", name)}
+	}
+	if _, ok := aggFuncs[name]; ok {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("%s is already the name of an aggregate", name)}
+	}
+	if condFuncNames[name] {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("%s is already the name of a conditional expression", name)}
+	}
+	if f == nil || (sig.Variadic && len(sig.ArgTypes) == 0) {
+		return GoDBError{IllegalOperationError, fmt.Sprintf("invalid signature or implementation for function %s", name)}
+	}
+	for _, t := range append([]DBType{sig.OutType}, sig.ArgTypes...) {
+		if t != IntType && t != StringType {
+			return GoDBError{TypeMismatchError, fmt.Sprintf("function %s has an argument or result of unsupported type %v", name, t)}
+		}
+	}
+	fType := &FuncType{
+		argTypes: append([]DBType{}, sig.ArgTypes...),
+		variadic: sig.Variadic,
+		outType:  sig.OutType,
+		volatile: sig.Volatile,
+		f:        f,
+	}
+	for _, other := range funcs[name] {
+		if other.variadic == fType.variadic && slices.Equal(other.argTypes, fType.argTypes) {
+			return GoDBError{IllegalOperationError, fmt.Sprintf("function %s%s is already registered", name, fType.argString())}
+		}
+	}
+	funcs[name] = append(funcs[name], fType)
+	return nil
 }
 
 func ListOfFunctions() string {
+	var names []string
+	for name := range funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 	fList := ""
-	for name, f := range funcs {
-		args := "("
-		argList := f.argTypes
-		hasArg := false
-		for _, a := range argList {
-			if hasArg {
-				args = args + ","
-			}
-			switch a {
-			case IntType:
-				args = args + "int"
-			case StringType:
-				args = args + "string"
-			}
-			hasArg = true
+	for _, name := range names {
+		for _, f := range funcs[name] {
+			fList = fList + "\t" + name + f.argString() + "\n"
 		}
-		args = args + ")"
-		fList = fList + "\t" + name + args + "\n"
 	}
 	return fList
 }
-func minFunc(args []any) any {
+
+func minFunc(args []any) (any, error) {
 	first := args[0].(int64)
 	second := args[1].(int64)
 	if first < second {
-		return first
+		return first, nil
 	}
-	return second
+	return second, nil
 }
 
-func maxFunc(args []any) any {
+func maxFunc(args []any) (any, error) {
 	first := args[0].(int64)
 	second := args[1].(int64)
 	if first >= second {
-		return first
+		return first, nil
 	}
-	return second
+	return second, nil
 }
 
-func dateTimeToEpoch(args []any) any {
+func dateTimeToEpoch(args []any) (any, error) {
 	inString := args[0].(string)
 	tt, err := time.Parse(time.UnixDate, inString)
 	if err != nil {
-		return int64(0)
+		return int64(0), nil
 	}
-	return int64(time.Time.Unix(tt))
+	return int64(time.Time.Unix(tt)), nil
 }
 
-func dateToEpoch(args []any) any {
+func dateToEpoch(args []any) (any, error) {
 	inString := args[0].(string)
 	tt, err := time.Parse("2006-01-02", inString)
 	if err != nil {
-		return int64(0)
+		return int64(0), nil
 	}
-	return int64(time.Time.Unix(tt))
+	return int64(time.Time.Unix(tt)), nil
 }
 
-func dateString(args []any) any {
+func dateString(args []any) (any, error) {
 	unixTime := args[0].(int64)
 	t := time.Unix(unixTime, 0)
 	strDate := t.Format(time.UnixDate)
-	return strDate
+	return strDate, nil
 }
 
-func epoch(args []any) any {
+func epoch(args []any) (any, error) {
 	t := time.Now()
-	return time.Time.Unix(t)
+	return time.Time.Unix(t), nil
 }
 
-func randIntFunc(args []any) any {
-	return int64(rand.Int())
+func randIntFunc(args []any) (any, error) {
+	return int64(rand.Int()), nil
 }
 
-func modFunc(args []any) any {
-	return args[0].(int64) % args[1].(int64)
+func modFunc(args []any) (any, error) {
+	if args[1].(int64) == 0 {
+		return nil, GoDBError{IllegalOperationError, "division by zero in mod"}
+	}
+	return args[0].(int64) % args[1].(int64), nil
 }
 
-func divFunc(args []any) any {
-	return args[0].(int64) / args[1].(int64)
+func divFunc(args []any) (any, error) {
+	if args[1].(int64) == 0 {
+		return nil, GoDBError{IllegalOperationError, "division by zero"}
+	}
+	return args[0].(int64) / args[1].(int64), nil
 }
 
-func timesFunc(args []any) any {
-	return args[0].(int64) * args[1].(int64)
+func timesFunc(args []any) (any, error) {
+	return args[0].(int64) * args[1].(int64), nil
 }
 
-func minusFunc(args []any) any {
-	return args[0].(int64) - args[1].(int64)
+func minusFunc(args []any) (any, error) {
+	return args[0].(int64) - args[1].(int64), nil
 }
 
-func addFunc(args []any) any {
-	return args[0].(int64) + args[1].(int64)
+func addFunc(args []any) (any, error) {
+	return args[0].(int64) + args[1].(int64), nil
 }
 
-func sqFunc(args []any) any {
-	return args[0].(int64) * args[0].(int64)
+func sqFunc(args []any) (any, error) {
+	return args[0].(int64) * args[0].(int64), nil
 }
 
-func subStrFunc(args []any) any {
+func subStrFunc(args []any) (any, error) {
 	stringVal := args[0].(string)
 	start := args[1].(int64)
 	numChars := args[2].(int64)
@@ -207,45 +435,50 @@ func subStrFunc(args []any) any {
 		substr = stringVal[start : start+numChars]
 	}
 
-	return substr
+	return substr, nil
 }
 
 func (f *FuncExpr) EvalExpr(t *Tuple) (DBValue, error) {
-	fType, exists := funcs[f.op]
-	if !exists {
-		return nil, GoDBError{ParseError, fmt.Sprintf("unknown function %s", f.op)}
-	}
-	if len(f.args) != len(fType.argTypes) {
-		return nil, GoDBError{ParseError, fmt.Sprintf("function %s expected %d args", f.op, len(fType.argTypes))}
-	}
-	argvals := make([]any, len(fType.argTypes))
-	for i, argType := range fType.argTypes {
-		arg := *f.args[i]
-		if arg.GetExprType().Ftype != argType {
-			typeName := "string"
-			switch argType {
-			case IntType:
-				typeName = "int"
-			}
-			return nil, GoDBError{ParseError, fmt.Sprintf("function %s expected arg of type %s", f.op, typeName)}
-		}
-		val, err := arg.EvalExpr(t)
+	fType, err := lookupFunc(f.op, f.argTypes())
+	if err != nil {
+		return nil, err
+	}
+	argvals := make([]DBValue, len(f.args))
+	for i, arg := range f.args {
+		val, err := (*arg).EvalExpr(t)
 		if err != nil {
 			return nil, err
 		}
-		switch argType {
-		case IntType:
-			argvals[i] = val.(IntField).Value
-		case StringType:
-			argvals[i] = val.(StringField).Value
+		// check the values are of the declared types, so that functions
+		// can assume so
+		want := fType.argTypes[min(i, len(fType.argTypes)-1)]
+		switch val.(type) {
+		case IntField:
+			if want == IntType {
+				argvals[i] = val
+			}
+		case StringField:
+			if want == StringType {
+				argvals[i] = val
+			}
+		}
+		if argvals[i] == nil {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("function %s expected arg %d of type %v, got %v", f.op, i+1, want, val)}
 		}
 	}
-	result := fType.f(argvals)
-	switch fType.outType {
-	case IntType:
-		return IntField{result.(int64)}, nil
-	case StringType:
-		return StringField{result.(string)}, nil
+	result, err := fType.f(argvals)
+	if err != nil {
+		return nil, err
+	}
+	switch result.(type) {
+	case IntField:
+		if fType.outType == IntType {
+			return result, nil
+		}
+	case StringField:
+		if fType.outType == StringType {
+			return result, nil
+		}
 	}
-	return nil, GoDBError{ParseError, "unknown result type in function"}
+	return nil, GoDBError{TypeMismatchError, fmt.Sprintf("function %s returned %v, not a value of type %v", f.op, result, fType.outType)}
 }
@@ -0,0 +1,131 @@
+package godb
+
+import (
+	"strings"
+	"testing"
+)
+
+func registerFunctionForTest(t *testing.T, name string, sig FunctionSignature, f ScalarFunction) {
+	t.Helper()
+	if err := RegisterFunction(name, sig, f); err != nil {
+		t.Fatalf(err.Error())
+	}
+	t.Cleanup(func() { delete(funcs, strings.ToLower(name)) })
+}
+
+// Run the query, returning the error getting or iterating through its results,
+// if any.
+func queryErrorForTest(t *testing.T, c *Catalog, bp *BufferPool, query string) error {
+	t.Helper()
+	_, plan, err := Parse(c, query)
+	if err != nil {
+		return err
+	}
+	tid := BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	iter, err := plan.Iterator(tid)
+	if err != nil {
+		return err
+	}
+	for {
+		tup, err := iter()
+		if err != nil || tup == nil {
+			return err
+		}
+	}
+}
+
+func TestRegisterFunction(t *testing.T) {
+	// a variadic function
+	registerFunctionForTest(t, "total", FunctionSignature{ArgTypes: []DBType{IntType}, Variadic: true, OutType: IntType},
+		func(args []DBValue) (DBValue, error) {
+			var sum int64
+			for _, a := range args {
+				sum += a.(IntField).Value
+			}
+			return IntField{sum}, nil
+		})
+	// an overloaded function
+	registerFunctionForTest(t, "Kind_Of", FunctionSignature{ArgTypes: []DBType{IntType}, OutType: StringType},
+		func(args []DBValue) (DBValue, error) { return StringField{"int"}, nil })
+	if err := RegisterFunction("kind_of", FunctionSignature{ArgTypes: []DBType{StringType}, OutType: StringType},
+		func(args []DBValue) (DBValue, error) {
+			return StringField{"string " + args[0].(StringField).Value}, nil
+		}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	// functions that fail
+	registerFunctionForTest(t, "fail", FunctionSignature{OutType: IntType},
+		func(args []DBValue) (DBValue, error) { return nil, GoDBError{IllegalOperationError, "failed"} })
+	registerFunctionForTest(t, "wrong_type", FunctionSignature{OutType: IntType},
+		func(args []DBValue) (DBValue, error) { return StringField{"not an int"}, nil })
+
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	tups := runQueryForTest(t, c, bp, "select total(age), total(age, age, 1), total(), kind_of(age), kind_of(name) from t where name = 'bill'")
+	expected := []DBValue{IntField{30}, IntField{61}, IntField{0}, StringField{"int"}, StringField{"string bill"}}
+	for i, e := range expected {
+		if tups[0].Fields[i] != e {
+			t.Errorf("expected %v for expression %d, got %v", e, i, tups[0].Fields[i])
+		}
+	}
+
+	for _, sql := range []string{
+		"select total(name) from t",
+		"select kind_of(age, age) from t",
+		"select no_such_function(age) from t",
+		"select fail() from t",
+		"select wrong_type() from t",
+		"select age / 0 from t",
+		"select mod(age, age - age) from t",
+	} {
+		if err := queryErrorForTest(t, c, bp, sql); err == nil {
+			t.Errorf("q=%s: expected error", sql)
+		}
+	}
+
+	f := func(args []DBValue) (DBValue, error) { return IntField{0}, nil }
+	invalid := []struct {
+		name string
+		sig  FunctionSignature
+	}{
+		{"total", FunctionSignature{ArgTypes: []DBType{IntType}, Variadic: true, OutType: IntType}},
+		{"count", FunctionSignature{OutType: IntType}},
+		{"+", FunctionSignature{OutType: IntType}},
+		{"no_args", FunctionSignature{Variadic: true, OutType: IntType}},
+		{"unknown", FunctionSignature{ArgTypes: []DBType{UnknownType}, OutType: IntType}},
+	}
+	for _, fn := range invalid {
+		if err := RegisterFunction(fn.name, fn.sig, f); err == nil {
+			t.Errorf("expected error registering function %s", fn.name)
+		}
+	}
+	list := ListOfFunctions()
+	for _, sig := range []string{"total(int...)", "kind_of(int)", "kind_of(string)", "getsubstr(string,int,int)"} {
+		if !strings.Contains(list, sig) {
+			t.Errorf("expected %s in list of functions, got\n%s", sig, list)
+		}
+	}
+}
+
+func TestVolatileFunctions(t *testing.T) {
+	registerFunctionForTest(t, "now_ish", FunctionSignature{OutType: IntType, Volatile: true},
+		func(args []DBValue) (DBValue, error) { return IntField{1}, nil })
+	one := Expr(&ConstExpr{IntField{1}, IntType})
+	for _, test := range []struct {
+		expr     *FuncExpr
+		volatile bool
+	}{
+		{&FuncExpr{"rand", nil}, true},
+		{&FuncExpr{"epoch", nil}, true},
+		{&FuncExpr{"now_ish", nil}, true},
+		{&FuncExpr{"+", []*Expr{&one, &one}}, false},
+		{&FuncExpr{"sq", []*Expr{&one}}, false},
+	} {
+		if v := test.expr.volatile(); v != test.volatile {
+			t.Errorf("expected volatile %t for %s, got %t", test.volatile, test.expr.op, v)
+		}
+	}
+}
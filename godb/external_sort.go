@@ -0,0 +1,520 @@
+package godb
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// The default maximum number of bytes of tuples (as estimated by
+// [tupleMemSize]) that a sort (an OrderBy, and the sorts performed by
+// sort-merge joins, DISTINCT and sort-based grouping) holds in memory. Larger
+// inputs are sorted externally, by writing sorted runs that fit in this many
+// bytes to temporary files and merging them.
+var SortBufferSize int = 64 << 20
+
+// The directory in which temporary files, such as the runs of external sorts,
+// are created. If empty, the system default ([os.TempDir]) is used.
+var TempDir string = ""
+
+// The size of the buffer through which a temporary file is written or read.
+const tempFileBufferSize = 64 << 10
+
+// The estimated number of bytes a tuple occupies in memory, besides its
+// fields: the Tuple itself and its slice of fields.
+const tupleOverhead = 64
+
+// Return the estimated number of bytes t occupies in memory.
+func tupleMemSize(t *Tuple) int {
+	size := tupleOverhead
+	for _, f := range t.Fields {
+		//each field is an interface value pointing at its value
+		size += 16
+		switch f := f.(type) {
+		case IntField:
+			size += 8
+		case StringField:
+			size += 16 + len(f.Value)
+		}
+	}
+	return size
+}
+
+// Return the estimated number of bytes a tuple of desc occupies in memory,
+// taking its strings to be StringLength bytes long, as in a HeapFile.
+func descMemSize(desc *TupleDesc) int {
+	t := &Tuple{Fields: make([]DBValue, len(desc.Fields))}
+	for i, f := range desc.Fields {
+		t.Fields[i] = zeroValue(f.Ftype)
+		if f.Ftype == StringType {
+			t.Fields[i] = StringField{strings.Repeat(" ", StringLength)}
+		}
+	}
+	return tupleMemSize(t)
+}
+
+// A tempFile is a temporary file holding intermediate results, such as a sorted
+// run of an external sort. It is written once, sequentially, and then read
+// sequentially, through a buffer rather than the BufferPool, so that
+// intermediate results don't evict the pages of tables or fill the BufferPool
+// with dirty pages.
+//
+// Unlike the pages of a HeapFile, its records have variable lengths, so that
+// strings of any length are written in full: an int is written as a varint,
+// and a string as its length, as a uvarint, followed by its bytes.
+type tempFile struct {
+	file   *os.File
+	desc   *TupleDesc
+	w      *bufio.Writer // nil once the file is finished
+	size   int64         // the number of bytes written
+	buf    []byte        // the encoding of the record being written
+	closed bool
+}
+
+// The number of temporary files that have been created and not yet closed.
+var openTempFiles atomic.Int64
+
+// Return an error if tuples with descriptor desc can't be written to a
+// temporary file.
+func checkTempFileDesc(desc *TupleDesc) error {
+	for _, f := range desc.Fields {
+		if f.Ftype != IntType && f.Ftype != StringType {
+			return GoDBError{TypeMismatchError, fmt.Sprintf("cannot write field %s of type %v to a temporary file", f.Fname, f.Ftype)}
+		}
+	}
+	return nil
+}
+
+// Create an empty temporary file for tuples with descriptor desc.
+func newTempFile(desc *TupleDesc) (*tempFile, error) {
+	if err := checkTempFileDesc(desc); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(TempDir, "godb-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	// where possible, remove the file now, so it doesn't outlive an
+	// iterator that is abandoned before the file is closed
+	os.Remove(file.Name())
+	openTempFiles.Add(1)
+	return &tempFile{file: file, desc: desc.copy(), w: bufio.NewWriterSize(file, tempFileBufferSize)}, nil
+}
+
+// Append t to the file.
+func (f *tempFile) append(t *Tuple) error {
+	if len(t.Fields) != len(f.desc.Fields) {
+		return GoDBError{TypeMismatchError, "cannot write a tuple with a different number of fields to a temporary file"}
+	}
+	f.buf = f.buf[:0]
+	for i, v := range t.Fields {
+		switch v := v.(type) {
+		case IntField:
+			if f.desc.Fields[i].Ftype != IntType {
+				return GoDBError{TypeMismatchError, fmt.Sprintf("cannot write an int to field %s of a temporary file", f.desc.Fields[i].Fname)}
+			}
+			f.buf = binary.AppendVarint(f.buf, v.Value)
+		case StringField:
+			if f.desc.Fields[i].Ftype != StringType {
+				return GoDBError{TypeMismatchError, fmt.Sprintf("cannot write a string to field %s of a temporary file", f.desc.Fields[i].Fname)}
+			}
+			f.buf = binary.AppendUvarint(f.buf, uint64(len(v.Value)))
+			f.buf = append(f.buf, v.Value...)
+		default:
+			return GoDBError{TypeMismatchError, fmt.Sprintf("cannot write %v to a temporary file", v)}
+		}
+	}
+	n, err := f.w.Write(f.buf)
+	f.size += int64(n)
+	return err
+}
+
+// Write any buffered tuples to the file. Must be called after the last call to
+// append and before calling iterator.
+func (f *tempFile) finish() error {
+	if f.w == nil {
+		return nil
+	}
+	// unlike HeapFile.flushPage, don't sync, since the file doesn't need to
+	// survive a crash
+	err := f.w.Flush()
+	f.w = nil
+	return err
+}
+
+// Return an iterator over the tuples of the file, in the order they were
+// appended, holding one buffer's worth of the file in memory at a time.
+func (f *tempFile) iterator() func() (*Tuple, error) {
+	r := bufio.NewReaderSize(io.NewSectionReader(f.file, 0, f.size), tempFileBufferSize)
+	return func() (*Tuple, error) {
+		//the end of the file is only expected at the start of a record
+		if _, err := r.Peek(1); err == io.EOF {
+			return nil, nil
+		}
+		fields := make([]DBValue, len(f.desc.Fields))
+		for i, field := range f.desc.Fields {
+			if field.Ftype == IntType {
+				v, err := binary.ReadVarint(r)
+				if err != nil {
+					return nil, tempFileReadError(err)
+				}
+				fields[i] = IntField{v}
+				continue
+			}
+			n, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, tempFileReadError(err)
+			}
+			b := make([]byte, n)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return nil, tempFileReadError(err)
+			}
+			fields[i] = StringField{string(b)}
+		}
+		return &Tuple{Desc: *f.desc, Fields: fields}, nil
+	}
+}
+
+// Return the error for err, which occurred reading a record of a temporary
+// file.
+func tempFileReadError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return GoDBError{MalformedDataError, "temporary file ends in the middle of a record"}
+	}
+	return err
+}
+
+// The descriptor of the tuples in the file.
+func (f *tempFile) Descriptor() *TupleDesc {
+	return f.desc
+}
+
+// Return an iterator over the tuples of the file, so that a finished file can
+// be the child of another operator.
+func (f *tempFile) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	return f.iterator(), nil
+}
+
+// Close and remove the file, if it hasn't been.
+func (f *tempFile) close() {
+	if f.closed {
+		return
+	}
+	f.closed = true
+	openTempFiles.Add(-1)
+	f.file.Close()
+	os.Remove(f.file.Name())
+}
+
+// Return an iterator that returns the tuples of iter, which have descriptor
+// desc, sorted by less, stably (i.e., tuples that are neither less than nor
+// greater than each other are returned in the order iter returns them).
+//
+// At most maxBufferBytes bytes of tuples (as estimated by [tupleMemSize]), but
+// at least one tuple, are held in memory at once. If iter returns more, they
+// are sorted externally: sorted runs that fit in maxBufferBytes are written
+// to temporary files (see [tempFile]), which are then merged, in several
+// passes if there are too many runs to merge at once.
+//
+// The temporary files are closed and removed (see [mergedRuns]) once the
+// returned iterator is exhausted or returns an error, or, if it is abandoned
+// before then, e.g., by a LIMIT or EXISTS, once it is garbage collected. Where
+// the operating system allows, they are removed as soon as they are created.
+func externalSort(desc *TupleDesc, iter func() (*Tuple, error), less func(t1, t2 *Tuple) (bool, error), maxBufferBytes int) (func() (*Tuple, error), error) {
+	var sortErr error
+	sortBuffer := func(tuples []*Tuple) error {
+		sort.SliceStable(tuples, func(i, j int) bool {
+			if sortErr != nil {
+				return false
+			}
+			l, err := less(tuples[i], tuples[j])
+			if err != nil {
+				sortErr = err
+			}
+			return l
+		})
+		return sortErr
+	}
+
+	var runs []*tempFile
+	closeRuns := func() {
+		for _, r := range runs {
+			r.close()
+		}
+	}
+	var buffer []*Tuple
+	bufferBytes := 0
+	for {
+		t, err := iter()
+		if err != nil {
+			closeRuns()
+			return nil, err
+		}
+		if t == nil {
+			break
+		}
+		size := tupleMemSize(t)
+		if len(buffer) > 0 && bufferBytes+size > maxBufferBytes {
+			if err := sortBuffer(buffer); err != nil {
+				closeRuns()
+				return nil, err
+			}
+			run, err := writeRun(desc, buffer)
+			if err != nil {
+				closeRuns()
+				return nil, err
+			}
+			runs = append(runs, run)
+			buffer = buffer[:0]
+			bufferBytes = 0
+		}
+		buffer = append(buffer, t)
+		bufferBytes += size
+	}
+	if err := sortBuffer(buffer); err != nil {
+		closeRuns()
+		return nil, err
+	}
+
+	// the common case: everything fits in memory
+	if len(runs) == 0 {
+		i := 0
+		return func() (*Tuple, error) {
+			if i >= len(buffer) {
+				return nil, nil
+			}
+			i++
+			return buffer[i-1], nil
+		}, nil
+	}
+
+	if len(buffer) > 0 {
+		run, err := writeRun(desc, buffer)
+		if err != nil {
+			closeRuns()
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	buffer = nil
+
+	// each run being merged holds a read buffer in memory, so merge as many
+	// runs at once as there are read buffers in the memory budget
+	fanIn := max(maxBufferBytes/tempFileBufferSize, 2)
+	for len(runs) > fanIn {
+		var merged []*tempFile
+		for start := 0; start < len(runs); start += fanIn {
+			group := runs[start:min(start+fanIn, len(runs))]
+			if len(group) == 1 {
+				merged = append(merged, group[0])
+				continue
+			}
+			run, err := mergeToRun(group, less)
+			for _, r := range group {
+				r.close()
+			}
+			if err != nil {
+				for _, r := range merged {
+					r.close()
+				}
+				runs = runs[start+len(group):]
+				closeRuns()
+				return nil, err
+			}
+			merged = append(merged, run)
+		}
+		runs = merged
+	}
+
+	mergeIter, err := mergeRuns(runs, less)
+	if err != nil {
+		closeRuns()
+		return nil, err
+	}
+	merged := &mergedRuns{runs, mergeIter}
+	runtime.SetFinalizer(merged, (*mergedRuns).close)
+	return func() (*Tuple, error) {
+		return merged.next()
+	}, nil
+}
+
+// The sorted runs of an external sort and the iterator merging them. Iterators
+// have no means of telling their source that they're abandoned, so the runs
+// are closed by a finalizer if the merge is garbage collected before it ends.
+type mergedRuns struct {
+	runs  []*tempFile // nil once closed
+	merge func() (*Tuple, error)
+}
+
+// Return the next tuple of the merge, closing the runs after the last tuple or
+// an error.
+func (m *mergedRuns) next() (*Tuple, error) {
+	if m.runs == nil {
+		return nil, nil
+	}
+	t, err := m.merge()
+	if err != nil || t == nil {
+		m.close()
+	}
+	return t, err
+}
+
+// Close and remove the runs.
+func (m *mergedRuns) close() {
+	closeTempFiles(m.runs)
+	m.runs = nil
+	runtime.SetFinalizer(m, nil)
+}
+
+// Return true if the fields of t1 sort before those of t2, comparing the fields
+// in order, as for sorting on all of the fields of a DISTINCT.
+func fieldsLess(t1, t2 *Tuple) (bool, error) {
+	if len(t1.Fields) != len(t2.Fields) {
+		return false, GoDBError{TypeMismatchError, "cannot compare tuples with different numbers of fields"}
+	}
+	for i, f := range t1.Fields {
+		if f.EvalPred(t2.Fields[i], OpLt) {
+			return true, nil
+		}
+		if !f.EvalPred(t2.Fields[i], OpEq) {
+			return false, nil
+		}
+	}
+	return false, nil
+}
+
+// Write the tuples, which have descriptor desc, to a new temporary file.
+func writeRun(desc *TupleDesc, tuples []*Tuple) (*tempFile, error) {
+	run, err := newTempFile(desc)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tuples {
+		if err := run.append(t); err != nil {
+			run.close()
+			return nil, err
+		}
+	}
+	if err := run.finish(); err != nil {
+		run.close()
+		return nil, err
+	}
+	return run, nil
+}
+
+// Merge the sorted runs into a single new run.
+func mergeToRun(runs []*tempFile, less func(t1, t2 *Tuple) (bool, error)) (*tempFile, error) {
+	iter, err := mergeRuns(runs, less)
+	if err != nil {
+		return nil, err
+	}
+	out, err := newTempFile(runs[0].desc)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, err := iter()
+		if err != nil {
+			out.close()
+			return nil, err
+		}
+		if t == nil {
+			break
+		}
+		if err := out.append(t); err != nil {
+			out.close()
+			return nil, err
+		}
+	}
+	if err := out.finish(); err != nil {
+		out.close()
+		return nil, err
+	}
+	return out, nil
+}
+
+// The head of one of the runs being merged; run is the run's position in the
+// list of runs, which breaks ties so that the merge is stable.
+type mergeEntry struct {
+	t    *Tuple
+	run  int
+	iter func() (*Tuple, error)
+}
+
+// A min-heap of the heads of the runs being merged. Errors comparing tuples are
+// recorded in err.
+type mergeHeap struct {
+	entries []*mergeEntry
+	less    func(t1, t2 *Tuple) (bool, error)
+	err     error
+}
+
+func (h *mergeHeap) Len() int      { return len(h.entries) }
+func (h *mergeHeap) Swap(i, j int) { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
+func (h *mergeHeap) Push(x any)    { h.entries = append(h.entries, x.(*mergeEntry)) }
+func (h *mergeHeap) Pop() any {
+	last := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return last
+}
+func (h *mergeHeap) Less(i, j int) bool {
+	a, b := h.entries[i], h.entries[j]
+	l, err := h.less(a.t, b.t)
+	if err == nil && !l {
+		var g bool
+		g, err = h.less(b.t, a.t)
+		l = !g && a.run < b.run
+	}
+	if err != nil {
+		h.err = err
+		return false
+	}
+	return l
+}
+
+// Return an iterator that merges the sorted runs, stably.
+func mergeRuns(runs []*tempFile, less func(t1, t2 *Tuple) (bool, error)) (func() (*Tuple, error), error) {
+	h := &mergeHeap{less: less}
+	for i, r := range runs {
+		iter := r.iterator()
+		t, err := iter()
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			h.entries = append(h.entries, &mergeEntry{t, i, iter})
+		}
+	}
+	heap.Init(h)
+	if h.err != nil {
+		return nil, h.err
+	}
+	return func() (*Tuple, error) {
+		if h.Len() == 0 {
+			return nil, nil
+		}
+		head := h.entries[0]
+		t := head.t
+		next, err := head.iter()
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			heap.Pop(h)
+		} else {
+			head.t = next
+			heap.Fix(h, 0)
+		}
+		if h.err != nil {
+			return nil, h.err
+		}
+		return t, nil
+	}, nil
+}
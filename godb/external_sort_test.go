@@ -0,0 +1,259 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Make a MemFile of n (name, age) tuples with many duplicate names and ages.
+func makeExternalSortVars(t *testing.T, n int) (TupleDesc, *MemFile) {
+	t.Helper()
+	td, _, _ := makeTupleTestVars()
+	var tuples []Tuple
+	for i := 0; i < n; i++ {
+		tuples = append(tuples, Tuple{Desc: td, Fields: []DBValue{
+			StringField{fmt.Sprintf("n%d", (i*13)%17)},
+			IntField{int64((i * 7919) % 101)},
+		}})
+	}
+	return td, CreateMemFileFromTuples(tuples)
+}
+
+// Use a new temporary directory for temporary files, checking that it is empty
+// at the end of the test.
+func useTempDirForTest(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	oldDir := TempDir
+	TempDir = dir
+	t.Cleanup(func() {
+		TempDir = oldDir
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("expected temporary files to be removed, found %d", len(entries))
+		}
+	})
+}
+
+func collectTuplesForTest(t *testing.T, op Operator, tid TransactionID) []*Tuple {
+	t.Helper()
+	iter, err := op.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var tups []*Tuple
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			return tups
+		}
+		tups = append(tups, tup)
+	}
+}
+
+func TestExternalOrderBy(t *testing.T) {
+	useTempDirForTest(t)
+	td, mf := makeExternalSortVars(t, 2000)
+	exprs := []Expr{&FieldExpr{td.Fields[1]}}
+	ascs := []bool{false}
+
+	inMemory, err := NewOrderBy(exprs, mf, ascs)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := collectTuplesForTest(t, inMemory, 0)
+	// 7 tuples per run means many more runs than can be merged at once, so
+	// the runs are merged in several passes
+	tupSize := tupleMemSize(&Tuple{Fields: []DBValue{StringField{"n16"}, IntField{0}}})
+	for _, bufSize := range []int{7, 500, 1999, 2000} {
+		external, err := NewExternalOrderBy(exprs, mf, ascs, bufSize*tupSize)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		got := collectTuplesForTest(t, external, 0)
+		if len(got) != len(expected) {
+			t.Fatalf("buffer size %d: expected %d tuples, got %d", bufSize, len(expected), len(got))
+		}
+		// the sort is stable, so the names of tuples with the same age
+		// must be in the same order, too
+		for i := range got {
+			if !got[i].equals(expected[i]) {
+				t.Errorf("buffer size %d: expected %v at position %d, got %v", bufSize, expected[i], i, got[i])
+				break
+			}
+		}
+	}
+}
+
+func TestSortMergeJoin(t *testing.T) {
+	useTempDirForTest(t)
+	td, left := makeExternalSortVars(t, 300)
+	_, right := makeExternalSortVars(t, 50)
+	leftField, rightField := &FieldExpr{td.Fields[0]}, &FieldExpr{td.Fields[0]}
+
+	nl, err := NewJoin(left, leftField, right, rightField, 100)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := make(map[any]int)
+	for _, tup := range collectTuplesForTest(t, nl, 0) {
+		expected[tup.tupleKey()]++
+	}
+	tupSize := tupleMemSize(&Tuple{Fields: []DBValue{StringField{"n16"}, IntField{0}}})
+	for _, bufSize := range []int{3, 1000} {
+		smj, err := NewSortMergeJoin(left, leftField, right, rightField, bufSize*tupSize)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		got := make(map[any]int)
+		tups := collectTuplesForTest(t, smj, 0)
+		for i, tup := range tups {
+			got[tup.tupleKey()]++
+			if i > 0 && tup.Fields[0].EvalPred(tups[i-1].Fields[0], OpLt) {
+				t.Errorf("expected join results in order of join value")
+			}
+		}
+		if len(got) != len(expected) {
+			t.Errorf("buffer size %d: expected %d distinct results, got %d", bufSize, len(expected), len(got))
+		}
+		for k, n := range expected {
+			if got[k] != n {
+				t.Errorf("buffer size %d: expected %d copies of %v, got %d", bufSize, n, k, got[k])
+			}
+		}
+	}
+
+	if _, err := NewSortMergeJoin(left, leftField, right, &FieldExpr{td.Fields[1]}, 10); err == nil {
+		t.Errorf("expected error joining a string with an int")
+	}
+}
+
+func TestSortDistinctAndGroupBy(t *testing.T) {
+	useTempDirForTest(t)
+	oldSize := SortBufferSize
+	SortBufferSize = 10 * tupleMemSize(&Tuple{Fields: []DBValue{StringField{"n16"}, IntField{0}}})
+	defer func() { SortBufferSize = oldSize }()
+
+	td, mf := makeExternalSortVars(t, 1000)
+	name := &FieldExpr{td.Fields[0]}
+	proj, err := NewProjectOp([]Expr{name}, []string{"name"}, true, mf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tups := collectTuplesForTest(t, proj, 0)
+	if len(tups) != 17 {
+		t.Errorf("expected 17 distinct names, got %d", len(tups))
+	}
+	for i := 1; i < len(tups); i++ {
+		if !tups[i-1].Fields[0].EvalPred(tups[i].Fields[0], OpLt) {
+			t.Errorf("expected distinct names in sorted order, got %v before %v", tups[i-1].Fields[0], tups[i].Fields[0])
+		}
+	}
+
+	sumState := func() []AggState {
+		sa := SumAggState{}
+		if err := sa.Init("sum", &FieldExpr{td.Fields[1]}); err != nil {
+			t.Fatalf(err.Error())
+		}
+		return []AggState{&sa}
+	}
+	expected := make(map[string]int64)
+	for _, tup := range collectTuplesForTest(t, NewGroupedAggregator(sumState(), []Expr{name}, mf), 0) {
+		expected[tup.Fields[0].(StringField).Value] = tup.Fields[1].(IntField).Value
+	}
+	got := collectTuplesForTest(t, NewSortGroupedAggregator(sumState(), []Expr{name}, mf), 0)
+	if len(got) != len(expected) {
+		t.Errorf("expected %d groups, got %d", len(expected), len(got))
+	}
+	for i, tup := range got {
+		n := tup.Fields[0].(StringField).Value
+		if sum := tup.Fields[1].(IntField).Value; sum != expected[n] {
+			t.Errorf("expected sum %d for group %s, got %d", expected[n], n, sum)
+		}
+		if i > 0 && !got[i-1].Fields[0].EvalPred(tup.Fields[0], OpLt) {
+			t.Errorf("expected groups in sorted order")
+		}
+	}
+}
+
+// check that strings longer than StringLength survive being written to
+// temporary files, by sorts and by spilling aggregates
+func TestExternalSortLongStrings(t *testing.T) {
+	useTempDirForTest(t)
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	c := NewCatalog("catalog.txt", bp, t.TempDir())
+	if _, _, err := Parse(c, "create table k (id int, v varchar(20))"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	runQueryForTest(t, c, bp, "insert into k values (1, 'c'), (2, 'a'), (3, 'b'), (4, 'a')")
+
+	oldSort, oldAgg := SortBufferSize, AggBufferSize
+	defer func() { SortBufferSize, AggBufferSize = oldSort, oldAgg }()
+	SortBufferSize, AggBufferSize = 1, 1
+	suffix := strings.Repeat("x", 100)
+	tups := runQueryForTest(t, c, bp, "select id, concat(v, '"+suffix+"') as s from k order by s, id")
+	expected := []int64{2, 4, 3, 1}
+	if len(tups) != len(expected) {
+		t.Fatalf("expected %d tuples, got %d", len(expected), len(tups))
+	}
+	for i, tup := range tups {
+		s := tup.Fields[1].(StringField).Value
+		if tup.Fields[0].(IntField).Value != expected[i] || len(s) != 101 || !strings.HasSuffix(s, suffix) {
+			t.Errorf("expected id %d with a 101 character string at position %d, got %v", expected[i], i, tup.Fields)
+		}
+	}
+
+	tups = runQueryForTest(t, c, bp, "select concat(v, '"+suffix+"') as s, count(id) from k group by concat(v, '"+suffix+"')")
+	if len(tups) != 3 {
+		t.Fatalf("expected 3 groups, got %d", len(tups))
+	}
+	for _, tup := range tups {
+		if s := tup.Fields[0].(StringField).Value; len(s) != 101 {
+			t.Errorf("expected a 101 character group, got %q", s)
+		}
+	}
+}
+
+func TestExternalSortClosesRuns(t *testing.T) {
+	useTempDirForTest(t)
+	td, mf := makeExternalSortVars(t, 2000)
+	exprs := []Expr{&FieldExpr{td.Fields[1]}}
+	ascs := []bool{true}
+	tupSize := tupleMemSize(&Tuple{Fields: []DBValue{StringField{"n16"}, IntField{0}}})
+	open := openTempFiles.Load()
+
+	//the runs of an exhausted sort are closed as soon as it ends
+	external, err := NewExternalOrderBy(exprs, mf, ascs, 100*tupSize)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	collectTuplesForTest(t, external, 0)
+	if n := openTempFiles.Load(); n != open {
+		t.Errorf("expected the runs of an exhausted sort to be closed, %d are open", n-open)
+	}
+
+	//a sort abandoned by a LIMIT has runs open until it is garbage collected
+	limited := NewLimitOp(&ConstExpr{IntField{1}, IntType}, external)
+	if tups := collectTuplesForTest(t, limited, 0); len(tups) != 1 {
+		t.Fatalf("expected 1 tuple, got %d", len(tups))
+	}
+	if openTempFiles.Load() == open {
+		t.Fatalf("expected the runs of the abandoned sort to be open")
+	}
+	for i := 0; i < 100 && openTempFiles.Load() != open; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := openTempFiles.Load(); n != open {
+		t.Errorf("expected the runs of an abandoned sort to be closed, %d are open", n-open)
+	}
+}
@@ -26,6 +26,12 @@ func (f *Filter) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 	if err != nil {
 		return nil, err
 	}
+	// compile the pattern of a pattern matching predicate once, rather than
+	// for each tuple
+	var matcher *patternMatcher
+	if f.op.isPattern() {
+		matcher = &patternMatcher{op: f.op}
+	}
 
 	return func() (*Tuple, error) {
 		for {
@@ -48,7 +54,15 @@ func (f *Filter) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 			}
 
 			// Evaluate the predicate
-			satisfies := leftValue.EvalPred(rightValue, f.op)
+			var satisfies bool
+			if matcher != nil {
+				satisfies, err = matcher.match(leftValue, rightValue)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				satisfies = leftValue.EvalPred(rightValue, f.op)
+			}
 
 			// Return the tuple if it satisfies the predicate
 			if satisfies {
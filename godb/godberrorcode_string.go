@@ -21,11 +21,12 @@ func _() {
 	_ = x[IllegalOperationError-10]
 	_ = x[DeadlockError-11]
 	_ = x[IllegalTransactionError-12]
+	_ = x[DuplicateKeyError-13]
 }
 
-const _GoDBErrorCode_name = "TupleNotFoundErrorPageFullErrorIncompatibleTypesErrorTypeMismatchErrorMalformedDataErrorBufferPoolFullErrorParseErrorDuplicateTableErrorNoSuchTableErrorAmbiguousNameErrorIllegalOperationErrorDeadlockErrorIllegalTransactionError"
+const _GoDBErrorCode_name = "TupleNotFoundErrorPageFullErrorIncompatibleTypesErrorTypeMismatchErrorMalformedDataErrorBufferPoolFullErrorParseErrorDuplicateTableErrorNoSuchTableErrorAmbiguousNameErrorIllegalOperationErrorDeadlockErrorIllegalTransactionErrorDuplicateKeyError"
 
-var _GoDBErrorCode_index = [...]uint8{0, 18, 31, 53, 70, 88, 107, 117, 136, 152, 170, 191, 204, 227}
+var _GoDBErrorCode_index = [...]uint8{0, 18, 31, 53, 70, 88, 107, 117, 136, 152, 170, 191, 204, 227, 244}
 
 func (i GoDBErrorCode) String() string {
 	if i < 0 || i >= GoDBErrorCode(len(_GoDBErrorCode_index)-1) {
@@ -22,6 +22,8 @@ type HeapFile struct {
 	pageSize  int         // Size of each page in bytes
 	file      *os.File    // Handle to the actual file on disk
 	tupleDesc *TupleDesc
+	keyFields []int        // Fields of the file's unique key; nil if it has none
+	keyIdx    *uniqueIndex // Index of the unique key, once built
 	//mutex sync.RWMutex    // For concurrent access control
 }
 
@@ -209,6 +211,15 @@ func (f *HeapFile) readPage(pageNo int) (Page, error) {
 //
 // The page the tuple is inserted into should be marked as dirty.
 func (f *HeapFile) insertTuple(t *Tuple, tid TransactionID) error {
+	idx, err := f.keyIndex(tid)
+	if err != nil {
+		return err
+	}
+	if idx != nil {
+		if _, ok := idx.lookup(t); ok {
+			return idx.duplicateKeyError(t)
+		}
+	}
 
 	pageNo := 0
 
@@ -236,6 +247,9 @@ func (f *HeapFile) insertTuple(t *Tuple, tid TransactionID) error {
 			t.Rid = rid
 			heapPage.setDirty(tid, true)
 			//fmt.Println("test4")
+			if idx != nil {
+				return idx.add(t)
+			}
 			return nil
 		}
 
@@ -258,6 +272,11 @@ func (f *HeapFile) insertTuple(t *Tuple, tid TransactionID) error {
 	newPage.setDirty(tid, true)
 	//fmt.Println("test7")
 	f.numPages++
+	if idx != nil {
+		if err := idx.add(t); err != nil {
+			return err
+		}
+	}
 
 	//fmt.Println("CLEAR HF")
 	return f.flushPage(newPage)
@@ -289,10 +308,17 @@ func (f *HeapFile) deleteTuple(t *Tuple, tid TransactionID) error {
 		return errors.New("invalid page type")
 	}
 
+	var old *Tuple
+	if rid.Slot >= 0 && rid.Slot < heapPage.numSlots {
+		old = heapPage.tuples[rid.Slot]
+	}
 	err = heapPage.deleteTuple(rid)
 	if err != nil {
 		return err
 	}
+	if f.keyIdx != nil {
+		f.keyIdx.remove(&Tuple{Fields: old.Fields, Rid: rid})
+	}
 
 	heapPage.setDirty(tid, true)
 
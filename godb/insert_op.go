@@ -5,6 +5,9 @@ import "fmt"
 type InsertOp struct {
 	insertFile DBFile
 	child      Operator
+	returning  bool        // return the inserted tuples rather than their count
+	tableInfo  *Table      // the table of insertFile, if set
+	bufPool    *BufferPool // holds the modifications until the transaction commits
 }
 
 // Construct an insert operator that inserts the records in the child Operator
@@ -16,18 +19,27 @@ func NewInsertOp(insertFile DBFile, child Operator) *InsertOp {
 	}
 }
 
-// The insert TupleDesc is a one column descriptor with an integer field named "count"
+// Return the inserted tuples, rather than their count, from the iterator.
+func (i *InsertOp) setReturning() {
+	i.returning = true
+}
+
+// Record the inserted tuples in the statistics of table, that of insertFile.
+func (i *InsertOp) setTable(table *Table, bp *BufferPool) {
+	i.tableInfo = table
+	i.bufPool = bp
+}
+
+// The insert TupleDesc is a one column descriptor with an integer field named
+// "count", or the DBFile's descriptor if returning the inserted tuples.
 func (i *InsertOp) Descriptor() *TupleDesc {
-	return &TupleDesc{
-		Fields: []FieldType{
-			{Fname: "count", Ftype: IntType},
-		},
-	}
+	return dmlDescriptor(i.insertFile, i.returning)
 }
 
 // Return an iterator function that inserts all of the tuples from the child
 // iterator into the DBFile and then returns a one-field tuple with a "count"
-// field indicating the number of tuples that were inserted.
+// field indicating the number of tuples that were inserted (or, if returning,
+// each of the inserted tuples).
 func (iop *InsertOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 	// Get iterator from child operator
 	childIter, err := iop.child.Iterator(tid)
@@ -36,15 +48,24 @@ func (iop *InsertOp) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 	}
 
 	// Create closure to track state
-	var returned bool
+	var results func() (*Tuple, error)
 	var count int64 = 0
+	var inserted []*Tuple
 
 	return func() (*Tuple, error) {
-		// If we've already returned the count, we're done
-		if returned {
-			return nil, nil
+		// If we've already inserted the tuples, return the results
+		if results != nil {
+			return results()
 		}
 
+		// A file with a unique key is checked against all of the tuples
+		// before any are inserted, so a statement inserts all or none of them
+		idx, err := fileKeyIndex(iop.insertFile, tid)
+		if err != nil {
+			return nil, err
+		}
+		var pending []*Tuple
+
 		// Insert all tuples from child iterator
 		for {
 			// Get next tuple from child
@@ -56,26 +77,42 @@ func (iop *InsertOp) Iterator(tid TransactionID) (func() (*Tuple, error), error)
 			if tuple == nil {
 				break
 			}
-
-			// Insert the tuple into the file
-			err = iop.insertFile.insertTuple(tuple, tid)
-			if err != nil {
-				return nil, fmt.Errorf("failed to insert tuple: %v", err)
+			if idx != nil {
+				pending = append(pending, tuple)
+				continue
+			}
+			if err := iop.insert(tuple, tid, &inserted); err != nil {
+				return nil, err
 			}
 			count++
 		}
-
-		// Create return tuple with count
-		countTuple := &Tuple{
-			Fields: []DBValue{
-				IntField{Value: count},
-			},
-			Desc: *iop.Descriptor(),
+		if idx != nil {
+			if err := idx.checkReplace(nil, pending); err != nil {
+				return nil, err
+			}
+			for _, tuple := range pending {
+				if err := iop.insert(tuple, tid, &inserted); err != nil {
+					return nil, err
+				}
+				count++
+			}
 		}
 
-		// Mark as returned so next iteration returns nil
-		returned = true
-
-		return countTuple, nil
+		iop.bufPool.recordModifications(iop.tableInfo, tid, count)
+		// Return the count or the inserted tuples
+		results = dmlResultIter(iop.returning, count, inserted)
+		return results()
 	}, nil
 }
+
+// Insert tuple into the DBFile, appending it to inserted if returning the
+// inserted tuples.
+func (iop *InsertOp) insert(tuple *Tuple, tid TransactionID, inserted *[]*Tuple) error {
+	if err := iop.insertFile.insertTuple(tuple, tid); err != nil {
+		return fmt.Errorf("failed to insert tuple: %v", err)
+	}
+	if iop.returning {
+		*inserted = append(*inserted, &Tuple{Desc: *iop.Descriptor(), Fields: tuple.Fields})
+	}
+	return nil
+}
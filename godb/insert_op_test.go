@@ -1,6 +1,7 @@
 package godb
 
 import (
+	"fmt"
 	"os"
 	"testing"
 )
@@ -59,3 +60,156 @@ func TestInsert(t *testing.T) {
 		t.Errorf("insert failed, expected 2 tuples, got %d", cnt)
 	}
 }
+
+func TestInsertColumnList(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	os.Remove(c.tableNameToFile("dflt"))
+	defer os.Remove(c.tableNameToFile("dflt"))
+	if _, _, err := Parse(c, "create table dflt (name varchar(20) default 'n/a', age int default 7, city varchar(20))"); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	inserts := []struct {
+		sql      string
+		expected int64
+	}{
+		{"insert into dflt (city, name) values ('boston', 'ann')", 1},
+		{"insert into dflt (city) values ('nyc'), ('la')", 2},
+		{"insert into dflt (city, age) select name, age from t where age > 90", 2},
+		{"insert into dflt values ('bob', 30, 'sf')", 1},
+	}
+	for _, ins := range inserts {
+		tups := runQueryForTest(t, c, bp, ins.sql)
+		if len(tups) != 1 || tups[0].Fields[0].(IntField).Value != ins.expected {
+			t.Errorf("q=%s: expected %d inserted tuples, got %v", ins.sql, ins.expected, tups)
+		}
+	}
+
+	expected := map[string]string{
+		"boston": "ann 7",
+		"nyc":    "n/a 7",
+		"la":     "n/a 7",
+		"bo":     "n/a 99",
+		"sam":    "n/a 99",
+		"sf":     "bob 30",
+	}
+	tups := runQueryForTest(t, c, bp, "select name, age, city from dflt")
+	if len(tups) != len(expected) {
+		t.Errorf("expected %d tuples, got %d", len(expected), len(tups))
+	}
+	for _, tup := range tups {
+		city := tup.Fields[2].(StringField).Value
+		got := fmt.Sprintf("%s %d", tup.Fields[0].(StringField).Value, tup.Fields[1].(IntField).Value)
+		if got != expected[city] {
+			t.Errorf("expected %s for city %s, got %s", expected[city], city, got)
+		}
+	}
+
+	for _, q := range []string{
+		"insert into dflt (name) values ('x')",
+		"insert into dflt (city, city) values ('a', 'b')",
+		"insert into dflt (nosuch, city) values (1, 'a')",
+		"insert into dflt (city) values ('a', 'b')",
+		"insert into dflt (city, age) select name from t",
+		"create table dflt2 (age int default 'x')",
+	} {
+		if _, _, err := Parse(c, q); err == nil {
+			t.Errorf("q=%s: expected error", q)
+		}
+	}
+}
+
+func TestInsertDefaultExprs(t *testing.T) {
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	dir := t.TempDir()
+	c := NewCatalog("catalog.txt", bp, dir)
+	if _, _, err := Parse(c, "create table k (id int primary key, minutes int default 24 * 60, shift int default -5 not null, name varchar(20) default upper('n' || '/a'), city varchar(20))"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	table, err := c.GetTableInfo("k")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for i, v := range []DBValue{nil, IntField{1440}, IntField{-5}, StringField{"N/A"}, nil} {
+		if table.defaultValue(i) != v {
+			t.Errorf("expected default %v for %s, got %v", v, table.desc.Fields[i].Fname, table.defaultValue(i))
+		}
+	}
+	if len(table.primaryKey) != 1 || table.primaryKey[0] != "id" {
+		t.Errorf("expected primary key (id), got %v", table.primaryKey)
+	}
+
+	runQueryForTest(t, c, bp, "insert into k values (1, default, 7, default, 'boston')")
+	runQueryForTest(t, c, bp, "insert into k (id, city, name) values (2, 'nyc', default)")
+	tups := runQueryForTest(t, c, bp, "select id, minutes, shift, name, city from k order by id")
+	expected := [][]DBValue{
+		{IntField{1}, IntField{1440}, IntField{7}, StringField{"N/A"}, StringField{"boston"}},
+		{IntField{2}, IntField{1440}, IntField{-5}, StringField{"N/A"}, StringField{"nyc"}},
+	}
+	if len(tups) != len(expected) {
+		t.Fatalf("expected %d tuples, got %d", len(expected), len(tups))
+	}
+	for i, tup := range tups {
+		for j, v := range expected[i] {
+			if tup.Fields[j] != v {
+				t.Errorf("row %d: expected %v for %s, got %v", i, v, table.desc.Fields[j].Fname, tup.Fields[j])
+			}
+		}
+	}
+
+	for _, q := range []string{
+		"insert into k values (3, default, default, default, default)",
+		"insert into k (id, city) values (default, 'la')",
+		"create table k2 (id int default id + 1)",
+		"create table k2 (name varchar(20) default 1 + 2)",
+		//volatile defaults would be evaluated only once, when k2 is created
+		"create table k2 (ts int default epoch())",
+		"create table k2 (r int default rand() + 1)",
+	} {
+		if _, _, err := Parse(c, q); err == nil {
+			t.Errorf("q=%s: expected error", q)
+		}
+	}
+}
+
+func TestCatalogDefaults(t *testing.T) {
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	dir := t.TempDir()
+	c := NewCatalog("catalog.txt", bp, dir)
+	if _, _, err := Parse(c, "create table people (name varchar(20) default 'o''brien, jr (sr)', age int default 5, city varchar(20))"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := c.SaveToFile("catalog.txt", dir); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	c2, err := NewCatalogFromFile("catalog.txt", bp, dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if c2.String() != c.String() {
+		t.Errorf("catalog changed after saving and loading:\n%s\nvs\n%s", c.String(), c2.String())
+	}
+	table, err := c2.GetTableInfo("people")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if v := table.defaultValue(0); v != (StringField{"o'brien, jr (sr)"}) {
+		t.Errorf("unexpected default for name: %v", v)
+	}
+	if v := table.defaultValue(1); v != (IntField{5}) {
+		t.Errorf("unexpected default for age: %v", v)
+	}
+	if v := table.defaultValue(2); v != nil {
+		t.Errorf("expected no default for city, got %v", v)
+	}
+}
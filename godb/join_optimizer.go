@@ -1,30 +1,194 @@
 package godb
 
+import (
+	"math"
+	"math/bits"
+)
+
+// The join algorithms the optimizer chooses among.
+type JoinAlgorithm int
+
+const (
+	// A [SortMergeJoin], which sorts both of its inputs on their join fields
+	// and merges them, reading each once.
+	SortMergeJoinAlgorithm JoinAlgorithm = iota
+	// A nested loops [EqualityJoin], which iterates over its right input once
+	// for each tuple of its left input.
+	NestedLoopsJoinAlgorithm
+)
+
+// Consider bushy join plans, in which both inputs of a join may be joins, as
+// well as left-deep plans, in which the right input of each join is a table.
+var EnableBushyJoins = false
+
+// The maximum number of tables whose join orders OrderJoins enumerates; the
+// number of plans it considers grows exponentially with the number of tables.
+const MaxJoinOrderTables = 12
+
+// Return the cost of sorting card tuples: the number of comparisons.
+func sortCost(card int) float64 {
+	if card < 2 {
+		return float64(card)
+	}
+	return float64(card) * math.Log2(float64(card))
+}
+
+// Estimate the cost of joining inputs with cardinalities card1 and card2 and
+// costs cost1 and cost2 using the join algorithm alg.
+func estimateJoinAlgorithmCost(alg JoinAlgorithm, card1 int, card2 int, cost1 float64, cost2 float64) float64 {
+	if alg == NestedLoopsJoinAlgorithm {
+		//the right input is evaluated again for each left tuple, and the
+		//predicate is applied to each pair of tuples
+		return cost1 + float64(card1)*cost2 + float64(card1)*float64(card2)
+	}
+	return cost1 + cost2 + sortCost(card1) + sortCost(card2) + float64(card1) + float64(card2)
+}
+
+// Return the cheapest algorithm for joining inputs with cardinalities card1
+// and card2 and costs cost1 and cost2, and its cost.
+func chooseJoinAlgorithm(card1 int, card2 int, cost1 float64, cost2 float64) (JoinAlgorithm, float64) {
+	best, bestCost := SortMergeJoinAlgorithm, estimateJoinAlgorithmCost(SortMergeJoinAlgorithm, card1, card2, cost1, cost2)
+	if cost := estimateJoinAlgorithmCost(NestedLoopsJoinAlgorithm, card1, card2, cost1, cost2); cost < bestCost {
+		best, bestCost = NestedLoopsJoinAlgorithm, cost
+	}
+	return best, bestCost
+}
+
 // Estimate the cost of a join j given the cardinalities (card1, card2) and
 // estimated costs (cost1, cost2) of the left and right sides of the join,
 // respectively.
 //
-// The cost of the join should be calculated based on the join algorithm (or
-// algorithms) that you implemented for Lab 2. It should be a function of the
-// amount of data that must be read over the course of the query, as well as the
-// number of CPU opertions performed by your join. Assume that the cost of a
-// single predicate application is roughly 1.
+// The cost is that of the cheapest of the join algorithms: a sort-merge join,
+// which reads each input once and sorts it, or a nested loops join, which
+// reads the right input once for each left tuple. The cost of a single
+// predicate application or comparison is roughly 1, and that of reading a
+// page CostPerPage.
 func EstimateJoinCost(card1 int, card2 int, cost1 float64, cost2 float64) float64 {
-	// Dummy implementation. Do not worry about this.
-	return -1.0
+	_, cost := chooseJoinAlgorithm(card1, card2, cost1, cost2)
+	return cost
+}
+
+// Estimate the cardinality of the result of the join j of inputs with
+// cardinalities t1card and t2card, given the statistics of the join fields,
+// the tables' primary keys, and the selectivities of the filters on the tables.
+// Each input is the join's table alone (with its filters); see
+// estimateInputsJoinCardinality for inputs that are joins.
+func EstimateJoinCardinality(j *JoinNode, t1card int, t2card int) int {
+	return estimateInputsJoinCardinality(j, t1card, t2card, true, true)
+}
+
+// Estimate the cardinality of the result of the join j of inputs with
+// cardinalities t1card and t2card; leftSingle and rightSingle are true if the
+// left and right inputs, respectively, are the join's table alone, rather
+// than joins of it with other tables.
+//
+// The cardinality is that of the cross product of the inputs times the
+// selectivity of the join predicate (see joinSelectivity). Each tuple of one
+// input joins with at most one tuple of an input that is a table whose join
+// field is unique. A join field unique in its table needn't be in a join of
+// the table, e.g., the left input of a join in a left-deep plan, in which its
+// values may repeat.
+//
+// Without statistics of the join fields, the join is assumed to be of a key of
+// one input with the other, so that each tuple of the larger input joins with
+// a single tuple of the smaller; if one of the join fields is known to be a
+// key of a table that is an input, each tuple of the other input joins with a
+// tuple of the table that satisfies its filters.
+func estimateInputsJoinCardinality(j *JoinNode, t1card int, t2card int, leftSingle bool, rightSingle bool) int {
+	leftUnique := leftSingle && j.leftTable.unique(j.leftField)
+	rightUnique := rightSingle && j.rightTable.unique(j.rightField)
+	sel, ok := joinSelectivity(j, t1card, t2card)
+	if !ok {
+		switch {
+		case rightUnique:
+			return int(float64(t1card)*j.rightTable.sel + 0.5)
+		case leftUnique:
+			return int(float64(t2card)*j.leftTable.sel + 0.5)
+		}
+		return max(t1card, t2card)
+	}
+	card := float64(t1card) * float64(t2card) * sel
+	if rightUnique {
+		card = min(card, float64(t1card))
+	}
+	if leftUnique {
+		card = min(card, float64(t2card))
+	}
+	return int(card + 0.5)
+}
+
+// Return the estimated fraction of the pairs of tuples of the inputs of the
+// join j, of cardinalities card1 and card2, that satisfy its predicate, and
+// whether either join field has statistics to estimate it with.
+//
+// As in Selinger et al., each value of the join field with fewer distinct
+// values is assumed to equal a value of the other, so the fraction is one
+// over the larger number of distinct values. Values of either field outside
+// the range of the other's, per its histogram, equal none of them.
+func joinSelectivity(j *JoinNode, card1 int, card2 int) (float64, bool) {
+	lcs, rcs := j.leftTable.statistics().ColumnStats(j.leftField), j.rightTable.statistics().ColumnStats(j.rightField)
+	if lcs == nil && rcs == nil || lcs != nil && rcs != nil && lcs.ftype != rcs.ftype {
+		return 0, false
+	}
+	lfrac, rfrac := 1.0, 1.0
+	if lcs != nil && rcs != nil {
+		lfrac, rfrac = lcs.overlap(rcs), rcs.overlap(lcs)
+	}
+	//an input has no more distinct values than tuples
+	ld := min(j.leftTable.distinctValues(j.leftField), float64(card1)) * lfrac
+	rd := min(j.rightTable.distinctValues(j.rightField), float64(card2)) * rfrac
+	return lfrac * rfrac / max(ld, rd, 1), true
 }
 
-// Estimate the cardinality of the result of a join between two tables, given
-// the join operator, primary key information, and table statistics.
-func EstimateJoinCardinality(t1card int, t2card int) int {
-	// Dummy implementation. Do not worry about this.
-	return -1
+// Estimate the cardinality of applying the join j to card tuples that already
+// join its tables, e.g., the last join of a cycle of joins, which only
+// filters them.
+func estimateJoinFilterCardinality(j *JoinNode, card int) int {
+	sel, ok := joinSelectivity(j, card, card)
+	if !ok {
+		sel = DefaultEqSelectivity
+	}
+	return int(float64(card)*sel + 0.5)
 }
 
 type TableInfo struct {
-	name  string  // Name of the table
-	stats Stats   // Statistics for the table; may be nil if no stats are available
-	sel   float64 // Selectivity of the filters on the table
+	name  string   // Name of the table
+	stats Stats    // Statistics for the table; may be nil if no stats are available
+	sel   float64  // Selectivity of the filters on the table
+	key   []string // Fields of the table's primary key; nil if it has none
+}
+
+// Return the statistics of the table, or dummy statistics if it has none.
+func (t *TableInfo) statistics() Stats {
+	if t.stats == nil {
+		return &DummyStats{}
+	}
+	return t.stats
+}
+
+// Return true if no two tuples of the table have the same value of field:
+// if it's the table's primary key, or its statistics show no duplicates.
+func (t *TableInfo) unique(field string) bool {
+	if len(t.key) == 1 && t.key[0] == field {
+		return true
+	}
+	cs := t.statistics().ColumnStats(field)
+	return cs != nil && cs.count > 0 && cs.distinct == cs.count
+}
+
+// Return the estimated number of distinct values of field among the tuples of
+// the table that satisfy its filters, or 0 if there are no statistics of it.
+//
+// Of d distinct values among n tuples, each of which n/d tuples have, a value
+// remains unless all of its tuples are filtered out, so that a fraction sel
+// of the tuples has d(1 - (1-sel)^(n/d)) distinct values.
+func (t *TableInfo) distinctValues(field string) float64 {
+	cs := t.statistics().ColumnStats(field)
+	if cs == nil || cs.distinct == 0 {
+		return 0
+	}
+	d, n := float64(cs.distinct), float64(cs.count)
+	return d * (1 - math.Pow(1-t.sel, n/d))
 }
 
 // A JoinNode represents a join between two tables.
@@ -34,6 +198,22 @@ type JoinNode struct {
 
 	rightTable TableInfo
 	rightField string
+
+	// The algorithm with which to join the inputs containing the two tables;
+	// the input containing the left table is the left input.
+	algorithm JoinAlgorithm
+}
+
+// Return the join with its left and right tables swapped.
+func (j *JoinNode) swap() *JoinNode {
+	return &JoinNode{j.rightTable, j.rightField, j.leftTable, j.leftField, j.algorithm}
+}
+
+// The cheapest plan found for joining a set of tables.
+type joinPlan struct {
+	card  int
+	cost  float64
+	joins []*JoinNode // in the order to apply them
 }
 
 // Given a list of joins, table statistics, and selectivities, return the best
@@ -45,8 +225,93 @@ type JoinNode struct {
 // (table) and an alias. We may apply different filters to the same base table
 // but with different aliases, so the selectivity map contains selectivities for
 // a particular alias, not for a base table.
+//
+// Following Selinger et al., the cheapest plan for joining each set of tables
+// is found from the cheapest plans for joining its subsets, starting with the
+// single tables; plans with cross products aren't considered. Unless
+// EnableBushyJoins is set, the right input of each join is a single table.
+// Each returned join is oriented so that its left table is in the left input,
+// and records the join algorithm to use. The join of two inputs is followed by
+// the other joins between them, which are then filters.
+//
+// If there are more than MaxJoinOrderTables tables, or they can't all be
+// joined without a cross product, the joins are returned unchanged.
 func OrderJoins(joins []*JoinNode) ([]*JoinNode, error) {
-	// Dummy implementation. Do not worry about this.
-	return joins, nil
-}
+	var tables []TableInfo
+	index := make(map[string]int)
+	for _, j := range joins {
+		for _, t := range []TableInfo{j.leftTable, j.rightTable} {
+			if _, ok := index[t.name]; !ok {
+				index[t.name] = len(tables)
+				tables = append(tables, t)
+			}
+		}
+	}
+	if len(tables) > MaxJoinOrderTables {
+		return joins, nil
+	}
 
+	//the plans of sets of tables, whose members are the bits of the index
+	plans := make(map[uint]*joinPlan)
+	for i, t := range tables {
+		stats := t.statistics()
+		plans[1<<i] = &joinPlan{stats.EstimateCardinality(t.sel), stats.EstimateScanCost(), nil}
+	}
+	all := uint(1)<<len(tables) - 1
+	//each subset of a set precedes it
+	for set := uint(1); set <= all; set++ {
+		if bits.OnesCount(set) < 2 {
+			continue
+		}
+		var best *joinPlan
+		for left := (set - 1) & set; left > 0; left = (left - 1) & set {
+			right := set &^ left
+			if !EnableBushyJoins && bits.OnesCount(right) != 1 {
+				continue
+			}
+			leftPlan, rightPlan := plans[left], plans[right]
+			if leftPlan == nil || rightPlan == nil {
+				continue
+			}
+			var between []*JoinNode
+			for _, j := range joins {
+				l, r := uint(1)<<index[j.leftTable.name], uint(1)<<index[j.rightTable.name]
+				switch {
+				case l&left != 0 && r&right != 0:
+					between = append(between, j)
+				case r&left != 0 && l&right != 0:
+					between = append(between, j.swap())
+				}
+			}
+			if len(between) == 0 {
+				continue
+			}
+			alg, cost := chooseJoinAlgorithm(leftPlan.card, rightPlan.card, leftPlan.cost, rightPlan.cost)
+			if best != nil && cost >= best.cost {
+				continue
+			}
+			join := *between[0]
+			join.algorithm = alg
+			planJoins := append(append(append([]*JoinNode{}, leftPlan.joins...), rightPlan.joins...), &join)
+			card := estimateInputsJoinCardinality(&join, leftPlan.card, rightPlan.card, bits.OnesCount(left) == 1, bits.OnesCount(right) == 1)
+			for _, j := range between[1:] {
+				card = estimateJoinFilterCardinality(j, card)
+			}
+			best = &joinPlan{card, cost, append(planJoins, between[1:]...)}
+		}
+		if best != nil {
+			plans[set] = best
+		}
+	}
+	if plans[all] == nil {
+		return joins, nil
+	}
+	ordered := plans[all].joins
+	//joins of a table with itself are between no two inputs
+	for _, j := range joins {
+		if j.leftTable.name == j.rightTable.name {
+			ordered = append(ordered, j)
+		}
+	}
+	return ordered, nil
+}
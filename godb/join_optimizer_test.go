@@ -0,0 +1,283 @@
+package godb
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// Return statistics of a table with tups tuples on pages pages.
+func makeJoinTestStats(tups int, pages int) *TableStats {
+	return &TableStats{basePages: pages, baseTups: tups, histograms: make(map[string]*ColumnStats)}
+}
+
+// Return the cost of applying joins in order, and whether each join's right
+// input is a single table.
+func joinOrderCost(joins []*JoinNode) (float64, bool) {
+	type input struct {
+		card   int
+		cost   float64
+		tables int
+	}
+	inputs := make(map[string]*input)
+	for _, j := range joins {
+		for _, t := range []TableInfo{j.leftTable, j.rightTable} {
+			if inputs[t.name] == nil {
+				stats := t.statistics()
+				inputs[t.name] = &input{stats.EstimateCardinality(t.sel), stats.EstimateScanCost(), 1}
+			}
+		}
+	}
+	leftDeep := true
+	var last *input
+	for _, j := range joins {
+		l, r := inputs[j.leftTable.name], inputs[j.rightTable.name]
+		if l == r {
+			l.card = estimateJoinFilterCardinality(j, l.card)
+			continue
+		}
+		leftDeep = leftDeep && r.tables == 1
+		joined := &input{estimateInputsJoinCardinality(j, l.card, r.card, l.tables == 1, r.tables == 1), estimateJoinAlgorithmCost(j.algorithm, l.card, r.card, l.cost, r.cost), l.tables + r.tables}
+		for name, in := range inputs {
+			if in == l || in == r {
+				inputs[name] = joined
+			}
+		}
+		last = joined
+	}
+	return last.cost, leftDeep
+}
+
+// Return the lowest cost of applying joins in any order, with any orientation
+// and join algorithms.
+func bestJoinOrderCost(joins []*JoinNode) float64 {
+	best := math.Inf(1)
+	var permute func(done []*JoinNode, rest []*JoinNode)
+	permute = func(done []*JoinNode, rest []*JoinNode) {
+		if len(rest) == 0 {
+			cost, _ := joinOrderCost(done)
+			best = min(best, cost)
+			return
+		}
+		for i, j := range rest {
+			others := append(append([]*JoinNode{}, rest[:i]...), rest[i+1:]...)
+			for _, oriented := range []*JoinNode{j, j.swap()} {
+				for _, alg := range []JoinAlgorithm{SortMergeJoinAlgorithm, NestedLoopsJoinAlgorithm} {
+					choice := *oriented
+					choice.algorithm = alg
+					permute(append(append([]*JoinNode{}, done...), &choice), others)
+				}
+			}
+		}
+	}
+	permute(nil, joins)
+	return best
+}
+
+func TestJoinAlgorithmChoice(t *testing.T) {
+	//a single outer tuple is best joined by scanning the inner once
+	if alg, cost := chooseJoinAlgorithm(1, 10000, 1000, 100000); alg != NestedLoopsJoinAlgorithm || cost != EstimateJoinCost(1, 10000, 1000, 100000) {
+		t.Errorf("expected a nested loops join of a single tuple, got %v costing %f", alg, cost)
+	}
+	//rescanning large inputs costs more than sorting them
+	if alg, _ := chooseJoinAlgorithm(1000, 10000, 10000, 100000); alg != SortMergeJoinAlgorithm {
+		t.Errorf("expected a sort-merge join of large inputs, got %v", alg)
+	}
+	if c1, c2 := EstimateJoinCost(100, 100, 1000, 1000), EstimateJoinCost(1000, 1000, 1000, 1000); c1 <= 0 || c1 >= c2 {
+		t.Errorf("expected joins of more tuples to cost more, got %f and %f", c1, c2)
+	}
+	//without statistics, a key of the smaller input is assumed to be joined
+	j := &JoinNode{leftTable: TableInfo{"a", nil, 1.0, nil}, leftField: "x", rightTable: TableInfo{"b", nil, 1.0, nil}, rightField: "x"}
+	if card := EstimateJoinCardinality(j, 10, 1000); card != 1000 {
+		t.Errorf("expected the larger cardinality, got %d", card)
+	}
+}
+
+func TestOrderJoins(t *testing.T) {
+	tables := map[string]TableInfo{
+		"a": {"a", makeJoinTestStats(100000, 1000), 1.0, nil},
+		"b": {"b", makeJoinTestStats(5000, 50), 0.1, nil},
+		"c": {"c", makeJoinTestStats(20, 1), 0.05, nil},
+		"d": {"d", makeJoinTestStats(2000, 20), 1.0, nil},
+		"e": {"e", makeJoinTestStats(300000, 3000), 0.001, nil},
+	}
+	join := func(l, r string) *JoinNode {
+		return &JoinNode{leftTable: tables[l], leftField: "x", rightTable: tables[r], rightField: "x"}
+	}
+	queries := [][]*JoinNode{
+		{join("a", "b"), join("b", "c")},
+		{join("a", "b"), join("b", "c"), join("c", "d")},
+		{join("e", "a"), join("a", "b"), join("a", "c"), join("c", "d")},
+		{join("a", "b"), join("a", "c"), join("a", "d"), join("a", "e")},
+	}
+	defer func() { EnableBushyJoins = false }()
+	for i, joins := range queries {
+		writtenCost, _ := joinOrderCost(joins)
+		best := bestJoinOrderCost(joins)
+
+		EnableBushyJoins = false
+		ordered, err := OrderJoins(joins)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(ordered) != len(joins) {
+			t.Fatalf("query %d: expected %d joins, got %d", i, len(joins), len(ordered))
+		}
+		leftDeepCost, leftDeep := joinOrderCost(ordered)
+		if !leftDeep {
+			t.Errorf("query %d: expected a left-deep plan", i)
+		}
+		if leftDeepCost > writtenCost || leftDeepCost < best {
+			t.Errorf("query %d: expected a cost between %f and %f, got %f", i, best, writtenCost, leftDeepCost)
+		}
+
+		EnableBushyJoins = true
+		ordered, err = OrderJoins(joins)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if bushyCost, _ := joinOrderCost(ordered); bushyCost != best || bushyCost > leftDeepCost {
+			t.Errorf("query %d: expected the cheapest plan, costing %f, got %f", i, best, bushyCost)
+		}
+	}
+
+	//joins that need a cross product are left in order
+	joins := []*JoinNode{join("a", "b"), join("c", "d")}
+	if ordered, _ := OrderJoins(joins); ordered[0] != joins[0] || ordered[1] != joins[1] {
+		t.Errorf("expected joins with a cross product to be unchanged")
+	}
+}
+
+func TestJoinOrderQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	explain := func(q string) string {
+		t.Helper()
+		_, plan, err := Parse(c, q)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %s", q, err.Error())
+		}
+		var sb strings.Builder
+		OutputPhysicalPlan(func(format string, a ...any) {
+			sb.WriteString(fmt.Sprintf(format, a...))
+		}, plan, "")
+		return sb.String()
+	}
+	defer func() { EnableJoinOptimization = true }()
+
+	queries := []struct {
+		query string
+		// a line of the optimized plan
+		expected string
+	}{
+		{"select t.name from t, t2 where t.name = t2.name", "Sort Merge Join"},
+		{"select t.name from t, t2 where t.name = t2.name and t2.name = 'kathy'", "Nested Loops Join, t2.name == t.name, card:1, cost:2012"},
+		{"select t.name, t2.age from t, t2 where t.name = t2.name and t.age = t2.age", "Filter"},
+	}
+	for _, q := range queries {
+		EnableJoinOptimization = false
+		expected := len(runQueryForTest(t, c, bp, q.query))
+		EnableJoinOptimization = true
+		if got := len(runQueryForTest(t, c, bp, q.query)); got != expected {
+			t.Errorf("expected %d tuples for %s, got %d", expected, q.query, got)
+		}
+		if plan := explain(q.query); !strings.Contains(plan, q.expected) {
+			t.Errorf("expected %s in the plan of %s, got\n%s", q.expected, q.query, plan)
+		}
+	}
+}
+
+// Return a catalog in a temporary directory with tables like the routes,
+// stations and station_orders tables of the transit database: routes each
+// visit a run of consecutive stations, and routes of some lines are longer
+// than others.
+func makeTransitTestDatabase(t *testing.T) (*BufferPool, *Catalog) {
+	bp, err := NewBufferPool(1000)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	c := NewCatalog("catalog.txt", bp, t.TempDir())
+	for _, q := range []string{
+		"create table stations (station_id varchar(10) primary key, station_name varchar(20))",
+		"create table routes (route_id int primary key, line_id varchar(10), first_station_id varchar(10), last_station_id varchar(10), direction int, direction_desc varchar(10), route_name varchar(20))",
+		"create table station_orders (route_id int, station_id varchar(10), stop_order int, distance_from_last_station_miles int)",
+	} {
+		if _, _, err := Parse(c, q); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	lines := []string{"red", "orange", "blue", "green", "silver", "mattapan"}
+	var stations, routes, orders []string
+	for i := 0; i < 150; i++ {
+		stations = append(stations, fmt.Sprintf("('s%03d', 'station %d')", i, i))
+	}
+	for r := 0; r < 24; r++ {
+		line := lines[r%len(lines)]
+		first, stops := r*7%150, 5+r%len(lines)*8
+		last := (first + stops - 1) % 150
+		routes = append(routes, fmt.Sprintf("(%d, '%s', 's%03d', 's%03d', %d, 'dir%d', '%s %d')", r, line, first, last, r%2, r%2, line, r))
+		for k := 0; k < stops; k++ {
+			orders = append(orders, fmt.Sprintf("(%d, 's%03d', %d, %d)", r, (first+k)%150, k, k%3))
+		}
+	}
+	runQueryForTest(t, c, bp, "insert into stations (station_id, station_name) values "+strings.Join(stations, ", "))
+	runQueryForTest(t, c, bp, "insert into routes (route_id, line_id, first_station_id, last_station_id, direction, direction_desc, route_name) values "+strings.Join(routes, ", "))
+	runQueryForTest(t, c, bp, "insert into station_orders (route_id, station_id, stop_order, distance_from_last_station_miles) values "+strings.Join(orders, ", "))
+	if err := c.ComputeTableStats(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return bp, c
+}
+
+func TestJoinCardinalityEstimates(t *testing.T) {
+	bp, c := makeTransitTestDatabase(t)
+	queries := []string{
+		"select so.stop_order from station_orders so, routes r where so.route_id = r.route_id",
+		"select so.stop_order from station_orders so, stations s where so.station_id = s.station_id",
+		"select s.station_name from station_orders so, routes r, stations s where so.route_id = r.route_id and so.station_id = s.station_id",
+		"select s.station_name from station_orders so, routes r, stations s where so.route_id = r.route_id and so.station_id = s.station_id and r.line_id = 'red'",
+		"select r.route_name from station_orders so, routes r, stations s where so.route_id = r.route_id and so.station_id = s.station_id and s.station_name = 'station 12'",
+		"select s.station_name from station_orders so, routes r, stations s where so.route_id = r.route_id and so.station_id = s.station_id and so.stop_order < 5 and r.direction = 0",
+		"select s.station_name from routes r, stations s where r.first_station_id = s.station_id",
+		"select so.stop_order from station_orders so, routes r where so.station_id = r.last_station_id",
+		"select so.stop_order from station_orders so, stations s where so.station_id = s.station_id and s.station_id = 's010'",
+	}
+	for _, q := range queries {
+		_, plan, err := Parse(c, q)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %s", q, err.Error())
+		}
+		est := plan.(*OperatorCard).Cardinality
+		actual := len(runQueryForTest(t, c, bp, q))
+		//estimates should be within an order of magnitude
+		if est*10 < actual || est > actual*10 {
+			t.Errorf("%s: estimated %d tuples, got %d", q, est, actual)
+		}
+	}
+
+	//without statistics, each tuple joins with a tuple of a key that
+	//satisfies its table's filters
+	j := &JoinNode{leftTable: TableInfo{"so", nil, 1.0, nil}, leftField: "route_id", rightTable: TableInfo{"r", nil, 0.25, []string{"route_id"}}, rightField: "route_id"}
+	if card := EstimateJoinCardinality(j, 400, 24); card != 100 {
+		t.Errorf("expected a quarter of the tuples to join with a key, got %d", card)
+	}
+	if card := EstimateJoinCardinality(j.swap(), 24, 400); card != 100 {
+		t.Errorf("expected a quarter of the tuples to join with a key, got %d", card)
+	}
+	//the key of r doesn't bound a join of r with other tables
+	if card := estimateInputsJoinCardinality(j.swap(), 2400, 400, false, true); card != 2400 {
+		t.Errorf("expected the larger cardinality when the key's table is joined, got %d", card)
+	}
+	stats, err := c.GetTableInfo("routes")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	j = &JoinNode{leftTable: TableInfo{"r", stats.stats, 1.0, []string{"route_id"}}, leftField: "route_id", rightTable: TableInfo{"so", nil, 1.0, nil}, rightField: "route_id"}
+	single, joined := EstimateJoinCardinality(j, 24, 10), estimateInputsJoinCardinality(j, 2400, 10, false, true)
+	if single > 10 || joined <= 10 {
+		t.Errorf("expected a key to bound the join of its table alone, but not of a join of it, got %d and %d", single, joined)
+	}
+}
@@ -0,0 +1,155 @@
+package godb
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Pattern matching: LIKE and ILIKE, whose patterns match a whole string, with
+// % matching any sequence of characters, _ any single character, and a
+// backslash escaping the next character; and REGEXP (or ~), whose patterns are
+// Go regular expressions matching any part of a string. ILIKE and ~* are case
+// insensitive. Patterns are translated into regular expressions.
+//
+// The backslashes of a string LIKE pattern in a query are part of the pattern
+// as written (see escapeLikePatterns), e.g., name LIKE '100\%' matches only
+// 100%, rather than being decoded as string escapes.
+
+// Return true if op is a pattern matching operator.
+func (op BoolOp) isPattern() bool {
+	switch op {
+	case OpLike, OpNotLike, OpILike, OpNotILike, OpRegexp, OpNotRegexp, OpIRegexp, OpNotIRegexp:
+		return true
+	}
+	return false
+}
+
+// Return the case insensitive version of a pattern matching operator.
+func (op BoolOp) caseInsensitive() BoolOp {
+	switch op {
+	case OpLike:
+		return OpILike
+	case OpNotLike:
+		return OpNotILike
+	case OpRegexp:
+		return OpIRegexp
+	case OpNotRegexp:
+		return OpNotIRegexp
+	}
+	return op
+}
+
+// Return the regular expression equivalent to the LIKE pattern.
+func likeToRegexp(pattern string) string {
+	var re strings.Builder
+	re.WriteString(`^(?s:`)
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			re.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			re.WriteString(`.*`)
+		case r == '_':
+			re.WriteString(`.`)
+		default:
+			re.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		//a trailing backslash matches itself
+		re.WriteString(`\\`)
+	}
+	re.WriteString(`)$`)
+	return re.String()
+}
+
+// Compile the pattern of the pattern matching operator op.
+func compilePattern(op BoolOp, pattern string) (*regexp.Regexp, error) {
+	re := pattern
+	switch op {
+	case OpLike, OpNotLike, OpILike, OpNotILike:
+		re = likeToRegexp(pattern)
+	}
+	switch op {
+	case OpILike, OpNotILike, OpIRegexp, OpNotIRegexp:
+		re = "(?i)" + re
+	}
+	compiled, err := regexp.Compile(re)
+	if err != nil {
+		return nil, GoDBError{ParseError, fmt.Sprintf("invalid pattern '%s': %s", pattern, err.Error())}
+	}
+	return compiled, nil
+}
+
+// Return true if s matches (or, for the NOT operators, doesn't match) re.
+func matchPattern(op BoolOp, re *regexp.Regexp, s string) bool {
+	switch op {
+	case OpNotLike, OpNotILike, OpNotRegexp, OpNotIRegexp:
+		return !re.MatchString(s)
+	}
+	return re.MatchString(s)
+}
+
+// Convert the LIKE pattern with the escape character escape into one with the
+// default escape character, backslash.
+func convertLikeEscape(pattern string, escape string) (string, error) {
+	escapeRunes := []rune(escape)
+	if len(escapeRunes) != 1 {
+		return "", GoDBError{ParseError, fmt.Sprintf("escape must be a single character, got '%s'", escape)}
+	}
+	esc := escapeRunes[0]
+	if esc == '\\' {
+		return pattern, nil
+	}
+	var converted strings.Builder
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			converted.WriteRune('\\')
+			converted.WriteRune(r)
+			escaped = false
+		case r == esc:
+			escaped = true
+		case r == '\\':
+			converted.WriteString(`\\`)
+		default:
+			converted.WriteRune(r)
+		}
+	}
+	if escaped {
+		return "", GoDBError{ParseError, fmt.Sprintf("pattern '%s' ends with its escape character", pattern)}
+	}
+	return converted.String(), nil
+}
+
+// A patternMatcher evaluates a pattern matching operator, compiling its
+// pattern only when it differs from the last one, i.e., only once if the
+// pattern is constant.
+type patternMatcher struct {
+	op      BoolOp
+	pattern string
+	re      *regexp.Regexp
+}
+
+// Return true if s matches pattern, which must be a string.
+func (m *patternMatcher) match(s DBValue, pattern DBValue) (bool, error) {
+	str, ok1 := s.(StringField)
+	pat, ok2 := pattern.(StringField)
+	if !ok1 || !ok2 {
+		return false, GoDBError{TypeMismatchError, fmt.Sprintf("%s requires string arguments, got %v and %v", strings.TrimSpace(m.op.String()), s, pattern)}
+	}
+	if m.re == nil || pat.Value != m.pattern {
+		re, err := compilePattern(m.op, pat.Value)
+		if err != nil {
+			return false, err
+		}
+		m.re, m.pattern = re, pat.Value
+	}
+	return matchPattern(m.op, m.re, str.Value), nil
+}
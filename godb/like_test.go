@@ -0,0 +1,179 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestPatternMatching(t *testing.T) {
+	cases := []struct {
+		op       BoolOp
+		pattern  string
+		s        string
+		expected bool
+	}{
+		{OpLike, "s%", "sam", true},
+		{OpLike, "s%", "bo", false},
+		{OpLike, "%", "", true},
+		{OpLike, "s_m", "sam", true},
+		{OpLike, "s_m", "seem", false},
+		{OpLike, "_", "é", true},
+		{OpLike, "a%b", "a\nxb", true},
+		{OpLike, "A%", "abc", false},
+		// regular expression metacharacters match themselves
+		{OpLike, "a.c", "abc", false},
+		{OpLike, "a.c", "a.c", true},
+		{OpLike, "(a+)*", "(a+)*", true},
+		{OpLike, "[ab]", "a", false},
+		// escapes
+		{OpLike, `100\%`, "100%", true},
+		{OpLike, `100\%`, "1000", false},
+		{OpLike, `a\_b`, "a_b", true},
+		{OpLike, `a\_b`, "axb", false},
+		{OpLike, `a\\b`, `a\b`, true},
+		{OpLike, `a\`, `a\`, true},
+		{OpNotLike, "s%", "sam", false},
+		{OpNotLike, "s%", "bo", true},
+		{OpILike, "S%", "sam", true},
+		{OpILike, "%AR%", "sarah", true},
+		{OpNotILike, "S%", "sam", false},
+		// regular expressions match any part of the string
+		{OpRegexp, "ar", "sarah", true},
+		{OpRegexp, "^ar", "sarah", false},
+		{OpRegexp, "^s.*h$", "sarah", true},
+		{OpRegexp, "AR", "sarah", false},
+		{OpNotRegexp, "ar", "sarah", false},
+		{OpIRegexp, "AR", "sarah", true},
+		{OpNotIRegexp, "AR", "sarah", false},
+	}
+	for _, c := range cases {
+		m := &patternMatcher{op: c.op}
+		got, err := m.match(StringField{c.s}, StringField{c.pattern})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if got != c.expected {
+			t.Errorf("expected %v for '%s'%s'%s', got %v", c.expected, c.s, c.op, c.pattern, got)
+		}
+		if got := (StringField{c.s}).EvalPred(StringField{c.pattern}, c.op); got != c.expected {
+			t.Errorf("expected EvalPred %v for '%s'%s'%s', got %v", c.expected, c.s, c.op, c.pattern, got)
+		}
+	}
+
+	// a pattern is only compiled again when it changes
+	m := &patternMatcher{op: OpLike}
+	m.match(StringField{"sam"}, StringField{"s%"})
+	re := m.re
+	m.match(StringField{"bo"}, StringField{"s%"})
+	if m.re != re {
+		t.Errorf("expected the same pattern not to be compiled again")
+	}
+	if match, _ := m.match(StringField{"bo"}, StringField{"b%"}); !match || m.re == re {
+		t.Errorf("expected a different pattern to be compiled")
+	}
+
+	if _, err := (&patternMatcher{op: OpRegexp}).match(StringField{"a"}, StringField{"("}); err == nil {
+		t.Errorf("expected error for an invalid regular expression")
+	}
+	if _, err := (&patternMatcher{op: OpLike}).match(IntField{1}, StringField{"1"}); err == nil {
+		t.Errorf("expected error matching an int")
+	}
+}
+
+func TestConvertLikeEscape(t *testing.T) {
+	cases := []struct{ pattern, escape, expected string }{
+		{"100!%", "!", `100\%`},
+		{"a!_b!!c", "!", `a\_b\!c`},
+		{`a\b%`, "!", `a\\b%`},
+		{`a\%`, `\`, `a\%`},
+	}
+	for _, c := range cases {
+		got, err := convertLikeEscape(c.pattern, c.escape)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if got != c.expected {
+			t.Errorf("converting '%s' escape '%s': expected '%s', got '%s'", c.pattern, c.escape, c.expected, got)
+		}
+	}
+	for _, c := range []struct{ pattern, escape string }{{"a!", "!"}, {"a", "!!"}, {"a", ""}} {
+		if _, err := convertLikeEscape(c.pattern, c.escape); err == nil {
+			t.Errorf("expected error converting '%s' escape '%s'", c.pattern, c.escape)
+		}
+	}
+}
+
+func TestPatternOpRewrite(t *testing.T) {
+	queries := []struct{ query, expected string }{
+		{"select a from t where a ilike 's%'", "select a from t where a  like godb_icase('s%')"},
+		{"select a from t where a NOT ILIKE lower(b) and c = 1", "select a from t where a NOT  like godb_icase(lower(b)) and c = 1"},
+		{"select a from t where a ~ '^x' and b !~ t.c", "select a from t where a  regexp '^x' and b  not regexp t.c"},
+		{"select a from t where a ~* ('x') or b !~* 'y'", "select a from t where a  regexp godb_icase(('x')) or b  not regexp godb_icase('y')"},
+		// strings, identifiers and unary ~ aren't rewritten
+		{"select 'a ilike b', ~a, a_ilike from t", "select 'a ilike b', ~a, a_ilike from t"},
+		// the backslashes of LIKE patterns are escaped for sqlparser
+		{`select a from t where a like 'x\_y' and b not ilike "it\"s\\%" and c = 'd\_'`, `select a from t where a like 'x\\_y' and b not  like godb_icase("it\"s\\\\%") and c = 'd\_'`},
+	}
+	for _, q := range queries {
+		if got := rewritePatternOps(q.query); got != q.expected {
+			t.Errorf("rewriting %s: expected %s, got %s", q.query, q.expected, got)
+		}
+	}
+}
+
+func TestPatternQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	queries := []struct {
+		query    string
+		expected int
+	}{
+		{"select name from t where name like 's%'", 3},
+		{"select name from t where name like 's_m'", 2},
+		{"select name from t where name not like '%a%'", 3},
+		{"select name from t where name ilike 'S%' and age > 30", 2},
+		{"select name from t where name not ilike '%A%'", 3},
+		{"select name from t where name regexp '^r.*a$'", 2},
+		{"select name from t where name ~ 'ar'", 2},
+		{"select name from t where name ~* '^SA'", 3},
+		{"select name from t where name !~ 'a'", 3},
+		{"select name from t where name like 'sam!%' escape '!'", 0},
+		{"select name from t where case when 'sam%' like 'sam!%' escape '!' then name like 'b%' else 0 end = 1", 2},
+		{"select name from t where name like 'it''s'", 0},
+		// backslashes escape pattern characters, without an ESCAPE clause
+		{`select name from t where name like 's\_m'`, 0},
+		{`select name from t where name not ilike 'S\%'`, 12},
+		{`select name from t where 'x_y' like 'x\_y' and 'xay' not like 'x\_y' and name like 's%'`, 3},
+		{`select name from t where 'it''s' like 'it\'s' and name like 'b%'`, 2},
+	}
+	for _, q := range queries {
+		if tups := runQueryForTest(t, c, bp, q.query); len(tups) != q.expected {
+			t.Errorf("expected %d tuples for %s, got %d", q.expected, q.query, len(tups))
+		}
+	}
+
+	tups := runQueryForTest(t, c, bp, "select name, name like 'b%', name ilike 'B%' from t where age > 90")
+	for _, tup := range tups {
+		expected := int64(0)
+		if tup.Fields[0].(StringField).Value == "bo" {
+			expected = 1
+		}
+		if tup.Fields[1].(IntField).Value != expected || tup.Fields[2].(IntField).Value != expected {
+			t.Errorf("expected like and ilike to be %d for %v, got %v", expected, tup.Fields[0], tup.Fields[1:])
+		}
+	}
+
+	if _, _, err := Parse(c, "select name from t where name regexp 'a' escape '!'"); err == nil {
+		t.Errorf("expected error for escape with regexp")
+	}
+	if _, _, err := Parse(c, "select name from t where name like 'a' escape '!!'"); err == nil {
+		t.Errorf("expected error for a multi-character escape")
+	}
+	if err := queryErrorForTest(t, c, bp, "select name from t where name regexp '('"); err == nil {
+		t.Errorf("expected error for an invalid regular expression")
+	}
+	if err := queryErrorForTest(t, c, bp, "select name from t where age like '1%'"); err == nil {
+		t.Errorf("expected error for like on an int")
+	}
+}
@@ -5,18 +5,47 @@ import (
 )
 
 type LimitOp struct {
-	child     Operator
-	limitTups Expr
-	// Add additional fields here, if needed
+	child      Operator
+	limitTups  Expr
+	offsetTups Expr // may be nil, for no offset
 }
 
 // Construct a new limit operator. lim is how many tuples to return and child is
 // the child operator.
 func NewLimitOp(lim Expr, child Operator) *LimitOp {
+	return NewLimitOffsetOp(lim, nil, child)
+}
+
+// Construct a new limit operator that skips the first offset tuples of child
+// before returning at most lim tuples. offset may be nil, for no offset.
+func NewLimitOffsetOp(lim Expr, offset Expr, child Operator) *LimitOp {
 	return &LimitOp{
-		child:     child,
-		limitTups: lim,
+		child:      child,
+		limitTups:  lim,
+		offsetTups: offset,
+	}
+}
+
+// Evaluate the constant expression e of a LIMIT or OFFSET clause, returning
+// def if e is nil. kind names the clause in errors.
+func evalLimitExpr(e Expr, kind string, def int64) (int64, error) {
+	if e == nil {
+		return def, nil
+	}
+	value, err := e.EvalExpr(nil)
+	if err != nil {
+		return 0, fmt.Errorf("error evaluating %s expression: %v", kind, err)
+	}
+
+	// Ensure the value is a non-negative integer
+	v, ok := value.(IntField)
+	if !ok {
+		return 0, fmt.Errorf("%s expression did not evaluate to an integer", kind)
+	}
+	if v.Value < 0 {
+		return 0, fmt.Errorf("%s value cannot be negative", kind)
 	}
+	return v.Value, nil
 }
 
 // Return a TupleDescriptor for this limit.
@@ -27,21 +56,17 @@ func (l *LimitOp) Descriptor() *TupleDesc {
 
 // Limit operator implementation. This function should iterate over the results
 // of the child iterator and limit the result set to the first [lim] tuples it
-// sees (where lim is specified in the constructor).
+// sees (where lim is specified in the constructor), after skipping the first
+// offset tuples, if an offset was specified.
 func (l *LimitOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
-	// Fetch the limit value
-	limitValue, err := l.limitTups.EvalExpr(nil)
+	// Fetch the limit and offset values
+	limit, err := evalLimitExpr(l.limitTups, "limit", 0)
 	if err != nil {
-		return nil, fmt.Errorf("error evaluating limit expression: %v", err)
-	}
-
-	// Ensure the limit is an integer value
-	limit, ok := limitValue.(IntField)
-	if !ok {
-		return nil, fmt.Errorf("limit expression did not evaluate to an integer")
+		return nil, err
 	}
-	if limit.Value < 0 {
-		return nil, fmt.Errorf("limit value cannot be negative")
+	offset, err := evalLimitExpr(l.offsetTups, "offset", 0)
+	if err != nil {
+		return nil, err
 	}
 
 	// Get the child iterator
@@ -51,13 +76,19 @@ func (l *LimitOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 	}
 
 	// Track the number of tuples returned
-	count := 0
+	var count int64 = 0
 
 	// Iterator function for limiting tuples
 	return func() (*Tuple, error) {
-		if count >= int(limit.Value) {
+		if count >= limit {
 			return nil, nil // Stop when the limit is reached
 		}
+		for ; offset > 0; offset-- {
+			tuple, err := childIter()
+			if err != nil || tuple == nil {
+				return nil, err
+			}
+		}
 		tuple, err := childIter()
 		if err != nil {
 			return nil, err // Propagate errors from the child iterator
@@ -2,14 +2,16 @@ package godb
 
 import (
 	"fmt"
-	"sort"
 )
 
 type OrderBy struct {
 	orderBy   []Expr // OrderBy should include these two fields (used by parser)
 	child     Operator
 	ascending []bool
-	// TODO: You may want to add additional fields here
+
+	// The maximum number of bytes of tuples to sort in memory; larger inputs
+	// are sorted externally (see [externalSort]).
+	maxBufferBytes int
 }
 
 // Construct an order by operator. Saves the list of field, child, and ascending
@@ -17,16 +19,25 @@ type OrderBy struct {
 // expressions that can be extracted from the child operator's tuples, and the
 // ascending bitmap indicates whether the ith field in the orderByFields list
 // should be in ascending (true) or descending (false) order.
+//
+// At most [SortBufferSize] bytes of tuples are sorted in memory.
 func NewOrderBy(orderByFields []Expr, child Operator, ascending []bool) (*OrderBy, error) {
+	return NewExternalOrderBy(orderByFields, child, ascending, SortBufferSize)
+}
+
+// Construct an order by operator, as for [NewOrderBy], that holds at most
+// maxBufferBytes bytes of tuples in memory, writing sorted runs of larger
+// inputs to temporary files.
+func NewExternalOrderBy(orderByFields []Expr, child Operator, ascending []bool, maxBufferBytes int) (*OrderBy, error) {
 	if len(orderByFields) != len(ascending) {
 		return nil, fmt.Errorf("length of orderByFields and ascending must match")
 	}
 
 	return &OrderBy{
-		orderBy:   orderByFields,
-		child:     child,
-		ascending: ascending,
-		// Add additional fields if needed
+		orderBy:        orderByFields,
+		child:          child,
+		ascending:      ascending,
+		maxBufferBytes: maxBufferBytes,
 	}, nil
 }
 
@@ -40,70 +51,47 @@ func (o *OrderBy) Descriptor() *TupleDesc {
 
 // Return a function that iterates through the results of the child iterator in
 // ascending/descending order, as specified in the constructor.  This sort is
-// "blocking" -- it should first construct an in-memory sorted list of results
-// to return, and then iterate through them one by one on each subsequent
-// invocation of the iterator function.
+// "blocking" -- it first sorts all of the child's tuples, and then iterates
+// through them one by one on each subsequent invocation of the iterator
+// function.
 //
-// Although you are free to implement your own sorting logic, you may wish to
-// leverage the go sort package and the [sort.Sort] method for this purpose. To
-// use this you will need to implement three methods: Len, Swap, and Less that
-// the sort algorithm will invoke to produce a sorted list. See the first
-// example, example of SortMultiKeys, and documentation at:
-// https://pkg.go.dev/sort
+// Inputs that fit in maxBufferBytes are sorted in memory; larger ones are
+// sorted with an external merge sort, see [externalSort]. Either way, the sort
+// is stable.
 func (o *OrderBy) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 	childIter, err := o.child.Iterator(tid)
 	if err != nil {
 		return nil, err
 	}
+	return externalSort(o.child.Descriptor(), childIter, func(t1, t2 *Tuple) (bool, error) {
+		return orderByLess(o.orderBy, o.ascending, t1, t2)
+	}, o.maxBufferBytes)
+}
 
-	// Fetch all tuples from the child
-	var tuples []*Tuple
-	for {
-		tuple, err := childIter()
-		if err != nil {
-			return nil, err
-		}
-		if tuple == nil && err == nil {
-			break
+// Return true if t1 sorts before t2 when ordered by the values of orderBy, with
+// the ith expression in ascending order if ascending[i] is true, and descending
+// order otherwise.
+func orderByLess(orderBy []Expr, ascending []bool, t1 *Tuple, t2 *Tuple) (bool, error) {
+	for ind, expr := range orderBy {
+		val1, err1 := expr.EvalExpr(t1)
+		val2, err2 := expr.EvalExpr(t2)
+		if err1 != nil || err2 != nil {
+			return false, fmt.Errorf("Error evaluating expression: %v, %v", err1, err2)
 		}
-		tuples = append(tuples, tuple)
-	}
-
-	// Sort tuples using the sort package
-	sort.SliceStable(tuples, func(i, j int) bool {
-		for ind := 0; ind < len(o.orderBy); ind++ {
-			expr := o.orderBy[ind]
-			val1, err1 := expr.EvalExpr(tuples[i])
-			val2, err2 := expr.EvalExpr(tuples[j])
-			if err1 != nil || err2 != nil {
-				panic(fmt.Sprintf("Error evaluating expression: %v, %v", err1, err2))
+		switch expr.GetExprType().Ftype {
+		case IntType:
+			if val1.(IntField).Value != val2.(IntField).Value {
+				return (ascending[ind] && val1.(IntField).Value < val2.(IntField).Value) ||
+					(!ascending[ind] && val1.(IntField).Value > val2.(IntField).Value), nil
 			}
-			switch expr.GetExprType().Ftype {
-			case IntType:
-				if val1.(IntField).Value != val2.(IntField).Value {
-					return (o.ascending[ind] && val1.(IntField).Value < val2.(IntField).Value) ||
-						(!o.ascending[ind] && val1.(IntField).Value > val2.(IntField).Value)
-				}
-			case StringType:
-				if val1.(StringField).Value != val2.(StringField).Value {
-					return (o.ascending[ind] && val1.(StringField).Value < val2.(StringField).Value) ||
-						(!o.ascending[ind] && val1.(StringField).Value > val2.(StringField).Value)
-				}
-			default:
-				panic(fmt.Sprintf("Unsupported field type: %v", expr.GetExprType().Ftype))
+		case StringType:
+			if val1.(StringField).Value != val2.(StringField).Value {
+				return (ascending[ind] && val1.(StringField).Value < val2.(StringField).Value) ||
+					(!ascending[ind] && val1.(StringField).Value > val2.(StringField).Value), nil
 			}
+		default:
+			return false, fmt.Errorf("Unsupported field type: %v", expr.GetExprType().Ftype)
 		}
-		return false
-	})
-
-	// Iterator function for sorted tuples
-	index := 0
-	return func() (*Tuple, error) {
-		if index >= len(tuples) {
-			return nil, nil
-		}
-		tuple := tuples[index]
-		index++
-		return tuple, nil
-	}, nil
+	}
+	return false, nil
 }
@@ -0,0 +1,136 @@
+package godb
+
+type OuterJoin struct {
+	// Expressions that when applied to tuples from the left or right operators,
+	// respectively, return the values that must be equal for the tuples to join.
+	leftFields, rightFields []Expr
+
+	left, right Operator
+
+	// Produces the tuple, with the fields of right, that left tuples matching
+	// no tuple of right are joined with.
+	padding Operator
+}
+
+// Construct a left outer join, which emits each tuple of left joined with each
+// tuple of right with equal values of leftFields and rightFields, like an
+// equality join, and each tuple of left that matches no tuple of right joined
+// with the single tuple of padding, which must have the same fields as right.
+//
+// GoDB has no NULL, so padding supplies the values of the right fields of the
+// unmatched tuples, e.g., the value of an aggregate over no tuples for the
+// grouped aggregate of a decorrelated subquery (see decorrelate).
+func NewOuterJoin(left Operator, leftFields []Expr, right Operator, rightFields []Expr, padding Operator) (*OuterJoin, error) {
+	if len(leftFields) != len(rightFields) {
+		return nil, GoDBError{IllegalOperationError, "outer join requires the same number of left and right expressions"}
+	}
+	for i := range leftFields {
+		if leftFields[i].GetExprType().Ftype != rightFields[i].GetExprType().Ftype {
+			return nil, GoDBError{TypeMismatchError, "outer join expressions must have the same type"}
+		}
+	}
+	padFields, rightDesc := padding.Descriptor().Fields, right.Descriptor()
+	if len(padFields) != len(rightDesc.Fields) {
+		return nil, GoDBError{TypeMismatchError, "outer join padding must have the fields of the right input"}
+	}
+	for i, f := range padFields {
+		if f.Ftype != rightDesc.Fields[i].Ftype {
+			return nil, GoDBError{TypeMismatchError, "outer join padding must have the fields of the right input"}
+		}
+	}
+	return &OuterJoin{leftFields, rightFields, left, right, padding}, nil
+}
+
+// Return a TupleDesc for this outer join, with the fields of the left input
+// followed by those of the right.
+func (oj *OuterJoin) Descriptor() *TupleDesc {
+	return oj.left.Descriptor().merge(oj.right.Descriptor())
+}
+
+// Outer join operator implementation. On the first invocation, the right input
+// is read in full and its tuples are hashed on their rightFields values; the
+// left input is then streamed and probed against them. The padding tuple is
+// computed the first time a left tuple matches no right tuple.
+func (oj *OuterJoin) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	leftIter, err := oj.left.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches map[any][]*Tuple
+	build := func() error {
+		rightIter, err := oj.right.Iterator(tid)
+		if err != nil {
+			return err
+		}
+		matches = make(map[any][]*Tuple)
+		for {
+			t, err := rightIter()
+			if err != nil {
+				return err
+			}
+			if t == nil {
+				return nil
+			}
+			k, err := evalKey(oj.rightFields, t)
+			if err != nil {
+				return err
+			}
+			matches[k] = append(matches[k], t)
+		}
+	}
+
+	var padding *Tuple
+	pad := func() (*Tuple, error) {
+		if padding != nil {
+			return padding, nil
+		}
+		iter, err := oj.padding.Iterator(tid)
+		if err != nil {
+			return nil, err
+		}
+		t, err := iter()
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			return nil, GoDBError{IllegalOperationError, "outer join padding returned no rows"}
+		}
+		padding = &Tuple{Desc: *oj.right.Descriptor(), Fields: t.Fields}
+		return padding, nil
+	}
+
+	var cur *Tuple
+	var curMatches []*Tuple
+	return func() (*Tuple, error) {
+		for len(curMatches) == 0 {
+			t, err := leftIter()
+			if err != nil {
+				return nil, err
+			}
+			if t == nil {
+				return nil, nil
+			}
+			if matches == nil {
+				if err := build(); err != nil {
+					return nil, err
+				}
+			}
+			k, err := evalKey(oj.leftFields, t)
+			if err != nil {
+				return nil, err
+			}
+			cur, curMatches = t, matches[k]
+			if len(curMatches) == 0 {
+				p, err := pad()
+				if err != nil {
+					return nil, err
+				}
+				curMatches = []*Tuple{p}
+			}
+		}
+		t := joinTuples(cur, curMatches[0])
+		curMatches = curMatches[1:]
+		return t, nil
+	}, nil
+}
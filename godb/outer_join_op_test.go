@@ -0,0 +1,51 @@
+package godb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestOuterJoin(t *testing.T) {
+	td, t1, t2, hf, bp, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+
+	os.Remove(JoinTestFile)
+	hf2, _ := NewHeapFile(JoinTestFile, &td, bp)
+	insertTupleForTest(t, hf2, &t2, tid)
+	insertTupleForTest(t, hf2, &t2, tid)
+
+	field := FieldExpr{td.Fields[1]}
+	padding := NewValueOp([][]Expr{{&ConstExpr{StringField{"none"}, StringType}, &ConstExpr{IntField{-1}, IntType}}})
+	oj, err := NewOuterJoin(hf, []Expr{&field}, hf2, []Expr{&field}, padding)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(oj.Descriptor().Fields) != 4 {
+		t.Errorf("outer join descriptor should have the fields of both inputs")
+	}
+	iter, err := oj.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	//t2 matches both right tuples, and t1 none, so is joined with the padding
+	matched, padded := 0, 0
+	for tup, err := iter(); tup != nil || err != nil; tup, err = iter() {
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		switch tup.Fields[3].(IntField).Value {
+		case 999:
+			matched++
+		case -1:
+			padded++
+		}
+	}
+	if matched != 2 || padded != 1 {
+		t.Errorf("expected 2 matched and 1 padded tuples, got %d and %d", matched, padded)
+	}
+
+	if _, err := NewOuterJoin(hf, []Expr{&field}, hf2, []Expr{&field}, NewValueOp([][]Expr{{&ConstExpr{IntField{-1}, IntType}}})); err == nil {
+		t.Errorf("expected an error for padding without the fields of the right input")
+	}
+}
@@ -3,6 +3,7 @@ package godb
 import (
 	"fmt"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"unsafe"
@@ -21,24 +22,47 @@ type LogicalJoinNode struct {
 	predOp      BoolOp
 }
 
+// A LogicalSemiJoinNode represents an IN or EXISTS predicate over a subquery.
+// For IN, expr is the outer expression whose value is looked up in the single
+// column produced by subplan; for EXISTS, expr is nil.
+type LogicalSemiJoinNode struct {
+	expr    *LogicalSelectNode
+	subplan *LogicalPlan
+	anti    bool // NOT IN / NOT EXISTS
+
+	// for a decorrelated subquery, the expressions of the enclosing query
+	// that must match the trailing columns of subplan
+	outerKeys []*LogicalSelectNode
+}
+
 type SelectExprType int
 
 const (
-	ExprField SelectExprType = iota
-	ExprConst SelectExprType = iota
-	ExprFunc  SelectExprType = iota
-	ExprStar  SelectExprType = iota
-	ExprAggr  SelectExprType = iota
+	ExprField    SelectExprType = iota
+	ExprConst    SelectExprType = iota
+	ExprFunc     SelectExprType = iota
+	ExprStar     SelectExprType = iota
+	ExprAggr     SelectExprType = iota
+	ExprSubquery SelectExprType = iota
+	ExprOuterRef SelectExprType = iota
+	ExprWindow   SelectExprType = iota
+	ExprCond     SelectExprType = iota
 )
 
 type LogicalSelectNode struct {
 	exprType    SelectExprType
 	table       string
 	field       string
-	funcOp      *string //may be nil, if no aggregate
+	funcOp      *string        //may be nil, if no aggregate
+	distinct    bool           //for aggregates of distinct values, e.g. count(distinct x)
+	aggOrderBy  []*OrderByNode //for aggregates of ordered values, e.g. group_concat(x order by y)
+	window      *LogicalWindow //for window functions, e.g. rank() over (order by x)
 	alias       string
 	value       string
+	quoted      bool                 //for constants that are quoted strings, e.g., '1'
 	args        []*LogicalSelectNode //for functions other than aggregates
+	subplan     *LogicalPlan         //for scalar subqueries
+	outer       *outerTuple          //for references to an enclosing query
 	cachedField *FieldType
 }
 
@@ -86,6 +110,31 @@ func NewFuncSelectNode(op string, args []*LogicalSelectNode, alias string) Logic
 	return lsn
 }
 
+// Construct a node for a conditional expression or a cast, whose kind is one of
+// "case", "coalesce", "nullif", "cast", "and", "or", "not", or the operator of
+// a comparison (a key of BoolOpMap). See generateCondExpr for its arguments.
+func NewCondSelectNode(kind string, args []*LogicalSelectNode, alias string) LogicalSelectNode {
+	lsn := NewFuncSelectNode(kind, args, alias)
+	lsn.exprType = ExprCond
+	return lsn
+}
+
+func NewSubquerySelectNode(subplan *LogicalPlan, alias string) LogicalSelectNode {
+	lsn := LogicalSelectNode{}
+	lsn.exprType = ExprSubquery
+	lsn.subplan = subplan
+	lsn.alias = alias
+	return lsn
+}
+
+func NewOuterRefSelectNode(table string, field string) LogicalSelectNode {
+	lsn := LogicalSelectNode{}
+	lsn.exprType = ExprOuterRef
+	lsn.table = table
+	lsn.field = field
+	return lsn
+}
+
 func (t SelectExprType) String() string {
 	switch t {
 	case ExprField:
@@ -98,6 +147,14 @@ func (t SelectExprType) String() string {
 		return "ExprStar"
 	case ExprAggr:
 		return "ExprAggr"
+	case ExprSubquery:
+		return "ExprSubquery"
+	case ExprOuterRef:
+		return "ExprOuterRef"
+	case ExprWindow:
+		return "ExprWindow"
+	case ExprCond:
+		return "ExprCond"
 	default:
 		return "Unknown"
 	}
@@ -119,6 +176,20 @@ func (op BoolOp) String() string {
 		return "<"
 	case OpLike:
 		return " LIKE "
+	case OpNotLike:
+		return " NOT LIKE "
+	case OpILike:
+		return " ILIKE "
+	case OpNotILike:
+		return " NOT ILIKE "
+	case OpRegexp:
+		return " REGEXP "
+	case OpNotRegexp:
+		return " NOT REGEXP "
+	case OpIRegexp:
+		return " ~* "
+	case OpNotIRegexp:
+		return " !~* "
 	default:
 		return "??"
 	}
@@ -182,10 +253,10 @@ func checkNameInTablesOrSubqueries(table string, field string, c *Catalog, subqu
 // If catalog is non null, will try to resolve table name from catalog
 // otherwise, will not.
 func (lsn *LogicalSelectNode) getTableField(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode) (string, string, error) {
-	if lsn.exprType == ExprConst {
+	if lsn.exprType == ExprConst || lsn.exprType == ExprSubquery || lsn.exprType == ExprOuterRef {
 		return "", "", nil
 	}
-	if lsn.exprType == ExprFunc || lsn.exprType == ExprAggr {
+	if lsn.exprType == ExprFunc || lsn.exprType == ExprAggr || lsn.exprType == ExprWindow || lsn.exprType == ExprCond {
 		tabName := ""
 		fieldName := ""
 		for _, subLsn := range lsn.args {
@@ -221,12 +292,39 @@ func (lsn *LogicalSelectNode) getTableField(c *Catalog, subqueries []*LogicalPla
 	return tabName, field, nil
 }
 
+// Return true if the expression has no columns, aggregates or subqueries, so
+// that it has the same value for every tuple. It may still call a volatile
+// function such as rand, whose value differs between evaluations (see
+// [FuncExpr.volatile]).
+func (lsn *LogicalSelectNode) isConstant() bool {
+	switch lsn.exprType {
+	case ExprConst:
+		return true
+	case ExprFunc, ExprCond:
+		for _, arg := range lsn.args {
+			if !arg.isConstant() {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
 type LogicalTableNode struct {
 	tableName string
 	alias     string
 	file      *DBFile
 }
 
+// A set operation over the results of two queries. The enclosing LogicalPlan
+// only contributes its order by and limit clauses.
+type LogicalSetOpNode struct {
+	op          SetOpType
+	all         bool
+	left, right *LogicalPlan
+}
+
 type GroupBy struct {
 	expr *LogicalSelectNode
 }
@@ -236,18 +334,41 @@ type OrderByNode struct {
 	ascending bool
 }
 
+// The window of a window function, e.g., rank() over (partition by x order by
+// y). Window functions with the same key have the same partitions and order,
+// and are computed by the same [WindowOp].
+type LogicalWindow struct {
+	partitionBy []*LogicalSelectNode
+	orderBy     []*OrderByNode
+	frame       WindowFrame
+	key         string
+}
+
 type LogicalPlan struct {
 	filters       []*LogicalFilterNode
 	joins         []*LogicalJoinNode
 	selects       []*LogicalSelectNode
 	aggs          []*LogicalSelectNode
+	windows       []*LogicalSelectNode
 	tables        []*LogicalTableNode
 	subqueries    []*LogicalPlan
+	semiJoins     []*LogicalSemiJoinNode
 	groupByFields []*GroupBy
+	having        []*LogicalFilterNode
 	orderByFields []*OrderByNode
 	limit         *LogicalSelectNode
+	offset        *LogicalSelectNode
 	distinct      bool
 	alias         string
+
+	setOp *LogicalSetOpNode // non-nil for UNION, INTERSECT and EXCEPT queries
+
+	correlated  []*LogicalFilterNode // predicates referring to an enclosing query
+	outer       *outerTuple          // binding for the outer references in correlated
+	joinFilters []*LogicalFilterNode // filters applied after all joins
+	hidden      bool                 // FROM subquery added by decorrelation, not selected by *
+	outerKeys   []*LogicalSelectNode // if hidden, the enclosing query's fields equal to the first selects
+	empty       bool                 // plan the query over no tuples, e.g., for an aggregate over none
 }
 
 func (p *LogicalPlan) getSubplanFields(c *Catalog) []*FieldType {
@@ -259,252 +380,1590 @@ func (p *LogicalPlan) getSubplanFields(c *Catalog) []*FieldType {
 	return nodes
 }
 
-// Parse a where statement into a list of filters and joins.
-func parseWhere(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode, expr sqlparser.Expr) ([]*LogicalFilterNode, []*LogicalJoinNode, error) {
+// Parse a having clause into a list of filters over the output of the
+// aggregate. Either side of each filter may be an aggregate or a group by
+// expression.
+func parseHaving(c *Catalog, expr sqlparser.Expr) ([]*LogicalFilterNode, error) {
 	switch expr := expr.(type) {
 	case *sqlparser.AndExpr:
-		// Parse AND by parsing left and right sides
-		filterListLeft, joinListLeft, _ := parseWhere(c, subqueries, ts, expr.Left)
-		filterListRight, joinListRight, _ := parseWhere(c, subqueries, ts, expr.Right)
-		filterExprs := append(filterListLeft, filterListRight...)
-		joinExprs := append(joinListLeft, joinListRight...)
-		return filterExprs, joinExprs, nil
-
-	case *sqlparser.ComparisonExpr:
-		op := BoolOpMap[expr.Operator]
-		left, err := parseExpr(c, expr.Left, "")
+		left, err := parseHaving(c, expr.Left)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
-		right, err := parseExpr(c, expr.Right, "")
+		right, err := parseHaving(c, expr.Right)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
-		//here we want to search the catalog for the table id, if it's not specified
-		lTable, _, err := left.getTableField(c, subqueries, ts)
+		return append(left, right...), nil
+
+	case *sqlparser.ParenExpr:
+		return parseHaving(c, expr.Expr)
+
+	case *sqlparser.ComparisonExpr:
+		opName, rightExpr, err := parseComparisonOp(expr)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
-		rTable, _, err := right.getTableField(c, subqueries, ts)
+		op, ok := BoolOpMap[opName]
+		if !ok {
+			return nil, GoDBError{ParseError, fmt.Sprintf("unsupported operator %s in having clause", opName)}
+		}
+		left, err := parseExpr(c, expr.Left, "")
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
-		if lTable != "" && rTable != "" && lTable != rTable { //join
-			if op != OpEq {
-				return nil, nil, GoDBError{IllegalOperationError, "only equality joins are supported"}
-			}
-			return nil, []*LogicalJoinNode{{left, right, op}}, nil
-		} else {
-			return []*LogicalFilterNode{{*left, *right, op}}, nil, nil
+		right, err := parseExpr(c, rightExpr, "")
+		if err != nil {
+			return nil, err
 		}
+		return []*LogicalFilterNode{{*left, *right, op}}, nil
 
 	default:
-		return nil, nil, GoDBError{ParseError, "where expression with non value or column on RHS (disjunctions and nested where expressions are not supported)"}
+		return nil, GoDBError{ParseError, "having expression must be a conjunction of comparisons"}
 	}
 }
 
-func parseFrom(c *Catalog, t sqlparser.TableExpr) ([]*LogicalTableNode, []*LogicalPlan, []*LogicalJoinNode, error) {
-	switch tableEx := t.(type) {
-	case *sqlparser.AliasedTableExpr:
-		switch tableEx.Expr.(type) {
-		case *sqlparser.Subquery:
-			sq := (tableEx.Expr).(*sqlparser.Subquery)
-			//print("got subquery")
-			switch stmt := sq.Select.(type) {
-			case *sqlparser.Select:
-				subplan, err := parseStatement(c, stmt)
-				if err != nil {
-					return nil, nil, nil, err
-				}
-				subplan.alias = strings.ToLower(sqlparser.String(tableEx.As))
-				return nil, []*LogicalPlan{subplan}, nil, nil
-			}
-		case sqlparser.SimpleTableExpr:
-			tableName := strings.ToLower(sqlparser.GetTableName(tableEx.Expr).CompliantName())
-			//fmt.Printf("got simple table, name %s\n", tableName)
-			dbFile, err := c.GetTable(tableName)
-			if err != nil {
-				return nil, nil, nil, err
-			}
-			table := LogicalTableNode{tableName,
-				strings.ToLower(sqlparser.String(tableEx.As)),
-				&dbFile}
-			table.alias = strings.ToLower(sqlparser.String(tableEx.As))
-			return []*LogicalTableNode{&table}, nil, nil, nil
+// The names of the case insensitive versions of the pattern matching operators
+// (keys of BoolOpMap).
+var iCaseOpNames = map[string]string{
+	"like":       "ilike",
+	"not like":   "not ilike",
+	"regexp":     "~*",
+	"not regexp": "!~*",
+}
+
+// Return the name of the operator of the comparison expr (a key of BoolOpMap,
+// if it's supported) and its right hand side. The operator of a pattern
+// wrapped in a call of patternICaseName (see rewritePatternOps) is case
+// insensitive, and a LIKE pattern with an ESCAPE clause is converted into one
+// with the default escape character, backslash.
+func parseComparisonOp(expr *sqlparser.ComparisonExpr) (string, sqlparser.Expr, error) {
+	opName, right := expr.Operator, expr.Right
+	if f, ok := right.(*sqlparser.FuncExpr); ok && f.Name.Lowered() == patternICaseName {
+		iCaseName, ok := iCaseOpNames[opName]
+		if !ok || len(f.Exprs) != 1 {
+			return "", nil, GoDBError{ParseError, fmt.Sprintf("unsupported case insensitive operator %s", opName)}
 		}
-	case *sqlparser.ParenTableExpr:
-		var (
-			tables   []*LogicalTableNode
-			subplans []*LogicalPlan
-			joins    []*LogicalJoinNode
-		)
-		for _, e := range tableEx.Exprs {
-			newTables, newSubplans, newJoins, err := parseFrom(c, e)
-			if err != nil {
-				return nil, nil, nil, err
-			}
-			tables = append(tables, newTables...)
-			subplans = append(subplans, newSubplans...)
-			joins = append(joins, newJoins...)
+		pattern, ok := f.Exprs[0].(*sqlparser.AliasedExpr)
+		if !ok {
+			return "", nil, GoDBError{ParseError, "unsupported pattern"}
 		}
-		return tables, subplans, joins, nil
-	case *sqlparser.JoinTableExpr:
-		joinTable, _ := t.(*sqlparser.JoinTableExpr)
-		leftTables, leftSubplans, leftJoins, err := parseFrom(c, joinTable.LeftExpr)
+		opName, right = iCaseName, pattern.Expr
+	}
+	if expr.Escape != nil {
+		pattern, ok1 := right.(*sqlparser.SQLVal)
+		escape, ok2 := expr.Escape.(*sqlparser.SQLVal)
+		if op := BoolOpMap[opName]; op != OpLike && op != OpNotLike && op != OpILike && op != OpNotILike {
+			return "", nil, GoDBError{ParseError, fmt.Sprintf("escape is not supported with operator %s", opName)}
+		}
+		if !ok1 || !ok2 || pattern.Type != sqlparser.StrVal || escape.Type != sqlparser.StrVal {
+			return "", nil, GoDBError{ParseError, "escape is only supported with constant string patterns"}
+		}
+		converted, err := convertLikeEscape(string(pattern.Val), string(escape.Val))
 		if err != nil {
-			return nil, nil, nil, err
+			return "", nil, err
 		}
-		rightTables, rightSubplans, rightJoins, err := parseFrom(c, joinTable.RightExpr)
+		right = sqlparser.NewStrVal([]byte(converted))
+	}
+	return opName, right, nil
+}
+
+// Parse a where statement into a list of filters, joins, and semi-joins (for
+// IN and EXISTS predicates over subqueries).
+func parseWhere(c *Catalog, subqueries []*LogicalPlan, ts []*LogicalTableNode, expr sqlparser.Expr) ([]*LogicalFilterNode, []*LogicalJoinNode, []*LogicalSemiJoinNode, error) {
+	switch expr := expr.(type) {
+	case *sqlparser.AndExpr:
+		// Parse AND by parsing left and right sides
+		filterListLeft, joinListLeft, semiListLeft, err := parseWhere(c, subqueries, ts, expr.Left)
 		if err != nil {
 			return nil, nil, nil, err
 		}
-		if joinTable.Join != "join" {
-			return nil, nil, nil, GoDBError{ParseError, fmt.Sprintf("unsupported join type %s", joinTable.Join)}
-		}
-		tabList := append(leftTables, rightTables...)
-		subPlanList := append(leftSubplans, rightSubplans...)
-		_, joins, err := parseWhere(c, subPlanList, tabList, joinTable.Condition.On)
+		filterListRight, joinListRight, semiListRight, err := parseWhere(c, subqueries, ts, expr.Right)
 		if err != nil {
 			return nil, nil, nil, err
 		}
-		return tabList, subPlanList, append(leftJoins, append(rightJoins, joins...)...), nil
+		filterExprs := append(filterListLeft, filterListRight...)
+		joinExprs := append(joinListLeft, joinListRight...)
+		semiExprs := append(semiListLeft, semiListRight...)
+		return filterExprs, joinExprs, semiExprs, nil
 
-	}
-	return nil, nil, nil, GoDBError{ParseError, "unknown query type in parseFrom"}
-}
+	case *sqlparser.ParenExpr:
+		return parseWhere(c, subqueries, ts, expr.Expr)
 
-func isAgg(f string) bool {
-	return f == "count" || f == "sum" || f == "avg" || f == "min" || f == "max"
-}
+	case *sqlparser.ExistsExpr:
+		subplan, err := parseSubquery(c, expr.Subquery)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return nil, nil, []*LogicalSemiJoinNode{{expr: nil, subplan: subplan}}, nil
 
-func parseExpr(c *Catalog, expr sqlparser.Expr, alias string) (*LogicalSelectNode, error) {
-	switch expr := expr.(type) {
-	case *sqlparser.FuncExpr:
-		funName := strings.ToLower(sqlparser.String(expr.Name))
-		if isAgg(funName) {
-			if len(expr.Exprs) != 1 {
-				return nil, GoDBError{ParseError, fmt.Sprintf("expected one argument to aggregate %s in select list", sqlparser.String(expr.Name))}
-			}
-			star, ok := expr.Exprs[0].(*sqlparser.StarExpr)
-			if ok {
-				if funName != "count" {
-					return nil, GoDBError{ParseError, "got * in non-count aggregate"}
-				}
-				subField := NewFieldSelectNode(strings.ToLower(sqlparser.String(star.TableName)), "*", "")
-				field := NewAggrSelectNode(funName, &subField, alias)
-				return &field, nil
+	case *sqlparser.NotExpr:
+		filters, joins, semiJoins, err := parseWhere(c, subqueries, ts, expr.Expr)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if len(filters) != 0 || len(joins) != 0 || len(semiJoins) != 1 {
+			return nil, nil, nil, GoDBError{ParseError, "NOT is only supported before IN or EXISTS subqueries"}
+		}
+		semiJoins[0].anti = !semiJoins[0].anti
+		return nil, nil, semiJoins, nil
+
+	case *sqlparser.ComparisonExpr:
+		if expr.Operator == sqlparser.InStr || expr.Operator == sqlparser.NotInStr {
+			sq, ok := expr.Right.(*sqlparser.Subquery)
+			if !ok {
+				return nil, nil, nil, GoDBError{ParseError, "IN is only supported with a subquery"}
 			}
-			field, err := parseSelect(c, expr.Exprs[0])
+			left, err := parseExpr(c, expr.Left, "")
 			if err != nil {
-				return nil, err
-			}
-			outer := NewAggrSelectNode(funName, field, alias)
-			return &outer, nil
-		} else {
-			funName := strings.ToLower(sqlparser.String(expr.Name))
-			exprList := make([]*LogicalSelectNode, len(expr.Exprs))
-			for i, subExpr := range expr.Exprs {
-				e, err := parseSelect(c, subExpr)
-				if err != nil {
-					return nil, err
-				}
-				exprList[i] = e
+				return nil, nil, nil, err
 			}
-			if funName[0] == '\'' || funName[0] == '`' {
-				funName = funName[1 : len(funName)-1]
+			subplan, err := parseSubquery(c, sq)
+			if err != nil {
+				return nil, nil, nil, err
 			}
-			outer := NewFuncSelectNode(funName, exprList, alias)
-			return &outer, nil
+			return nil, nil, []*LogicalSemiJoinNode{{expr: left, subplan: subplan, anti: expr.Operator == sqlparser.NotInStr}}, nil
+		}
+
+		opName, rightExpr, err := parseComparisonOp(expr)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		op, ok := BoolOpMap[opName]
+		if !ok {
+			return nil, nil, nil, GoDBError{ParseError, fmt.Sprintf("unsupported operator %s in where clause", opName)}
 		}
-	case *sqlparser.BinaryExpr:
-		opname := expr.Operator
 		left, err := parseExpr(c, expr.Left, "")
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
-		right, err := parseExpr(c, expr.Right, "")
+		right, err := parseExpr(c, rightExpr, "")
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
-		exprList := make([]*LogicalSelectNode, 2)
-		exprList[0] = left
-		exprList[1] = right
-		outer := NewFuncSelectNode(opname, exprList, alias)
-		return &outer, nil
-	case *sqlparser.ParenExpr:
-		return parseExpr(c, expr.Expr, alias)
-	case *sqlparser.ColName:
-		field := NewFieldSelectNode(strings.ToLower(sqlparser.String(expr.Qualifier)), strings.ToLower(sqlparser.String(expr.Name)), alias)
-		if len(field.table) > 1 && (field.table[0] == '\'' || field.table[0] == '`') {
-			field.table = field.table[1 : len(field.table)-1]
+		//filters are applied to the table of the left hand side, so move
+		//subqueries to the right (the operands of pattern matching can't be
+		//swapped)
+		if left.exprType == ExprSubquery && right.exprType != ExprSubquery && !op.isPattern() {
+			left, right = right, left
+			op = op.flip()
 		}
-		if len(field.field) > 1 && (field.field[0] == '\'' || field.field[0] == '`') {
-			field.field = field.field[1 : len(field.field)-1]
+		//here we want to search the catalog for the table id, if it's not specified
+		lTable, _, err := left.getTableField(c, subqueries, ts)
+		if err != nil {
+			return nil, nil, nil, err
 		}
-
-		return &field, nil
-	case *sqlparser.SQLVal:
-		str := sqlparser.String(expr)
-		if str[0] == '\'' {
-			str = str[1 : len(str)-1]
-			//str = str[-1]
+		rTable, _, err := right.getTableField(c, subqueries, ts)
+		if err != nil {
+			return nil, nil, nil, err
 		}
-		field := NewConstSelectNode(str, alias)
-		return &field, nil
+		//keep constants on the right, e.g., 30 < age is age > 30, so that
+		//the filter is applied to the table of the column
+		if left.isConstant() && rTable != "" && !op.isPattern() {
+			left, right = right, left
+			lTable, rTable = rTable, lTable
+			op = op.flip()
+		}
+		if lTable != "" && rTable != "" && lTable != rTable { //join
+			//non-equality joins are only supported as correlation predicates
+			//of subqueries, and are rejected when planned as joins
+			return nil, []*LogicalJoinNode{{left, right, op}}, nil, nil
+		} else {
+			return []*LogicalFilterNode{{*left, *right, op}}, nil, nil, nil
+		}
+
 	default:
-		return nil, GoDBError{ParseError, fmt.Sprintf("unsupported expression type %s in select list", reflect.TypeOf(expr))}
+		return nil, nil, nil, GoDBError{ParseError, "where expression with non value or column on RHS (disjunctions and nested where expressions are not supported)"}
 	}
+}
 
+// Parse the statement of a subquery appearing in a FROM clause, a WHERE
+// clause, or a select list.
+func parseSubquery(c *Catalog, sq *sqlparser.Subquery) (*LogicalPlan, error) {
+	return parseSelectStatement(c, sq.Select)
 }
-func parseSelect(c *Catalog, stmt sqlparser.SelectExpr) (*LogicalSelectNode, error) {
-	star, ok := stmt.(*sqlparser.StarExpr)
-	if ok {
-		node := NewStarSelectNode(strings.ToLower(sqlparser.String(star.TableName)))
-		return &node, nil
+
+// Parse a select statement, which may be a set operation over several selects.
+func parseSelectStatement(c *Catalog, stmt sqlparser.SelectStatement) (*LogicalPlan, error) {
+	switch stmt := stmt.(type) {
+	case *sqlparser.Select:
+		return parseStatement(c, stmt)
+	case *sqlparser.ParenSelect:
+		return parseSelectStatement(c, stmt.Select)
+	case *sqlparser.Union:
+		return parseUnion(c, stmt)
 	}
+	return nil, GoDBError{ParseError, fmt.Sprintf("unsupported subquery type %s", reflect.TypeOf(stmt))}
+}
 
-	switch exprAlias := stmt.(type) {
-	case (*sqlparser.AliasedExpr):
-		alias := strings.ToLower(sqlparser.String(exprAlias.As))
-		return parseExpr(c, exprAlias.Expr, alias)
-	default:
-		return nil, GoDBError{ParseError, fmt.Sprintf("unsupported expression type %s in select list", reflect.TypeOf(exprAlias))}
+// Some statements that sqlparser can't parse are rewritten into ones it can
+// before parsing, with the information lost in the rewrite recorded in a
+// comment starting with rewriteMarker:
+//   - INTERSECT and EXCEPT are replaced with UNION ALL, and the first select of
+//     the right hand side is marked with the actual operation (see
+//     rewriteSetOps).
+//   - INSERT ... ON CONFLICT is replaced with the equivalent MySQL syntax, and
+//     the insert is marked with the conflict columns (see rewriteOnConflict).
+//
+// Window function calls, f(...) OVER (...), are instead rewritten into calls
+// of a function named windowFuncName (see rewriteWindows), the types of casts
+// into MySQL's (see rewriteCasts), pattern matching operators that sqlparser
+// can't parse into ones that it can (see rewritePatternOps), the || operator
+// into calls of concat (see rewriteConcatOps), and position(sub IN s) into
+// position(sub, s) (see rewritePositions).
+const rewriteMarker = "/*godb:"
+
+// Rewrite the expressions of query that sqlparser can't parse: the types of
+// casts, pattern matching operators, the || operator and position(sub IN s)
+// (see rewriteMarker). Any query or fragment of one, e.g., the select list of
+// a RETURNING clause, that is parsed as a select is rewritten with this.
+func rewriteExprs(query string) string {
+	return rewritePositions(rewriteConcatOps(rewritePatternOps(rewriteCasts(query))))
+}
 
-	}
+// A word (identifier or keyword) in a query, outside of any quoted string.
+type sqlWord struct {
+	start, end int
+	lower      string
 }
 
-func extractAggs(s *LogicalSelectNode) []*LogicalSelectNode {
-	switch s.exprType {
-	case ExprAggr:
-		return []*LogicalSelectNode{s}
-	case ExprFunc:
-		var aggs []*LogicalSelectNode
-		for _, subs := range s.args {
-			aggs = append(aggs, extractAggs(subs)...)
+// Return true if ch may be part of a word of a query.
+func isWordChar(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
+
+// Return the words of query, skipping quoted strings.
+func scanWords(query string) []sqlWord {
+	var words []sqlWord
+	for i := 0; i < len(query); {
+		ch := query[i]
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			j := i + 1
+			for j < len(query) && query[j] != ch {
+				if query[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			i = min(j+1, len(query))
+		case isWordChar(ch):
+			j := i
+			for j < len(query) && isWordChar(query[j]) {
+				j++
+			}
+			words = append(words, sqlWord{i, j, strings.ToLower(query[i:j])})
+			i = j
+		default:
+			i++
 		}
-		return aggs
 	}
-	return nil
+	return words
 }
 
-func parseStatement(c *Catalog, s *sqlparser.Select) (*LogicalPlan, error) {
-	from := s.From
-	var (
-		tables   []*LogicalTableNode
-		subplans []*LogicalPlan
-		joins    []*LogicalJoinNode
-		filters  []*LogicalFilterNode
-		aggs     []*LogicalSelectNode
-	)
+// Return true if only whitespace separates the words a and b of query.
+func adjacentWords(query string, a, b sqlWord) bool {
+	return strings.TrimSpace(query[a.end:b.start]) == ""
+}
 
-	for _, t := range from {
-		newTables, newSubplans, newJoins, err := parseFrom(c, t)
-		if err != nil {
-			return nil, err
+// Return the positions of the matching parenthesis of each parenthesis of
+// query, outside of quoted strings, and the depth of nesting of parentheses at
+// each position.
+func matchParens(query string) (map[int]int, []int) {
+	match := make(map[int]int)
+	depth := make([]int, len(query))
+	var open []int
+	for i := 0; i < len(query); i++ {
+		depth[i] = len(open)
+		switch ch := query[i]; ch {
+		case '\'', '"', '`':
+			j := i + 1
+			for j < len(query) && query[j] != ch {
+				if query[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			for k := i; k <= j && k < len(query); k++ {
+				depth[k] = len(open)
+			}
+			i = j
+		case '(':
+			open = append(open, i)
+		case ')':
+			if len(open) > 0 {
+				match[open[len(open)-1]] = i
+				match[i] = open[len(open)-1]
+				open = open[:len(open)-1]
+				depth[i] = len(open)
+			}
 		}
-		tables = append(tables, newTables...)
-		subplans = append(subplans, newSubplans...)
-		joins = append(joins, newJoins...)
+	}
+	return match, depth
+}
+
+// The MySQL types that the types of casts are rewritten into, by name (with
+// any length removed, e.g., varchar(10) is varchar).
+var castTypeNames = map[string]string{
+	"int":      "signed",
+	"integer":  "signed",
+	"bigint":   "signed",
+	"smallint": "signed",
+	"varchar":  "char",
+	"text":     "char",
+	"string":   "char",
+}
+
+// Rewrite the types of the casts in query that sqlparser can't parse, e.g.,
+// cast(x as int) or cast(x as varchar(10)), into the equivalent MySQL types,
+// e.g., cast(x as signed) or cast(x as char).
+func rewriteCasts(query string) string {
+	for {
+		rewritten, ok := rewriteFirstCast(query)
+		if !ok {
+			return query
+		}
+		query = rewritten
+	}
+}
+
+// Rewrite the type of the first cast of query whose type needs rewriting,
+// returning false if there is none.
+func rewriteFirstCast(query string) (string, bool) {
+	parens, depth := matchParens(query)
+	words := scanWords(query)
+	for i, w := range words {
+		if w.lower != "cast" {
+			continue
+		}
+		open := len(query) - len(strings.TrimLeft(query[w.end:], " \t\r\n"))
+		if open >= len(query) || query[open] != '(' {
+			continue
+		}
+		close, ok := parens[open]
+		if !ok {
+			continue
+		}
+		//the type follows the cast's last AS that isn't in nested parentheses
+		asEnd := -1
+		for _, as := range words[i+1:] {
+			if as.start >= close {
+				break
+			}
+			if as.lower == "as" && depth[as.start] == depth[open]+1 {
+				asEnd = as.end
+			}
+		}
+		if asEnd < 0 {
+			continue
+		}
+		typ := strings.ToLower(strings.TrimSpace(query[asEnd:close]))
+		if lengthStart := strings.IndexByte(typ, '('); lengthStart >= 0 {
+			typ = strings.TrimSpace(typ[:lengthStart])
+		}
+		if mysqlType, ok := castTypeNames[typ]; ok {
+			return query[:asEnd] + " " + mysqlType + query[close:], true
+		}
+	}
+	return query, false
+}
+
+// The name of the function that the patterns of case insensitive pattern
+// matching operators are wrapped in by rewritePatternOps.
+const patternICaseName = "godb_icase"
+
+// Rewrite the pattern matching operators in query that sqlparser can't parse:
+// ILIKE into LIKE, and ~, ~*, !~ and !~* into REGEXP or NOT REGEXP, wrapping
+// the patterns of the case insensitive operators in a call of
+// patternICaseName, e.g.,
+//
+//	name not ilike 's%' and name ~* '^S'
+//
+// becomes
+//
+//	name not like godb_icase('s%') and name regexp godb_icase('^S')
+//
+// Case insensitive operators whose pattern isn't a string, a column, a
+// function call or a parenthesized expression are left as they are, so that
+// parsing them fails.
+//
+// The backslashes of LIKE patterns are then escaped (see escapeLikePatterns).
+func rewritePatternOps(query string) string {
+	for {
+		rewritten, ok := rewriteFirstPatternOp(query)
+		if !ok {
+			return escapeLikePatterns(query)
+		}
+		query = rewritten
+	}
+}
+
+// Double the backslashes in the string patterns of the LIKE operators of query
+// (including those of ILIKE, rewritten by rewritePatternOps), so that
+// sqlparser, which decodes backslash escape sequences in strings, passes them
+// to the pattern as written: name like 'x\_y' matches only x_y. A backslash
+// before a quote still escapes the quote.
+func escapeLikePatterns(query string) string {
+	words := scanWords(query)
+	//rewrite from the end, so that the positions of earlier words are valid
+	for w := len(words) - 1; w >= 0; w-- {
+		if words[w].lower != "like" {
+			continue
+		}
+		start := len(query) - len(strings.TrimLeft(query[words[w].end:], " \t\r\n"))
+		if strings.HasPrefix(query[start:], patternICaseName+"(") {
+			start += len(patternICaseName) + 1
+			start = len(query) - len(strings.TrimLeft(query[start:], " \t\r\n"))
+		}
+		if start == len(query) || query[start] != '\'' && query[start] != '"' {
+			continue
+		}
+		quote, end := query[start], quoteEnd(query, start)
+		var pattern strings.Builder
+		for i := start + 1; i < end; i++ {
+			switch {
+			case query[i] == '\\' && i+1 < end && query[i+1] == quote:
+				pattern.WriteString(query[i : i+2])
+				i++
+			case query[i] == '\\':
+				pattern.WriteString(`\\`)
+			default:
+				pattern.WriteByte(query[i])
+			}
+		}
+		query = query[:start+1] + pattern.String() + query[end:]
+	}
+	return query
+}
+
+// Rewrite the first pattern matching operator of query that sqlparser can't
+// parse, returning false if there is none.
+func rewriteFirstPatternOp(query string) (string, bool) {
+	for i := 0; i < len(query); i++ {
+		if ch := query[i]; ch == '\'' || ch == '"' || ch == '`' {
+			i = quoteEnd(query, i)
+			continue
+		}
+		var opLen int
+		var op string
+		iCase := false
+		rest := query[i:]
+		switch {
+		case strings.HasPrefix(rest, "!~*"):
+			opLen, op, iCase = 3, "not regexp", true
+		case strings.HasPrefix(rest, "~*"):
+			opLen, op, iCase = 2, "regexp", true
+		case strings.HasPrefix(rest, "!~"):
+			opLen, op = 2, "not regexp"
+		case strings.HasPrefix(rest, "~"):
+			opLen, op = 1, "regexp"
+		case len(rest) >= 5 && strings.EqualFold(rest[:5], "ilike") && (i == 0 || !isWordChar(query[i-1])) && (len(rest) == 5 || !isWordChar(rest[5])):
+			opLen, op, iCase = 5, "like", true
+		default:
+			continue
+		}
+		//~ is also unary bitwise negation, which isn't rewritten
+		before := strings.TrimRight(query[:i], " \t\r\n")
+		if before == "" {
+			continue
+		}
+		if last := before[len(before)-1]; !isWordChar(last) && last != ')' && last != '\'' && last != '"' && last != '`' {
+			continue
+		}
+		patternStart := len(query) - len(strings.TrimLeft(query[i+opLen:], " \t\r\n"))
+		if !iCase {
+			return query[:i] + " " + op + " " + query[patternStart:], true
+		}
+		patternEnd := operandEnd(query, patternStart)
+		if patternEnd < 0 {
+			continue
+		}
+		return query[:i] + " " + op + " " + patternICaseName + "(" + query[patternStart:patternEnd] + ")" + query[patternEnd:], true
+	}
+	return query, false
+}
+
+// Return the position of the quote closing the quoted string starting at
+// start (or the end of query, if it isn't closed). A doubled quote, e.g., in
+// 'it”s', doesn't close the string.
+func quoteEnd(query string, start int) int {
+	quote := query[start]
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(query)
+}
+
+// Return the end of the operand of query starting at start: a quoted string, a
+// parenthesized expression, or a possibly qualified column or a function call.
+// Returns -1 if there is no such operand at start.
+func operandEnd(query string, start int) int {
+	if start >= len(query) {
+		return -1
+	}
+	parens, _ := matchParens(query)
+	switch ch := query[start]; {
+	case ch == '\'' || ch == '"':
+		if end := quoteEnd(query, start); end < len(query) {
+			return end + 1
+		}
+		return -1
+	case ch == '(':
+		if end, ok := parens[start]; ok {
+			return end + 1
+		}
+		return -1
+	case isWordChar(ch) || ch == '`':
+		end := start
+		for end < len(query) && (isWordChar(query[end]) || query[end] == '.' || query[end] == '`') {
+			end++
+		}
+		call := len(query) - len(strings.TrimLeft(query[end:], " \t\r\n"))
+		if call < len(query) && query[call] == '(' {
+			if callEnd, ok := parens[call]; ok {
+				return callEnd + 1
+			}
+			return -1
+		}
+		return end
+	}
+	return -1
+}
+
+// The name of the function that window function calls are rewritten into (see
+// rewriteWindows), and of the functions of its arguments describing the window.
+const (
+	windowFuncName        = "godb_window"
+	windowPartitionByName = "godb_partition_by"
+	windowOrderByName     = "godb_order_by"
+	windowFrameName       = "godb_frame"
+)
+
+// Rewrite the window function calls in query, which sqlparser can't parse, into
+// calls of windowFuncName whose first argument is the call of the window
+// function, and whose remaining arguments describe the window, e.g.,
+//
+//	sum(x) over (partition by y order by z desc rows 2 preceding)
+//
+// becomes
+//
+//	godb_window(sum(x), godb_partition_by(y), godb_order_by(z, 'desc'),
+//	            godb_frame('rows', '2 preceding', 'current row'))
+//
+// Calls whose window can't be rewritten (e.g., named windows) are left as they
+// are, so that parsing them fails.
+func rewriteWindows(query string) string {
+	for {
+		rewritten, ok := rewriteFirstWindow(query)
+		if !ok {
+			return query
+		}
+		query = rewritten
+	}
+}
+
+// Rewrite the first window function call of query, returning false if there is
+// none that can be rewritten.
+func rewriteFirstWindow(query string) (string, bool) {
+	parens, _ := matchParens(query)
+	for _, w := range scanWords(query) {
+		if w.lower != "over" {
+			continue
+		}
+		callEnd := len(strings.TrimSpace(query[:w.start])) - 1
+		specStart := w.end + len(query[w.end:]) - len(strings.TrimLeft(query[w.end:], " \t\r\n"))
+		if callEnd < 0 || query[callEnd] != ')' || specStart >= len(query) || query[specStart] != '(' {
+			continue
+		}
+		callStart, ok1 := parens[callEnd]
+		specEnd, ok2 := parens[specStart]
+		if !ok1 || !ok2 {
+			continue
+		}
+		nameEnd := len(strings.TrimRight(query[:callStart], " \t\r\n"))
+		nameStart := nameEnd
+		for nameStart > 0 && isWordChar(query[nameStart-1]) {
+			nameStart--
+		}
+		if nameStart == nameEnd {
+			continue
+		}
+		spec, ok := rewriteWindowSpec(query[specStart+1 : specEnd])
+		if !ok {
+			continue
+		}
+		return query[:nameStart] + windowFuncName + "(" + query[nameStart:callEnd+1] + spec + ")" + query[specEnd+1:], true
+	}
+	return query, false
+}
+
+// Rewrite the window specification of a window function call, i.e., the text
+// in the parentheses after OVER, into the arguments of windowFuncName after
+// the call (see rewriteWindows).
+func rewriteWindowSpec(spec string) (string, bool) {
+	_, depth := matchParens(spec)
+	var words []sqlWord
+	for _, w := range scanWords(spec) {
+		if depth[w.start] == 0 {
+			words = append(words, w)
+		}
+	}
+	// the positions in spec of each clause, and of the text after its keywords
+	partitionStart, partitionText := -1, -1
+	orderStart, orderText := -1, -1
+	frameStart := -1
+	for i, w := range words {
+		next := ""
+		if i+1 < len(words) && adjacentWords(spec, w, words[i+1]) {
+			next = words[i+1].lower
+		}
+		switch {
+		case w.lower == "partition" && next == "by" && partitionStart < 0:
+			partitionStart, partitionText = w.start, words[i+1].end
+		case w.lower == "order" && next == "by" && orderStart < 0:
+			orderStart, orderText = w.start, words[i+1].end
+		case (w.lower == "rows" || w.lower == "range") && frameStart < 0:
+			frameStart = w.start
+		}
+	}
+	// the clauses must be in order, with nothing before them
+	clauseStarts := []int{}
+	for _, start := range []int{partitionStart, orderStart, frameStart} {
+		if start >= 0 {
+			if len(clauseStarts) > 0 && start < clauseStarts[len(clauseStarts)-1] {
+				return "", false
+			}
+			clauseStarts = append(clauseStarts, start)
+		}
+	}
+	if len(clauseStarts) > 0 && strings.TrimSpace(spec[:clauseStarts[0]]) != "" {
+		return "", false
+	}
+	if len(clauseStarts) == 0 && strings.TrimSpace(spec) != "" {
+		return "", false
+	}
+	clauseEnd := func(start int) int {
+		for _, s := range clauseStarts {
+			if s > start {
+				return s
+			}
+		}
+		return len(spec)
+	}
+
+	var out strings.Builder
+	if partitionStart >= 0 {
+		fmt.Fprintf(&out, ", %s(%s)", windowPartitionByName, strings.TrimSpace(spec[partitionText:clauseEnd(partitionStart)]))
+	}
+	if orderStart >= 0 {
+		var items []string
+		for _, item := range splitTopLevel(spec[orderText:clauseEnd(orderStart)], ',') {
+			dir := "asc"
+			itemWords := scanWords(item)
+			if n := len(itemWords); n > 1 && (itemWords[n-1].lower == "asc" || itemWords[n-1].lower == "desc") {
+				dir = itemWords[n-1].lower
+				item = item[:itemWords[n-1].start]
+			}
+			if strings.TrimSpace(item) == "" {
+				return "", false
+			}
+			items = append(items, fmt.Sprintf("%s, '%s'", strings.TrimSpace(item), dir))
+		}
+		fmt.Fprintf(&out, ", %s(%s)", windowOrderByName, strings.Join(items, ", "))
+	}
+	if frameStart >= 0 {
+		var frameWords []string
+		for _, w := range scanWords(spec[frameStart:]) {
+			frameWords = append(frameWords, w.lower)
+		}
+		if strings.ContainsAny(spec[frameStart:], "'\"`(),") {
+			return "", false
+		}
+		start, end := strings.Join(frameWords[1:], " "), "current row"
+		if len(frameWords) > 1 && frameWords[1] == "between" {
+			bounds := strings.SplitN(strings.Join(frameWords[2:], " "), " and ", 2)
+			if len(bounds) != 2 {
+				return "", false
+			}
+			start, end = bounds[0], bounds[1]
+		}
+		fmt.Fprintf(&out, ", %s('%s', '%s', '%s')", windowFrameName, frameWords[0], start, end)
+	}
+	return out.String(), true
+}
+
+// Rewrite the INTERSECT [ALL] and EXCEPT [ALL] operations in query so that it
+// can be parsed by sqlparser (see rewriteMarker).
+//
+// The rewritten operations are parsed with the same precedence as UNION;
+// parseUnion restores the precedence of INTERSECT.
+func rewriteSetOps(query string) string {
+	var out strings.Builder
+	marker := ""
+	last := 0
+	words := scanWords(query)
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		switch w.lower {
+		case "intersect", "except":
+			out.WriteString(query[last:w.start])
+			out.WriteString("union all")
+			last = w.end
+			marker = rewriteMarker + w.lower
+			if i+1 < len(words) && adjacentWords(query, w, words[i+1]) {
+				switch words[i+1].lower {
+				case "all":
+					marker += " all"
+					fallthrough
+				case "distinct":
+					i++
+					last = words[i].end
+				}
+			}
+			marker += "*/"
+		case "select":
+			if marker != "" {
+				out.WriteString(query[last:w.end])
+				out.WriteString(" " + marker)
+				last = w.end
+				marker = ""
+			}
+		}
+	}
+	out.WriteString(query[last:])
+	return out.String()
+}
+
+// Rewrite INSERT ... ON CONFLICT [(cols)] DO UPDATE SET ... into MySQL's
+// INSERT ... ON DUPLICATE KEY UPDATE ..., and ON CONFLICT [(cols)] DO NOTHING
+// into INSERT IGNORE, so that query can be parsed by sqlparser. The conflict
+// columns, if any, are recorded in a comment after INSERT (see rewriteMarker).
+func rewriteOnConflict(query string) string {
+	words := scanWords(query)
+	if len(words) == 0 || words[0].lower != "insert" {
+		return query
+	}
+	for i := 1; i+3 < len(words); i++ {
+		if words[i].lower != "on" || words[i+1].lower != "conflict" || !adjacentWords(query, words[i], words[i+1]) {
+			continue
+		}
+		// the optional parenthesized conflict columns come before DO
+		j := i + 2
+		for j < len(words) && words[j].lower != "do" {
+			j++
+		}
+		if j+1 >= len(words) {
+			return query
+		}
+		target := strings.TrimSpace(query[words[i+1].end:words[j].start])
+		if target != "" && (target[0] != '(' || target[len(target)-1] != ')') {
+			return query
+		}
+		target = strings.TrimSpace(strings.Trim(target, "()"))
+
+		var insert, clause string
+		var end int
+		switch words[j+1].lower {
+		case "nothing":
+			insert, clause, end = "insert ignore", "", words[j+1].end
+		case "update":
+			if j+2 >= len(words) || words[j+2].lower != "set" {
+				return query
+			}
+			insert, clause, end = "insert", "on duplicate key update", words[j+2].end
+		default:
+			return query
+		}
+		if target != "" {
+			insert = fmt.Sprintf("insert %sconflict %s*/%s", rewriteMarker, target, strings.TrimPrefix(insert, "insert"))
+		}
+		return insert + query[words[0].end:words[i].start] + clause + query[end:]
+	}
+	return query
+}
+
+// Return the conflict columns recorded by rewriteOnConflict in the comments of
+// an insert statement, or nil if there are none.
+func conflictColumns(comments sqlparser.Comments) []string {
+	for _, comment := range comments {
+		target, found := strings.CutPrefix(string(comment), rewriteMarker+"conflict ")
+		if !found {
+			continue
+		}
+		var cols []string
+		for _, col := range strings.Split(strings.TrimSuffix(target, "*/"), ",") {
+			cols = append(cols, strings.ToLower(strings.TrimSpace(col)))
+		}
+		return cols
+	}
+	return nil
+}
+
+// Split query, an INSERT, UPDATE or DELETE, into the statement and the select
+// list of its RETURNING clause, which sqlparser can't parse. The select list is
+// empty if there is no RETURNING clause.
+func splitReturning(query string) (string, string) {
+	words := scanWords(query)
+	if len(words) == 0 {
+		return query, ""
+	}
+	switch words[0].lower {
+	case "insert", "update", "delete":
+	default:
+		return query, ""
+	}
+	for _, w := range words[1:] {
+		if w.lower == "returning" {
+			return query[:w.start], strings.TrimSuffix(strings.TrimSpace(query[w.end:]), ";")
+		}
+	}
+	return query, ""
+}
+
+// The words that end the DEFAULT expression of a column definition.
+var columnAttributeWords = map[string]bool{
+	"primary": true, "not": true, "null": true, "unique": true, "key": true,
+	"comment": true, "auto_increment": true, "collate": true,
+}
+
+// Split the DEFAULT expressions of the columns of query, a CREATE TABLE
+// statement, from it, since sqlparser only allows them to be literals. Returns
+// the statement without them and the text of each column's expression, by
+// lowercased column name.
+func splitDefaults(query string) (string, map[string]string) {
+	words := scanWords(query)
+	if len(words) < 2 || words[0].lower != "create" || words[1].lower != "table" {
+		return query, nil
+	}
+	_, depth := matchParens(query)
+	defaults := make(map[string]string)
+	var out strings.Builder
+	last := 0
+	column := ""
+	for i := 2; i < len(words); i++ {
+		w := words[i]
+		if w.start < last || depth[w.start] != 1 {
+			continue
+		}
+		//a column definition starts after the ( or , before it
+		if before := strings.TrimSpace(query[:w.start]); strings.HasSuffix(before, "(") || strings.HasSuffix(before, ",") {
+			column = w.lower
+		}
+		if w.lower != "default" {
+			continue
+		}
+		//the expression ends at the , or ) that ends the definition
+		end := w.end
+		for end < len(query) && depth[end] > 0 && (query[end] != ',' || depth[end] != 1) {
+			if ch := query[end]; ch == '\'' || ch == '"' || ch == '`' {
+				end++
+				for end < len(query) && query[end] != ch {
+					if query[end] == '\\' {
+						end++
+					}
+					end++
+				}
+			}
+			end = min(end+1, len(query))
+		}
+		for _, next := range words[i+1:] {
+			if next.start >= end {
+				break
+			}
+			if depth[next.start] == 1 && columnAttributeWords[next.lower] {
+				end = next.start
+				break
+			}
+		}
+		defaults[column] = strings.TrimSpace(query[w.end:end])
+		out.WriteString(query[last:w.start])
+		last = end
+	}
+	out.WriteString(query[last:])
+	return out.String(), defaults
+}
+
+// Return the tables of the statement "ANALYZE [table [, table ...]]", which
+// sqlparser can't parse, and whether query is one; no tables means all of
+// them.
+func parseAnalyze(query string) ([]string, bool, error) {
+	words := scanWords(query)
+	if len(words) == 0 || words[0].lower != "analyze" {
+		return nil, false, nil
+	}
+	rest := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(query[words[0].end:]), ";"))
+	if rest == "" {
+		return nil, true, nil
+	}
+	var tables []string
+	for _, name := range strings.Split(rest, ",") {
+		name = strings.Trim(strings.TrimSpace(name), "`")
+		if name == "" || strings.IndexFunc(name, func(r rune) bool { return r > 127 || !isWordChar(byte(r)) }) >= 0 {
+			return nil, true, GoDBError{ParseError, fmt.Sprintf("invalid ANALYZE statement %s", query)}
+		}
+		tables = append(tables, name)
+	}
+	return tables, true, nil
+}
+
+// Return the set operation named by the marker comment of the first select of
+// stmt, if any.
+func setOpOfStatement(stmt sqlparser.SelectStatement) (op SetOpType, all bool, ok bool) {
+	switch stmt := stmt.(type) {
+	case *sqlparser.ParenSelect:
+		return setOpOfStatement(stmt.Select)
+	case *sqlparser.Union:
+		return setOpOfStatement(stmt.Left)
+	case *sqlparser.Select:
+		for _, comment := range stmt.Comments {
+			name, found := strings.CutPrefix(string(comment), rewriteMarker)
+			if !found {
+				continue
+			}
+			name, all = strings.CutSuffix(strings.TrimSuffix(name, "*/"), " all")
+			switch name {
+			case "intersect":
+				return SetIntersect, all, true
+			case "except":
+				return SetExcept, all, true
+			}
+		}
+	}
+	return SetUnion, false, false
+}
+
+// A set operation of a chain of set operations, and the input on its right.
+type setOpTerm struct {
+	op    SetOpType
+	all   bool
+	right *LogicalPlan
+}
+
+// Return the plan of the chain of set operations u. sqlparser parses the
+// chain left to right, but, as in standard SQL, INTERSECT binds more tightly
+// than UNION and EXCEPT, so the intersections are applied first; parenthesized
+// operations are inputs of the chain.
+func parseUnion(c *Catalog, u *sqlparser.Union) (*LogicalPlan, error) {
+	var first *LogicalPlan
+	var terms []setOpTerm
+	var flatten func(stmt sqlparser.SelectStatement) error
+	flatten = func(stmt sqlparser.SelectStatement) error {
+		inner, ok := stmt.(*sqlparser.Union)
+		if !ok {
+			plan, err := parseSelectStatement(c, stmt)
+			first = plan
+			return err
+		}
+		if err := flatten(inner.Left); err != nil {
+			return err
+		}
+		right, err := parseSelectStatement(c, inner.Right)
+		if err != nil {
+			return err
+		}
+		op, all, ok := setOpOfStatement(inner.Right)
+		if !ok {
+			op, all = SetUnion, inner.Type == sqlparser.UnionAllStr
+		}
+		terms = append(terms, setOpTerm{op, all, right})
+		return nil
+	}
+	if err := flatten(u); err != nil {
+		return nil, err
+	}
+
+	//apply the intersections to the inputs they follow
+	inputs := []*LogicalPlan{first}
+	var ops []setOpTerm
+	for _, t := range terms {
+		if t.op == SetIntersect {
+			last := inputs[len(inputs)-1]
+			inputs[len(inputs)-1] = &LogicalPlan{setOp: &LogicalSetOpNode{t.op, t.all, last, t.right}}
+			continue
+		}
+		inputs = append(inputs, t.right)
+		ops = append(ops, t)
+	}
+	plan := inputs[0]
+	for i, t := range ops {
+		plan = &LogicalPlan{setOp: &LogicalSetOpNode{t.op, t.all, plan, inputs[i+1]}}
+	}
+
+	orderBys, err := parseOrderBy(c, u.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+	limExpr, offsetExpr, err := parseLimit(c, u.Limit)
+	if err != nil {
+		return nil, err
+	}
+	//the order and limit apply to the result of the whole chain
+	plan.orderByFields, plan.limit, plan.offset = orderBys, limExpr, offsetExpr
+	return plan, nil
+}
+
+func parseFrom(c *Catalog, t sqlparser.TableExpr) ([]*LogicalTableNode, []*LogicalPlan, []*LogicalJoinNode, error) {
+	switch tableEx := t.(type) {
+	case *sqlparser.AliasedTableExpr:
+		switch tableEx.Expr.(type) {
+		case *sqlparser.Subquery:
+			sq := (tableEx.Expr).(*sqlparser.Subquery)
+			//print("got subquery")
+			subplan, err := parseSubquery(c, sq)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			subplan.alias = strings.ToLower(sqlparser.String(tableEx.As))
+			return nil, []*LogicalPlan{subplan}, nil, nil
+		case sqlparser.SimpleTableExpr:
+			tableName := strings.ToLower(sqlparser.GetTableName(tableEx.Expr).CompliantName())
+			//fmt.Printf("got simple table, name %s\n", tableName)
+			dbFile, err := c.GetTable(tableName)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			table := LogicalTableNode{tableName,
+				strings.ToLower(sqlparser.String(tableEx.As)),
+				&dbFile}
+			table.alias = strings.ToLower(sqlparser.String(tableEx.As))
+			return []*LogicalTableNode{&table}, nil, nil, nil
+		}
+	case *sqlparser.ParenTableExpr:
+		var (
+			tables   []*LogicalTableNode
+			subplans []*LogicalPlan
+			joins    []*LogicalJoinNode
+		)
+		for _, e := range tableEx.Exprs {
+			newTables, newSubplans, newJoins, err := parseFrom(c, e)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			tables = append(tables, newTables...)
+			subplans = append(subplans, newSubplans...)
+			joins = append(joins, newJoins...)
+		}
+		return tables, subplans, joins, nil
+	case *sqlparser.JoinTableExpr:
+		joinTable, _ := t.(*sqlparser.JoinTableExpr)
+		leftTables, leftSubplans, leftJoins, err := parseFrom(c, joinTable.LeftExpr)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		rightTables, rightSubplans, rightJoins, err := parseFrom(c, joinTable.RightExpr)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if joinTable.Join != "join" {
+			return nil, nil, nil, GoDBError{ParseError, fmt.Sprintf("unsupported join type %s", joinTable.Join)}
+		}
+		tabList := append(leftTables, rightTables...)
+		subPlanList := append(leftSubplans, rightSubplans...)
+		_, joins, semiJoins, err := parseWhere(c, subPlanList, tabList, joinTable.Condition.On)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if len(semiJoins) > 0 {
+			return nil, nil, nil, GoDBError{ParseError, "subqueries are not supported in join conditions"}
+		}
+		return tabList, subPlanList, append(leftJoins, append(rightJoins, joins...)...), nil
+
+	}
+	return nil, nil, nil, GoDBError{ParseError, "unknown query type in parseFrom"}
+}
+
+func isAgg(f string) bool {
+	_, ok := aggFuncs[f]
+	return ok
+}
+
+func parseExpr(c *Catalog, expr sqlparser.Expr, alias string) (*LogicalSelectNode, error) {
+	switch expr := expr.(type) {
+	case *sqlparser.FuncExpr:
+		funName := strings.ToLower(sqlparser.String(expr.Name))
+		//names that are keywords, such as mode, are quoted
+		if funName[0] == '\'' || funName[0] == '`' {
+			funName = funName[1 : len(funName)-1]
+		}
+		if funName == windowFuncName {
+			return parseWindow(c, expr, alias)
+		}
+		if condFuncNames[funName] {
+			if expr.Distinct {
+				return nil, GoDBError{ParseError, fmt.Sprintf("unexpected distinct in %s", funName)}
+			}
+			args, err := parseExprList(c, expr.Exprs)
+			if err != nil {
+				return nil, err
+			}
+			outer := NewCondSelectNode(funName, args, alias)
+			return &outer, nil
+		}
+		if isAgg(funName) {
+			if nArgs := aggFuncs[funName].args + 1; len(expr.Exprs) != nArgs {
+				return nil, GoDBError{ParseError, fmt.Sprintf("expected %d argument(s) to aggregate %s in select list", nArgs, sqlparser.String(expr.Name))}
+			}
+			star, ok := expr.Exprs[0].(*sqlparser.StarExpr)
+			if ok {
+				if funName != "count" {
+					return nil, GoDBError{ParseError, "got * in non-count aggregate"}
+				}
+				if expr.Distinct {
+					return nil, GoDBError{ParseError, "got * in distinct aggregate"}
+				}
+				subField := NewFieldSelectNode(strings.ToLower(sqlparser.String(star.TableName)), "*", "")
+				field := NewAggrSelectNode(funName, &subField, alias)
+				return &field, nil
+			}
+			field, err := parseSelect(c, expr.Exprs[0])
+			if err != nil {
+				return nil, err
+			}
+			outer := NewAggrSelectNode(funName, field, alias)
+			outer.distinct = expr.Distinct
+			for _, argExpr := range expr.Exprs[1:] {
+				arg, err := parseSelect(c, argExpr)
+				if err != nil {
+					return nil, err
+				}
+				outer.args = append(outer.args, arg)
+			}
+			return &outer, nil
+		} else {
+			exprList, err := parseExprList(c, expr.Exprs)
+			if err != nil {
+				return nil, err
+			}
+			outer := NewFuncSelectNode(funName, exprList, alias)
+			return &outer, nil
+		}
+	case *sqlparser.GroupConcatExpr:
+		if len(expr.Exprs) != 1 {
+			return nil, GoDBError{ParseError, "expected one expression to concatenate in group_concat"}
+		}
+		field, err := parseSelect(c, expr.Exprs[0])
+		if err != nil {
+			return nil, err
+		}
+		orderBy, err := parseOrderBy(c, expr.OrderBy)
+		if err != nil {
+			return nil, err
+		}
+		if expr.Distinct != "" && len(orderBy) > 0 {
+			return nil, GoDBError{ParseError, "group_concat with both distinct and order by is not supported"}
+		}
+		//the separator is formatted as " separator 'sep'"
+		sep := ","
+		if expr.Separator != "" {
+			sep = strings.TrimPrefix(expr.Separator, " separator ")
+			sep = sep[1 : len(sep)-1]
+		}
+		sepNode := NewConstSelectNode(sep, "")
+		outer := NewAggrSelectNode("group_concat", field, alias)
+		outer.args = append(outer.args, &sepNode)
+		outer.distinct = expr.Distinct != ""
+		outer.aggOrderBy = orderBy
+		return &outer, nil
+	case *sqlparser.BinaryExpr:
+		opname := expr.Operator
+		left, err := parseExpr(c, expr.Left, "")
+		if err != nil {
+			return nil, err
+		}
+		right, err := parseExpr(c, expr.Right, "")
+		if err != nil {
+			return nil, err
+		}
+		exprList := make([]*LogicalSelectNode, 2)
+		exprList[0] = left
+		exprList[1] = right
+		outer := NewFuncSelectNode(opname, exprList, alias)
+		return &outer, nil
+	case *sqlparser.ParenExpr:
+		return parseExpr(c, expr.Expr, alias)
+	case *sqlparser.CaseExpr:
+		var args []*LogicalSelectNode
+		for _, when := range expr.Whens {
+			cond, err := parseExpr(c, when.Cond, "")
+			if err != nil {
+				return nil, err
+			}
+			if expr.Expr != nil {
+				//CASE x WHEN v ... is CASE WHEN x = v ...
+				operand, err := parseExpr(c, expr.Expr, "")
+				if err != nil {
+					return nil, err
+				}
+				eq := NewCondSelectNode("=", []*LogicalSelectNode{operand, cond}, "")
+				cond = &eq
+			}
+			result, err := parseExpr(c, when.Val, "")
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, cond, result)
+		}
+		if expr.Else != nil {
+			elseNode, err := parseExpr(c, expr.Else, "")
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, elseNode)
+		}
+		outer := NewCondSelectNode("case", args, alias)
+		return &outer, nil
+	case *sqlparser.ConvertExpr:
+		arg, err := parseExpr(c, expr.Expr, "")
+		if err != nil {
+			return nil, err
+		}
+		outer := NewCondSelectNode("cast", []*LogicalSelectNode{arg}, alias)
+		switch strings.ToLower(expr.Type.Type) {
+		case "signed", "unsigned":
+			outer.value = "int"
+		case "char", "nchar", "binary":
+			outer.value = "string"
+		default:
+			return nil, GoDBError{ParseError, fmt.Sprintf("unsupported type %s in cast", expr.Type.Type)}
+		}
+		return &outer, nil
+	case *sqlparser.ComparisonExpr:
+		opName, rightExpr, err := parseComparisonOp(expr)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := BoolOpMap[opName]; !ok {
+			return nil, GoDBError{ParseError, fmt.Sprintf("unsupported operator %s in expression", opName)}
+		}
+		left, err := parseExpr(c, expr.Left, "")
+		if err != nil {
+			return nil, err
+		}
+		right, err := parseExpr(c, rightExpr, "")
+		if err != nil {
+			return nil, err
+		}
+		outer := NewCondSelectNode(opName, []*LogicalSelectNode{left, right}, alias)
+		return &outer, nil
+	case *sqlparser.AndExpr, *sqlparser.OrExpr:
+		kind, l, r := "and", sqlparser.Expr(nil), sqlparser.Expr(nil)
+		if and, ok := expr.(*sqlparser.AndExpr); ok {
+			l, r = and.Left, and.Right
+		} else {
+			or := expr.(*sqlparser.OrExpr)
+			kind, l, r = "or", or.Left, or.Right
+		}
+		left, err := parseExpr(c, l, "")
+		if err != nil {
+			return nil, err
+		}
+		right, err := parseExpr(c, r, "")
+		if err != nil {
+			return nil, err
+		}
+		outer := NewCondSelectNode(kind, []*LogicalSelectNode{left, right}, alias)
+		return &outer, nil
+	case *sqlparser.NotExpr:
+		arg, err := parseExpr(c, expr.Expr, "")
+		if err != nil {
+			return nil, err
+		}
+		outer := NewCondSelectNode("not", []*LogicalSelectNode{arg}, alias)
+		return &outer, nil
+	case *sqlparser.Subquery:
+		subplan, err := parseSubquery(c, expr)
+		if err != nil {
+			return nil, err
+		}
+		field := NewSubquerySelectNode(subplan, alias)
+		return &field, nil
+	case *sqlparser.ColName:
+		field := NewFieldSelectNode(strings.ToLower(sqlparser.String(expr.Qualifier)), strings.ToLower(sqlparser.String(expr.Name)), alias)
+		if len(field.table) > 1 && (field.table[0] == '\'' || field.table[0] == '`') {
+			field.table = field.table[1 : len(field.table)-1]
+		}
+		if len(field.field) > 1 && (field.field[0] == '\'' || field.field[0] == '`') {
+			field.field = field.field[1 : len(field.field)-1]
+		}
+
+		return &field, nil
+	case *sqlparser.ValuesFuncExpr:
+		//VALUES(col) in ON DUPLICATE KEY UPDATE is the value proposed for
+		//insertion (see makeInsertOp)
+		field := NewFieldSelectNode(excludedAlias, strings.ToLower(expr.Name.Name.String()), alias)
+		return &field, nil
+	case *sqlparser.SQLVal:
+		str := sqlparser.String(expr)
+		if expr.Type == sqlparser.StrVal {
+			//the unescaped value, e.g., it's for 'it''s'
+			str = string(expr.Val)
+		}
+		field := NewConstSelectNode(str, alias)
+		field.quoted = expr.Type == sqlparser.StrVal
+		return &field, nil
+	default:
+		return nil, GoDBError{ParseError, fmt.Sprintf("unsupported expression type %s in select list", reflect.TypeOf(expr))}
+	}
+
+}
+
+// Parse the arguments of a function call.
+func parseExprList(c *Catalog, exprs sqlparser.SelectExprs) ([]*LogicalSelectNode, error) {
+	exprList := make([]*LogicalSelectNode, len(exprs))
+	for i, subExpr := range exprs {
+		e, err := parseSelect(c, subExpr)
+		if err != nil {
+			return nil, err
+		}
+		exprList[i] = e
+	}
+	return exprList, nil
+}
+
+func parseSelect(c *Catalog, stmt sqlparser.SelectExpr) (*LogicalSelectNode, error) {
+	star, ok := stmt.(*sqlparser.StarExpr)
+	if ok {
+		node := NewStarSelectNode(strings.ToLower(sqlparser.String(star.TableName)))
+		return &node, nil
+	}
+
+	switch exprAlias := stmt.(type) {
+	case (*sqlparser.AliasedExpr):
+		alias := strings.ToLower(sqlparser.String(exprAlias.As))
+		return parseExpr(c, exprAlias.Expr, alias)
+	default:
+		return nil, GoDBError{ParseError, fmt.Sprintf("unsupported expression type %s in select list", reflect.TypeOf(exprAlias))}
+
+	}
+}
+
+func extractAggs(s *LogicalSelectNode) []*LogicalSelectNode {
+	switch s.exprType {
+	case ExprAggr:
+		return []*LogicalSelectNode{s}
+	case ExprFunc, ExprCond:
+		var aggs []*LogicalSelectNode
+		for _, subs := range s.args {
+			aggs = append(aggs, extractAggs(subs)...)
+		}
+		return aggs
+	case ExprWindow:
+		//window functions are computed after aggregation, so may be of
+		//aggregates, e.g. rank() over (order by sum(x))
+		var aggs []*LogicalSelectNode
+		for _, subs := range s.args {
+			aggs = append(aggs, extractAggs(subs)...)
+		}
+		for _, subs := range s.window.partitionBy {
+			aggs = append(aggs, extractAggs(subs)...)
+		}
+		for _, oby := range s.window.orderBy {
+			aggs = append(aggs, extractAggs(oby.expr)...)
+		}
+		return aggs
+	}
+	return nil
+}
+
+func extractWindows(s *LogicalSelectNode) []*LogicalSelectNode {
+	switch s.exprType {
+	case ExprWindow:
+		return []*LogicalSelectNode{s}
+	case ExprFunc, ExprCond:
+		var windows []*LogicalSelectNode
+		for _, subs := range s.args {
+			windows = append(windows, extractWindows(subs)...)
+		}
+		return windows
+	}
+	return nil
+}
+
+// Parse a call of windowFuncName, into which rewriteWindows rewrites window
+// function calls.
+func parseWindow(c *Catalog, expr *sqlparser.FuncExpr, alias string) (*LogicalSelectNode, error) {
+	if len(expr.Exprs) == 0 {
+		return nil, GoDBError{ParseError, "missing window function"}
+	}
+	call, ok := expr.Exprs[0].(*sqlparser.AliasedExpr)
+	if !ok {
+		return nil, GoDBError{ParseError, "unsupported window function"}
+	}
+	fun, ok := call.Expr.(*sqlparser.FuncExpr)
+	if !ok {
+		return nil, GoDBError{ParseError, fmt.Sprintf("unsupported window function %s", sqlparser.String(call.Expr))}
+	}
+	if fun.Distinct {
+		return nil, GoDBError{ParseError, "distinct window functions are not supported"}
+	}
+	funName := strings.ToLower(sqlparser.String(fun.Name))
+	if funName[0] == '\'' || funName[0] == '`' {
+		funName = funName[1 : len(funName)-1]
+	}
+	var args []*LogicalSelectNode
+	for _, argExpr := range fun.Exprs {
+		if _, ok := argExpr.(*sqlparser.StarExpr); ok {
+			if funName != "count" {
+				return nil, GoDBError{ParseError, "got * in non-count aggregate"}
+			}
+			//count(*) counts the rows of the frame, as does a count of any constant
+			one := NewConstSelectNode("1", "")
+			args = append(args, &one)
+			continue
+		}
+		arg, err := parseSelect(c, argExpr)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	window := &LogicalWindow{frame: DefaultWindowFrame}
+	var keyParts []string
+	for _, specExpr := range expr.Exprs[1:] {
+		clause, ok := specExpr.(*sqlparser.AliasedExpr)
+		if !ok {
+			return nil, GoDBError{ParseError, "invalid window specification"}
+		}
+		spec, ok := clause.Expr.(*sqlparser.FuncExpr)
+		if !ok {
+			return nil, GoDBError{ParseError, "invalid window specification"}
+		}
+		switch strings.ToLower(spec.Name.String()) {
+		case windowPartitionByName:
+			for _, pExpr := range spec.Exprs {
+				p, err := parseSelect(c, pExpr)
+				if err != nil {
+					return nil, err
+				}
+				window.partitionBy = append(window.partitionBy, p)
+			}
+			keyParts = append(keyParts, "partition by "+sqlparser.String(spec.Exprs))
+		case windowOrderByName:
+			for i := 0; i+1 < len(spec.Exprs); i += 2 {
+				o, err := parseSelect(c, spec.Exprs[i])
+				if err != nil {
+					return nil, err
+				}
+				dir := sqlparser.String(spec.Exprs[i+1])
+				window.orderBy = append(window.orderBy, &OrderByNode{o, dir == "'asc'"})
+			}
+			keyParts = append(keyParts, "order by "+sqlparser.String(spec.Exprs))
+		case windowFrameName:
+			var bounds [3]string
+			for i := range bounds {
+				if i < len(spec.Exprs) {
+					bounds[i] = strings.Trim(sqlparser.String(spec.Exprs[i]), "'")
+				}
+			}
+			start, err := parseFrameBound(bounds[1])
+			if err != nil {
+				return nil, err
+			}
+			end, err := parseFrameBound(bounds[2])
+			if err != nil {
+				return nil, err
+			}
+			window.frame = WindowFrame{bounds[0] == "rows", start, end}
+		default:
+			return nil, GoDBError{ParseError, "invalid window specification"}
+		}
+	}
+	window.key = strings.Join(keyParts, " ")
+
+	node := NewFuncSelectNode(funName, args, alias)
+	node.exprType = ExprWindow
+	node.window = window
+	return &node, nil
+}
+
+// Parse a bound of a window frame, e.g., "2 preceding" or "current row".
+func parseFrameBound(bound string) (FrameBound, error) {
+	words := strings.Fields(bound)
+	if len(words) != 2 {
+		return FrameBound{}, GoDBError{ParseError, fmt.Sprintf("invalid window frame bound %s", bound)}
+	}
+	switch {
+	case words[0] == "unbounded" && words[1] == "preceding":
+		return FrameBound{UnboundedPreceding, 0}, nil
+	case words[0] == "unbounded" && words[1] == "following":
+		return FrameBound{UnboundedFollowing, 0}, nil
+	case words[0] == "current" && words[1] == "row":
+		return FrameBound{CurrentRow, 0}, nil
+	}
+	offset, err := strconv.ParseInt(words[0], 10, 64)
+	if err != nil {
+		return FrameBound{}, GoDBError{ParseError, fmt.Sprintf("invalid window frame bound %s", bound)}
+	}
+	switch words[1] {
+	case "preceding":
+		return FrameBound{Preceding, offset}, nil
+	case "following":
+		return FrameBound{Following, offset}, nil
+	}
+	return FrameBound{}, GoDBError{ParseError, fmt.Sprintf("invalid window frame bound %s", bound)}
+}
+
+func parseOrderBy(c *Catalog, orderBy sqlparser.OrderBy) ([]*OrderByNode, error) {
+	var orderBys = make([]*OrderByNode, len(orderBy))
+	for i, oby := range orderBy {
+		expr, err := parseExpr(c, oby.Expr, "")
+		if err != nil {
+			return nil, err
+		}
+		orderBys[i] = &OrderByNode{expr, oby.Direction == sqlparser.AscScr}
+	}
+	return orderBys, nil
+}
+
+// Parse a LIMIT clause, returning its row count and offset, either of which may
+// be nil.
+func parseLimit(c *Catalog, lim *sqlparser.Limit) (*LogicalSelectNode, *LogicalSelectNode, error) {
+	if lim == nil {
+		return nil, nil, nil
+	}
+	limExpr, err := parseExpr(c, lim.Rowcount, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	if lim.Offset == nil {
+		return limExpr, nil, nil
+	}
+	offsetExpr, err := parseExpr(c, lim.Offset, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	return limExpr, offsetExpr, nil
+}
+
+func parseStatement(c *Catalog, s *sqlparser.Select) (*LogicalPlan, error) {
+	from := s.From
+	var (
+		tables    []*LogicalTableNode
+		subplans  []*LogicalPlan
+		joins     []*LogicalJoinNode
+		filters   []*LogicalFilterNode
+		semiJoins []*LogicalSemiJoinNode
+		aggs      []*LogicalSelectNode
+	)
+
+	for _, t := range from {
+		newTables, newSubplans, newJoins, err := parseFrom(c, t)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, newTables...)
+		subplans = append(subplans, newSubplans...)
+		joins = append(joins, newJoins...)
 	}
 	where := s.Where
 	if where != nil {
@@ -517,15 +1976,17 @@ func parseStatement(c *Catalog, s *sqlparser.Select) (*LogicalPlan, error) {
 					}
 		*/
 		//}
-		newFilters, newJoins, err := parseWhere(c, subplans, tables, where.Expr)
+		newFilters, newJoins, newSemiJoins, err := parseWhere(c, subplans, tables, where.Expr)
 		if err != nil {
 			return nil, err
 		}
 		joins = append(joins, newJoins...)
 		filters = append(filters, newFilters...)
+		semiJoins = append(semiJoins, newSemiJoins...)
 	}
 	//extract select list
 
+	var windows []*LogicalSelectNode
 	var selects = make([]*LogicalSelectNode, len(s.SelectExprs))
 	for i, stmt := range s.SelectExprs {
 		sel, err := parseSelect(c, stmt)
@@ -534,6 +1995,7 @@ func parseStatement(c *Catalog, s *sqlparser.Select) (*LogicalPlan, error) {
 		}
 		selects[i] = sel
 		aggs = append(aggs, extractAggs(sel)...)
+		windows = append(windows, extractWindows(sel)...)
 	}
 
 	var groupBys = make([]*GroupBy, len(s.GroupBy))
@@ -545,26 +2007,52 @@ func parseStatement(c *Catalog, s *sqlparser.Select) (*LogicalPlan, error) {
 		groupBys[i] = &GroupBy{expr}
 	}
 
-	var orderBys = make([]*OrderByNode, len(s.OrderBy))
-	for i, oby := range s.OrderBy {
-		expr, err := parseExpr(c, oby.Expr, "")
+	var having []*LogicalFilterNode
+	if s.Having != nil {
+		var err error
+		having, err = parseHaving(c, s.Having.Expr)
 		if err != nil {
 			return nil, err
 		}
-		orderBys[i] = &OrderByNode{expr, oby.Direction == sqlparser.AscScr}
+		//aggregates that only appear in the having clause are computed by the
+		//aggregate but not projected
+		for _, f := range having {
+			aggs = append(aggs, extractAggs(&f.fieldExpr)...)
+			aggs = append(aggs, extractAggs(&f.constExpr)...)
+		}
+		if len(aggs) == 0 && len(groupBys) == 0 {
+			return nil, GoDBError{ParseError, "having clause requires a group by or aggregate"}
+		}
 	}
 
-	lim := s.Limit
-	var limExpr *LogicalSelectNode
-	if lim != nil {
-		var err error
-		limExpr, err = parseExpr(c, lim.Rowcount, "")
-		if err != nil {
-			return nil, err
-		}
+	orderBys, err := parseOrderBy(c, s.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+	limExpr, offsetExpr, err := parseLimit(c, s.Limit)
+	if err != nil {
+		return nil, err
 	}
 
-	p := LogicalPlan{filters, joins, selects, aggs, tables, subplans, groupBys, orderBys, limExpr, s.Distinct != "", ""}
+	p := LogicalPlan{
+		filters:       filters,
+		joins:         joins,
+		selects:       selects,
+		aggs:          aggs,
+		windows:       windows,
+		tables:        tables,
+		subqueries:    subplans,
+		semiJoins:     semiJoins,
+		groupByFields: groupBys,
+		having:        having,
+		orderByFields: orderBys,
+		limit:         limExpr,
+		offset:        offsetExpr,
+		distinct:      s.Distinct != "",
+	}
+	if err := p.bindAllOuterRefs(c); err != nil {
+		return nil, err
+	}
 
 	return &p, nil
 }
@@ -669,6 +2157,10 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 			if tName != "" {
 				tName = tName + "."
 			}
+			if s.distinct {
+				fName = "distinct " + tName + fName
+				tName = ""
+			}
 			fieldName = fmt.Sprintf("%s(%s%s)", *s.funcOp, tName, fName)
 		} else {
 			fieldName = s.field
@@ -685,7 +2177,7 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 		var fval DBValue
 		constType := StringType
 		intFval, e := strconv.Atoi(s.value)
-		if e == nil {
+		if e == nil && !s.quoted {
 			constType = IntType
 			fval = IntField{int64(intFval)}
 		} else {
@@ -702,6 +2194,10 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 		if s.alias != "" {
 			fieldName = s.alias
 		}
+		if s.cachedField != nil {
+			//a group by expression, computed by the aggregate
+			return &FieldExpr{*s.cachedField}, fieldName, nil
+		}
 		exprs := make([]*Expr, len(s.args))
 		for i, lsn := range s.args {
 			newExpr, _, err := lsn.generateExpr(c, inputDesc, tableMap)
@@ -712,12 +2208,191 @@ func (s *LogicalSelectNode) generateExpr(c *Catalog, inputDesc *TupleDesc, table
 		}
 
 		fe := FuncExpr{*s.funcOp, exprs}
-		return &fe, fieldName, nil
+		if _, err := lookupFunc(fe.op, fe.argTypes()); err != nil {
+			return nil, "", err
+		}
+		return simplifyExpr(&fe), fieldName, nil
+	case ExprSubquery:
+		if s.subplan.outer != nil {
+			s.subplan.outer.desc = inputDesc
+		}
+		subOp, err := makePhysicalPlan(c, s.subplan)
+		if err != nil {
+			return nil, "", err
+		}
+		se, err := NewScalarSubqueryExpr(subOp)
+		if err != nil {
+			return nil, "", err
+		}
+		se.outer = s.subplan.outer
+		fieldName := se.GetExprType().Fname
+		if s.alias != "" {
+			fieldName = s.alias
+		}
+		return se, fieldName, nil
+	case ExprOuterRef:
+		fieldName := s.field
+		if s.alias != "" {
+			fieldName = s.alias
+		}
+		return &OuterRefExpr{FieldType{s.field, s.table, UnknownType}, s.outer}, fieldName, nil
+	case ExprCond:
+		fieldName := *s.funcOp
+		if s.alias != "" {
+			fieldName = s.alias
+		}
+		if s.cachedField != nil {
+			//a group by expression, computed by the aggregate
+			return &FieldExpr{*s.cachedField}, fieldName, nil
+		}
+		exprs := make([]Expr, len(s.args))
+		for i, lsn := range s.args {
+			newExpr, _, err := lsn.generateExpr(c, inputDesc, tableMap)
+			if err != nil {
+				return nil, "", err
+			}
+			exprs[i] = newExpr
+		}
+		e, err := generateCondExpr(*s.funcOp, s.value, exprs)
+		if err != nil {
+			return nil, "", err
+		}
+		return simplifyExpr(e), fieldName, nil
+	case ExprWindow:
+		//window functions are computed by the window operators planned by
+		//makeWindowOps, which cache the fields of their results
+		if s.cachedField == nil {
+			return nil, "", GoDBError{ParseError, fmt.Sprintf("window function %s is only supported in the select list", *s.funcOp)}
+		}
+		fieldName := *s.funcOp
+		if s.alias != "" {
+			fieldName = s.alias
+		}
+		return &FieldExpr{*s.cachedField}, fieldName, nil
 	}
 	return nil, "", GoDBError{ParseError, "unhandled expression type in select list"}
 
 }
 
+// Generate the conditional expression or cast of the given kind (see
+// NewCondSelectNode) over args. The arguments of a case are its conditions
+// and their results, alternately, followed by its else expression, if any;
+// castType is the type a cast is to, "int" or "string".
+func generateCondExpr(kind string, castType string, args []Expr) (Expr, error) {
+	switch kind {
+	case "case":
+		var conds, results []Expr
+		for i := 0; i+1 < len(args); i += 2 {
+			conds = append(conds, args[i])
+			results = append(results, args[i+1])
+		}
+		var elseExpr Expr
+		if len(args)%2 == 1 {
+			elseExpr = args[len(args)-1]
+		}
+		return NewCaseExpr(conds, results, elseExpr)
+	case "coalesce":
+		return NewCoalesceExpr(args)
+	case "nullif":
+		if len(args) != 2 {
+			return nil, GoDBError{ParseError, "expected two arguments to nullif"}
+		}
+		return NewNullIfExpr(args[0], args[1])
+	case "cast":
+		if castType == "int" {
+			return NewCastExpr(args[0], IntType)
+		}
+		return NewCastExpr(args[0], StringType)
+	case "and":
+		return NewCondExpr(CondAnd, 0, args)
+	case "or":
+		return NewCondExpr(CondOr, 0, args)
+	case "not":
+		return NewCondExpr(CondNot, 0, args)
+	}
+	op, ok := BoolOpMap[kind]
+	if !ok {
+		return nil, GoDBError{ParseError, fmt.Sprintf("unknown conditional expression %s", kind)}
+	}
+	if len(args) == 2 {
+		args[0], args[1] = coerceComparison(args[0], args[1])
+	}
+	return NewCondExpr(CondCompare, op, args)
+}
+
+// Return left and right, the operands of a comparison, with a quoted string
+// constant that is an integer, e.g., '25', converted to an int if the other
+// operand is an int, so that, e.g., age = '25' compares ages to 25.
+func coerceComparison(left, right Expr) (Expr, Expr) {
+	coerce := func(e Expr, other Expr) Expr {
+		c, ok := e.(*ConstExpr)
+		if !ok || c.constType != StringType || other.GetExprType().Ftype != IntType {
+			return e
+		}
+		i, err := strconv.ParseInt(c.val.(StringField).Value, 10, 64)
+		if err != nil {
+			return e
+		}
+		return &ConstExpr{IntField{i}, IntType}
+	}
+	return coerce(left, right), coerce(right, left)
+}
+
+// Return whether the comparison left op right holds, if its operands are both
+// constants; constant is false otherwise.
+func constantComparison(left Expr, op BoolOp, right Expr) (holds bool, constant bool, err error) {
+	if !isConstExpr(left) || !isConstExpr(right) {
+		return false, false, nil
+	}
+	cond, err := NewCondExpr(CondCompare, op, []Expr{left, right})
+	if err != nil {
+		return false, false, err
+	}
+	v, err := cond.EvalExpr(nil)
+	if err != nil {
+		return false, false, err
+	}
+	holds, err = isTrue(v)
+	return holds, true, err
+}
+
+// Return whether the filter f, whose operands are constants (e.g., 1 = 0),
+// holds for every tuple, rather than none.
+func (f *LogicalFilterNode) constantHolds(c *Catalog) (bool, error) {
+	left, _, err := f.fieldExpr.generateExpr(c, &TupleDesc{}, nil)
+	if err != nil {
+		return false, err
+	}
+	right, _, err := f.constExpr.generateExpr(c, &TupleDesc{}, nil)
+	if err != nil {
+		return false, err
+	}
+	left, right = coerceComparison(left, right)
+	holds, constant, err := constantComparison(left, f.predOp, right)
+	if err != nil {
+		return false, err
+	}
+	if !constant {
+		//the operands couldn't be folded because evaluating them fails, or
+		//because they're volatile
+		for _, e := range []Expr{left, right} {
+			if _, err := e.EvalExpr(nil); err != nil {
+				return false, err
+			}
+		}
+		return false, GoDBError{ParseError, fmt.Sprintf("unsupported predicate %s %s %s, which calls a volatile function but refers to no column", exprToStr(left), opToStr(f.predOp), exprToStr(right))}
+	}
+	return holds, nil
+}
+
+// Replace the operators of the tables of tableMap with ones returning no
+// tuples, e.g., because a filter never holds, so that they aren't scanned.
+func emptyPlanNodes(tableMap map[string]*PlanNode) {
+	for name, node := range tableMap {
+		tableMap[name] = &PlanNode{NewOperatorCard(NewEmptyValueOp(node.desc), 0), node.desc}
+	}
+}
+
 const JoinBufferSize int = 10000000
 
 func exprToStr(e Expr) string {
@@ -736,6 +2411,45 @@ func exprToStr(e Expr) string {
 			argStr += fmt.Sprintf("%s,", exprToStr(*arg))
 		}
 		return fmt.Sprintf("%s(%s)", ex.op, argStr)
+	case *ScalarSubqueryExpr:
+		return "(subquery)"
+	case *OuterRefExpr:
+		return fmt.Sprintf("outer.%s", ex.selectField.Fname)
+	case *CondExpr:
+		switch ex.kind {
+		case CondCompare:
+			return fmt.Sprintf("%s %s %s", exprToStr(ex.args[0]), opToStr(ex.op), exprToStr(ex.args[1]))
+		case CondNot:
+			return fmt.Sprintf("not (%s)", exprToStr(ex.args[0]))
+		}
+		sep := " and "
+		if ex.kind == CondOr {
+			sep = " or "
+		}
+		argStrs := make([]string, len(ex.args))
+		for i, arg := range ex.args {
+			argStrs[i] = "(" + exprToStr(arg) + ")"
+		}
+		return strings.Join(argStrs, sep)
+	case *CaseExpr:
+		str := "case"
+		for i, cond := range ex.conds {
+			str += fmt.Sprintf(" when %s then %s", exprToStr(cond), exprToStr(ex.results[i]))
+		}
+		if ex.elseExpr != nil {
+			str += " else " + exprToStr(ex.elseExpr)
+		}
+		return str + " end"
+	case *CoalesceExpr:
+		argStrs := make([]string, len(ex.args))
+		for i, arg := range ex.args {
+			argStrs[i] = exprToStr(arg)
+		}
+		return fmt.Sprintf("coalesce(%s)", strings.Join(argStrs, ","))
+	case *NullIfExpr:
+		return fmt.Sprintf("nullif(%s,%s)", exprToStr(ex.left), exprToStr(ex.right))
+	case *CastExpr:
+		return fmt.Sprintf("cast(%s as %v)", exprToStr(ex.expr), ex.to)
 	default:
 		return fmt.Sprintf("%+v, ", e)
 	}
@@ -755,9 +2469,8 @@ func opToStr(op BoolOp) string {
 		return "<="
 	case OpLt:
 		return "<"
-	case OpLike:
-		return " LIKE "
-
+	case OpLike, OpNotLike, OpILike, OpNotILike, OpRegexp, OpNotRegexp, OpIRegexp, OpNotIRegexp:
+		return op.String()
 	}
 	return "??"
 }
@@ -770,12 +2483,20 @@ func GetUnexportedField(field reflect.Value) interface{} {
 
 func OutputPhysicalPlan(printf func(format string, a ...any), o Operator, indent string) {
 	oc := o.(*OperatorCard)
+	if oc.metrics != nil {
+		printf = oc.metrics.annotate(printf, oc.Cardinality)
+	}
 	switch op := oc.Op.(type) {
 	case *EqualityJoin:
-		printf("%sJoin, %+v == %+v, card:%d\n", indent, exprToStr(op.leftField), exprToStr(op.rightField), oc.Cardinality)
+		printf("%sNested Loops Join, %+v == %+v, card:%d, cost:%.0f\n", indent, exprToStr(op.leftField), exprToStr(op.rightField), oc.Cardinality, oc.Cost)
 		indent = indent + "\t"
 		OutputPhysicalPlan(printf, *op.left, indent)
 		OutputPhysicalPlan(printf, *op.right, indent)
+	case *SortMergeJoin:
+		printf("%sSort Merge Join, %+v == %+v, card:%d, cost:%.0f\n", indent, exprToStr(op.leftField), exprToStr(op.rightField), oc.Cardinality, oc.Cost)
+		indent = indent + "\t"
+		OutputPhysicalPlan(printf, op.left, indent)
+		OutputPhysicalPlan(printf, op.right, indent)
 	case *Project:
 		selectStr := ""
 		for _, ex := range op.selectFields {
@@ -786,12 +2507,66 @@ func OutputPhysicalPlan(printf func(format string, a ...any), o Operator, indent
 		OutputPhysicalPlan(printf, op.child, indent)
 
 	case *Filter:
-		printf("%sFilter %s %s %s, card:%d", indent, exprToStr(op.left), opToStr(op.op), exprToStr(op.right), oc.Cardinality)
+		printf("%sFilter %s %s %s, card:%d\n", indent, exprToStr(op.left), opToStr(op.op), exprToStr(op.right), oc.Cardinality)
+		indent = indent + "\t"
+		OutputPhysicalPlan(printf, op.child, indent)
+
+	case *SetOp:
+		name := op.op.String()
+		if op.all {
+			name += " All"
+		}
+		printf("%s%s, card:%d\n", indent, name, oc.Cardinality)
+		indent = indent + "\t"
+		OutputPhysicalPlan(printf, op.left, indent)
+		OutputPhysicalPlan(printf, op.right, indent)
+
+	case *OuterJoin:
+		leftStr, rightStr := "", ""
+		for i := range op.leftFields {
+			leftStr += exprToStr(op.leftFields[i]) + ","
+			rightStr += exprToStr(op.rightFields[i]) + ","
+		}
+		printf("%sLeft Outer Join, (%s) == (%s), card:%d\n", indent, leftStr, rightStr, oc.Cardinality)
+		indent = indent + "\t"
+		OutputPhysicalPlan(printf, op.left, indent)
+		OutputPhysicalPlan(printf, op.right, indent)
+
+	case *SemiJoin:
+		name := "Semi Join"
+		if op.anti {
+			name = "Anti Join"
+		}
+		if op.params != nil {
+			name = "Correlated " + name
+		}
+		if len(op.leftFields) == 0 {
+			printf("%s%s, exists, card:%d\n", indent, name, oc.Cardinality)
+		} else {
+			leftStr, rightStr := "", ""
+			for i := range op.leftFields {
+				leftStr += exprToStr(op.leftFields[i]) + ","
+				rightStr += exprToStr(op.rightFields[i]) + ","
+			}
+			printf("%s%s, (%s) in (%s), card:%d\n", indent, name, leftStr, rightStr, oc.Cardinality)
+		}
 		indent = indent + "\t"
+		OutputPhysicalPlan(printf, op.left, indent)
+		OutputPhysicalPlan(printf, op.right, indent)
+
+	case *InitPlanOp:
+		printf("%sInit Plan, %d subqueries, card:%d\n", indent, len(op.subqueries), oc.Cardinality)
+		indent = indent + "\t"
+		for _, s := range op.subqueries {
+			OutputPhysicalPlan(printf, s.plan, indent)
+		}
 		OutputPhysicalPlan(printf, op.child, indent)
 
 	case *HeapFile:
-		printf("%sHeap Scan %s, card:%d\n", indent, op.BackingFile(), oc.Cardinality)
+		printf("%sHeap Scan %s, card:%d, cost:%.0f\n", indent, op.BackingFile(), oc.Cardinality, oc.Cost)
+
+	case *ValueOp:
+		printf("%sValues, %d rows, card:%d\n", indent, len(op.exprs), oc.Cardinality)
 
 	case *OrderBy:
 		orderStr := ""
@@ -805,8 +2580,66 @@ func OutputPhysicalPlan(printf func(format string, a ...any), o Operator, indent
 		indent = indent + "\t"
 		OutputPhysicalPlan(printf, op.child, indent)
 
+	case *WindowOp:
+		windowStr := ""
+		if len(op.partitionBy) > 0 {
+			windowStr += " partition by "
+			for i, e := range op.partitionBy {
+				if i > 0 {
+					windowStr += ", "
+				}
+				windowStr += exprToStr(e)
+			}
+		}
+		if len(op.orderBy) > 0 {
+			windowStr += " order by "
+			for i, e := range op.orderBy {
+				if i > 0 {
+					windowStr += ", "
+				}
+				windowStr += exprToStr(e)
+			}
+		}
+		funcStr := ""
+		for i, f := range op.funcs {
+			if i > 0 {
+				funcStr += ", "
+			}
+			funcStr += f.name + "("
+			for j, arg := range f.args {
+				if j > 0 {
+					funcStr += ","
+				}
+				funcStr += exprToStr(arg)
+			}
+			funcStr += ")"
+		}
+		printf("%sWindow%s: %s, card:%d\n", indent, windowStr, funcStr, oc.Cardinality)
+		indent = indent + "\t"
+		OutputPhysicalPlan(printf, op.child, indent)
+
+	case *TopN:
+		orderStr := ""
+		for i, e := range op.orderBy {
+			if i > 0 {
+				orderStr += ", "
+			}
+			orderStr += exprToStr(e)
+		}
+		offsetStr := ""
+		if op.offsetTups != nil {
+			offsetStr = " offset " + exprToStr(op.offsetTups)
+		}
+		printf("%sTop N %s, limit %s%s, card:%d\n", indent, orderStr, exprToStr(op.limitTups), offsetStr, oc.Cardinality)
+		indent = indent + "\t"
+		OutputPhysicalPlan(printf, op.child, indent)
+
 	case *LimitOp:
-		printf("%sLimit %s, card:%d\n", indent, exprToStr(op.limitTups), oc.Cardinality)
+		offsetStr := ""
+		if op.offsetTups != nil {
+			offsetStr = " offset " + exprToStr(op.offsetTups)
+		}
+		printf("%sLimit %s%s, card:%d\n", indent, exprToStr(op.limitTups), offsetStr, oc.Cardinality)
 		indent = indent + "\t"
 		OutputPhysicalPlan(printf, op.child, indent)
 
@@ -814,33 +2647,151 @@ func OutputPhysicalPlan(printf func(format string, a ...any), o Operator, indent
 		gbyStr := ""
 		if len(op.groupByFields) > 0 {
 			gbyStr = "Group By "
+			if op.inputSorted {
+				gbyStr = "Streaming Group By "
+			} else if op.sortGroups {
+				gbyStr = "Sort Group By "
+			}
+		}
+		for _, ex := range op.groupByFields {
+			gbyStr += exprToStr(ex) + ","
+		}
+
+		aggStr := ""
+		for _, ex := range op.newAggState {
+			aggStr += fmt.Sprintf("%s(%s),", reflect.TypeOf(ex), ex.GetTupleDesc().HeaderString(false))
+		}
+
+		printf("%sAggregate, %s %s, card:%d\n", indent, aggStr, gbyStr, oc.Cardinality)
+		indent = indent + "\t"
+		OutputPhysicalPlan(printf, op.child, indent)
+
+	default:
+		printf("%sUnknown op, %s\n", indent, reflect.TypeOf(op))
+	}
+}
+
+func PrintPhysicalPlan(o Operator, indent string) {
+	OutputPhysicalPlan(func(s string, a ...any) { fmt.Printf(s, a...) }, o, indent)
+}
+
+// Return the order of the tuples op returns, if known: the ith element lists
+// expressions on which the tuples are sorted (in either direction) after those
+// of the previous elements. There may be several such expressions, e.g., the
+// left and right fields of a sort-merge join, which are equal in every tuple.
+func sortedOutputOrder(op Operator) [][]Expr {
+	switch op := op.(type) {
+	case *OperatorCard:
+		return sortedOutputOrder(op.Op)
+	case *OrderBy:
+		order := make([][]Expr, len(op.orderBy))
+		for i, e := range op.orderBy {
+			order[i] = []Expr{e}
+		}
+		return order
+	case *TopN:
+		order := make([][]Expr, len(op.orderBy))
+		for i, e := range op.orderBy {
+			order[i] = []Expr{e}
+		}
+		return order
+	case *SortMergeJoin:
+		return [][]Expr{{op.leftField, op.rightField}}
+	case *OuterJoin:
+		return sortedOutputOrder(op.left)
+	case *Filter:
+		return sortedOutputOrder(op.child)
+	case *LimitOp:
+		return sortedOutputOrder(op.child)
+	case *InitPlanOp:
+		return sortedOutputOrder(op.child)
+	}
+	return nil
+}
+
+// Return true if e1 and e2 are both references to the same field.
+func sameField(e1, e2 Expr) bool {
+	f1, ok1 := e1.(*FieldExpr)
+	f2, ok2 := e2.(*FieldExpr)
+	return ok1 && ok2 && f1.selectField == f2.selectField
+}
+
+// Return true if op's tuples are known to be sorted such that the tuples with
+// the same values of gbys are adjacent, i.e., if some prefix of the order of
+// op's output is on exactly the fields of gbys.
+func groupsAreAdjacent(op Operator, gbys []Expr) bool {
+	matched := make([]bool, len(gbys))
+	nMatched := 0
+	for _, equiv := range sortedOutputOrder(op) {
+		found := false
+		for i, gby := range gbys {
+			for _, e := range equiv {
+				if sameField(gby, e) {
+					found = true
+					if !matched[i] {
+						matched[i] = true
+						nMatched++
+					}
+				}
+			}
 		}
-		for _, ex := range op.groupByFields {
-			gbyStr += exprToStr(ex) + ","
+		if !found {
+			return false
 		}
-
-		aggStr := ""
-		for _, ex := range op.newAggState {
-			aggStr += fmt.Sprintf("%s(%s),", reflect.TypeOf(ex), ex.GetTupleDesc().HeaderString(false))
+		if nMatched == len(gbys) {
+			return true
 		}
+	}
+	return false
+}
 
-		printf("%sAggregate, %s %s, card:%d\n", indent, aggStr, gbyStr, oc.Cardinality)
-		indent = indent + "\t"
-		OutputPhysicalPlan(printf, op.child, indent)
-
-	default:
-		printf("%sUnknown op, %s\n", indent, reflect.TypeOf(op))
+// Return the number of the tables of tableMap whose plan is op, e.g., 1 if op
+// scans a single table (and applies its filters), or more if op joins tables.
+func inputTables(tableMap map[string]*PlanNode, op *OperatorCard) int {
+	n := 0
+	for _, node := range tableMap {
+		if node.op == op {
+			n++
+		}
 	}
+	return n
 }
 
-func PrintPhysicalPlan(o Operator, indent string) {
-	OutputPhysicalPlan(func(s string, a ...any) { fmt.Printf(s, a...) }, o, indent)
+// Estimate the number of groups of the group by fields of plan, whose input
+// has cardinality card: the product of the numbers of distinct values of the
+// fields, per the statistics of their tables, but no more than card.
+//
+// Returns false if a group by expression isn't a field of a table with
+// statistics of it.
+func estimateGroups(c *Catalog, plan *LogicalPlan, tableStats map[string]Stats, card int) (int, bool) {
+	groups := 1.0
+	for _, gby := range plan.groupByFields {
+		if gby.expr.exprType != ExprField {
+			return 0, false
+		}
+		tabName, fieldName, err := gby.expr.getTableField(c, plan.subqueries, plan.tables)
+		if err != nil || tableStats[tabName] == nil {
+			return 0, false
+		}
+		cs := tableStats[tabName].ColumnStats(fieldName)
+		if cs == nil {
+			return 0, false
+		}
+		groups *= float64(cs.distinct)
+	}
+	return int(min(groups, float64(card))), true
 }
 
-// Wraps an operator with a cardinality estimate.
+// Wraps an operator with a cardinality estimate, and, for scans, filters and
+// joins, an estimate of the cost of evaluating it (see EstimateJoinCost).
 type OperatorCard struct {
 	Cardinality int
 	Op          Operator
+	Cost        float64
+
+	// what the operator did when the plan was run by ExplainAnalyze, or nil
+	// if it wasn't or the operator never ran
+	metrics *operatorMetrics
 }
 
 func (o *OperatorCard) Descriptor() *TupleDesc {
@@ -848,6 +2799,9 @@ func (o *OperatorCard) Descriptor() *TupleDesc {
 }
 
 func (o *OperatorCard) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	if bp := analyzingBufferPool(tid); bp != nil {
+		return o.analyzedIterator(bp, tid)
+	}
 	return o.Op.Iterator(tid)
 }
 
@@ -856,7 +2810,7 @@ func NewOperatorCard(op Operator, card int) *OperatorCard {
 	if ok {
 		panic("cannot wrap an operator card in another operator card")
 	}
-	return &OperatorCard{card, op}
+	return &OperatorCard{card, op, 0, nil}
 }
 
 var EnableJoinOptimization = true
@@ -876,15 +2830,107 @@ func (s *DummyStats) EstimateSelectivity(field string, op BoolOp, val DBValue) (
 	return 1.0, nil
 }
 
+func (s *DummyStats) ColumnStats(field string) *ColumnStats {
+	return nil
+}
+
 type TableAndField struct {
 	table string
 	field string
 }
 
+// Apply the IN or EXISTS predicate sj to the output of op. leftExprs are the
+// expressions of the enclosing query, evaluated against op, that must match
+// the columns of the subquery: the outer expression of an IN predicate
+// followed by sj.outerKeys. leftExprs is empty for an uncorrelated EXISTS.
+func makeSemiJoin(c *Catalog, op Operator, leftExprs []Expr, sj *LogicalSemiJoinNode) (Operator, error) {
+	params := sj.subplan.outer
+	if params != nil {
+		params.desc = op.Descriptor()
+	}
+	subOp, err := makePhysicalPlan(c, sj.subplan)
+	if err != nil {
+		return nil, err
+	}
+	subDesc := subOp.Descriptor()
+	if len(leftExprs) > 0 && len(subDesc.Fields) != len(leftExprs) {
+		return nil, GoDBError{ParseError, "subquery in IN predicate must return exactly one column"}
+	}
+	rightExprs := make([]Expr, len(leftExprs))
+	for i := range leftExprs {
+		rightExprs[i] = &FieldExpr{subDesc.Fields[i]}
+	}
+	var newOp *SemiJoin
+	if sj.anti {
+		newOp, err = NewAntiJoin(op, leftExprs, subOp, rightExprs)
+	} else {
+		newOp, err = NewSemiJoin(op, leftExprs, subOp, rightExprs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	newOp.params = params
+	return newOp, nil
+}
+
+// Outer join op with subNode, the plan of the subquery sub that decorrelate
+// added to the enclosing query, on the equality of sub's outer keys and its
+// first fields. Tuples of op with no group of sub are joined with the value of
+// sub's aggregate over no tuples (and zero values of its keys).
+func makeOuterJoin(c *Catalog, op *OperatorCard, tableMap map[string]*PlanNode, sub *LogicalPlan, subNode *PlanNode) (Operator, error) {
+	subDesc := subNode.desc
+	var leftExprs, rightExprs []Expr
+	for i, key := range sub.outerKeys {
+		e, _, err := key.generateExpr(c, op.Descriptor(), tableMap)
+		if err != nil {
+			return nil, err
+		}
+		leftExprs = append(leftExprs, e)
+		rightExprs = append(rightExprs, &FieldExpr{subDesc.Fields[i]})
+	}
+
+	//the value of the subquery for tuples with no group, as in the subquery
+	//without the correlation predicates over no tuples
+	empty := *sub
+	empty.selects = sub.selects[len(sub.outerKeys):]
+	empty.groupByFields = nil
+	empty.empty = true
+	emptyOp, err := makePhysicalPlan(c, &empty)
+	if err != nil {
+		return nil, err
+	}
+	var padExprs []Expr
+	for _, f := range subDesc.Fields[:len(sub.outerKeys)] {
+		padExprs = append(padExprs, &ConstExpr{zeroValue(f.Ftype), f.Ftype})
+	}
+	for _, f := range emptyOp.Descriptor().Fields {
+		padExprs = append(padExprs, &FieldExpr{f})
+	}
+	var padNames []string
+	for _, f := range subDesc.Fields {
+		padNames = append(padNames, f.Fname)
+	}
+	padding, err := NewProjectOp(padExprs, padNames, false, emptyOp)
+	if err != nil {
+		return nil, err
+	}
+	return NewOuterJoin(op, leftExprs, subNode.op, rightExprs, NewOperatorCard(padding, 1))
+}
+
 func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 	tableMap := make(map[string]*PlanNode) // mapping from table aliases to operators
 	tableStats := make(map[string]Stats)   // mapping from table aliases to table stats
 	sel := make(map[string]float64)        // mapping from table aliases to selectivities
+	keys := make(map[string][]string)      // mapping from table aliases to primary keys
+	var initPlans []*ScalarSubqueryExpr    // scalar subqueries to evaluate before the query runs
+	hidden := make(map[string]bool)        // fields of subqueries added by decorrelation
+	var outerJoins []*PlanNode             // plans of the subqueries added by decorrelation
+
+	if plan.setOp != nil {
+		return makeSetOpPlan(c, plan)
+	}
+
+	plan.decorrelate()
 
 	for _, p := range plan.subqueries {
 		subPhysP, err := makePhysicalPlan(c, p)
@@ -893,16 +2939,24 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 		}
 		td := subPhysP.Descriptor()
 		td.setTableAlias(p.alias)
+		if p.hidden {
+			for _, f := range td.Fields {
+				hidden[f.Fname] = true
+			}
+			outerJoins = append(outerJoins, &PlanNode{subPhysP, td})
+			continue
+		}
 		tableMap[p.alias] = &PlanNode{subPhysP, td}
 		tableStats[p.alias] = &DummyStats{}
 		sel[p.alias] = 1.0
 	}
 
 	for _, t := range plan.tables {
-		var stats Stats
-		stats = c.GetTableStats(t.tableName)
-		if stats == nil {
-			stats = &DummyStats{}
+		//tables that haven't been analyzed have no statistics; note that a
+		//nil *TableStats isn't a nil Stats
+		var stats Stats = &DummyStats{}
+		if tableStats := c.GetTableStats(t.tableName); tableStats != nil {
+			stats = tableStats
 		}
 
 		name := t.tableName
@@ -910,6 +2964,9 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 			name = t.alias
 		}
 		tableStats[name] = stats
+		if info, err := c.GetTableInfo(t.tableName); err == nil {
+			keys[name] = info.primaryKey
+		}
 
 		td := (*t.file).Descriptor()
 		td.setTableAlias(name)
@@ -918,12 +2975,29 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 		if stats != nil {
 			card = stats.EstimateCardinality(1.0)
 		}
-		tableMap[name] = &PlanNode{NewOperatorCard(*t.file, card), td}
+		scan := NewOperatorCard(*t.file, card)
+		scan.Cost = stats.EstimateScanCost()
+		tableMap[name] = &PlanNode{scan, td}
 		sel[name] = 1.0
 	}
+	if plan.empty {
+		emptyPlanNodes(tableMap)
+	}
 
-	//now apply each filter to appropriate table
-	for _, f := range plan.filters {
+	//now apply each filter to appropriate table; the correlation predicates of
+	//a subquery that wasn't decorrelated are filters on its outer references
+	filters := append(append([]*LogicalFilterNode{}, plan.filters...), plan.correlated...)
+	for _, f := range filters {
+		if f.fieldExpr.isConstant() && f.constExpr.isConstant() {
+			holds, err := f.constantHolds(c)
+			if err != nil {
+				return nil, err
+			}
+			if !holds {
+				emptyPlanNodes(tableMap)
+			}
+			continue
+		}
 		tabName, fieldName, err := f.fieldExpr.getTableField(c, plan.subqueries, plan.tables)
 		if err != nil {
 			return nil, err
@@ -940,6 +3014,19 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 		if err != nil {
 			return nil, err
 		}
+		leftExpr, rightExpr = coerceComparison(leftExpr, rightExpr)
+		//e.g., case when 1 = 1 then 5 else age end = 5, once simplified
+		holds, constant, err := constantComparison(leftExpr, f.predOp, rightExpr)
+		if err != nil {
+			return nil, err
+		}
+		if constant {
+			if !holds {
+				emptyPlanNodes(tableMap)
+			}
+			continue
+		}
+		initPlans = append(initPlans, findScalarSubqueries(rightExpr)...)
 
 		op := node.op
 		desc := *op.Descriptor()
@@ -947,6 +3034,10 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 
 		fieldType := leftExpr.GetExprType()
 		table := fieldType.TableQualifier
+		if table == "" {
+			//e.g., a case expression, which isn't named after a field
+			table = tabName
+		}
 		field := fieldType.Fname
 		table_stats := tableStats[table]
 
@@ -965,12 +3056,46 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 			return nil, err
 		}
 
-		tableMap[table] = &PlanNode{NewOperatorCard(newOp, int(float64(op.Cardinality)*filterSel)), &desc}
+		filter := NewOperatorCard(newOp, int(float64(op.Cardinality)*filterSel))
+		filter.Cost = op.Cost
+		tableMap[table] = &PlanNode{filter, &desc}
+	}
+
+	//apply uncorrelated IN predicates to the table of their outer expression
+	for _, sj := range plan.semiJoins {
+		if sj.expr == nil || len(sj.outerKeys) > 0 || sj.subplan.outer != nil {
+			continue
+		}
+		tabName, fieldName, err := sj.expr.getTableField(c, plan.subqueries, plan.tables)
+		if err != nil {
+			return nil, err
+		}
+		node, err := fieldToOp(tabName, fieldName, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		leftExpr, _, err := sj.expr.generateExpr(c, node.desc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		newOp, err := makeSemiJoin(c, node.op, []Expr{leftExpr}, sj)
+		if err != nil {
+			return nil, err
+		}
+		newNode := &PlanNode{NewOperatorCard(newOp, node.op.Cardinality), node.desc}
+		for key, n := range tableMap {
+			if n.op == node.op {
+				tableMap[key] = newNode
+			}
+		}
 	}
 
 	selects := make(map[TableAndField]*LogicalSelectNode)
 	join_order := make([]*JoinNode, len(plan.joins))
 	for i, j := range plan.joins {
+		if j.predOp != OpEq {
+			return nil, GoDBError{IllegalOperationError, "only equality joins are supported"}
+		}
 		leftName, leftField, err := j.left.getTableField(c, plan.subqueries, plan.tables)
 		if err != nil {
 			return nil, err
@@ -992,9 +3117,9 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 		}
 
 		join_order[i] = &JoinNode{
-			leftTable:  TableInfo{leftName, leftStats, sel[leftName]},
+			leftTable:  TableInfo{leftName, leftStats, sel[leftName], keys[leftName]},
 			leftField:  leftField,
-			rightTable: TableInfo{rightName, rightStats, sel[rightName]},
+			rightTable: TableInfo{rightName, rightStats, sel[rightName], keys[rightName]},
 			rightField: rightField,
 		}
 		selects[TableAndField{leftName, leftField}] = j.left
@@ -1055,12 +3180,40 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 			return nil, err
 		}
 
-		newOp, err := NewJoin(op1, leftExpr, op2, rightExpr, JoinBufferSize)
+		if lt, rt := leftExpr.GetExprType().Ftype, rightExpr.GetExprType().Ftype; lt != rt {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("cannot join %v with %v", lt, rt)}
+		}
+		if op1 == op2 {
+			//the tables were already joined by other joins, e.g., of a
+			//cycle of joins, so this join only filters the joined tuples
+			filterOp, err := NewFilter(rightExpr, OpEq, leftExpr, op1)
+			if err != nil {
+				return nil, err
+			}
+			filter := NewOperatorCard(filterOp, estimateJoinFilterCardinality(j, op1.Cardinality))
+			filter.Cost = op1.Cost
+			newNode := &PlanNode{filter, node1.desc}
+			for key, node := range tableMap {
+				if node.op == op1 {
+					tableMap[key] = newNode
+				}
+			}
+			continue
+		}
+
+		var newOp Operator
+		if j.algorithm == NestedLoopsJoinAlgorithm {
+			newOp, err = NewJoin(op1, leftExpr, op2, rightExpr, JoinBufferSize)
+		} else {
+			newOp, err = NewSortMergeJoin(op1, leftExpr, op2, rightExpr, SortBufferSize)
+		}
 		if err != nil {
 			return nil, err
 		}
 
-		newNode := &PlanNode{NewOperatorCard(newOp, EstimateJoinCardinality(node1.op.Cardinality, node2.op.Cardinality)), newOp.Descriptor()}
+		joinCard := NewOperatorCard(newOp, estimateInputsJoinCardinality(j, op1.Cardinality, op2.Cardinality, inputTables(tableMap, op1) == 1, inputTables(tableMap, op2) == 1))
+		joinCard.Cost = estimateJoinAlgorithmCost(j.algorithm, op1.Cardinality, op2.Cardinality, op1.Cost, op2.Cost)
+		newNode := &PlanNode{joinCard, newOp.Descriptor()}
 		for key, node := range tableMap {
 			if node.op == op1 {
 				tableMap[key] = newNode
@@ -1089,6 +3242,69 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 
 	topOp := curOp
 
+	//outer join the grouped aggregates of decorrelated scalar subqueries, which
+	//the filters comparing with their values refer to
+	hiddenSubqueries := 0
+	for _, p := range plan.subqueries {
+		if !p.hidden {
+			continue
+		}
+		newOp, err := makeOuterJoin(c, topOp, tableMap, p, outerJoins[hiddenSubqueries])
+		if err != nil {
+			return nil, err
+		}
+		hiddenSubqueries++
+		topOp = NewOperatorCard(newOp, topOp.Cardinality)
+		newNode := &PlanNode{topOp, newOp.Descriptor()}
+		for key := range tableMap {
+			tableMap[key] = newNode
+		}
+		tableMap[p.alias] = newNode
+	}
+
+	for _, f := range plan.joinFilters {
+		leftExpr, _, err := f.fieldExpr.generateExpr(c, topOp.Descriptor(), tableMap)
+		if err != nil {
+			return nil, err
+		}
+		rightExpr, _, err := f.constExpr.generateExpr(c, topOp.Descriptor(), tableMap)
+		if err != nil {
+			return nil, err
+		}
+		leftExpr, rightExpr = coerceComparison(leftExpr, rightExpr)
+		initPlans = append(initPlans, findScalarSubqueries(leftExpr)...)
+		initPlans = append(initPlans, findScalarSubqueries(rightExpr)...)
+		newOp, err := NewFilter(rightExpr, f.predOp, leftExpr, topOp)
+		if err != nil {
+			return nil, err
+		}
+		topOp = NewOperatorCard(newOp, topOp.Cardinality)
+	}
+
+	//EXISTS and correlated IN predicates may refer to any table, so apply
+	//them after joins; uncorrelated EXISTS either keeps or discards all tuples
+	for _, sj := range plan.semiJoins {
+		if sj.expr != nil && len(sj.outerKeys) == 0 && sj.subplan.outer == nil {
+			continue
+		}
+		var leftExprs []Expr
+		for _, n := range append([]*LogicalSelectNode{sj.expr}, sj.outerKeys...) {
+			if n == nil {
+				continue
+			}
+			e, _, err := n.generateExpr(c, topOp.Descriptor(), tableMap)
+			if err != nil {
+				return nil, err
+			}
+			leftExprs = append(leftExprs, e)
+		}
+		newOp, err := makeSemiJoin(c, topOp, leftExprs, sj)
+		if err != nil {
+			return nil, err
+		}
+		topOp = NewOperatorCard(newOp, topOp.Cardinality)
+	}
+
 	//var fieldList []FieldType
 	var fieldNames []string
 	hasAgg := len(plan.aggs) > 0
@@ -1136,24 +3352,66 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 					return nil, err
 				}
 
-				switch *s.funcOp {
-				case "max":
-					as = &MaxAggState{}
-
-				case "min":
-					as = &MinAggState{}
-				case "avg":
-					as = &AvgAggState{}
-				case "sum":
-					as = &SumAggState{}
-				case "count":
-					as = &CountAggState{}
-				default:
+				aggFn, ok := aggFuncs[*s.funcOp]
+				if !ok {
 					return nil, GoDBError{IllegalOperationError, fmt.Sprintf("unknown aggregate function %s", *s.funcOp)}
 				}
+				var args []DBValue
+				for _, arg := range s.args[1:] {
+					if arg.exprType != ExprConst {
+						return nil, GoDBError{ParseError, fmt.Sprintf("expected constant arguments after the first argument of aggregate %s", *s.funcOp)}
+					}
+					argExpr, _, err := arg.generateExpr(c, node.desc, tableMap)
+					if err != nil {
+						return nil, err
+					}
+					argVal, err := argExpr.EvalExpr(nil)
+					if err != nil {
+						return nil, err
+					}
+					args = append(args, argVal)
+				}
+				as, err = aggFn.newState(args)
+				if err != nil {
+					return nil, err
+				}
+				if len(s.aggOrderBy) > 0 {
+					sa, ok := as.(*StringAggState)
+					if !ok {
+						return nil, GoDBError{ParseError, fmt.Sprintf("order by is not supported in aggregate %s", *s.funcOp)}
+					}
+					var exprs []Expr
+					var ascs []bool
+					for _, oby := range s.aggOrderBy {
+						obyTab, obyField, err := oby.expr.getTableField(c, plan.subqueries, plan.tables)
+						if err != nil {
+							return nil, err
+						}
+						obyNode, err := fieldToOp(obyTab, obyField, tableMap)
+						if err != nil {
+							return nil, err
+						}
+						expr, _, err := oby.expr.generateExpr(c, obyNode.desc, tableMap)
+						if err != nil {
+							return nil, err
+						}
+						exprs = append(exprs, expr)
+						ascs = append(ascs, oby.ascending)
+					}
+					if err := sa.SetOrderBy(exprs, ascs); err != nil {
+						return nil, err
+					}
+				}
+
+				distinctStr := ""
+				if s.distinct {
+					// aggregate each group's distinct values once
+					as = NewDistinctAggState(as)
+					distinctStr = "distinct "
+				}
 
 				//make sure name has unique id
-				name := fmt.Sprintf("%s(%s.%s)%d", *s.funcOp, tabName, fieldName, aggCnt)
+				name := fmt.Sprintf("%s(%s%s.%s)%d", *s.funcOp, distinctStr, tabName, fieldName, aggCnt)
 				aggCnt++
 				if s.alias != "" {
 					name = s.alias
@@ -1182,33 +3440,253 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 
 		if len(gbys) == 0 {
 			topOp = NewOperatorCard(NewAggregator(aggs, topOp), 1)
+		} else if groupsAreAdjacent(topOp, gbys) {
+			// e.g., grouping on the key of a sort-merge join; aggregating
+			// each group as it is read needs no hashing, sorting or spilling
+			topOp = NewOperatorCard(NewPresortedGroupedAggregator(aggs, gbys, topOp), 0)
+		} else if groups, ok := estimateGroups(c, plan, tableStats, topOp.Cardinality); ok && groups > AggBufferSize {
+			// hashing would spill the tuples of the groups that don't fit
+			// in memory, perhaps several times; sorting spills each once
+			topOp = NewOperatorCard(NewSortGroupedAggregator(aggs, gbys, topOp), 0)
 		} else {
 			topOp = NewOperatorCard(NewGroupedAggregator(aggs, gbys, topOp), 0)
 		}
-	}
-
-	exprList := make([]Expr, len(plan.selects))
-	for i, s := range plan.selects {
-		switch s.exprType {
-		case ExprStar:
-			if s.field == "*" && s.funcOp == nil {
-				selectAll = true
+
+		if len(gbys) > 0 {
+			gbyFields := topOp.Descriptor().Fields[:len(gbys)]
+			for _, s := range plan.selects {
+				bindGroupByExprs(s, plan.groupByFields, gbyFields)
+			}
+			for _, f := range plan.having {
+				bindGroupByExprs(&f.fieldExpr, plan.groupByFields, gbyFields)
+				bindGroupByExprs(&f.constExpr, plan.groupByFields, gbyFields)
+			}
+		}
+	}
+
+	for _, f := range plan.having {
+		leftExpr, _, err := f.fieldExpr.generateExpr(c, topOp.Descriptor(), tableMap)
+		if err != nil {
+			return nil, err
+		}
+		rightExpr, _, err := f.constExpr.generateExpr(c, topOp.Descriptor(), tableMap)
+		if err != nil {
+			return nil, err
+		}
+		leftExpr, rightExpr = coerceComparison(leftExpr, rightExpr)
+		initPlans = append(initPlans, findScalarSubqueries(leftExpr)...)
+		initPlans = append(initPlans, findScalarSubqueries(rightExpr)...)
+		newOp, err := NewFilter(rightExpr, f.predOp, leftExpr, topOp)
+		if err != nil {
+			return nil, err
+		}
+		topOp = NewOperatorCard(newOp, topOp.Cardinality)
+	}
+
+	if len(plan.windows) > 0 {
+		windowOp, err := makeWindowOps(c, plan.windows, topOp, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		topOp = windowOp
+	}
+
+	exprList := make([]Expr, len(plan.selects))
+	for i, s := range plan.selects {
+		switch s.exprType {
+		case ExprStar:
+			if s.field == "*" && s.funcOp == nil {
+				selectAll = true
+			}
+		default:
+			expr, field, err := s.generateExpr(c, topOp.Descriptor(), tableMap)
+			if err != nil {
+				return nil, err
+			}
+			initPlans = append(initPlans, findScalarSubqueries(expr)...)
+			exprList[i] = expr
+			fieldNames = append(fieldNames, field)
+		}
+	}
+	if selectAll {
+		//don't output the columns of subqueries added by decorrelation
+		//(the join output doesn't always retain their qualifier, so match
+		//them by their generated names)
+		if len(hidden) > 0 {
+			exprList, fieldNames = nil, nil
+			for _, f := range topOp.Descriptor().Fields {
+				if !hidden[f.Fname] {
+					exprList = append(exprList, &FieldExpr{f})
+					fieldNames = append(fieldNames, f.Fname)
+				}
+			}
+			selectAll = false
+		}
+	}
+	if !selectAll {
+		projOp, err := NewProjectOp(exprList, fieldNames, plan.distinct, topOp)
+		if err != nil {
+			return nil, err
+		}
+		topOp = NewOperatorCard(projOp, topOp.Cardinality)
+	}
+
+	topOp, err := makeOrderByLimit(c, plan, topOp, tableMap)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(initPlans) > 0 {
+		topOp = NewOperatorCard(NewInitPlanOp(initPlans, topOp), topOp.Cardinality)
+	}
+	return topOp, nil
+}
+
+// Compute the window functions windows over topOp, with a [WindowOp] for each
+// of their distinct windows (in the order they first appear in the select
+// list), and cache the fields of their results in windows.
+func makeWindowOps(c *Catalog, windows []*LogicalSelectNode, topOp *OperatorCard, tableMap map[string]*PlanNode) (*OperatorCard, error) {
+	var keys []string
+	byKey := make(map[string][]*LogicalSelectNode)
+	for _, w := range windows {
+		if _, ok := byKey[w.window.key]; !ok {
+			keys = append(keys, w.window.key)
+		}
+		byKey[w.window.key] = append(byKey[w.window.key], w)
+	}
+
+	var windowCnt int
+	for _, key := range keys {
+		group := byKey[key]
+		window := group[0].window
+		desc := topOp.Descriptor()
+		var partitionBy, orderBy []Expr
+		var ascs []bool
+		for _, p := range window.partitionBy {
+			expr, _, err := p.generateExpr(c, desc, tableMap)
+			if err != nil {
+				return nil, err
+			}
+			partitionBy = append(partitionBy, expr)
+		}
+		for _, oby := range window.orderBy {
+			expr, _, err := oby.expr.generateExpr(c, desc, tableMap)
+			if err != nil {
+				return nil, err
+			}
+			orderBy = append(orderBy, expr)
+			ascs = append(ascs, oby.ascending)
+		}
+
+		funcs := make([]*WindowFunc, len(group))
+		for i, s := range group {
+			var args []Expr
+			for _, arg := range s.args {
+				expr, _, err := arg.generateExpr(c, desc, tableMap)
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, expr)
+			}
+			//make sure name has unique id
+			name := fmt.Sprintf("%s()%d", *s.funcOp, windowCnt)
+			windowCnt++
+			f, err := NewWindowFunc(*s.funcOp, args, s.window.frame, name)
+			if err != nil {
+				return nil, err
+			}
+			funcs[i] = f
+			s.cachedField = &f.field
+		}
+
+		windowOp, err := NewWindowOp(partitionBy, orderBy, ascs, funcs, topOp)
+		if err != nil {
+			return nil, err
+		}
+		topOp = NewOperatorCard(windowOp, topOp.Cardinality)
+	}
+	return topOp, nil
+}
+
+// Bind the expressions in n that are group by expressions other than fields,
+// e.g., a case expression, to the aggregate's fields for them, gbyFields, so
+// that they aren't evaluated over the aggregate's output (which doesn't have
+// the fields they're computed from).
+func bindGroupByExprs(n *LogicalSelectNode, gbys []*GroupBy, gbyFields []FieldType) {
+	switch n.exprType {
+	case ExprAggr:
+		//computed by the aggregate from its input
+		return
+	case ExprFunc, ExprCond:
+		for i, gby := range gbys {
+			if sameSelectNode(n, gby.expr) {
+				n.cachedField = &gbyFields[i]
+				return
+			}
+		}
+	case ExprWindow:
+		for _, p := range n.window.partitionBy {
+			bindGroupByExprs(p, gbys, gbyFields)
+		}
+		for _, oby := range n.window.orderBy {
+			bindGroupByExprs(oby.expr, gbys, gbyFields)
+		}
+	}
+	for _, arg := range n.args {
+		bindGroupByExprs(arg, gbys, gbyFields)
+	}
+}
+
+// Return true if the select nodes a and b are the same expression, ignoring
+// their aliases.
+func sameSelectNode(a, b *LogicalSelectNode) bool {
+	if a.exprType != b.exprType || a.table != b.table || a.field != b.field || a.value != b.value || a.distinct != b.distinct || len(a.args) != len(b.args) {
+		return false
+	}
+	if (a.funcOp == nil) != (b.funcOp == nil) || (a.funcOp != nil && *a.funcOp != *b.funcOp) {
+		return false
+	}
+	switch a.exprType {
+	case ExprSubquery, ExprOuterRef, ExprWindow:
+		return a == b
+	}
+	for i := range a.args {
+		if !sameSelectNode(a.args[i], b.args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply the order by and limit clauses of plan to topOp.
+//
+// An order by directly followed by a limit is planned as a TopN, which doesn't
+// need to sort all of topOp's tuples.
+func makeOrderByLimit(c *Catalog, plan *LogicalPlan, topOp *OperatorCard, tableMap map[string]*PlanNode) (*OperatorCard, error) {
+	var limExpr, offsetExpr Expr
+	var numTups, offset int64
+	card := topOp.Cardinality
+	if plan.limit != nil {
+		var err error
+		limExpr, _, err = plan.limit.generateExpr(c, topOp.Descriptor(), tableMap)
+		if err != nil {
+			return nil, err
+		}
+		numTups, err = evalLimitExpr(limExpr, "limit", 0)
+		if err != nil {
+			return nil, err
+		}
+		if plan.offset != nil {
+			offsetExpr, _, err = plan.offset.generateExpr(c, topOp.Descriptor(), tableMap)
+			if err != nil {
+				return nil, err
 			}
-		default:
-			expr, field, err := s.generateExpr(c, topOp.Descriptor(), tableMap)
+			offset, err = evalLimitExpr(offsetExpr, "offset", 0)
 			if err != nil {
 				return nil, err
 			}
-			exprList[i] = expr
-			fieldNames = append(fieldNames, field)
-		}
-	}
-	if !selectAll {
-		projOp, err := NewProjectOp(exprList, fieldNames, plan.distinct, topOp)
-		if err != nil {
-			return nil, err
 		}
-		topOp = NewOperatorCard(projOp, topOp.Cardinality)
+		card = min(int(numTups), max(card-int(offset), 0))
 	}
 
 	if len(plan.orderByFields) > 0 {
@@ -1224,6 +3702,15 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 			ascs = append(ascs, oby.ascending)
 
 		}
+		//a top-N keeps offset+limit tuples in memory, so larger results are
+		//sorted externally and then limited
+		if limExpr != nil && numTups+offset <= int64(SortBufferSize/descMemSize(topOp.Descriptor())) {
+			topNOp, err := NewTopN(exprs, ascs, limExpr, offsetExpr, topOp)
+			if err != nil {
+				return nil, err
+			}
+			return NewOperatorCard(topNOp, card), nil
+		}
 		orderOp, err := NewOrderBy(exprs, topOp, ascs)
 		if err != nil {
 			return nil, err
@@ -1231,37 +3718,116 @@ func makePhysicalPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
 		topOp = NewOperatorCard(orderOp, topOp.Cardinality)
 	}
 
-	if plan.limit != nil {
-		expr, _, err := plan.limit.generateExpr(c, topOp.Descriptor(), tableMap)
-		if err != nil {
-			return nil, err
+	if limExpr != nil {
+		topOp = NewOperatorCard(NewLimitOffsetOp(limExpr, offsetExpr, topOp), card)
+	}
+	return topOp, nil
+}
+
+// Build the physical plan of a set operation, i.e., a plan whose setOp is
+// non-nil.
+func makeSetOpPlan(c *Catalog, plan *LogicalPlan) (*OperatorCard, error) {
+	left, err := makePhysicalPlan(c, plan.setOp.left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := makePhysicalPlan(c, plan.setOp.right)
+	if err != nil {
+		return nil, err
+	}
+	op, err := NewSetOp(left, right, plan.setOp.op, plan.setOp.all)
+	if err != nil {
+		return nil, err
+	}
+	card := left.Cardinality
+	switch plan.setOp.op {
+	case SetUnion:
+		card += right.Cardinality
+	case SetIntersect:
+		card = min(card, right.Cardinality)
+	}
+	return makeOrderByLimit(c, plan, NewOperatorCard(op, card), make(map[string]*PlanNode))
+}
+
+// Map the fields of table to the columns of the rows of an insert statement
+// with the supplied column list. The ith element of the result is the column
+// holding the value of the ith field, or -1 if the field isn't listed and
+// takes its default value.
+//
+// If columns is empty, every field must be supplied, in the table's order.
+func insertColumnMap(table *Table, columns sqlparser.Columns) ([]int, error) {
+	colMap := make([]int, len(table.desc.Fields))
+	if len(columns) == 0 {
+		for i := range colMap {
+			colMap[i] = i
 		}
-		numTupsExpr, err := expr.EvalExpr(&Tuple{})
+		return colMap, nil
+	}
+	for i := range colMap {
+		colMap[i] = -1
+	}
+	for j, col := range columns {
+		name := strings.ToLower(col.String())
+		i, err := findFieldInTd(FieldType{name, "", UnknownType}, &table.desc)
 		if err != nil {
-			return nil, err
+			return nil, GoDBError{ParseError, fmt.Sprintf("no column %s in table %s", name, table.name)}
 		}
-		numTups := numTupsExpr.(IntField).Value
-		topOp = NewOperatorCard(NewLimitOp(expr, topOp), min(int(numTups), topOp.Cardinality))
+		if colMap[i] != -1 {
+			return nil, GoDBError{ParseError, fmt.Sprintf("column %s specified more than once", name)}
+		}
+		colMap[i] = j
 	}
-	return topOp, nil
+	for i, j := range colMap {
+		if j == -1 && table.defaultValue(i) == nil {
+			return nil, GoDBError{ParseError, fmt.Sprintf("column %s has no default value and must be specified", table.desc.Fields[i].Fname)}
+		}
+	}
+	return colMap, nil
 }
 
-func parseInsert(c *Catalog, insStmt *sqlparser.Insert) (Operator, error) {
-	if insStmt.Columns != nil {
-		return nil, GoDBError{ParseError, "GoDB doesn't support inserts of incomplete tuples"}
+// Return the expression for the ith field of table in a row inserted with
+// column map colMap (see [insertColumnMap]), given the expressions for the
+// columns of the row; a nil expression is the DEFAULT keyword.
+//
+// Returns an error if the field takes its default value but has none.
+func insertFieldExpr(table *Table, colMap []int, i int, row []Expr) (Expr, error) {
+	if colMap[i] == -1 || row[colMap[i]] == nil {
+		if table.defaultValue(i) == nil {
+			return nil, GoDBError{ParseError, fmt.Sprintf("column %s has no default value", table.desc.Fields[i].Fname)}
+		}
+		return &ConstExpr{table.defaultValue(i), table.desc.Fields[i].Ftype}, nil
 	}
+	return row[colMap[i]], nil
+}
+
+func parseInsert(c *Catalog, insStmt *sqlparser.Insert, returning sqlparser.SelectExprs) (Operator, error) {
 	tab := insStmt.Table.Name
-	file, err := c.GetTable(sqlparser.String(tab))
+	table, err := c.GetTableInfo(sqlparser.String(tab))
+	if err != nil {
+		return nil, err
+	}
+	colMap, err := insertColumnMap(table, insStmt.Columns)
 	if err != nil {
 		return nil, err
 	}
+	numCols := len(table.desc.Fields)
+	if len(insStmt.Columns) > 0 {
+		numCols = len(insStmt.Columns)
+	}
 
 	switch stmt := insStmt.Rows.(type) {
 	case sqlparser.Values:
 		var exprAr []([]Expr)
 		for _, t := range stmt {
-			var tupAr []Expr
+			if len(t) != numCols {
+				return nil, GoDBError{ParseError, fmt.Sprintf("insert has %d values but %d columns", len(t), numCols)}
+			}
+			var row []Expr
 			for _, e := range t {
+				if _, ok := e.(*sqlparser.Default); ok {
+					row = append(row, nil)
+					continue
+				}
 				expr, err := parseExpr(c, e, "")
 				if err != nil {
 					return nil, err
@@ -1270,89 +3836,406 @@ func parseInsert(c *Catalog, insStmt *sqlparser.Insert) (Operator, error) {
 				if err != nil {
 					return nil, err
 				}
-				tupAr = append(tupAr, exprOp)
+				row = append(row, exprOp)
+			}
+			tupAr := make([]Expr, len(colMap))
+			for i := range colMap {
+				tupAr[i], err = insertFieldExpr(table, colMap, i, row)
+				if err != nil {
+					return nil, err
+				}
 			}
 			exprAr = append(exprAr, tupAr)
 		}
 		iterOp := NewValueOp(exprAr)
-		insertOp := NewInsertOp(file, iterOp)
-		return insertOp, nil
+		return makeInsertOp(c, table, insStmt, iterOp, returning)
 
-	case *sqlparser.Select:
-		plan, err := parseStatement(c, stmt)
+	case sqlparser.SelectStatement:
+		plan, err := parseSelectStatement(c, stmt)
 		if err != nil {
 			return nil, err
 		}
-		op, err := makePhysicalPlan(c, plan)
+		var op Operator
+		op, err = makePhysicalPlan(c, plan)
 		if err != nil {
 			return nil, err
 		}
 
-		insertOp := NewInsertOp(file, op)
-		return insertOp, nil
+		if len(insStmt.Columns) > 0 {
+			//reorder the selected columns to match the table, adding defaults
+			selDesc := op.Descriptor()
+			if len(selDesc.Fields) != numCols {
+				return nil, GoDBError{ParseError, fmt.Sprintf("insert has %d selected columns but %d target columns", len(selDesc.Fields), numCols)}
+			}
+			row := make([]Expr, len(selDesc.Fields))
+			for j, f := range selDesc.Fields {
+				row[j] = &FieldExpr{f}
+			}
+			exprs := make([]Expr, len(colMap))
+			names := make([]string, len(colMap))
+			for i, f := range table.desc.Fields {
+				exprs[i], err = insertFieldExpr(table, colMap, i, row)
+				if err != nil {
+					return nil, err
+				}
+				names[i] = f.Fname
+			}
+			op, err = NewProjectOp(exprs, names, false, op)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return makeInsertOp(c, table, insStmt, op, returning)
 	}
 	return nil, nil
 }
 
-func parseDelete(c *Catalog, delStmt *sqlparser.Delete) (Operator, error) {
-	if len(delStmt.TableExprs) > 1 {
-		return nil, GoDBError{ParseError, "godb does not supporting deleting from multiple tables"}
+// Qualify the unqualified fields in n with table.
+func qualifyFields(n *LogicalSelectNode, table string) {
+	if n.exprType == ExprField && n.table == "" {
+		n.table = table
+	}
+	for _, arg := range n.args {
+		qualifyFields(arg, table)
+	}
+}
+
+// Unqualify the fields in n qualified by one of names, returning an error if
+// any field is qualified by some other name.
+func unqualifyFields(n *LogicalSelectNode, names ...string) error {
+	if n.exprType == ExprField && n.table != "" {
+		if !slices.Contains(names, n.table) {
+			return GoDBError{ParseError, fmt.Sprintf("table %s is not being modified", n.table)}
+		}
+		n.table = ""
+	}
+	for _, arg := range n.args {
+		if err := unqualifyFields(arg, names...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return an operator that evaluates the select list of a RETURNING clause on
+// each of the tuples modified by dml, a modification of the named table (which
+// returning may also refer to by alias), along with the scalar subqueries in
+// the select list. If returning is empty, dml is returned unchanged.
+func makeReturning(c *Catalog, dml dmlOperator, table string, alias string, returning sqlparser.SelectExprs) (Operator, []*ScalarSubqueryExpr, error) {
+	if len(returning) == 0 {
+		return dml, nil, nil
+	}
+	dml.setReturning()
+	desc := dml.Descriptor()
+	tableMap := map[string]*PlanNode{table: {&OperatorCard{Op: dml, Cardinality: 0}, desc}}
+	names := []string{table}
+	if alias != "" {
+		names = append(names, alias)
+	}
+
+	var exprs []Expr
+	var fieldNames []string
+	var initPlans []*ScalarSubqueryExpr
+	for _, se := range returning {
+		sel, err := parseSelect(c, se)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(extractAggs(sel)) > 0 {
+			return nil, nil, GoDBError{ParseError, "aggregates are not allowed in RETURNING"}
+		}
+		if sel.exprType == ExprStar {
+			if sel.table != "" && !slices.Contains(names, sel.table) {
+				return nil, nil, GoDBError{ParseError, fmt.Sprintf("table %s is not being modified", sel.table)}
+			}
+			for _, f := range desc.Fields {
+				exprs = append(exprs, &FieldExpr{f})
+				fieldNames = append(fieldNames, f.Fname)
+			}
+			continue
+		}
+		if err := unqualifyFields(sel, names...); err != nil {
+			return nil, nil, err
+		}
+		expr, name, err := sel.generateExpr(c, desc, tableMap)
+		if err != nil {
+			return nil, nil, err
+		}
+		initPlans = append(initPlans, findScalarSubqueries(expr)...)
+		exprs = append(exprs, expr)
+		fieldNames = append(fieldNames, name)
+	}
+	projOp, err := NewProjectOp(exprs, fieldNames, false, dml)
+	if err != nil {
+		return nil, nil, err
+	}
+	return projOp, initPlans, nil
+}
+
+// Return an operator that inserts the tuples of child into table. If insStmt
+// has an ON DUPLICATE KEY UPDATE clause or is an INSERT IGNORE (including those
+// rewritten from ON CONFLICT by rewriteOnConflict), tuples whose key matches an
+// existing tuple update or are discarded, respectively.
+//
+// The key is the table's primary key; the conflict columns of an ON CONFLICT
+// clause, if any, must be its fields.
+func makeInsertOp(c *Catalog, table *Table, insStmt *sqlparser.Insert, child Operator, returning sqlparser.SelectExprs) (Operator, error) {
+	if len(insStmt.OnDup) == 0 && insStmt.Ignore == "" {
+		insOp := NewInsertOp(table.file, child)
+		insOp.setTable(table, c.bufferPool)
+		op, initPlans, err := makeReturning(c, insOp, table.name, "", returning)
+		if err != nil {
+			return nil, err
+		}
+		if len(initPlans) > 0 {
+			return NewInitPlanOp(initPlans, op), nil
+		}
+		return op, nil
+	}
+	keyCols := table.primaryKey
+	if len(keyCols) == 0 {
+		return nil, GoDBError{ParseError, fmt.Sprintf("table %s has no primary key to detect conflicts with", table.name)}
+	}
+	if cols := conflictColumns(insStmt.Comments); cols != nil {
+		matches := len(cols) == len(keyCols)
+		for i := range cols {
+			matches = matches && slices.Contains(keyCols, cols[i]) && slices.Contains(cols, keyCols[i])
+		}
+		if !matches {
+			return nil, GoDBError{ParseError, fmt.Sprintf("there is no unique or primary key constraint of table %s matching the ON CONFLICT specification", table.name)}
+		}
+	}
+	keyFields := make([]FieldType, len(keyCols))
+	for i, col := range keyCols {
+		keyFields[i] = FieldType{col, "", UnknownType}
+	}
+
+	//update expressions refer to the existing tuple, or to the proposed one
+	//as excluded.col or VALUES(col)
+	conflictDesc := upsertConflictDesc(table.file.Descriptor(), table.name)
+	tableMap := make(map[string]*PlanNode)
+	var initPlans []*ScalarSubqueryExpr
+	updateFields := make([]FieldType, len(insStmt.OnDup))
+	updateExprs := make([]Expr, len(insStmt.OnDup))
+	for i, ue := range insStmt.OnDup {
+		name := strings.ToLower(ue.Name.Name.String())
+		qualifier := strings.ToLower(ue.Name.Qualifier.Name.String())
+		if qualifier != "" && qualifier != table.name {
+			return nil, GoDBError{ParseError, fmt.Sprintf("cannot update column %s of table %s", name, qualifier)}
+		}
+		updateFields[i] = FieldType{name, "", UnknownType}
+
+		val, err := parseExpr(c, ue.Expr, "")
+		if err != nil {
+			return nil, err
+		}
+		qualifyFields(val, table.name)
+		updateExprs[i], _, err = val.generateExpr(c, conflictDesc, tableMap)
+		if err != nil {
+			return nil, err
+		}
+		initPlans = append(initPlans, findScalarSubqueries(updateExprs[i])...)
+	}
+
+	upsertOp, err := NewUpsertOp(table.file, table.name, child, keyFields, updateFields, updateExprs, len(insStmt.OnDup) == 0)
+	if err != nil {
+		return nil, err
 	}
-	tables, subplans, joins, err := parseFrom(c, delStmt.TableExprs[0])
+	upsertOp.setTable(table, c.bufferPool)
+	op, returningPlans, err := makeReturning(c, upsertOp, table.name, "", returning)
 	if err != nil {
 		return nil, err
 	}
+	initPlans = append(initPlans, returningPlans...)
+	if len(initPlans) > 0 {
+		return NewInitPlanOp(initPlans, op), nil
+	}
+	return op, nil
+}
+
+// Plan the tuples of the single table named in tableExprs that satisfy where,
+// for a statement that modifies them. verb describes the statement in errors.
+//
+// Returns the table, the operator producing its qualifying tuples, and the
+// scalar subqueries that must be evaluated before that operator runs.
+func parseModifySource(c *Catalog, tableExprs sqlparser.TableExprs, where *sqlparser.Where, verb string) (*LogicalTableNode, Operator, map[string]*PlanNode, []*ScalarSubqueryExpr, error) {
+	multipleTablesErr := GoDBError{ParseError, fmt.Sprintf("godb does not supporting %s multiple tables", verb)}
+	if len(tableExprs) > 1 {
+		return nil, nil, nil, nil, multipleTablesErr
+	}
+	tables, subplans, joins, err := parseFrom(c, tableExprs[0])
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
 	if len(tables) > 1 {
-		return nil, GoDBError{ParseError, "godb does not supporting deleting from multiple tables"}
+		return nil, nil, nil, nil, multipleTablesErr
 	}
 	if subplans != nil || joins != nil {
-		return nil, GoDBError{ParseError, "godb does not supporting deleting from multiple tables"}
+		return nil, nil, nil, nil, multipleTablesErr
 	}
 
 	tableMap := make(map[string]*PlanNode)
 	tableMap[tables[0].tableName] = &PlanNode{&OperatorCard{Op: *tables[0].file, Cardinality: 0}, (*tables[0].file).Descriptor()}
 
 	var filters []*LogicalFilterNode = make([]*LogicalFilterNode, 0)
-	if delStmt.Where != nil {
-		filters, joins, err = parseWhere(c, subplans, tables, delStmt.Where.Expr)
+	var semiJoins []*LogicalSemiJoinNode
+	if where != nil {
+		filters, joins, semiJoins, err = parseWhere(c, subplans, tables, where.Expr)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, nil, err
 		}
 		if joins != nil {
-			return nil, GoDBError{ParseError, "godb does not supporting deleting from multiple tables"}
+			return nil, nil, nil, nil, multipleTablesErr
+		}
+		//correlated subqueries are re-run for each tuple considered
+		p := &LogicalPlan{tables: tables, filters: filters, semiJoins: semiJoins}
+		if err := p.bindAllOuterRefs(c); err != nil {
+			return nil, nil, nil, nil, err
 		}
 	}
+	var initPlans []*ScalarSubqueryExpr
 	var newOp Operator
 	newOp = *tables[0].file
 	for _, f := range filters {
+		if f.fieldExpr.isConstant() && f.constExpr.isConstant() {
+			holds, err := f.constantHolds(c)
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			if !holds {
+				newOp = NewEmptyValueOp(newOp.Descriptor())
+			}
+			continue
+		}
 		tabName, fieldName, err := f.fieldExpr.getTableField(c, subplans, tables)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, nil, err
 		}
 		node, err := fieldToOp(tabName, fieldName, tableMap)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, nil, err
 		}
 		leftExpr, _, err := f.fieldExpr.generateExpr(c, node.desc, tableMap)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, nil, err
 		}
 		rightExpr, _, err := f.constExpr.generateExpr(c, node.desc, tableMap)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, nil, err
 		}
+		leftExpr, rightExpr = coerceComparison(leftExpr, rightExpr)
+		holds, constant, err := constantComparison(leftExpr, f.predOp, rightExpr)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		if constant {
+			if !holds {
+				newOp = NewEmptyValueOp(newOp.Descriptor())
+			}
+			continue
+		}
+		initPlans = append(initPlans, findScalarSubqueries(rightExpr)...)
 
 		//op := node.op
 		//dbField, _ := fieldNameToField(f.table, f.field, &PlanNode{op, &desc})
 
 		//newInt, _ := strconv.Atoi(f.constVal)
 		newOp, err = NewFilter(rightExpr, f.predOp, leftExpr, newOp)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+	}
+	for _, sj := range semiJoins {
+		var leftExprs []Expr
+		if sj.expr != nil {
+			leftExpr, _, err := sj.expr.generateExpr(c, newOp.Descriptor(), tableMap)
+			if err != nil {
+				return nil, nil, nil, nil, err
+			}
+			leftExprs = []Expr{leftExpr}
+		}
+		newOp, err = makeSemiJoin(c, newOp, leftExprs, sj)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+	}
+	return tables[0], newOp, tableMap, initPlans, nil
+}
+
+func parseDelete(c *Catalog, delStmt *sqlparser.Delete, returning sqlparser.SelectExprs) (Operator, error) {
+	table, newOp, _, initPlans, err := parseModifySource(c, delStmt.TableExprs, delStmt.Where, "deleting from")
+	if err != nil {
+		return nil, err
+	}
+
+	dop := NewDeleteOp(*table.file, newOp)
+	if t, err := c.GetTableInfo(table.tableName); err == nil {
+		dop.setTable(t, c.bufferPool)
+	}
+	delOp, returningPlans, err := makeReturning(c, dop, table.tableName, table.alias, returning)
+	if err != nil {
+		return nil, err
+	}
+	initPlans = append(initPlans, returningPlans...)
+	if len(initPlans) > 0 {
+		delOp = NewInitPlanOp(initPlans, delOp)
+	}
+	return delOp, nil
+}
+
+func parseUpdate(c *Catalog, updStmt *sqlparser.Update, returning sqlparser.SelectExprs) (Operator, error) {
+	if updStmt.OrderBy != nil || updStmt.Limit != nil {
+		return nil, GoDBError{ParseError, "godb does not support ORDER BY or LIMIT in updates"}
+	}
+	table, newOp, tableMap, initPlans, err := parseModifySource(c, updStmt.TableExprs, updStmt.Where, "updating")
+	if err != nil {
+		return nil, err
+	}
+
+	fileDesc := (*table.file).Descriptor()
+	fields := make([]FieldType, len(updStmt.Exprs))
+	exprs := make([]Expr, len(updStmt.Exprs))
+	for i, ue := range updStmt.Exprs {
+		name := strings.ToLower(ue.Name.Name.String())
+		qualifier := strings.ToLower(ue.Name.Qualifier.Name.String())
+		if qualifier != "" && qualifier != table.tableName && qualifier != table.alias {
+			return nil, GoDBError{ParseError, fmt.Sprintf("cannot update column %s of table %s", name, qualifier)}
+		}
+		fieldNo, err := findFieldInTd(FieldType{name, "", UnknownType}, fileDesc)
+		if err != nil {
+			return nil, GoDBError{ParseError, fmt.Sprintf("no column %s in table %s", name, table.tableName)}
+		}
+		fields[i] = fileDesc.Fields[fieldNo]
+
+		//the new value is computed from the tuple's current values
+		val, err := parseExpr(c, ue.Expr, "")
+		if err != nil {
+			return nil, err
+		}
+		exprs[i], _, err = val.generateExpr(c, newOp.Descriptor(), tableMap)
 		if err != nil {
 			return nil, err
 		}
+		initPlans = append(initPlans, findScalarSubqueries(exprs[i])...)
 	}
 
-	return NewDeleteOp(*tables[0].file, newOp), nil
+	updOp, err := NewUpdateOp(*table.file, fields, exprs, newOp)
+	if err != nil {
+		return nil, err
+	}
+	if t, err := c.GetTableInfo(table.tableName); err == nil {
+		updOp.setTable(t, c.bufferPool)
+	}
+	op, returningPlans, err := makeReturning(c, updOp, table.tableName, table.alias, returning)
+	if err != nil {
+		return nil, err
+	}
+	initPlans = append(initPlans, returningPlans...)
+	if len(initPlans) > 0 {
+		return NewInitPlanOp(initPlans, op), nil
+	}
+	return op, nil
 }
 
 type QueryType int
@@ -1364,13 +4247,64 @@ const (
 	AbortXactionType     QueryType = iota
 	CreateTableQueryType QueryType = iota
 	DropTableQueryType   QueryType = iota
+	AnalyzeQueryType     QueryType = iota
 	UnknownQueryType     QueryType = iota
 )
 
-func processDDL(c *Catalog, ddl *sqlparser.DDL) (QueryType, error) {
+// Return the value of the DEFAULT expression expr of a column of type t, which
+// must be constant and call no volatile function, since it is evaluated when
+// the table is created rather than for each inserted tuple.
+func defaultValueOf(c *Catalog, expr string, t DBType) (DBValue, error) {
+	stmt, err := sqlparser.Parse(rewriteExprs("select " + expr))
+	if err != nil {
+		return nil, GoDBError{ParseError, fmt.Sprintf("invalid default value %s: %s", expr, err.Error())}
+	}
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok || len(sel.SelectExprs) != 1 {
+		return nil, GoDBError{ParseError, fmt.Sprintf("invalid default value %s", expr)}
+	}
+	aliased, ok := sel.SelectExprs[0].(*sqlparser.AliasedExpr)
+	if !ok {
+		return nil, GoDBError{ParseError, fmt.Sprintf("invalid default value %s", expr)}
+	}
+	node, err := parseExpr(c, aliased.Expr, "")
+	if err != nil {
+		return nil, err
+	}
+	if !node.isConstant() {
+		return nil, GoDBError{ParseError, fmt.Sprintf("default value %s must be a constant expression", expr)}
+	}
+	e, _, err := node.generateExpr(c, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	v, err := e.EvalExpr(nil)
+	if err != nil {
+		return nil, err
+	}
+	//constant expressions that can be evaluated are folded unless volatile
+	if !isConstExpr(simplifyExpr(e)) {
+		return nil, GoDBError{ParseError, fmt.Sprintf("default value %s must not call a volatile function", expr)}
+	}
+	if _, isInt := v.(IntField); isInt != (t == IntType) {
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("default value %s does not match column type %v", expr, t)}
+	}
+	return v, nil
+}
+
+// The KeyOpt of a column declared PRIMARY KEY; sqlparser doesn't export the
+// values of [sqlparser.ColumnKeyOption], of which this is the second.
+const columnKeyPrimary sqlparser.ColumnKeyOption = 1
+
+func processDDL(c *Catalog, ddl *sqlparser.DDL, defaultExprs map[string]string) (QueryType, error) {
 	switch ddl.Action {
 	case "create":
+		if ddl.TableSpec == nil {
+			return UnknownQueryType, GoDBError{ParseError, "unsupported create table statement"}
+		}
 		fields := make([]FieldType, len(ddl.TableSpec.Columns))
+		defaults := make([]DBValue, len(ddl.TableSpec.Columns))
+		var primaryKey []string
 		tabName := sqlparser.String(ddl.NewName.Name)
 		t, _ := c.GetTable(tabName)
 		if t != nil {
@@ -1393,12 +4327,44 @@ func processDDL(c *Catalog, ddl *sqlparser.DDL) (QueryType, error) {
 
 			}
 			fields[i] = FieldType{colName, "", colType}
+
+			if col.Type.KeyOpt == columnKeyPrimary {
+				primaryKey = append(primaryKey, colName)
+			}
+			if expr, ok := defaultExprs[strings.ToLower(colName)]; ok {
+				v, err := defaultValueOf(c, expr, colType)
+				if err != nil {
+					return UnknownQueryType, err
+				}
+				defaults[i] = v
+			}
+		}
+
+		for _, idx := range ddl.TableSpec.Indexes {
+			if !idx.Info.Primary {
+				continue
+			}
+			if primaryKey != nil {
+				return UnknownQueryType, GoDBError{ParseError, "multiple primary keys are not allowed"}
+			}
+			for _, col := range idx.Columns {
+				primaryKey = append(primaryKey, col.Column.Lowered())
+			}
 		}
 
 		_, err := c.addTable(tabName, TupleDesc{fields})
 		if err != nil {
 			return UnknownQueryType, err
 		}
+		if err := c.setDefaults(tabName, defaults); err != nil {
+			return UnknownQueryType, err
+		}
+		if primaryKey != nil {
+			if err := c.setPrimaryKey(tabName, primaryKey); err != nil {
+				c.dropTable(tabName)
+				return UnknownQueryType, err
+			}
+		}
 		return CreateTableQueryType, nil
 
 	case "drop":
@@ -1414,13 +4380,37 @@ func processDDL(c *Catalog, ddl *sqlparser.DDL) (QueryType, error) {
 }
 
 func Parse(c *Catalog, query string) (QueryType, Operator, error) {
-	stmt, err := sqlparser.Parse(query)
+	if tables, ok, err := parseAnalyze(query); ok {
+		if err == nil {
+			err = c.ComputeTableStats(tables...)
+		}
+		if err != nil {
+			return UnknownQueryType, nil, err
+		}
+		return AnalyzeQueryType, nil, nil
+	}
+	query, returningList := splitReturning(query)
+	query, defaultExprs := splitDefaults(query)
+	var returning sqlparser.SelectExprs
+	if returningList != "" {
+		//parse the RETURNING clause as the select list of a query
+		sel, err := sqlparser.Parse(rewriteExprs("select " + returningList))
+		if err != nil {
+			return UnknownQueryType, nil, err
+		}
+		s, ok := sel.(*sqlparser.Select)
+		if !ok {
+			return UnknownQueryType, nil, GoDBError{ParseError, fmt.Sprintf("invalid RETURNING clause %s", returningList)}
+		}
+		returning = s.SelectExprs
+	}
+	stmt, err := sqlparser.Parse(rewriteExprs(rewriteWindows(rewriteOnConflict(rewriteSetOps(query)))))
 	if err != nil {
 		return UnknownQueryType, nil, err
 	}
 	switch stmt := stmt.(type) {
-	case *sqlparser.Select:
-		plan, err := parseStatement(c, stmt)
+	case sqlparser.SelectStatement:
+		plan, err := parseSelectStatement(c, stmt)
 		if err != nil {
 			//fmt.Printf("Err: %s\n", err.Error())
 			return UnknownQueryType, nil, err
@@ -1432,13 +4422,19 @@ func Parse(c *Catalog, query string) (QueryType, Operator, error) {
 		}
 		return IteratorType, op, nil
 	case *sqlparser.Insert:
-		op, err := parseInsert(c, stmt)
+		op, err := parseInsert(c, stmt, returning)
 		if err != nil {
 			return UnknownQueryType, nil, err
 		}
 		return IteratorType, op, nil
 	case *sqlparser.Delete:
-		op, err := parseDelete(c, stmt)
+		op, err := parseDelete(c, stmt, returning)
+		if err != nil {
+			return UnknownQueryType, nil, err
+		}
+		return IteratorType, op, nil
+	case *sqlparser.Update:
+		op, err := parseUpdate(c, stmt, returning)
 		if err != nil {
 			return UnknownQueryType, nil, err
 		}
@@ -1450,7 +4446,7 @@ func Parse(c *Catalog, query string) (QueryType, Operator, error) {
 	case *sqlparser.Rollback:
 		return AbortXactionType, nil, nil
 	case *sqlparser.DDL:
-		qtype, err := processDDL(c, stmt)
+		qtype, err := processDDL(c, stmt, defaultExprs)
 		if err != nil {
 			return UnknownQueryType, nil, err
 		} else {
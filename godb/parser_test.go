@@ -2,6 +2,7 @@ package godb
 
 import (
 	"os"
+	"testing"
 )
 
 func MakeTestDatabase(bufferPoolSize int, catalog string) (*BufferPool, *Catalog, error) {
@@ -69,3 +70,72 @@ func MakeParserTestDatabase(bufferPoolSize int) (*BufferPool, *Catalog, error) {
 
 	return bp, c, nil
 }
+
+// Parse and run query against c, returning all of its result tuples.
+func runQueryForTest(t *testing.T, c *Catalog, bp *BufferPool, query string) []*Tuple {
+	t.Helper()
+	qType, plan, err := Parse(c, query)
+	if err != nil {
+		t.Fatalf("failed to parse, q=%s, %s", query, err.Error())
+	}
+	if qType != IteratorType {
+		t.Fatalf("expected an iterator query, q=%s", query)
+	}
+	tid := BeginTransactionForTest(t, bp)
+	iter, err := plan.Iterator(tid)
+	if err != nil {
+		t.Fatalf("failed to get iterator, q=%s, %s", query, err.Error())
+	}
+	var tups []*Tuple
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf("failed to get tuple, q=%s, %s", query, err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		tups = append(tups, tup)
+	}
+	bp.CommitTransaction(tid)
+	return tups
+}
+
+func TestHaving(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	queries := []struct {
+		sql      string
+		expected int
+	}{
+		{"select name, sum(age) from t group by name having sum(age) > 60", 3},
+		{"select name, sum(age) as s from t group by name having s > 60 and name <> 'bo'", 2},
+		{"select name from t group by name having count(age) > 1", 2},
+		{"select name from t group by name having max(age) > (select avg(age) from t2)", 4},
+		{"select sum(age) from t having sum(age) > 500", 1},
+		{"select sum(age) from t having sum(age) > 1000", 0},
+	}
+	for _, q := range queries {
+		tups := runQueryForTest(t, c, bp, q.sql)
+		if len(tups) != q.expected {
+			t.Errorf("q=%s: expected %d results, got %d", q.sql, q.expected, len(tups))
+		}
+	}
+
+	// aggregates only used by the having clause are not output
+	tups := runQueryForTest(t, c, bp, "select name from t group by name having count(age) > 1")
+	for _, tup := range tups {
+		if len(tup.Fields) != 1 {
+			t.Errorf("expected 1 output field, got %d", len(tup.Fields))
+		}
+		if name := tup.Fields[0].(StringField).Value; name != "riza" && name != "sam" {
+			t.Errorf("unexpected group %s", name)
+		}
+	}
+
+	if _, _, err := Parse(c, "select name from t having age > 1"); err == nil {
+		t.Errorf("expected error for having without group by or aggregates")
+	}
+}
@@ -52,54 +52,66 @@ func (p *Project) Descriptor() *TupleDesc {
 
 // Project operator implementation. This function should iterate over the
 // results of the child iterator, projecting out the fields from each tuple. In
-// the case of distinct projection, duplicate tuples should be removed. To
-// implement this you will need to record in some data structure with the
-// distinct tuples seen so far. Note that support for the distinct keyword is
-// optional as specified in the lab 2 assignment.
+// the case of distinct projection, duplicate tuples should be removed.
+//
+// Duplicates are removed by sorting the projected tuples (externally, if they
+// don't fit in [SortBufferSize] bytes; see [externalSort]) and skipping
+// those equal to their predecessor, so distinct results are returned in
+// sorted order.
 func (p *Project) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
 	childIter, err := p.child.Iterator(tid)
 	if err != nil {
 		return nil, err
 	}
 
-	seenTuples := make(map[any]struct{}) // For handling distinct tuples, if needed
+	desc := p.Descriptor()
+	projIter := func() (*Tuple, error) {
+		tuple, err := childIter()
+		if err != nil {
+			return nil, err
+		}
+		if tuple == nil && err == nil {
+			return nil, nil
+		}
 
-	return func() (*Tuple, error) {
-		for {
-			tuple, err := childIter()
+		// Project the fields
+		projectedFields := make([]DBValue, len(p.selectFields))
+		for i, expr := range p.selectFields {
+			value, err := expr.EvalExpr(tuple) // Assume Evaluate processes an expression
 			if err != nil {
 				return nil, err
 			}
-			if tuple == nil && err == nil {
-				return nil, nil
-			}
+			projectedFields[i] = value
+		}
 
-			// Project the fields
-			projectedFields := make([]DBValue, len(p.selectFields))
-			for i, expr := range p.selectFields {
-				value, err := expr.EvalExpr(tuple) // Assume Evaluate processes an expression
-				if err != nil {
-					return nil, err
-				}
-				projectedFields[i] = value
-			}
+		// Create a new tuple with projected fields
+		return &Tuple{
+			Fields: projectedFields,
+			Desc:   *desc,
+		}, nil
+	}
+	if !p.distinct {
+		return projIter, nil
+	}
 
-			// Create a new tuple with projected fields
-			projectedTuple := &Tuple{
-				Fields: projectedFields,
-				Desc:   *p.Descriptor(),
+	// Handle distinct logic
+	sortedIter, err := externalSort(desc, projIter, fieldsLess, SortBufferSize)
+	if err != nil {
+		return nil, err
+	}
+	var lastKey any
+	return func() (*Tuple, error) {
+		for {
+			tuple, err := sortedIter()
+			if err != nil || tuple == nil {
+				return nil, err
 			}
-
-			// Handle distinct logic (if enabled)
-			if p.distinct {
-				key := projectedTuple.tupleKey() // Serialize tuple to a string as a key
-				if _, exists := seenTuples[key]; exists {
-					continue // Skip duplicates
-				}
-				seenTuples[key] = struct{}{}
+			key := tuple.tupleKey()
+			if lastKey != nil && key == lastKey {
+				continue // Skip duplicates
 			}
-
-			return projectedTuple, nil
+			lastKey = key
+			return tuple, nil
 		}
 	}, nil
 }
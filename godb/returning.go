@@ -0,0 +1,51 @@
+package godb
+
+// An operator that modifies a DBFile (an InsertOp, DeleteOp, UpdateOp or
+// UpsertOp). By default it returns a single tuple with a "count" field
+// indicating the number of tuples it modified; after setReturning is called, it
+// instead returns each of the modified tuples, as for a RETURNING clause.
+// After setTable is called, the modified tuples are recorded in the statistics
+// of the file's table when the transaction commits (see
+// BufferPool.recordModifications), and the statistics become stale once
+// enough are.
+type dmlOperator interface {
+	Operator
+	setReturning()
+	setTable(table *Table, bp *BufferPool)
+}
+
+// Return the descriptor of the tuples returned by an operator that modifies
+// file: the descriptor of file if returning is set, or else a one column
+// descriptor with an integer field named "count".
+func dmlDescriptor(file DBFile, returning bool) *TupleDesc {
+	if returning {
+		return file.Descriptor().copy()
+	}
+	return &TupleDesc{
+		Fields: []FieldType{
+			{Fname: "count", Ftype: IntType},
+		},
+	}
+}
+
+// Return an iterator over the result of an operator that modified count
+// tuples: the modified tuples if returning is set, or else a one-field tuple
+// with their count.
+func dmlResultIter(returning bool, count int64, modified []*Tuple) func() (*Tuple, error) {
+	if !returning {
+		modified = []*Tuple{{
+			Fields: []DBValue{
+				IntField{Value: count},
+			},
+			Desc: *dmlDescriptor(nil, false),
+		}}
+	}
+	i := 0
+	return func() (*Tuple, error) {
+		if i >= len(modified) {
+			return nil, nil
+		}
+		i++
+		return modified[i-1], nil
+	}
+}
@@ -0,0 +1,108 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestInsertReturning(t *testing.T) {
+	_, t1, t2, hf, bp, tid := makeTestVars(t)
+	rows := [][]Expr{
+		{&ConstExpr{t1.Fields[0], StringType}, &ConstExpr{t1.Fields[1], IntType}},
+		{&ConstExpr{t2.Fields[0], StringType}, &ConstExpr{t2.Fields[1], IntType}},
+	}
+	iop := NewInsertOp(hf, NewValueOp(rows))
+	iop.setReturning()
+	if !iop.Descriptor().equals(hf.Descriptor()) {
+		t.Errorf("expected the descriptor of the heap file, got %v", iop.Descriptor())
+	}
+	iter, err := iop.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, expected := range []Tuple{t1, t2} {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil || !tup.equals(&expected) {
+			t.Errorf("expected inserted tuple %v, got %v", expected, tup)
+		}
+	}
+	if tup, _ := iter(); tup != nil {
+		t.Errorf("expected only the inserted tuples, got %v", tup)
+	}
+	bp.CommitTransaction(tid)
+
+	tid = BeginTransactionForTest(t, bp)
+	if cnt := countTuplesForTest(t, hf, tid); cnt != 2 {
+		t.Errorf("expected 2 tuples in the file, got %d", cnt)
+	}
+	bp.CommitTransaction(tid)
+}
+
+func TestReturningQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	queries := []struct {
+		sql      string
+		expected [][]any
+	}{
+		{"insert into t values ('zed', 1), ('yan', 2) returning name, age * 10 as a",
+			[][]any{{"zed", int64(10)}, {"yan", int64(20)}}},
+		{"insert into t select name, age from t2 where name = 'bo' returning *",
+			[][]any{{"bo", int64(99)}}},
+		{"update t set age = age + 1 where name = 'zed' returning t.age, name",
+			[][]any{{int64(2), "zed"}}},
+		{"update t as x set age = 0 where name = 'yan' returning x.*",
+			[][]any{{"yan", int64(0)}}},
+		{"delete from t where name = 'zed' returning name",
+			[][]any{{"zed"}}},
+		{"delete from t where age > 98 returning name, (select count(*) from t2) c",
+			[][]any{{"bo", int64(12)}, {"sam", int64(12)}, {"bo", int64(12)}}},
+		{"insert into t values ('kai', 4) returning name || '!', upper(name) || '?'",
+			[][]any{{"kai!", "KAI?"}}},
+		{"delete from t where name = 'kai' returning position('a' in name), name like 'k%'",
+			[][]any{{int64(2), int64(1)}}},
+		{"update t set age = 6 where name = 'yan' returning cast(age * 2 as varchar), cast(age as varchar) || name",
+			[][]any{{"12", "6yan"}}},
+		{"insert into t values ('returning', 3) returning name",
+			[][]any{{"returning"}}},
+	}
+	for _, q := range queries {
+		tups := runQueryForTest(t, c, bp, q.sql)
+		if len(tups) != len(q.expected) {
+			t.Errorf("q=%s: expected %d results, got %d", q.sql, len(q.expected), len(tups))
+			continue
+		}
+		for i, tup := range tups {
+			for j, v := range q.expected[i] {
+				var got any
+				switch f := tup.Fields[j].(type) {
+				case IntField:
+					got = f.Value
+				case StringField:
+					got = f.Value
+				}
+				if got != v {
+					t.Errorf("q=%s: expected %v in row %d, column %d, got %v", q.sql, v, i, j, got)
+				}
+			}
+		}
+	}
+
+	if tups := runQueryForTest(t, c, bp, "select name from t"); len(tups) != 12 {
+		t.Errorf("expected 12 tuples after modifications, got %d", len(tups))
+	}
+
+	for _, q := range []string{
+		"delete from t returning nosuch",
+		"delete from t returning t2.name",
+		"update t set age = 1 returning count(*)",
+	} {
+		if _, _, err := Parse(c, q); err == nil {
+			t.Errorf("q=%s: expected error", q)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package godb
+
+type SemiJoin struct {
+	// Expressions that when applied to tuples from the left or right operators,
+	// respectively, return the values compared by the IN predicate. Both are
+	// empty for an EXISTS predicate, which only checks whether right is
+	// non-empty.
+	leftFields, rightFields []Expr
+
+	left, right Operator
+
+	// If true, emit left tuples that have no match in right (NOT IN / NOT
+	// EXISTS) rather than those that do.
+	anti bool
+
+	// Non-nil if right is a correlated subquery, in which case right is re-run
+	// for every left tuple with params bound to that tuple.
+	params *outerTuple
+}
+
+// Construct a semi-join, which emits each tuple of left whose leftFields values
+// appear among the rightFields values of some tuple of right. Each left tuple
+// is emitted at most once, no matter how many right tuples it matches.
+//
+// If leftFields and rightFields are both empty, every left tuple is emitted if
+// right produces at least one tuple (i.e., an uncorrelated EXISTS).
+func NewSemiJoin(left Operator, leftFields []Expr, right Operator, rightFields []Expr) (*SemiJoin, error) {
+	if len(leftFields) != len(rightFields) {
+		return nil, GoDBError{IllegalOperationError, "semi-join requires the same number of left and right expressions"}
+	}
+	for i := range leftFields {
+		if leftFields[i].GetExprType().Ftype != rightFields[i].GetExprType().Ftype {
+			return nil, GoDBError{TypeMismatchError, "semi-join expressions must have the same type"}
+		}
+	}
+	return &SemiJoin{leftFields, rightFields, left, right, false, nil}, nil
+}
+
+// Construct an anti-join, which emits each tuple of left that a semi-join with
+// the same arguments would not.
+func NewAntiJoin(left Operator, leftFields []Expr, right Operator, rightFields []Expr) (*SemiJoin, error) {
+	sj, err := NewSemiJoin(left, leftFields, right, rightFields)
+	if err != nil {
+		return nil, err
+	}
+	sj.anti = true
+	return sj, nil
+}
+
+// Return a TupleDesc for this semi-join. Only the fields of the left input are
+// emitted.
+func (sj *SemiJoin) Descriptor() *TupleDesc {
+	return sj.left.Descriptor()
+}
+
+// Evaluate exprs on t, returning a key that can be used in a map.
+func evalKey(exprs []Expr, t *Tuple) (any, error) {
+	fields := make([]DBValue, len(exprs))
+	for i, e := range exprs {
+		v, err := e.EvalExpr(t)
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = v
+	}
+	return (&Tuple{Fields: fields}).tupleKey(), nil
+}
+
+// Semi-join operator implementation. On the first invocation, the right input
+// is read in full and the set of its rightFields values is built in memory;
+// the left input is then streamed and probed against that set.
+//
+// If the right input is correlated, it is instead re-run for each left tuple,
+// stopping at the first match.
+func (sj *SemiJoin) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	leftIter, err := sj.left.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys map[any]struct{}
+	nonEmpty := false
+	built := false
+
+	build := func() error {
+		rightIter, err := sj.right.Iterator(tid)
+		if err != nil {
+			return err
+		}
+		keys = make(map[any]struct{})
+		for {
+			t, err := rightIter()
+			if err != nil {
+				return err
+			}
+			if t == nil {
+				break
+			}
+			nonEmpty = true
+			if len(sj.rightFields) == 0 {
+				// EXISTS only needs to know there is one row
+				break
+			}
+			k, err := evalKey(sj.rightFields, t)
+			if err != nil {
+				return err
+			}
+			keys[k] = struct{}{}
+		}
+		built = true
+		return nil
+	}
+
+	probe := func(t *Tuple) (bool, error) {
+		if sj.params != nil {
+			return sj.probeCorrelated(t, tid)
+		}
+		if !built {
+			if err := build(); err != nil {
+				return false, err
+			}
+		}
+		if len(sj.leftFields) == 0 {
+			return nonEmpty, nil
+		}
+		k, err := evalKey(sj.leftFields, t)
+		if err != nil {
+			return false, err
+		}
+		_, match := keys[k]
+		return match, nil
+	}
+
+	return func() (*Tuple, error) {
+		for {
+			t, err := leftIter()
+			if err != nil {
+				return nil, err
+			}
+			if t == nil {
+				return nil, nil
+			}
+			match, err := probe(t)
+			if err != nil {
+				return nil, err
+			}
+			if match != sj.anti {
+				return t, nil
+			}
+		}
+	}, nil
+}
+
+// Re-run the correlated right input with its outer references bound to t, and
+// return true if it produces a tuple matching t.
+func (sj *SemiJoin) probeCorrelated(t *Tuple, tid TransactionID) (bool, error) {
+	var leftKey any
+	if len(sj.leftFields) > 0 {
+		k, err := evalKey(sj.leftFields, t)
+		if err != nil {
+			return false, err
+		}
+		leftKey = k
+	}
+	sj.params.t = t
+	rightIter, err := sj.right.Iterator(tid)
+	if err != nil {
+		return false, err
+	}
+	for {
+		rt, err := rightIter()
+		if err != nil {
+			return false, err
+		}
+		if rt == nil {
+			return false, nil
+		}
+		if leftKey == nil {
+			return true, nil
+		}
+		k, err := evalKey(sj.rightFields, rt)
+		if err != nil {
+			return false, err
+		}
+		if k == leftKey {
+			return true, nil
+		}
+	}
+}
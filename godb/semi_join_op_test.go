@@ -0,0 +1,143 @@
+package godb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSemiJoin(t *testing.T) {
+	td, t1, t2, hf, bp, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+
+	os.Remove(JoinTestFile)
+	hf2, _ := NewHeapFile(JoinTestFile, &td, bp)
+	insertTupleForTest(t, hf2, &t2, tid)
+	insertTupleForTest(t, hf2, &t2, tid)
+
+	field := FieldExpr{td.Fields[1]}
+	semi, err := NewSemiJoin(hf, []Expr{&field}, hf2, []Expr{&field})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !semi.Descriptor().equals(&td) {
+		t.Errorf("semi-join descriptor should match its left input")
+	}
+	// each matching left tuple is emitted once, even though it matches two
+	// right tuples
+	if cnt := countTuplesForTest(t, semi, tid); cnt != 2 {
+		t.Errorf("unexpected number of semi-join results (%d, expected 2)", cnt)
+	}
+
+	anti, err := NewAntiJoin(hf, []Expr{&field}, hf2, []Expr{&field})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if cnt := countTuplesForTest(t, anti, tid); cnt != 1 {
+		t.Errorf("unexpected number of anti-join results (%d, expected 1)", cnt)
+	}
+}
+
+func TestSemiJoinExists(t *testing.T) {
+	td, t1, t2, hf, bp, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+
+	os.Remove(JoinTestFile)
+	hf2, _ := NewHeapFile(JoinTestFile, &td, bp)
+
+	exists, _ := NewSemiJoin(hf, nil, hf2, nil)
+	notExists, _ := NewAntiJoin(hf, nil, hf2, nil)
+	if cnt := countTuplesForTest(t, exists, tid); cnt != 0 {
+		t.Errorf("EXISTS over empty input should emit nothing, got %d", cnt)
+	}
+	if cnt := countTuplesForTest(t, notExists, tid); cnt != 2 {
+		t.Errorf("NOT EXISTS over empty input should emit everything, got %d", cnt)
+	}
+
+	insertTupleForTest(t, hf2, &t1, tid)
+	if cnt := countTuplesForTest(t, exists, tid); cnt != 2 {
+		t.Errorf("EXISTS over non-empty input should emit everything, got %d", cnt)
+	}
+	if cnt := countTuplesForTest(t, notExists, tid); cnt != 0 {
+		t.Errorf("NOT EXISTS over non-empty input should emit nothing, got %d", cnt)
+	}
+
+	if _, err := NewSemiJoin(hf, []Expr{&FieldExpr{td.Fields[0]}}, hf2, nil); err == nil {
+		t.Errorf("expected error with only one join expression")
+	}
+}
+
+func TestSubqueryPredicates(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	queries := []struct {
+		sql      string
+		expected int
+	}{
+		{"select name from t where age in (select age from t2 where age > 50)", 3},
+		{"select name from t where age not in (select age from t2 where age > 50)", 9},
+		{"select name from t where name in (select name from t2 where age < 25) and age > 30", 1},
+		{"select name from t where exists (select name from t2 where age > 90)", 12},
+		{"select name from t where exists (select name from t2 where age > 1000)", 0},
+		{"select name from t where not exists (select name from t2 where age > 1000)", 12},
+		{"select name from t where age > (select avg(age) from t2)", 4},
+		{"select name from t where (select max(age) from t2) = age", 2},
+		{"select t.name, t.age from t join t2 on t.name = t2.name where t.age in (select age from t2 where name = 'sam')", 5},
+	}
+	for _, q := range queries {
+		tups := runQueryForTest(t, c, bp, q.sql)
+		if len(tups) != q.expected {
+			t.Errorf("q=%s: expected %d results, got %d", q.sql, q.expected, len(tups))
+		}
+	}
+}
+
+func TestScalarSubqueryInSelectList(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	tups := runQueryForTest(t, c, bp, "select name, (select max(age) from t2) as m from t")
+	if len(tups) != 12 {
+		t.Fatalf("expected 12 results, got %d", len(tups))
+	}
+	for _, tup := range tups {
+		if tup.Fields[1].(IntField).Value != 99 {
+			t.Errorf("expected subquery value 99, got %v", tup.Fields[1])
+		}
+	}
+	if tups[0].Desc.Fields[1].Fname != "m" {
+		t.Errorf("expected subquery column to be named m, got %s", tups[0].Desc.Fields[1].Fname)
+	}
+
+	_, plan, err := Parse(c, "select name from t where age = (select age from t2)")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := plan.Iterator(NewTID()); err == nil {
+		t.Errorf("expected error for subquery returning more than one row")
+	}
+}
+
+func countTuplesForTest(t *testing.T, op Operator, tid TransactionID) int {
+	t.Helper()
+	iter, err := op.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			return cnt
+		}
+		cnt++
+	}
+}
@@ -0,0 +1,160 @@
+package godb
+
+import "fmt"
+
+type SetOpType int
+
+const (
+	SetUnion     SetOpType = iota
+	SetIntersect SetOpType = iota
+	SetExcept    SetOpType = iota
+)
+
+func (op SetOpType) String() string {
+	switch op {
+	case SetUnion:
+		return "Union"
+	case SetIntersect:
+		return "Intersect"
+	case SetExcept:
+		return "Except"
+	}
+	return "Unknown"
+}
+
+type SetOp struct {
+	left, right Operator
+	op          SetOpType
+	all         bool // if false, duplicates are removed from the output
+	desc        *TupleDesc
+}
+
+// Construct a set operation (UNION, INTERSECT or EXCEPT) over the tuples of
+// left and right. If all is true, duplicates are retained as in UNION ALL,
+// INTERSECT ALL and EXCEPT ALL; otherwise each distinct tuple is emitted at
+// most once.
+//
+// The inputs must have the same number of fields, and corresponding fields
+// must have the same type. The output takes its field names from left.
+func NewSetOp(left Operator, right Operator, op SetOpType, all bool) (*SetOp, error) {
+	leftDesc, rightDesc := left.Descriptor(), right.Descriptor()
+	if len(leftDesc.Fields) != len(rightDesc.Fields) {
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("each %s query must have the same number of columns (%d vs %d)", op, len(leftDesc.Fields), len(rightDesc.Fields))}
+	}
+	desc := leftDesc.copy()
+	for i, f := range rightDesc.Fields {
+		if f.Ftype != desc.Fields[i].Ftype {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("%s types of column %s do not match", op, desc.Fields[i].Fname)}
+		}
+		desc.Fields[i].TableQualifier = ""
+	}
+	return &SetOp{left, right, op, all, desc}, nil
+}
+
+// Return a TupleDesc for this set operation, with the field names of the left
+// input.
+func (s *SetOp) Descriptor() *TupleDesc {
+	return s.desc
+}
+
+// Set operation implementation. UNION streams the left and then the right
+// input, tracking the tuples already emitted if duplicates are to be removed.
+// INTERSECT and EXCEPT first count the occurrences of each tuple of the right
+// input in memory, and then stream the left input, probing those counts.
+func (s *SetOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	leftIter, err := s.left.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+
+	emitted := make(map[any]bool)
+	var rightIter func() (*Tuple, error)
+	var rightCounts map[any]int
+
+	countRight := func() error {
+		iter, err := s.right.Iterator(tid)
+		if err != nil {
+			return err
+		}
+		rightCounts = make(map[any]int)
+		for {
+			t, err := iter()
+			if err != nil {
+				return err
+			}
+			if t == nil {
+				return nil
+			}
+			rightCounts[(&Tuple{Fields: t.Fields}).tupleKey()]++
+		}
+	}
+
+	// Return true if the tuple with key k from the left input is part of the
+	// output.
+	keep := func(k any) bool {
+		switch s.op {
+		case SetIntersect:
+			if rightCounts[k] == 0 {
+				return false
+			}
+			if s.all {
+				rightCounts[k]--
+			}
+			return true
+		case SetExcept:
+			if rightCounts[k] > 0 {
+				if s.all {
+					rightCounts[k]--
+				}
+				return false
+			}
+			return true
+		}
+		return true
+	}
+
+	return func() (*Tuple, error) {
+		for {
+			var t *Tuple
+			var err error
+			if rightIter == nil {
+				t, err = leftIter()
+				if err != nil {
+					return nil, err
+				}
+				if t == nil {
+					if s.op != SetUnion {
+						return nil, nil
+					}
+					if rightIter, err = s.right.Iterator(tid); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				if s.op != SetUnion && rightCounts == nil {
+					if err := countRight(); err != nil {
+						return nil, err
+					}
+				}
+			} else {
+				t, err = rightIter()
+				if err != nil || t == nil {
+					return nil, err
+				}
+			}
+
+			out := &Tuple{Desc: *s.desc, Fields: t.Fields}
+			k := (&Tuple{Fields: t.Fields}).tupleKey()
+			if rightIter == nil && !keep(k) {
+				continue
+			}
+			if !s.all {
+				if emitted[k] {
+					continue
+				}
+				emitted[k] = true
+			}
+			return out, nil
+		}
+	}, nil
+}
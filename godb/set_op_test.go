@@ -0,0 +1,111 @@
+package godb
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSetOp(t *testing.T) {
+	td, t1, t2, hf, bp, tid := makeTestVars(t)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+
+	os.Remove(JoinTestFile)
+	hf2, _ := NewHeapFile(JoinTestFile, &td, bp)
+	insertTupleForTest(t, hf2, &t2, tid)
+	insertTupleForTest(t, hf2, &t2, tid)
+
+	ops := []struct {
+		op       SetOpType
+		all      bool
+		expected int
+	}{
+		{SetUnion, false, 2},
+		{SetUnion, true, 5},
+		{SetIntersect, false, 1},
+		{SetIntersect, true, 1},
+		{SetExcept, false, 1},
+		{SetExcept, true, 2},
+	}
+	for _, o := range ops {
+		setOp, err := NewSetOp(hf, hf2, o.op, o.all)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if cnt := countTuplesForTest(t, setOp, tid); cnt != o.expected {
+			t.Errorf("%s (all=%t): expected %d results, got %d", o.op, o.all, o.expected, cnt)
+		}
+	}
+}
+
+func TestSetOpIncompatible(t *testing.T) {
+	td, _, _, hf, bp, _ := makeTestVars(t)
+	os.Remove(JoinTestFile)
+	reordered := TupleDesc{Fields: []FieldType{td.Fields[1], td.Fields[0]}}
+	hf2, _ := NewHeapFile(JoinTestFile, &reordered, bp)
+	if _, err := NewSetOp(hf, hf2, SetUnion, false); err == nil {
+		t.Errorf("expected error for union of columns with different types")
+	}
+	proj, _ := NewProjectOp([]Expr{&FieldExpr{td.Fields[0]}}, []string{"name"}, false, hf)
+	if _, err := NewSetOp(hf, proj, SetExcept, false); err == nil {
+		t.Errorf("expected error for union of inputs with different numbers of columns")
+	}
+}
+
+func TestSetOpQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	queries := []struct {
+		sql      string
+		expected int
+	}{
+		{"select name from t union select name from t2", 10},
+		{"select name from t union all select name from t2", 24},
+		{"select name from t where age > 40 intersect select name from t2 where age < 30", 2},
+		{"select name from t intersect all select name from t2", 12},
+		{"select name from t except select name from t2 where age > 40", 4},
+		{"select name from t except all select name from t2 where age > 40", 6},
+		{"select name from t union select name from t2 except select name from t where age > 40", 4},
+		//intersect binds more tightly than union and except
+		{"select name from t where age > 90 union select name from t where age < 23 intersect select name from t2 where age = 22", 4},
+		{"select name from t where age < 23 intersect select name from t2 where age = 22 union select name from t where age > 90", 4},
+		{"select name from t except select name from t where age < 30 intersect select name from t2 where age > 40", 8},
+		{"(select name from t where age > 90 union select name from t where age < 23) intersect select name from t2 where age = 22", 2},
+		{"select name from t where age > 90 union select name from t where age < 23 intersect all select name from t2 where age = 22 order by name limit 3", 3},
+		{"select name from t where age in (select age from t where name = 'bo' union select age from t2 where name = 'ang')", 4},
+		{"select name from t where name = 'except' union select name from t2 where name = 'intersect'", 0},
+	}
+	for _, q := range queries {
+		tups := runQueryForTest(t, c, bp, q.sql)
+		if len(tups) != q.expected {
+			t.Errorf("q=%s: expected %d results, got %d", q.sql, q.expected, len(tups))
+		}
+	}
+
+	ordered := []struct {
+		sql      string
+		expected []string
+	}{
+		{"select name from t union select name from t2 order by name limit 3", []string{"ang", "bill", "bo"}},
+		{"select u.name from (select name from t where age < 25 union select name from t2 where age > 90) u order by u.name", []string{"ang", "bo", "riza", "sam"}},
+	}
+	for _, q := range ordered {
+		tups := runQueryForTest(t, c, bp, q.sql)
+		if len(tups) != len(q.expected) {
+			t.Errorf("q=%s: expected %d results, got %d", q.sql, len(q.expected), len(tups))
+			continue
+		}
+		for i, tup := range tups {
+			if name := tup.Fields[0].(StringField).Value; name != q.expected[i] {
+				t.Errorf("q=%s: expected %s at position %d, got %s", q.sql, q.expected[i], i, name)
+			}
+		}
+	}
+
+	if _, _, err := Parse(c, "select name from t union select age from t2"); err == nil {
+		t.Errorf("expected error for union of columns with different types")
+	}
+}
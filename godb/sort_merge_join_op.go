@@ -0,0 +1,128 @@
+package godb
+
+import (
+	"fmt"
+)
+
+// A SortMergeJoin is an equality join that sorts both of its inputs on their
+// join expressions, using an external sort if necessary, and then merges them.
+// Unlike the nested loops [EqualityJoin], it reads each input once.
+type SortMergeJoin struct {
+	leftField, rightField Expr
+	left, right           Operator
+
+	// The maximum number of bytes of tuples each of the sorts holds in memory.
+	maxBufferBytes int
+}
+
+// Construct a sort-merge join of the tuples of left and right whose values of
+// leftField and rightField, respectively, are equal.
+//
+// Returns an error if the expressions are of different types.
+func NewSortMergeJoin(left Operator, leftField Expr, right Operator, rightField Expr, maxBufferBytes int) (*SortMergeJoin, error) {
+	lt, rt := leftField.GetExprType().Ftype, rightField.GetExprType().Ftype
+	if lt != rt {
+		return nil, GoDBError{TypeMismatchError, fmt.Sprintf("cannot join %v with %v", lt, rt)}
+	}
+	return &SortMergeJoin{leftField, rightField, left, right, maxBufferBytes}, nil
+}
+
+// The descriptor of the join is the fields of the left input followed by those
+// of the right.
+func (j *SortMergeJoin) Descriptor() *TupleDesc {
+	return j.left.Descriptor().merge(j.right.Descriptor())
+}
+
+// Return an iterator over the joined tuples. The tuples are returned in order
+// of their join values; tuples with the same join value are returned in the
+// same order as by a nested loops join over the sorted inputs.
+//
+// All of the right tuples with the same join value are held in memory at once.
+func (j *SortMergeJoin) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	sortedIter := func(op Operator, field Expr) (func() (*Tuple, error), error) {
+		iter, err := op.Iterator(tid)
+		if err != nil {
+			return nil, err
+		}
+		exprs, ascs := []Expr{field}, []bool{true}
+		return externalSort(op.Descriptor(), iter, func(t1, t2 *Tuple) (bool, error) {
+			return orderByLess(exprs, ascs, t1, t2)
+		}, j.maxBufferBytes)
+	}
+	leftIter, err := sortedIter(j.left, j.leftField)
+	if err != nil {
+		return nil, err
+	}
+	rightIter, err := sortedIter(j.right, j.rightField)
+	if err != nil {
+		return nil, err
+	}
+
+	// the next right tuple not yet added to a group, and its join value
+	nextRight, err := rightIter()
+	if err != nil {
+		return nil, err
+	}
+	var nextRightVal DBValue
+	advanceRight := func() error {
+		if nextRight == nil {
+			return nil
+		}
+		nextRightVal, err = j.rightField.EvalExpr(nextRight)
+		return err
+	}
+	if err := advanceRight(); err != nil {
+		return nil, err
+	}
+
+	var leftTuple *Tuple
+	var group []*Tuple // the right tuples whose join value is groupVal
+	var groupVal DBValue
+	groupIdx := 0
+	return func() (*Tuple, error) {
+		for {
+			if leftTuple != nil && groupIdx < len(group) {
+				groupIdx++
+				return joinTuples(leftTuple, group[groupIdx-1]), nil
+			}
+
+			leftTuple, err = leftIter()
+			if err != nil || leftTuple == nil {
+				return nil, err
+			}
+			leftVal, err := j.leftField.EvalExpr(leftTuple)
+			if err != nil {
+				return nil, err
+			}
+			groupIdx = 0
+			if group != nil && leftVal.EvalPred(groupVal, OpEq) {
+				continue
+			}
+
+			// skip the right tuples that are less than the left one, and
+			// collect those that are equal
+			group = nil
+			for nextRight != nil && nextRightVal.EvalPred(leftVal, OpLt) {
+				if nextRight, err = rightIter(); err != nil {
+					return nil, err
+				}
+				if err := advanceRight(); err != nil {
+					return nil, err
+				}
+			}
+			groupVal = leftVal
+			for nextRight != nil && nextRightVal.EvalPred(leftVal, OpEq) {
+				group = append(group, nextRight)
+				if nextRight, err = rightIter(); err != nil {
+					return nil, err
+				}
+				if err := advanceRight(); err != nil {
+					return nil, err
+				}
+			}
+			if group == nil && nextRight == nil {
+				return nil, nil
+			}
+		}
+	}, nil
+}
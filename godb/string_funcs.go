@@ -0,0 +1,279 @@
+package godb
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Built-in string functions. Lengths and positions count characters (i.e.,
+// runes), not bytes, and positions start at 1, as in SQL.
+
+func upperFunc(args []any) (any, error) {
+	return strings.ToUpper(args[0].(string)), nil
+}
+
+func lowerFunc(args []any) (any, error) {
+	return strings.ToLower(args[0].(string)), nil
+}
+
+func lengthFunc(args []any) (any, error) {
+	return int64(utf8.RuneCountInString(args[0].(string))), nil
+}
+
+// The characters removed by trim, ltrim and rtrim if none are given.
+const trimSpace = " \t\r\n"
+
+// Return the characters to trim given the arguments of trim, ltrim or rtrim.
+func trimChars(args []any) string {
+	if len(args) > 1 {
+		return args[1].(string)
+	}
+	return trimSpace
+}
+
+func trimFunc(args []any) (any, error) {
+	return strings.Trim(args[0].(string), trimChars(args)), nil
+}
+
+func ltrimFunc(args []any) (any, error) {
+	return strings.TrimLeft(args[0].(string), trimChars(args)), nil
+}
+
+func rtrimFunc(args []any) (any, error) {
+	return strings.TrimRight(args[0].(string), trimChars(args)), nil
+}
+
+func replaceFunc(args []any) (any, error) {
+	from := args[1].(string)
+	if from == "" {
+		return args[0].(string), nil
+	}
+	return strings.ReplaceAll(args[0].(string), from, args[2].(string)), nil
+}
+
+// split_part(s, delim, n) returns the nth field of s split by delim, counting
+// from the end if n is negative, or "" if there is no such field.
+func splitPartFunc(args []any) (any, error) {
+	s, delim, n := args[0].(string), args[1].(string), args[2].(int64)
+	if n == 0 {
+		return nil, GoDBError{IllegalOperationError, "field position in split_part must not be zero"}
+	}
+	var parts []string
+	if delim == "" {
+		parts = []string{s}
+	} else {
+		parts = strings.Split(s, delim)
+	}
+	if n < 0 {
+		n = int64(len(parts)) + n + 1
+	}
+	if n < 1 || n > int64(len(parts)) {
+		return "", nil
+	}
+	return parts[n-1], nil
+}
+
+func concatFunc(args []any) (any, error) {
+	var sb strings.Builder
+	for _, arg := range args {
+		sb.WriteString(arg.(string))
+	}
+	return sb.String(), nil
+}
+
+// position(sub, s) returns the position of the first occurrence of sub in s,
+// or 0 if there is none.
+func positionFunc(args []any) (any, error) {
+	sub, s := args[0].(string), args[1].(string)
+	i := strings.Index(s, sub)
+	if i < 0 {
+		return int64(0), nil
+	}
+	return int64(utf8.RuneCountInString(s[:i]) + 1), nil
+}
+
+// Return s padded to n characters on the left (or right) with repetitions of
+// fill (a space if not given), or truncated to its first n characters if it's
+// longer.
+func pad(args []any, left bool) (any, error) {
+	s, n := []rune(args[0].(string)), args[1].(int64)
+	fill := []rune(" ")
+	if len(args) > 2 {
+		fill = []rune(args[2].(string))
+	}
+	if n <= 0 {
+		return "", nil
+	}
+	if n <= int64(len(s)) {
+		return string(s[:n]), nil
+	}
+	if len(fill) == 0 {
+		return string(s), nil
+	}
+	padding := make([]rune, 0, n-int64(len(s)))
+	for i := 0; int64(len(padding)) < n-int64(len(s)); i++ {
+		padding = append(padding, fill[i%len(fill)])
+	}
+	if left {
+		return string(padding) + string(s), nil
+	}
+	return string(s) + string(padding), nil
+}
+
+func lpadFunc(args []any) (any, error) {
+	return pad(args, true)
+}
+
+func rpadFunc(args []any) (any, error) {
+	return pad(args, false)
+}
+
+// Return the number of characters that left(s, n) or right(s, n) return: the
+// first (or last) n characters of s, or, if n is negative, all but the last
+// (or first) -n characters.
+func prefixLen(s []rune, n int64) int {
+	if n < 0 {
+		n = max(int64(len(s))+n, 0)
+	}
+	return int(min(n, int64(len(s))))
+}
+
+func leftFunc(args []any) (any, error) {
+	s := []rune(args[0].(string))
+	return string(s[:prefixLen(s, args[1].(int64))]), nil
+}
+
+func rightFunc(args []any) (any, error) {
+	s := []rune(args[0].(string))
+	return string(s[len(s)-prefixLen(s, args[1].(int64)):]), nil
+}
+
+// Rewrite the || (string concatenation) operators in query into calls of
+// concat, which sqlparser would otherwise parse as OR, e.g.,
+//
+//	select name || ', ' || city from t
+//
+// becomes
+//
+//	select concat(concat(name, ', '), city) from t
+//
+// The operands of || must be strings, columns, function calls or
+// parenthesized expressions; any other operator next to || must be
+// parenthesized, e.g., (age + 1) || 'x'.
+func rewriteConcatOps(query string) string {
+	for {
+		rewritten, ok := rewriteFirstConcatOp(query)
+		if !ok {
+			return query
+		}
+		query = rewritten
+	}
+}
+
+// Rewrite the first || operator of query, returning false if there is none.
+func rewriteFirstConcatOp(query string) (string, bool) {
+	for i := 0; i+1 < len(query); i++ {
+		if ch := query[i]; ch == '\'' || ch == '"' || ch == '`' {
+			i = quoteEnd(query, i)
+			continue
+		}
+		if query[i:i+2] != "||" {
+			continue
+		}
+		leftEnd := len(strings.TrimRight(query[:i], " \t\r\n"))
+		leftStart := operandStart(query, leftEnd)
+		rightStart := len(query) - len(strings.TrimLeft(query[i+2:], " \t\r\n"))
+		rightEnd := operandEnd(query, rightStart)
+		if leftStart < 0 || rightEnd < 0 {
+			i++
+			continue
+		}
+		return fmt.Sprintf("%sconcat(%s, %s)%s", query[:leftStart], query[leftStart:leftEnd], query[rightStart:rightEnd], query[rightEnd:]), true
+	}
+	return query, false
+}
+
+// Return the start of the operand of query ending at end, as operandEnd does
+// for the start. A parenthesized expression is a function call only if the
+// name immediately precedes the parenthesis, so that, e.g., the keyword in
+// "select (a)" isn't taken to be a function name. Returns -1 if there is no
+// such operand.
+func operandStart(query string, end int) int {
+	if end <= 0 {
+		return -1
+	}
+	parens, _ := matchParens(query)
+	switch ch := query[end-1]; {
+	case ch == '\'' || ch == '"':
+		for i := 0; i < end; i++ {
+			if query[i] == '\'' || query[i] == '"' || query[i] == '`' {
+				closing := quoteEnd(query, i)
+				if closing == end-1 {
+					return i
+				}
+				i = closing
+			}
+		}
+		return -1
+	case ch == ')':
+		open, ok := parens[end-1]
+		if !ok {
+			return -1
+		}
+		start := open
+		for start > 0 && (isWordChar(query[start-1]) || query[start-1] == '.' || query[start-1] == '`') {
+			start--
+		}
+		return start
+	case isWordChar(ch) || ch == '`':
+		start := end
+		for start > 0 && (isWordChar(query[start-1]) || query[start-1] == '.' || query[start-1] == '`') {
+			start--
+		}
+		return start
+	}
+	return -1
+}
+
+// Rewrite the calls position(sub IN s) in query, which sqlparser can't parse,
+// into position(sub, s).
+func rewritePositions(query string) string {
+	parens, depth := matchParens(query)
+	words := scanWords(query)
+	var ins []sqlWord
+	for i, w := range words {
+		if w.lower != "position" {
+			continue
+		}
+		open := len(query) - len(strings.TrimLeft(query[w.end:], " \t\r\n"))
+		if open >= len(query) || query[open] != '(' {
+			continue
+		}
+		close, ok := parens[open]
+		if !ok {
+			continue
+		}
+		//the first IN of the call that isn't in nested parentheses
+		for _, in := range words[i+1:] {
+			if in.start >= close {
+				break
+			}
+			if in.lower == "in" && depth[in.start] == depth[open]+1 {
+				ins = append(ins, in)
+				break
+			}
+		}
+	}
+	slices.SortFunc(ins, func(a, b sqlWord) int { return a.start - b.start })
+	var out strings.Builder
+	last := 0
+	for _, in := range ins {
+		out.WriteString(query[last:in.start])
+		out.WriteString(",")
+		last = in.end
+	}
+	out.WriteString(query[last:])
+	return out.String()
+}
@@ -0,0 +1,181 @@
+package godb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStringFuncs(t *testing.T) {
+	str := func(s string) *Expr {
+		var e Expr = &ConstExpr{StringField{s}, StringType}
+		return &e
+	}
+	num := func(i int64) *Expr {
+		var e Expr = &ConstExpr{IntField{i}, IntType}
+		return &e
+	}
+	calls := []struct {
+		op       string
+		args     []*Expr
+		expected DBValue
+	}{
+		{"upper", []*Expr{str("Kendall/MIT")}, StringField{"KENDALL/MIT"}},
+		{"lower", []*Expr{str("Kendall/MIT")}, StringField{"kendall/mit"}},
+		{"length", []*Expr{str("Alewife")}, IntField{7}},
+		{"length", []*Expr{str("café")}, IntField{4}},
+		{"length", []*Expr{str("")}, IntField{0}},
+		{"trim", []*Expr{str(" \tPark St \n")}, StringField{"Park St"}},
+		{"trim", []*Expr{str("xxParkxyx"), str("xy")}, StringField{"Park"}},
+		{"ltrim", []*Expr{str("  Park  ")}, StringField{"Park  "}},
+		{"rtrim", []*Expr{str("  Park  ")}, StringField{"  Park"}},
+		{"rtrim", []*Expr{str("Park--"), str("-")}, StringField{"Park"}},
+		{"replace", []*Expr{str("Red Line"), str("Red"), str("Orange")}, StringField{"Orange Line"}},
+		{"replace", []*Expr{str("a-b-c"), str("-"), str("")}, StringField{"abc"}},
+		{"replace", []*Expr{str("abc"), str(""), str("x")}, StringField{"abc"}},
+		{"split_part", []*Expr{str("Red-Ashmont-Braintree"), str("-"), num(2)}, StringField{"Ashmont"}},
+		{"split_part", []*Expr{str("Red-Ashmont-Braintree"), str("-"), num(-1)}, StringField{"Braintree"}},
+		{"split_part", []*Expr{str("Red-Ashmont"), str("-"), num(3)}, StringField{""}},
+		{"split_part", []*Expr{str("Red"), str(""), num(1)}, StringField{"Red"}},
+		{"concat", []*Expr{str("Red"), str(" "), str("Line")}, StringField{"Red Line"}},
+		{"concat", []*Expr{str("Red")}, StringField{"Red"}},
+		{"concat", []*Expr{}, StringField{""}},
+		{"position", []*Expr{str("St"), str("Park St")}, IntField{6}},
+		{"position", []*Expr{str("é"), str("café")}, IntField{4}},
+		{"position", []*Expr{str("x"), str("Park St")}, IntField{0}},
+		{"position", []*Expr{str(""), str("Park St")}, IntField{1}},
+		{"lpad", []*Expr{str("7"), num(3), str("0")}, StringField{"007"}},
+		{"lpad", []*Expr{str("7"), num(4), str("ab")}, StringField{"aba7"}},
+		{"lpad", []*Expr{str("7"), num(3)}, StringField{"  7"}},
+		{"lpad", []*Expr{str("Alewife"), num(3), str("0")}, StringField{"Ale"}},
+		{"rpad", []*Expr{str("7"), num(3), str("0")}, StringField{"700"}},
+		{"rpad", []*Expr{str("7"), num(3), str("")}, StringField{"7"}},
+		{"rpad", []*Expr{str("7"), num(-1)}, StringField{""}},
+		{"left", []*Expr{str("Alewife"), num(3)}, StringField{"Ale"}},
+		{"left", []*Expr{str("Alewife"), num(-4)}, StringField{"Ale"}},
+		{"left", []*Expr{str("Alewife"), num(10)}, StringField{"Alewife"}},
+		{"right", []*Expr{str("Alewife"), num(4)}, StringField{"wife"}},
+		{"right", []*Expr{str("Alewife"), num(-3)}, StringField{"wife"}},
+		{"right", []*Expr{str("café"), num(2)}, StringField{"fé"}},
+		{"right", []*Expr{str("Alewife"), num(-10)}, StringField{""}},
+	}
+	for _, c := range calls {
+		f := &FuncExpr{c.op, c.args}
+		got, err := f.EvalExpr(nil)
+		if err != nil {
+			t.Fatalf("%s: %s", c.op, err.Error())
+		}
+		if got != c.expected {
+			t.Errorf("%s: expected %v, got %v", exprToStr(f), c.expected, got)
+		}
+		if ftype := f.GetExprType().Ftype; ftype != fieldTypeOf(c.expected) {
+			t.Errorf("%s: expected type %v, got %v", c.op, fieldTypeOf(c.expected), ftype)
+		}
+	}
+
+	for _, c := range []struct {
+		op   string
+		args []*Expr
+	}{
+		{"upper", []*Expr{num(1)}},
+		{"length", []*Expr{str("a"), str("b")}},
+		{"concat", []*Expr{str("a"), num(1)}},
+		{"lpad", []*Expr{str("a"), str("b")}},
+	} {
+		if _, err := lookupFunc(c.op, (&FuncExpr{c.op, c.args}).argTypes()); err == nil {
+			t.Errorf("expected error calling %s with %d arguments", c.op, len(c.args))
+		}
+	}
+	if _, err := (&FuncExpr{"split_part", []*Expr{str("a"), str("-"), num(0)}}).EvalExpr(nil); err == nil {
+		t.Errorf("expected error for split_part of field 0")
+	}
+
+	list := ListOfFunctions()
+	for _, f := range []string{"upper(string)", "trim(string,string)", "concat(string...)", "lpad(string,int,string)", "right(string,int)"} {
+		if !strings.Contains(list, f) {
+			t.Errorf("expected %s in the list of functions", f)
+		}
+	}
+}
+
+// Return the type of v.
+func fieldTypeOf(v DBValue) DBType {
+	if _, ok := v.(IntField); ok {
+		return IntType
+	}
+	return StringType
+}
+
+func TestStringSyntaxRewrite(t *testing.T) {
+	queries := []struct{ query, expected string }{
+		{"select a || b from t", "select concat(a, b) from t"},
+		{"select t.a||', '||f(b, c) as x from t", "select concat(concat(t.a, ', '), f(b, c)) as x from t"},
+		{"select (a || 'x') || ('y') from t where a || 'z' = 'qz'", "select concat((concat(a, 'x')), ('y')) from t where concat(a, 'z') = 'qz'"},
+		{"select 'it''s' || a from t", "select concat('it''s', a) from t"},
+		{"select position('a' in name), POSITION(lower(x) IN (y)) from t", "select position('a' , name), POSITION(lower(x) , (y)) from t"},
+		{"select position(position('a' in b) in 'c') from t", "select position(position('a' , b) , 'c') from t"},
+		// strings, and in outside of position, aren't rewritten
+		{"select 'a || b', a from t where a in ('x')", "select 'a || b', a from t where a in ('x')"},
+	}
+	for _, q := range queries {
+		if got := rewritePositions(rewriteConcatOps(q.query)); got != q.expected {
+			t.Errorf("rewriting %s: expected %s, got %s", q.query, q.expected, got)
+		}
+	}
+}
+
+func TestStringFuncQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+
+	tups := runQueryForTest(t, c, bp, "select upper(name) || '-' || cast(age as char), length(name), left(name, 2), lpad(cast(age as char), 3, '0') from t where position('ar' in name) = 2")
+	if len(tups) != 2 {
+		t.Fatalf("expected 2 tuples, got %d", len(tups))
+	}
+	for _, tup := range tups {
+		label := tup.Fields[0].(StringField).Value
+		if label != "MARK-50" && label != "SARAH-60" {
+			t.Errorf("unexpected label %s", label)
+		}
+		upper, age, _ := strings.Cut(label, "-")
+		name := strings.ToLower(upper)
+		if n := tup.Fields[1].(IntField).Value; n != int64(len(name)) {
+			t.Errorf("expected length %d for %s, got %d", len(name), name, n)
+		}
+		if l := tup.Fields[2].(StringField).Value; l != name[:2] {
+			t.Errorf("expected %s, got %s", name[:2], l)
+		}
+		if p := tup.Fields[3].(StringField).Value; p != "0"+age {
+			t.Errorf("expected 0%s, got %s", age, p)
+		}
+	}
+
+	queries := []struct {
+		query    string
+		expected int
+	}{
+		{"select name from t where upper(name) = 'SAM'", 2},
+		{"select name from t where name || 'x' = 'box'", 1},
+		{"select name from t where right(name, 1) = 'a' and length(name) > 3", 2},
+		{"select name from t where split_part(replace(name, 'a', '-'), '-', 2) = 'thy'", 1},
+		{"select distinct concat(left(name, 1), rpad('', 2, '.')) from t", 8},
+		// quoted constants are strings, except when compared to ints
+		{"select name from t where lpad(name, 4, '0') = '0sam' and age = '25'", 1},
+	}
+	for _, q := range queries {
+		if tups := runQueryForTest(t, c, bp, q.query); len(tups) != q.expected {
+			t.Errorf("expected %d tuples for %s, got %d", q.expected, q.query, len(tups))
+		}
+	}
+
+	for _, q := range []string{
+		"select upper(age) from t",
+		"select name || age from t",
+		"select lpad(name) from t",
+	} {
+		if _, _, err := Parse(c, q); err == nil {
+			t.Errorf("expected error for %s", q)
+		}
+	}
+}
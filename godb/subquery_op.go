@@ -0,0 +1,159 @@
+package godb
+
+import "fmt"
+
+// Methods to evaluate scalar subqueries, e.g., the subquery in
+// SELECT name FROM t WHERE age > (SELECT avg(age) FROM t).
+//
+// An uncorrelated subquery produces the same value for every tuple, so it is
+// run once, by an InitPlanOp placed above the operators that use it, and its
+// value is cached in the expression. A correlated subquery (one that refers to
+// columns of the enclosing query through an OuterRefExpr) is instead re-run
+// each time it is evaluated, with its outer references bound to the tuple it
+// is evaluated on.
+
+// An outerTuple holds the tuple of the enclosing query that the outer
+// references of a correlated subquery currently refer to.
+type outerTuple struct {
+	desc *TupleDesc // descriptor of the tuples bound to t; set during planning
+	t    *Tuple
+}
+
+// An OuterRefExpr is a reference from a correlated subquery to a field of the
+// enclosing query.
+type OuterRefExpr struct {
+	selectField FieldType
+	outer       *outerTuple
+}
+
+func (o *OuterRefExpr) EvalExpr(_ *Tuple) (DBValue, error) {
+	if o.outer.t == nil {
+		return nil, GoDBError{IllegalOperationError, fmt.Sprintf("outer reference %s evaluated without an outer tuple", o.selectField.Fname)}
+	}
+	outTup, err := o.outer.t.project([]FieldType{o.selectField})
+	if err != nil {
+		return nil, err
+	}
+	return outTup.Fields[0], nil
+}
+
+func (o *OuterRefExpr) GetExprType() FieldType {
+	if o.outer.desc != nil {
+		if i, err := findFieldInTd(o.selectField, o.outer.desc); err == nil {
+			return o.outer.desc.Fields[i]
+		}
+	}
+	return o.selectField
+}
+
+type ScalarSubqueryExpr struct {
+	plan  Operator
+	outer *outerTuple // non-nil if the subquery is correlated
+
+	// set by InitPlanOp
+	tid       TransactionID
+	val       DBValue
+	evaluated bool
+}
+
+func NewScalarSubqueryExpr(plan Operator) (*ScalarSubqueryExpr, error) {
+	if len(plan.Descriptor().Fields) != 1 {
+		return nil, GoDBError{ParseError, "subquery used as an expression must return exactly one column"}
+	}
+	return &ScalarSubqueryExpr{plan: plan}, nil
+}
+
+func (s *ScalarSubqueryExpr) GetExprType() FieldType {
+	ft := s.plan.Descriptor().Fields[0]
+	return FieldType{ft.Fname, "", ft.Ftype}
+}
+
+func (s *ScalarSubqueryExpr) EvalExpr(t *Tuple) (DBValue, error) {
+	if !s.evaluated {
+		return nil, GoDBError{IllegalOperationError, "scalar subquery evaluated before its init plan was run"}
+	}
+	if s.outer != nil {
+		s.outer.t = t
+		return s.run(s.tid)
+	}
+	return s.val, nil
+}
+
+// Prepare the subquery for evaluation on behalf of tid. An uncorrelated
+// subquery is run and its value cached.
+func (s *ScalarSubqueryExpr) evaluate(tid TransactionID) error {
+	s.tid = tid
+	if s.outer == nil {
+		val, err := s.run(tid)
+		if err != nil {
+			return err
+		}
+		s.val = val
+	}
+	s.evaluated = true
+	return nil
+}
+
+// Run the subquery, returning its single result value.
+//
+// Returns an error if the subquery produces no rows or more than one row.
+func (s *ScalarSubqueryExpr) run(tid TransactionID) (DBValue, error) {
+	iter, err := s.plan.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	t, err := iter()
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, GoDBError{IllegalOperationError, "scalar subquery returned no rows"}
+	}
+	extra, err := iter()
+	if err != nil {
+		return nil, err
+	}
+	if extra != nil {
+		return nil, GoDBError{IllegalOperationError, "more than one row returned by a subquery used as an expression"}
+	}
+	return t.Fields[0], nil
+}
+
+// Return the scalar subqueries appearing anywhere in e.
+func findScalarSubqueries(e Expr) []*ScalarSubqueryExpr {
+	switch ex := e.(type) {
+	case *ScalarSubqueryExpr:
+		return []*ScalarSubqueryExpr{ex}
+	case *FuncExpr:
+		var subqueries []*ScalarSubqueryExpr
+		for _, arg := range ex.args {
+			subqueries = append(subqueries, findScalarSubqueries(*arg)...)
+		}
+		return subqueries
+	}
+	return nil
+}
+
+type InitPlanOp struct {
+	subqueries []*ScalarSubqueryExpr
+	child      Operator
+}
+
+// Construct an operator that prepares the supplied scalar subqueries for
+// evaluation before returning the tuples of child unchanged.
+func NewInitPlanOp(subqueries []*ScalarSubqueryExpr, child Operator) *InitPlanOp {
+	return &InitPlanOp{subqueries, child}
+}
+
+func (ip *InitPlanOp) Descriptor() *TupleDesc {
+	return ip.child.Descriptor()
+}
+
+func (ip *InitPlanOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	for _, s := range ip.subqueries {
+		if err := s.evaluate(tid); err != nil {
+			return nil, fmt.Errorf("error evaluating subquery: %w", err)
+		}
+	}
+	return ip.child.Iterator(tid)
+}
@@ -0,0 +1,172 @@
+package godb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Table statistics are saved, as JSON, in a stats file alongside the catalog
+// (e.g., catalog.stats for catalog.txt), so that they needn't be computed
+// again each time the catalog is loaded. Values in histograms are saved as
+// strings, so that large ints aren't rounded to floats.
+
+type savedTableStats struct {
+	Table    string
+	Pages    int
+	Tuples   int
+	Modified int
+	Analyzed time.Time
+	Columns  []savedColumnStats
+}
+
+type savedColumnStats struct {
+	Name         string
+	Type         string
+	Count        int
+	Distinct     int
+	NullFraction float64
+	Bins         []savedBin
+}
+
+type savedBin struct {
+	Lo, Hi          string
+	Count, Distinct int
+}
+
+// Return the name of the stats file of the catalog file catalogFile.
+func statsFileName(catalogFile string) string {
+	return strings.TrimSuffix(catalogFile, filepath.Ext(catalogFile)) + ".stats"
+}
+
+// Return the string a value of a histogram is saved as.
+func savedValue(v DBValue) string {
+	switch v := v.(type) {
+	case IntField:
+		return strconv.FormatInt(v.Value, 10)
+	case StringField:
+		return v.Value
+	}
+	return ""
+}
+
+// Return the value of type t saved as s.
+func loadValue(s string, t DBType) (DBValue, error) {
+	if t == IntType {
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, GoDBError{ParseError, fmt.Sprintf("invalid int %s in stats file", s)}
+		}
+		return IntField{i}, nil
+	}
+	return StringField{s}, nil
+}
+
+func (ts *TableStats) save(table string) savedTableStats {
+	saved := savedTableStats{table, ts.basePages, ts.baseTups, ts.modified, ts.analyzed, nil}
+	for _, f := range ts.tupleDesc.Fields {
+		cs := ts.histograms[f.Fname]
+		if cs == nil {
+			continue
+		}
+		col := savedColumnStats{f.Fname, cs.ftype.String(), cs.count, cs.distinct, cs.nullFrac, nil}
+		for _, b := range cs.bins {
+			col.Bins = append(col.Bins, savedBin{savedValue(b.lo), savedValue(b.hi), b.count, b.distinct})
+		}
+		saved.Columns = append(saved.Columns, col)
+	}
+	return saved
+}
+
+// Return the statistics saved as saved, of a table with descriptor desc.
+//
+// Returns an error if the statistics are of columns that aren't in desc, as
+// when the table was dropped and created again with other columns.
+func (saved *savedTableStats) load(desc *TupleDesc) (*TableStats, error) {
+	ts := &TableStats{saved.Pages, saved.Tuples, make(map[string]*ColumnStats), desc.copy(), saved.Analyzed, saved.Modified, saved.Modified}
+	for _, col := range saved.Columns {
+		i, err := findFieldInTd(FieldType{col.Name, "", UnknownType}, desc)
+		if err != nil || desc.Fields[i].Ftype.String() != col.Type {
+			return nil, GoDBError{ParseError, fmt.Sprintf("saved statistics of column %s don't match table %s", col.Name, saved.Table)}
+		}
+		ftype := desc.Fields[i].Ftype
+		cs := &ColumnStats{ftype: ftype, count: col.Count, distinct: col.Distinct, nullFrac: col.NullFraction}
+		for _, b := range col.Bins {
+			lo, err := loadValue(b.Lo, ftype)
+			if err != nil {
+				return nil, err
+			}
+			hi, err := loadValue(b.Hi, ftype)
+			if err != nil {
+				return nil, err
+			}
+			cs.bins = append(cs.bins, histBin{lo, hi, b.Count, b.Distinct})
+		}
+		if len(cs.bins) > 0 {
+			cs.min, cs.max = cs.bins[0].lo, cs.bins[len(cs.bins)-1].hi
+		}
+		ts.histograms[col.Name] = cs
+	}
+	return ts, nil
+}
+
+// Save the statistics of the tables that have them to the stats file of
+// catalogFile in rootPath.
+func (c *Catalog) saveStatsToFile(catalogFile string, rootPath string) error {
+	var saved []savedTableStats
+	for _, t := range c.tableMap {
+		if t.stats != nil {
+			saved = append(saved, t.stats.save(t.name))
+		}
+	}
+	sort.Slice(saved, func(i, j int) bool { return saved[i].Table < saved[j].Table })
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(rootPath+"/"+statsFileName(catalogFile), data, 0644); err != nil {
+		return err
+	}
+	for _, t := range c.tableMap {
+		if t.stats != nil {
+			t.stats.saved = t.stats.modified
+		}
+	}
+	return nil
+}
+
+// Load the statistics of the catalog's tables from its stats file, if there
+// is one. Statistics of tables that no longer exist, or that don't match
+// their table, are ignored.
+func (c *Catalog) loadStatsFile() error {
+	data, err := os.ReadFile(c.rootPath + "/" + statsFileName(c.filePath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved []savedTableStats
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return GoDBError{ParseError, fmt.Sprintf("invalid stats file %s: %s", statsFileName(c.filePath), err.Error())}
+	}
+	for _, s := range saved {
+		t, ok := c.tableMap[s.Table]
+		if !ok {
+			continue
+		}
+		stats, err := s.load(&t.desc)
+		if err != nil {
+			continue
+		}
+		t.stats = stats
+	}
+	return nil
+}
@@ -1,5 +1,11 @@
 package godb
 
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
 /*
  TableStats represents statistics (e.g., histograms) about base tables in a
  query.
@@ -10,13 +16,18 @@ type Stats interface {
 	EstimateScanCost() float64
 	EstimateCardinality(selectivity float64) int
 	EstimateSelectivity(field string, op BoolOp, value DBValue) (float64, error)
+	// Return the statistics of the values of field, or nil if there are none.
+	ColumnStats(field string) *ColumnStats
 }
 
 type TableStats struct {
 	basePages  int
 	baseTups   int
-	histograms map[string]any
+	histograms map[string]*ColumnStats
 	tupleDesc  *TupleDesc
+	analyzed   time.Time
+	modified   int // tuples inserted, deleted or updated since analyzed
+	saved      int // the value of modified when last saved or loaded
 }
 
 // The default cost to read a page from disk. This value can be adjusted to
@@ -27,13 +38,340 @@ const CostPerPage = 1000
 // though our tests assume that you have at least 100 bins in your histograms.
 const NumHistBins = 100
 
-// Dummy Implementations to implement the interface
-func (ts *TableStats) EstimateScanCost() float64 {
+// The fraction of a table's tuples that may be inserted, deleted or updated
+// after its statistics are computed before they are stale.
+var StaleStatsFraction = 0.2
+
+// The selectivities assumed for predicates on values without statistics,
+// e.g., the results of expressions, as in Selinger et al.
+const (
+	DefaultEqSelectivity      = 0.1
+	DefaultRangeSelectivity   = 1.0 / 3
+	DefaultPatternSelectivity = 0.1
+)
+
+// Statistics about the values of a column: an equi-depth histogram of them,
+// whose bins hold roughly the same number of values, along with their number
+// of distinct values, minimum and maximum.
+//
+// GoDB has no NULLs; as COALESCE and NULLIF do, the zero value of the
+// column's type (0 or the empty string) stands in for NULL, so the null
+// fraction is the fraction of values that are zero.
+type ColumnStats struct {
+	ftype    DBType
+	count    int
+	distinct int
+	min, max DBValue
+	nullFrac float64
+	bins     []histBin
+}
+
+// A bin of a histogram, holding the values from lo to hi. A value is always
+// in a single bin, so the bins of a histogram don't overlap.
+type histBin struct {
+	lo, hi   DBValue
+	count    int
+	distinct int
+}
+
+// Return the number of distinct values of the column.
+func (cs *ColumnStats) Distinct() int {
+	return cs.distinct
+}
+
+// Return the minimum value of the column, or nil if the table is empty.
+func (cs *ColumnStats) Min() DBValue {
+	return cs.min
+}
+
+// Return the maximum value of the column, or nil if the table is empty.
+func (cs *ColumnStats) Max() DBValue {
+	return cs.max
+}
+
+// Return the fraction of the column's values that are the zero value of its
+// type.
+func (cs *ColumnStats) NullFraction() float64 {
+	return cs.nullFrac
+}
+
+// Compute the statistics of the n values of a column of type ftype, the
+// single fields of the tuples that sorted returns in sorted order.
+func newColumnStats(n int, ftype DBType, sorted func() (*Tuple, error)) (*ColumnStats, error) {
+	cs := &ColumnStats{ftype: ftype, count: n}
+	zero := zeroValue(ftype)
+	nulls := 0
+	depth := (n + NumHistBins - 1) / NumHistBins
+	var bin *histBin
+	var prev DBValue
+	for {
+		t, err := sorted()
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			break
+		}
+		v := t.Fields[0]
+		//the rest of the values equal to the last value of a full bin belong
+		//in it too
+		if bin == nil || bin.count >= depth && v != prev {
+			cs.bins = append(cs.bins, histBin{lo: v})
+			bin = &cs.bins[len(cs.bins)-1]
+		}
+		if bin.count == 0 || v != prev {
+			bin.distinct++
+			cs.distinct++
+		}
+		bin.hi = v
+		bin.count++
+		if v == zero {
+			nulls++
+		}
+		prev = v
+	}
+	if len(cs.bins) > 0 {
+		cs.min, cs.max = cs.bins[0].lo, prev
+		cs.nullFrac = float64(nulls) / float64(n)
+	}
+	return cs, nil
+}
+
+// Return the position of v between lo and hi, from 0 to 1, assuming that
+// values are evenly distributed between them.
+func interpolate(lo, hi, v DBValue) float64 {
+	switch lo := lo.(type) {
+	case IntField:
+		l, h, x := float64(lo.Value), float64(hi.(IntField).Value), float64(v.(IntField).Value)
+		if h <= l {
+			return 0
+		}
+		return min(max((x-l)/(h-l), 0), 1)
+	case StringField:
+		//strings are positioned by the characters after their common prefix
+		l, h, x := lo.Value, hi.(StringField).Value, v.(StringField).Value
+		prefix := 0
+		for prefix < len(l) && prefix < len(h) && l[prefix] == h[prefix] {
+			prefix++
+		}
+		lp, hp, xp := stringPosition(l, prefix), stringPosition(h, prefix), stringPosition(x, prefix)
+		if hp <= lp {
+			return 0
+		}
+		return min(max((xp-lp)/(hp-lp), 0), 1)
+	}
 	return 0
 }
+
+// Return the number whose base 256 digits are the first few bytes of s after
+// the first skip, so that strings are ordered as their numbers are.
+func stringPosition(s string, skip int) float64 {
+	pos, scale := 0.0, 1.0
+	for i := skip; i < skip+6; i++ {
+		scale /= 256
+		if i < len(s) {
+			pos += float64(s[i]) * scale
+		}
+	}
+	return pos
+}
+
+// Return the index of the bin that holds v, and whether there is one; if
+// there isn't, the index is that of the first bin whose values are greater
+// than v.
+func (cs *ColumnStats) findBin(v DBValue) (int, bool) {
+	i := sort.Search(len(cs.bins), func(i int) bool {
+		return !cs.bins[i].hi.EvalPred(v, OpLt)
+	})
+	return i, i < len(cs.bins) && !cs.bins[i].lo.EvalPred(v, OpGt)
+}
+
+// Return the estimated number of values equal to v.
+func (cs *ColumnStats) countEq(v DBValue) float64 {
+	i, ok := cs.findBin(v)
+	if !ok {
+		return 0
+	}
+	return float64(cs.bins[i].count) / float64(cs.bins[i].distinct)
+}
+
+// Return the estimated number of values less than v.
+func (cs *ColumnStats) countLt(v DBValue) float64 {
+	i, ok := cs.findBin(v)
+	n := 0.0
+	for _, b := range cs.bins[:i] {
+		n += float64(b.count)
+	}
+	if ok {
+		b := cs.bins[i]
+		n += interpolate(b.lo, b.hi, v) * (float64(b.count) - float64(b.count)/float64(b.distinct))
+	}
+	return n
+}
+
+// Return the estimated fraction of values for which "value op v" holds.
+func (cs *ColumnStats) selectivity(op BoolOp, v DBValue) float64 {
+	if cs.count == 0 {
+		return 0
+	}
+	n := float64(cs.count)
+	switch op {
+	case OpEq:
+		return cs.countEq(v) / n
+	case OpNeq:
+		return 1 - cs.countEq(v)/n
+	case OpLt:
+		return cs.countLt(v) / n
+	case OpLe:
+		return (cs.countLt(v) + cs.countEq(v)) / n
+	case OpGt:
+		return 1 - (cs.countLt(v)+cs.countEq(v))/n
+	case OpGe:
+		return 1 - cs.countLt(v)/n
+	case OpLike, OpNotLike:
+		sel := cs.likeSelectivity(v.(StringField).Value)
+		if op == OpNotLike {
+			return 1 - sel
+		}
+		return sel
+	}
+	return defaultSelectivity(op)
+}
+
+// Return the estimated fraction of the values of the column between the
+// minimum and maximum of the column of the same type with statistics other.
+func (cs *ColumnStats) overlap(other *ColumnStats) float64 {
+	if cs.count == 0 || other.count == 0 {
+		return 0
+	}
+	return max(cs.selectivity(OpGe, other.min)-cs.selectivity(OpGt, other.max), 0)
+}
+
+// Return the estimated fraction of values that match the LIKE pattern. A
+// pattern without wildcards matches as equality does, and one that starts
+// with characters other than wildcards matches the range of strings with
+// those characters as their prefix.
+func (cs *ColumnStats) likeSelectivity(pattern string) float64 {
+	prefix := pattern
+	if i := strings.IndexAny(pattern, `%_\`); i >= 0 {
+		prefix = pattern[:i]
+	} else {
+		return cs.selectivity(OpEq, StringField{pattern})
+	}
+	if prefix == "" {
+		return DefaultPatternSelectivity
+	}
+	//every string with the prefix is less than the prefix followed by the
+	//greatest byte
+	return (cs.countLt(StringField{prefix + "\xff"}) - cs.countLt(StringField{prefix})) / float64(cs.count)
+}
+
+// Compute the statistics of dbFile by scanning it as part of tid.
+//
+// The histogram of each column is built from its values in sorted order, read
+// by a scan of its own and sorted with [externalSort], so that at most
+// [SortBufferSize] bytes of values are held in memory at once.
+func ComputeTableStats(bp *BufferPool, dbFile DBFile, tid TransactionID) (*TableStats, error) {
+	desc := dbFile.Descriptor()
+	stats := &TableStats{dbFile.NumPages(), 0, make(map[string]*ColumnStats), desc.copy(), time.Now(), 0, 0}
+	for i, f := range desc.Fields {
+		iter, err := dbFile.Iterator(tid)
+		if err != nil {
+			return nil, err
+		}
+		valueDesc := TupleDesc{Fields: []FieldType{f}}
+		tups := 0
+		values := func() (*Tuple, error) {
+			t, err := iter()
+			if t == nil || err != nil {
+				return nil, err
+			}
+			tups++
+			return &Tuple{Desc: valueDesc, Fields: []DBValue{t.Fields[i]}}, nil
+		}
+		//the values are all read before the sort returns
+		sorted, err := externalSort(&valueDesc, values, fieldsLess, SortBufferSize)
+		if err != nil {
+			return nil, err
+		}
+		if stats.histograms[f.Fname], err = newColumnStats(tups, f.Ftype, sorted); err != nil {
+			return nil, err
+		}
+		stats.baseTups = tups
+	}
+	return stats, nil
+}
+
+// Return the number of tuples in the table when its statistics were
+// computed.
+func (ts *TableStats) NumTuples() int {
+	return ts.baseTups
+}
+
+// Return the number of pages of the table when its statistics were computed.
+func (ts *TableStats) NumPages() int {
+	return ts.basePages
+}
+
+// Return the time the statistics were computed.
+func (ts *TableStats) LastAnalyzed() time.Time {
+	return ts.analyzed
+}
+
+// Record that n of the table's tuples were inserted, deleted or updated.
+func (ts *TableStats) recordModifications(n int) {
+	ts.modified += n
+}
+
+// Return true if more than StaleStatsFraction of the table's tuples were
+// inserted, deleted or updated since the statistics were computed, so that
+// they should be computed again.
+func (ts *TableStats) Stale() bool {
+	return float64(ts.modified) > StaleStatsFraction*float64(ts.baseTups)
+}
+
+// Return the cost of scanning the table: the cost of reading each of its
+// pages.
+func (ts *TableStats) EstimateScanCost() float64 {
+	return float64(ts.basePages) * CostPerPage
+}
+
+// Return the number of tuples of the table that satisfy predicates with the
+// given selectivity.
 func (ts *TableStats) EstimateCardinality(selectivity float64) int {
-	return 0
+	return int(float64(ts.baseTups)*selectivity + 0.5)
 }
+
+// Return the estimated fraction of the table's tuples for which "field op
+// value" holds. Predicates on fields without statistics, or comparing them to
+// values of another type, have default selectivities.
 func (ts *TableStats) EstimateSelectivity(field string, op BoolOp, value DBValue) (float64, error) {
-	return 0.5, nil
-}
\ No newline at end of file
+	cs := ts.ColumnStats(field)
+	_, isInt := value.(IntField)
+	if cs == nil || value == nil || isInt != (cs.ftype == IntType) {
+		return defaultSelectivity(op), nil
+	}
+	return min(max(cs.selectivity(op, value), 0), 1), nil
+}
+
+// Return the statistics of the values of field, or nil if it isn't a field
+// of the table.
+func (ts *TableStats) ColumnStats(field string) *ColumnStats {
+	return ts.histograms[field]
+}
+
+// Return the selectivity assumed for predicates with the operator op on
+// values without statistics.
+func defaultSelectivity(op BoolOp) float64 {
+	switch op {
+	case OpEq:
+		return DefaultEqSelectivity
+	case OpNeq:
+		return 1 - DefaultEqSelectivity
+	case OpLt, OpLe, OpGt, OpGe:
+		return DefaultRangeSelectivity
+	case OpNotLike, OpNotILike, OpNotRegexp, OpNotIRegexp:
+		return 1 - DefaultPatternSelectivity
+	}
+	return DefaultPatternSelectivity
+}
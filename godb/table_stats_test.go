@@ -0,0 +1,304 @@
+package godb
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTableStatsSelectivity(t *testing.T) {
+	bp, hf := makeTestFile(t, 100)
+	tid := NewTID()
+	bp.BeginTransaction(tid)
+	td := hf.Descriptor()
+	for i := 0; i < 3000; i++ {
+		name := fmt.Sprintf("n%03d", i%100)
+		if i%3 == 0 {
+			name = "sam"
+		}
+		tup := Tuple{*td, []DBValue{StringField{name}, IntField{int64(i * 7 % 1000)}}, nil}
+		if err := hf.insertTuple(&tup, tid); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	stats, err := ComputeTableStats(bp, hf, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if stats.EstimateCardinality(1.0) != 3000 || stats.EstimateScanCost() != float64(hf.NumPages())*CostPerPage {
+		t.Errorf("expected 3000 tuples on %d pages, got %d costing %f", hf.NumPages(), stats.EstimateCardinality(1.0), stats.EstimateScanCost())
+	}
+
+	age := stats.ColumnStats("age")
+	if age.Distinct() != 1000 || age.Min() != (IntField{0}) || age.Max() != (IntField{999}) || math.Abs(age.NullFraction()-0.001) > 1e-9 {
+		t.Errorf("unexpected statistics of age: %d distinct from %v to %v, %f zero", age.Distinct(), age.Min(), age.Max(), age.NullFraction())
+	}
+	if name := stats.ColumnStats("name"); name.Distinct() != 101 {
+		t.Errorf("expected 101 distinct names, got %d", name.Distinct())
+	}
+	if stats.ColumnStats("nosuchfield") != nil {
+		t.Errorf("expected no statistics of a field that doesn't exist")
+	}
+
+	// sorting the values externally gives the same statistics
+	useTempDirForTest(t)
+	oldSize := SortBufferSize
+	defer func() { SortBufferSize = oldSize }()
+	SortBufferSize = 50 * tupleMemSize(&Tuple{Fields: []DBValue{IntField{0}}})
+	spilled, err := ComputeTableStats(bp, hf, tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	SortBufferSize = oldSize
+	for _, f := range []string{"name", "age"} {
+		if !reflect.DeepEqual(spilled.ColumnStats(f), stats.ColumnStats(f)) {
+			t.Errorf("expected the same statistics of %s when sorting externally", f)
+		}
+	}
+
+	preds := []struct {
+		field string
+		op    BoolOp
+		value DBValue
+	}{
+		{"age", OpEq, IntField{500}},
+		{"age", OpEq, IntField{5000}},
+		{"age", OpNeq, IntField{500}},
+		{"age", OpLt, IntField{250}},
+		{"age", OpLe, IntField{0}},
+		{"age", OpGt, IntField{901}},
+		{"age", OpGe, IntField{-10}},
+		{"age", OpLt, IntField{2000}},
+		{"name", OpEq, StringField{"sam"}},
+		{"name", OpEq, StringField{"n001"}},
+		{"name", OpEq, StringField{"bob"}},
+		{"name", OpLt, StringField{"n050"}},
+		{"name", OpGe, StringField{"n5"}},
+		{"name", OpGt, StringField{"sam"}},
+		{"name", OpLike, StringField{"n0%"}},
+		{"name", OpLike, StringField{"sam"}},
+		{"name", OpNotLike, StringField{"s%"}},
+	}
+	for _, p := range preds {
+		i, _ := findFieldInTd(FieldType{p.field, "", UnknownType}, td)
+		actual := 0
+		iter, _ := hf.Iterator(tid)
+		for tup, err := iter(); tup != nil || err != nil; tup, err = iter() {
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if tup.Fields[i].EvalPred(p.value, p.op) {
+				actual++
+			}
+		}
+		est, err := stats.EstimateSelectivity(p.field, p.op, p.value)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if math.Abs(est-float64(actual)/3000) > 0.02 {
+			t.Errorf("%s %s %v: expected selectivity %f, estimated %f", p.field, p.op, p.value, float64(actual)/3000, est)
+		}
+	}
+
+	for _, p := range []struct {
+		field    string
+		op       BoolOp
+		value    DBValue
+		expected float64
+	}{
+		{"nosuchfield", OpEq, IntField{1}, DefaultEqSelectivity},
+		{"age", OpGt, StringField{"a"}, DefaultRangeSelectivity},
+		{"name", OpRegexp, StringField{"^s"}, DefaultPatternSelectivity},
+		{"name", OpNotLike, StringField{"%a"}, 1 - DefaultPatternSelectivity},
+	} {
+		if est, _ := stats.EstimateSelectivity(p.field, p.op, p.value); est != p.expected {
+			t.Errorf("%s %s %v: expected default selectivity %f, got %f", p.field, p.op, p.value, p.expected, est)
+		}
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	if n := c.GetTableStats("t").NumTuples(); n != 12 {
+		t.Fatalf("expected statistics of 12 tuples, got %d", n)
+	}
+	runQueryForTest(t, c, bp, "insert into t (name, age) values ('ann', 70), ('ben', 80)")
+	if n := c.GetTableStats("t").NumTuples(); n != 12 {
+		t.Errorf("expected statistics to be unchanged until analyzed, got %d tuples", n)
+	}
+	qType, _, err := Parse(c, "ANALYZE t;")
+	if err != nil || qType != AnalyzeQueryType {
+		t.Fatalf("failed to analyze t: %v", err)
+	}
+	if n := c.GetTableStats("t").NumTuples(); n != 14 {
+		t.Errorf("expected statistics of 14 tuples, got %d", n)
+	}
+
+	//cardinalities are estimated with the statistics: 4 of the tuples are
+	//at least 70
+	_, plan, err := Parse(c, "select name from t where age >= 70")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var sb strings.Builder
+	OutputPhysicalPlan(func(format string, a ...any) {
+		sb.WriteString(fmt.Sprintf(format, a...))
+	}, plan, "")
+	for _, s := range []string{"card:14", "card:4"} {
+		if !strings.Contains(sb.String(), s) {
+			t.Errorf("expected %s in the plan, got\n%s", s, sb.String())
+		}
+	}
+
+	for _, q := range []string{"analyze", "analyze t, t2"} {
+		if qType, _, err := Parse(c, q); err != nil || qType != AnalyzeQueryType {
+			t.Errorf("failed to %s: %v", q, err)
+		}
+	}
+	for _, q := range []string{"analyze nosuchtable", "analyze t t2", "analyze t,"} {
+		if _, _, err := Parse(c, q); err == nil {
+			t.Errorf("expected error for %s", q)
+		}
+	}
+}
+
+func TestTableStatsPersistence(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	runQueryForTest(t, c, bp, "insert into t (name, age) values ('ann', 70)")
+	dir := t.TempDir()
+	if err := c.SaveToFile("catalog.txt", dir); err != nil {
+		t.Fatalf(err.Error())
+	}
+	c2, err := NewCatalogFromFile("catalog.txt", bp, dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, table := range []string{"t", "t2"} {
+		saved, loaded := c.GetTableStats(table), c2.GetTableStats(table)
+		if loaded == nil {
+			t.Fatalf("expected statistics of %s to be loaded", table)
+		}
+		if loaded.NumTuples() != saved.NumTuples() || loaded.NumPages() != saved.NumPages() || loaded.modified != saved.modified || !loaded.LastAnalyzed().Equal(saved.LastAnalyzed()) {
+			t.Errorf("statistics of %s changed after saving and loading", table)
+		}
+		for _, f := range saved.tupleDesc.Fields {
+			s, l := saved.ColumnStats(f.Fname), loaded.ColumnStats(f.Fname)
+			if l.Distinct() != s.Distinct() || l.Min() != s.Min() || l.Max() != s.Max() || l.NullFraction() != s.NullFraction() {
+				t.Errorf("statistics of %s.%s changed after saving and loading", table, f.Fname)
+			}
+		}
+	}
+	for _, p := range []struct {
+		field string
+		value DBValue
+	}{{"name", StringField{"sam"}}, {"age", IntField{40}}} {
+		s, _ := c.GetTableStats("t").EstimateSelectivity(p.field, OpLe, p.value)
+		l, _ := c2.GetTableStats("t").EstimateSelectivity(p.field, OpLe, p.value)
+		if s != l {
+			t.Errorf("expected selectivity %f of %s <= %v after loading, got %f", s, p.field, p.value, l)
+		}
+	}
+
+	//only changes to the schema or statistics need saving again
+	if c.Unsaved() || c2.Unsaved() {
+		t.Errorf("expected catalogs not to need saving after saving and loading")
+	}
+	runQueryForTest(t, c2, bp, "select name from t")
+	if c2.Unsaved() {
+		t.Errorf("expected a query not to change the catalog")
+	}
+	runQueryForTest(t, c2, bp, "insert into t (name, age) values ('bea', 71)")
+	if !c2.Unsaved() {
+		t.Errorf("expected modifying t to change its statistics")
+	}
+	if err := c2.SaveToFile("catalog.txt", dir); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, _, err := Parse(c2, "create table u (a int)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !c2.Unsaved() {
+		t.Errorf("expected creating a table to change the catalog")
+	}
+
+	//statistics that don't match their table are ignored
+	os.WriteFile(dir+"/catalog.txt", []byte("t (name string, height int)\n"), 0644)
+	c3, err := NewCatalogFromFile("catalog.txt", bp, dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if c3.GetTableStats("t") != nil {
+		t.Errorf("expected statistics of the old t to be ignored")
+	}
+}
+
+func TestStaleTableStats(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	//more than a fifth of t's 12 tuples must be modified
+	queries := []struct {
+		query string
+		stale bool
+	}{
+		{"insert into t (name, age) values ('ann', 70)", false},
+		{"update t set age = age + 1 where name = 'ann'", false},
+		{"delete from t where name = 'ann'", true},
+	}
+	for _, q := range queries {
+		runQueryForTest(t, c, bp, q.query)
+		if stale := c.GetTableStats("t").Stale(); stale != q.stale {
+			t.Errorf("after %s, expected statistics to be stale: %v, got %v", q.query, q.stale, stale)
+		}
+	}
+	if tables := c.StaleTables(); len(tables) != 1 || tables[0] != "t" {
+		t.Errorf("expected t to be the only stale table, got %v", tables)
+	}
+	if _, _, err := Parse(c, "analyze t"); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	//the modifications of a transaction only count once it commits
+	_, plan, err := Parse(c, "insert into t (name, age) values ('ann', 1), ('bea', 2), ('cy', 3)")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid := BeginTransactionForTest(t, bp)
+	iter, err := plan.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if _, err := iter(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if c.GetTableStats("t").Stale() {
+		t.Errorf("expected statistics not to be stale before the transaction commits")
+	}
+	bp.AbortTransaction(tid)
+	if c.GetTableStats("t").Stale() {
+		t.Errorf("expected the modifications of an aborted transaction not to count")
+	}
+	runQueryForTest(t, c, bp, "delete from t where age < 4")
+	if !c.GetTableStats("t").Stale() {
+		t.Errorf("expected statistics to be stale once the transaction commits")
+	}
+	if len(bp.modifications) != 0 {
+		t.Errorf("expected the buffer pool to keep no modifications of ended transactions, got %v", bp.modifications)
+	}
+	if _, _, err := Parse(c, "analyze t"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if c.GetTableStats("t").Stale() {
+		t.Errorf("expected statistics to be current after analyzing")
+	}
+}
@@ -0,0 +1,140 @@
+package godb
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+)
+
+// A TopN operator returns the tuples of an ORDER BY ... LIMIT [OFFSET] query
+// without sorting all of its child's tuples: it keeps only the best offset+lim
+// tuples seen so far in a bounded heap, so it uses O(offset+lim) memory and
+// O(n log(offset+lim)) time for n child tuples.
+type TopN struct {
+	orderBy    []Expr
+	ascending  []bool
+	limitTups  Expr
+	offsetTups Expr // may be nil, for no offset
+	child      Operator
+}
+
+// Construct a top-N operator that returns the tuples of child that come in
+// positions [offset, offset+lim) when they are sorted as specified by
+// orderByFields and ascending, as for [NewOrderBy]. offset may be nil, for no
+// offset. Ties are broken by the order of the child's tuples, as in OrderBy.
+func NewTopN(orderByFields []Expr, ascending []bool, lim Expr, offset Expr, child Operator) (*TopN, error) {
+	if len(orderByFields) != len(ascending) {
+		return nil, fmt.Errorf("length of orderByFields and ascending must match")
+	}
+	return &TopN{
+		orderBy:    orderByFields,
+		ascending:  ascending,
+		limitTups:  lim,
+		offsetTups: offset,
+		child:      child,
+	}, nil
+}
+
+// The top-N returns a subset of the child tuples, so has the same descriptor.
+func (o *TopN) Descriptor() *TupleDesc {
+	return o.child.Descriptor()
+}
+
+// An entry of the heap of a TopN iterator; seq is the position of the tuple in
+// the child's output, which breaks ties.
+type topNEntry struct {
+	t   *Tuple
+	seq int
+}
+
+// A max-heap of topNEntry, i.e., the root is the entry that sorts last, which
+// is the one to discard when a better tuple arrives. Errors evaluating the sort
+// expressions are recorded in err.
+type topNHeap struct {
+	entries []topNEntry
+	o       *TopN
+	err     error
+}
+
+// Return true if entry a sorts before entry b.
+func (h *topNHeap) before(a, b topNEntry) bool {
+	less, err := orderByLess(h.o.orderBy, h.o.ascending, a.t, b.t)
+	if err != nil {
+		h.err = err
+		return false
+	}
+	if less {
+		return true
+	}
+	greater, err := orderByLess(h.o.orderBy, h.o.ascending, b.t, a.t)
+	if err != nil {
+		h.err = err
+		return false
+	}
+	return !greater && a.seq < b.seq
+}
+
+func (h *topNHeap) Len() int           { return len(h.entries) }
+func (h *topNHeap) Less(i, j int) bool { return h.before(h.entries[j], h.entries[i]) }
+func (h *topNHeap) Swap(i, j int)      { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
+func (h *topNHeap) Push(x any)         { h.entries = append(h.entries, x.(topNEntry)) }
+func (h *topNHeap) Pop() any {
+	last := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return last
+}
+
+// Return a function that iterates through the top tuples of the child. Like
+// OrderBy, this is blocking: the whole child is consumed when the iterator is
+// created, but only the tuples that may be returned are retained.
+func (o *TopN) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	limit, err := evalLimitExpr(o.limitTups, "limit", 0)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := evalLimitExpr(o.offsetTups, "offset", 0)
+	if err != nil {
+		return nil, err
+	}
+	n := int(limit + offset)
+
+	childIter, err := o.child.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	h := &topNHeap{o: o}
+	for seq := 0; n > 0; seq++ {
+		t, err := childIter()
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			break
+		}
+		e := topNEntry{t, seq}
+		if h.Len() < n {
+			heap.Push(h, e)
+		} else if h.before(e, h.entries[0]) {
+			h.entries[0] = e
+			heap.Fix(h, 0)
+		}
+		if h.err != nil {
+			return nil, h.err
+		}
+	}
+
+	entries := h.entries
+	sort.Slice(entries, func(i, j int) bool { return h.before(entries[i], entries[j]) })
+	if h.err != nil {
+		return nil, h.err
+	}
+
+	index := int(offset)
+	return func() (*Tuple, error) {
+		if index >= len(entries) {
+			return nil, nil
+		}
+		index++
+		return entries[index-1].t, nil
+	}, nil
+}
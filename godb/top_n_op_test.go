@@ -0,0 +1,140 @@
+package godb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// check that TopN returns the same tuples, in the same order, as sorting all
+// of the tuples and then applying the limit and offset, including for ties
+func TestTopN(t *testing.T) {
+	td, _, _, _, _, tid := makeTestVars(t)
+	var tuples []Tuple
+	for i := 0; i < 200; i++ {
+		tuples = append(tuples, Tuple{Desc: td, Fields: []DBValue{
+			StringField{fmt.Sprintf("n%d", i%7)},
+			IntField{int64((i * 37) % 50)},
+		}})
+	}
+	child := CreateMemFileFromTuples(tuples)
+	name, age := &FieldExpr{td.Fields[0]}, &FieldExpr{td.Fields[1]}
+
+	orders := []struct {
+		exprs []Expr
+		ascs  []bool
+	}{
+		{[]Expr{age}, []bool{true}},
+		{[]Expr{age}, []bool{false}},
+		{[]Expr{name, age}, []bool{true, false}},
+	}
+	limits := []struct{ lim, offset int64 }{{0, 0}, {1, 0}, {10, 0}, {10, 5}, {50, 190}, {300, 0}, {5, 300}}
+	for _, o := range orders {
+		for _, l := range limits {
+			lim, offset := &ConstExpr{IntField{l.lim}, IntType}, &ConstExpr{IntField{l.offset}, IntType}
+			topN, err := NewTopN(o.exprs, o.ascs, lim, offset, child)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			oby, err := NewOrderBy(o.exprs, child, o.ascs)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			expected := NewLimitOffsetOp(lim, offset, oby)
+
+			topNIter, err := topN.Iterator(tid)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			expectedIter, err := expected.Iterator(tid)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			for i := 0; ; i++ {
+				got, err := topNIter()
+				if err != nil {
+					t.Fatalf(err.Error())
+				}
+				want, err := expectedIter()
+				if err != nil {
+					t.Fatalf(err.Error())
+				}
+				if got == nil || want == nil {
+					if got != want {
+						t.Errorf("limit %d offset %d: expected %v at position %d, got %v", l.lim, l.offset, want, i, got)
+					}
+					break
+				}
+				if !got.equals(want) {
+					t.Errorf("limit %d offset %d: expected %v at position %d, got %v", l.lim, l.offset, want, i, got)
+				}
+			}
+		}
+	}
+
+	if _, err := NewTopN([]Expr{age}, []bool{true, false}, &ConstExpr{IntField{1}, IntType}, nil, child); err == nil {
+		t.Errorf("expected error for mismatched order by fields and ascending")
+	}
+	topN, _ := NewTopN([]Expr{age}, []bool{true}, &ConstExpr{IntField{-1}, IntType}, nil, child)
+	if _, err := topN.Iterator(tid); err == nil {
+		t.Errorf("expected error for negative limit")
+	}
+}
+
+func TestLimitOffsetQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	queries := []struct {
+		sql      string
+		expected []string
+	}{
+		{"select name, age from t order by age desc, name limit 3 offset 2", []string{"sarah", "mark", "kathy"}},
+		{"select name from t order by name limit 1, 2", []string{"bill", "bo"}},
+		{"select name from t order by name limit 2 offset 20", nil},
+		{"select name from t where age > 45 order by name desc limit 2", []string{"sarah", "sam"}},
+		{"select name from t union select name from t2 order by name limit 2 offset 1", []string{"bill", "bo"}},
+	}
+	for _, q := range queries {
+		tups := runQueryForTest(t, c, bp, q.sql)
+		if len(tups) != len(q.expected) {
+			t.Errorf("q=%s: expected %d results, got %d", q.sql, len(q.expected), len(tups))
+			continue
+		}
+		for i, tup := range tups {
+			if name := tup.Fields[0].(StringField).Value; name != q.expected[i] {
+				t.Errorf("q=%s: expected %s at position %d, got %s", q.sql, q.expected[i], i, name)
+			}
+		}
+	}
+
+	if tups := runQueryForTest(t, c, bp, "select name from t limit 5 offset 10"); len(tups) != 2 {
+		t.Errorf("expected 2 results after offset, got %d", len(tups))
+	}
+
+	_, plan, err := Parse(c, "select name, age from t order by age limit 3 offset 1")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var explain strings.Builder
+	OutputPhysicalPlan(func(format string, args ...any) { fmt.Fprintf(&explain, format, args...) }, plan, "")
+	if !strings.Contains(explain.String(), "Top N") || strings.Contains(explain.String(), "Order By") {
+		t.Errorf("expected a top-N plan for order by with limit, got\n%s", explain.String())
+	}
+
+	//limits whose tuples don't fit in the sort buffer are sorted externally
+	sql := "select name, age from t order by age limit 10000000 offset 1"
+	_, plan, err = Parse(c, sql)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	explain.Reset()
+	OutputPhysicalPlan(func(format string, args ...any) { fmt.Fprintf(&explain, format, args...) }, plan, "")
+	if strings.Contains(explain.String(), "Top N") || !strings.Contains(explain.String(), "Order By") {
+		t.Errorf("expected an order by plan for a limit larger than the sort buffer, got\n%s", explain.String())
+	}
+	if tups := runQueryForTest(t, c, bp, sql); len(tups) != 11 {
+		t.Errorf("q=%s: expected 11 results, got %d", sql, len(tups))
+	}
+}
@@ -2,8 +2,6 @@ package godb
 
 import (
 	"fmt"
-	"regexp"
-	"strings"
 )
 
 type GoDBErrorCode int
@@ -22,6 +20,7 @@ const (
 	IllegalOperationError   GoDBErrorCode = iota
 	DeadlockError           GoDBErrorCode = iota
 	IllegalTransactionError GoDBErrorCode = iota
+	DuplicateKeyError       GoDBErrorCode = iota
 )
 
 //go:generate stringer -type=GoDBErrorCode
@@ -76,17 +75,50 @@ const (
 	OpEq   BoolOp = iota
 	OpNeq  BoolOp = iota
 	OpLike BoolOp = iota
+	// the other pattern matching operators (see like.go)
+	OpNotLike    BoolOp = iota
+	OpILike      BoolOp = iota
+	OpNotILike   BoolOp = iota
+	OpRegexp     BoolOp = iota
+	OpNotRegexp  BoolOp = iota
+	OpIRegexp    BoolOp = iota
+	OpNotIRegexp BoolOp = iota
 )
 
 var BoolOpMap = map[string]BoolOp{
-	">":    OpGt,
-	"<":    OpLt,
-	"<=":   OpLe,
-	">=":   OpGe,
-	"=":    OpEq,
-	"<>":   OpNeq,
-	"!=":   OpNeq,
-	"like": OpLike,
+	">":          OpGt,
+	"<":          OpLt,
+	"<=":         OpLe,
+	">=":         OpGe,
+	"=":          OpEq,
+	"<>":         OpNeq,
+	"!=":         OpNeq,
+	"like":       OpLike,
+	"not like":   OpNotLike,
+	"regexp":     OpRegexp,
+	"not regexp": OpNotRegexp,
+	//sqlparser can't parse these, so they're rewritten into the above with a
+	//marker on the pattern (see rewritePatternOps)
+	"ilike":     OpILike,
+	"not ilike": OpNotILike,
+	"~*":        OpIRegexp,
+	"!~*":       OpNotIRegexp,
+}
+
+// Return the operator that gives the same result when its operands are
+// swapped, e.g., a < b is equivalent to b > a.
+func (op BoolOp) flip() BoolOp {
+	switch op {
+	case OpGt:
+		return OpLt
+	case OpLt:
+		return OpGt
+	case OpGe:
+		return OpLe
+	case OpLe:
+		return OpGe
+	}
+	return op
 }
 
 func (i1 IntField) EvalPred(v2 DBValue, op BoolOp) bool {
@@ -134,20 +166,13 @@ func (i1 StringField) EvalPred(v2 DBValue, op BoolOp) bool {
 		return x1 < x2
 	case OpLe:
 		return x1 <= x2
-	case OpLike:
-		s1, ok := any(i1).(string)
-		if !ok {
-			return false
-		}
-		regex, ok := any(i2).(string)
-		if !ok {
-			return false
-		}
-		regex = "^" + regex + "$"
-		regex = strings.Replace(regex, "%", ".*?", -1)
-		match, _ := regexp.MatchString(regex, s1)
-		return match
 	default:
+		if op.isPattern() {
+			//filters compile constant patterns once, rather than each time
+			//(see patternMatcher)
+			re, err := compilePattern(op, x2)
+			return err == nil && matchPattern(op, re, x1)
+		}
 		return false
 	}
 }
@@ -0,0 +1,161 @@
+package godb
+
+import (
+	"fmt"
+	"slices"
+)
+
+// A uniqueIndex is an in-memory hash index over the tuples of a HeapFile,
+// mapping the values of the key fields of each tuple to its record ID. No two
+// tuples may have the same key.
+//
+// The index of a file's unique key (see [HeapFile.setUniqueKey]) is built the
+// first time it is needed, by scanning the file, and is then kept up to date
+// by [HeapFile.insertTuple] and [HeapFile.deleteTuple], which enforce the key.
+type uniqueIndex struct {
+	keyFields []int
+	rids      map[any]HeapRecordID
+}
+
+// Build a unique index on the fields keyFields (indexes into the file's
+// descriptor) of the tuples of file, by scanning it.
+//
+// Returns an error if two tuples of file have the same key.
+func buildUniqueIndex(file *HeapFile, keyFields []int, tid TransactionID) (*uniqueIndex, error) {
+	idx := &uniqueIndex{keyFields, make(map[any]HeapRecordID)}
+	iter, err := file.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, err := iter()
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			return idx, nil
+		}
+		if err := idx.add(t); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (idx *uniqueIndex) key(t *Tuple) any {
+	fields := make([]DBValue, len(idx.keyFields))
+	for i, f := range idx.keyFields {
+		fields[i] = t.Fields[f]
+	}
+	return (&Tuple{Fields: fields}).tupleKey()
+}
+
+func (idx *uniqueIndex) duplicateKeyError(t *Tuple) error {
+	fields := make([]DBValue, len(idx.keyFields))
+	for i, f := range idx.keyFields {
+		fields[i] = t.Fields[f]
+	}
+	return GoDBError{DuplicateKeyError, fmt.Sprintf("duplicate key value %v", fields)}
+}
+
+// Return the record ID of the tuple with the same key as t, and whether there
+// is one.
+func (idx *uniqueIndex) lookup(t *Tuple) (HeapRecordID, bool) {
+	rid, ok := idx.rids[idx.key(t)]
+	return rid, ok
+}
+
+// Add t, which must have been read from or inserted into the file, to the
+// index. Returns an error if a tuple with the same key exists.
+func (idx *uniqueIndex) add(t *Tuple) error {
+	k := idx.key(t)
+	if _, ok := idx.rids[k]; ok {
+		return idx.duplicateKeyError(t)
+	}
+	idx.rids[k] = *t.Rid.(*HeapRecordID)
+	return nil
+}
+
+// Remove t from the index, if it is the tuple indexed under its key.
+func (idx *uniqueIndex) remove(t *Tuple) {
+	k := idx.key(t)
+	if rid, ok := t.Rid.(*HeapRecordID); ok && idx.rids[k] == *rid {
+		delete(idx.rids, k)
+	}
+}
+
+// Return an error if replacing the tuples olds of the file with the tuples
+// news would leave two tuples with the same key, so that a statement can be
+// checked before it modifies the file.
+func (idx *uniqueIndex) checkReplace(olds []*Tuple, news []*Tuple) error {
+	removed := make(map[HeapRecordID]bool)
+	for _, t := range olds {
+		if rid, ok := t.Rid.(*HeapRecordID); ok {
+			removed[*rid] = true
+		}
+	}
+	added := make(map[any]bool)
+	for _, t := range news {
+		k := idx.key(t)
+		if rid, ok := idx.rids[k]; added[k] || ok && !removed[rid] {
+			return idx.duplicateKeyError(t)
+		}
+		added[k] = true
+	}
+	return nil
+}
+
+// Require the values of the fields keyFields (indexes into the file's
+// descriptor) of the file's tuples to be unique, as for a primary key.
+func (f *HeapFile) setUniqueKey(keyFields []int) {
+	f.keyFields = keyFields
+	f.keyIdx = nil
+}
+
+// Return true if the file's unique key is the fields keyFields, in any order.
+func (f *HeapFile) hasUniqueKey(keyFields []int) bool {
+	if len(f.keyFields) == 0 || len(keyFields) != len(f.keyFields) {
+		return false
+	}
+	for _, i := range keyFields {
+		if !slices.Contains(f.keyFields, i) {
+			return false
+		}
+	}
+	return true
+}
+
+// Return the index of the file's unique key, building it as part of tid if it
+// hasn't been, or nil if the file has no unique key.
+func (f *HeapFile) keyIndex(tid TransactionID) (*uniqueIndex, error) {
+	if f.keyFields == nil || f.keyIdx != nil {
+		return f.keyIdx, nil
+	}
+	idx, err := buildUniqueIndex(f, f.keyFields, tid)
+	if err != nil {
+		return nil, err
+	}
+	f.keyIdx = idx
+	return idx, nil
+}
+
+// Return the index of the unique key of file, or nil if it has none.
+func fileKeyIndex(file DBFile, tid TransactionID) (*uniqueIndex, error) {
+	if hf, ok := file.(*HeapFile); ok {
+		return hf.keyIndex(tid)
+	}
+	return nil, nil
+}
+
+// Return the tuple of the file with record ID rid.
+func (f *HeapFile) readTuple(rid HeapRecordID, tid TransactionID) (*Tuple, error) {
+	page, err := f.bufPool.GetPage(f, rid.PageID, tid, ReadPerm)
+	if err != nil {
+		return nil, err
+	}
+	hp, ok := page.(*heapPage)
+	if !ok || rid.Slot >= hp.numSlots || hp.tuples[rid.Slot] == nil {
+		return nil, GoDBError{TupleNotFoundError, fmt.Sprintf("no tuple with record ID %v", rid)}
+	}
+	t := hp.tuples[rid.Slot]
+	return &Tuple{Desc: *f.tupleDesc, Fields: t.Fields, Rid: &HeapRecordID{rid.PageID, rid.Slot}}, nil
+}
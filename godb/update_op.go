@@ -0,0 +1,149 @@
+package godb
+
+import (
+	"fmt"
+)
+
+type UpdateOp struct {
+	updateFile DBFile
+	fields     []FieldType // the fields of updateFile's tuples to set
+	exprs      []Expr      // the new value of each field
+	child      Operator
+	returning  bool        // return the updated tuples rather than their count
+	tableInfo  *Table      // the table of updateFile, if set
+	bufPool    *BufferPool // holds the modifications until the transaction commits
+}
+
+// Construct an update operator that replaces each record of the child
+// Operator in the specified DBFile with a copy in which the ith of fields is
+// set to the result of evaluating the ith of exprs on the original record.
+//
+// Returns an error if a field is not in the DBFile's descriptor or is assigned
+// an expression of a different type.
+func NewUpdateOp(updateFile DBFile, fields []FieldType, exprs []Expr, child Operator) (*UpdateOp, error) {
+	if len(fields) != len(exprs) {
+		return nil, GoDBError{IllegalOperationError, "update requires one expression per updated field"}
+	}
+	desc := updateFile.Descriptor()
+	seen := make(map[int]bool)
+	for i, f := range fields {
+		fieldNo, err := findFieldInTd(f, desc)
+		if err != nil {
+			return nil, err
+		}
+		if seen[fieldNo] {
+			return nil, GoDBError{IllegalOperationError, fmt.Sprintf("field %s updated more than once", f.Fname)}
+		}
+		seen[fieldNo] = true
+		ftype := exprs[i].GetExprType().Ftype
+		if ftype != UnknownType && ftype != desc.Fields[fieldNo].Ftype {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("cannot assign a value of type %v to field %s of type %v", ftype, f.Fname, desc.Fields[fieldNo].Ftype)}
+		}
+	}
+	return &UpdateOp{
+		updateFile: updateFile,
+		fields:     fields,
+		exprs:      exprs,
+		child:      child,
+	}, nil
+}
+
+// Return the new versions of the updated tuples, rather than their count, from
+// the iterator.
+func (u *UpdateOp) setReturning() {
+	u.returning = true
+}
+
+// Record the updated tuples in the statistics of table, that of updateFile.
+func (u *UpdateOp) setTable(table *Table, bp *BufferPool) {
+	u.tableInfo = table
+	u.bufPool = bp
+}
+
+// The update TupleDesc is a one column descriptor with an integer field named
+// "count", or the DBFile's descriptor if returning the updated tuples.
+func (u *UpdateOp) Descriptor() *TupleDesc {
+	return dmlDescriptor(u.updateFile, u.returning)
+}
+
+// Return an iterator that replaces each tuple of the child iterator in the
+// DBFile with its updated version, by deleting the original tuples and
+// inserting the new ones, and then returns a one-field tuple with a "count" field
+// indicating the number of tuples that were updated (or, if returning, the
+// new version of each of the updated tuples).
+//
+// All of the child's tuples are read before any are modified, so updated
+// tuples that are inserted into pages the child has yet to scan are not
+// updated again. If the DBFile has a unique key, none are modified if the new
+// tuples would violate it.
+func (u *UpdateOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	childIter, err := u.child.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	desc := u.updateFile.Descriptor()
+	fieldNos := make([]int, len(u.fields))
+	for i, f := range u.fields {
+		fieldNos[i], err = findFieldInTd(f, desc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var results func() (*Tuple, error)
+	return func() (*Tuple, error) {
+		if results != nil {
+			return results()
+		}
+
+		var olds, news []*Tuple
+		for {
+			tuple, err := childIter()
+			if err != nil {
+				return nil, err
+			}
+			if tuple == nil {
+				break
+			}
+			fields := make([]DBValue, len(tuple.Fields))
+			copy(fields, tuple.Fields)
+			for i, e := range u.exprs {
+				v, err := e.EvalExpr(tuple)
+				if err != nil {
+					return nil, err
+				}
+				fields[fieldNos[i]] = v
+			}
+			olds = append(olds, tuple)
+			news = append(news, &Tuple{Desc: *desc, Fields: fields})
+		}
+
+		//the new tuples of a file with a unique key are checked before any
+		//are modified, and all of the old ones deleted before any are
+		//inserted, so that e.g. SET id = id + 1 may move a key onto one
+		//that it replaces
+		idx, err := fileKeyIndex(u.updateFile, tid)
+		if err != nil {
+			return nil, err
+		}
+		if idx != nil {
+			if err := idx.checkReplace(olds, news); err != nil {
+				return nil, err
+			}
+		}
+		for _, old := range olds {
+			if err := u.updateFile.deleteTuple(old, tid); err != nil {
+				return nil, fmt.Errorf("failed to delete tuple: %v", err)
+			}
+		}
+		for _, t := range news {
+			if err := u.updateFile.insertTuple(t, tid); err != nil {
+				return nil, fmt.Errorf("failed to insert tuple: %v", err)
+			}
+		}
+
+		u.bufPool.recordModifications(u.tableInfo, tid, int64(len(olds)))
+		results = dmlResultIter(u.returning, int64(len(olds)), news)
+		return results()
+	}, nil
+}
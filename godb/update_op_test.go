@@ -0,0 +1,122 @@
+package godb
+
+import (
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	td, t1, t2, hf, bp, tid := makeTestVars(t)
+
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+	bp.CommitTransaction(tid)
+
+	age := FieldExpr{td.Fields[1]}
+	filt, err := NewFilter(&ConstExpr{IntField{25}, IntType}, OpGt, &age, hf)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	newAge := &FuncExpr{"+", []*Expr{exprPtr(&age), exprPtr(&ConstExpr{IntField{1}, IntType})}}
+	uop, err := NewUpdateOp(hf, []FieldType{td.Fields[1]}, []Expr{newAge}, filt)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	tid = BeginTransactionForTest(t, bp)
+	iter, _ := uop.Iterator(tid)
+	tup, err := iter()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if tup == nil {
+		t.Fatalf("update did not return tuple")
+	}
+	intField, ok := tup.Fields[0].(IntField)
+	if !ok || len(tup.Fields) != 1 || intField.Value != 1 {
+		t.Fatalf("invalid output tuple")
+	}
+	bp.CommitTransaction(tid)
+
+	tid = BeginTransactionForTest(t, bp)
+	iter, _ = hf.Iterator(tid)
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		cnt++
+		name := tup.Fields[0].(StringField).Value
+		age := tup.Fields[1].(IntField).Value
+		if name == "sam" && age != 25 || name == "george jones" && age != 1000 {
+			t.Errorf("unexpected tuple after update: %s, %d", name, age)
+		}
+	}
+	if cnt != 2 {
+		t.Errorf("expected 2 tuples after update, got %d", cnt)
+	}
+	bp.CommitTransaction(tid)
+
+	if _, err := NewUpdateOp(hf, []FieldType{td.Fields[1]}, []Expr{&ConstExpr{StringField{"x"}, StringType}}, hf); err == nil {
+		t.Errorf("expected error assigning a string to an int field")
+	}
+	if _, err := NewUpdateOp(hf, []FieldType{{Fname: "nosuch", Ftype: IntType}}, []Expr{newAge}, hf); err == nil {
+		t.Errorf("expected error updating a field that doesn't exist")
+	}
+}
+
+func exprPtr(e Expr) *Expr {
+	return &e
+}
+
+func TestUpdateQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	updates := []struct {
+		sql      string
+		expected int64
+	}{
+		{"update t set age = age + 1 where name = 'sam'", 2},
+		{"update t set name = 'old', age = 0 where age > (select avg(age) from t2)", 4},
+		// every tuple is updated exactly once, even if moved to a later page
+		{"update t set age = age + 1", 12},
+	}
+	for _, u := range updates {
+		tups := runQueryForTest(t, c, bp, u.sql)
+		if len(tups) != 1 || tups[0].Fields[0].(IntField).Value != u.expected {
+			t.Errorf("q=%s: expected %d updated tuples, got %v", u.sql, u.expected, tups)
+		}
+	}
+
+	tups := runQueryForTest(t, c, bp, "select age from t where name = 'sam'")
+	if len(tups) != 1 || tups[0].Fields[0].(IntField).Value != 27 {
+		t.Errorf("expected one sam of age 27 after updates, got %v", tups)
+	}
+	tups = runQueryForTest(t, c, bp, "select age from t where name = 'old'")
+	if len(tups) != 4 {
+		t.Errorf("expected 4 updated tuples, got %d", len(tups))
+	}
+	for _, tup := range tups {
+		if tup.Fields[0].(IntField).Value != 1 {
+			t.Errorf("expected updated age of 1, got %v", tup.Fields[0])
+		}
+	}
+	if tups := runQueryForTest(t, c, bp, "select name from t"); len(tups) != 12 {
+		t.Errorf("expected 12 tuples after updates, got %d", len(tups))
+	}
+
+	for _, q := range []string{
+		"update t set age = 'abc'",
+		"update t set nosuch = 1",
+		"update t set t2.age = 1",
+	} {
+		if _, _, err := Parse(c, q); err == nil {
+			t.Errorf("q=%s: expected error", q)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package godb
+
+import (
+	"fmt"
+)
+
+// The alias under which the expressions of an upsert refer to the tuple
+// proposed for insertion, as in ON CONFLICT ... DO UPDATE SET a = excluded.a.
+const excludedAlias = "excluded"
+
+// Return the descriptor of the tuples that the update expressions of an upsert
+// into a table named table with descriptor desc are evaluated on: the fields of
+// the existing tuple, qualified by table, followed by those of the proposed
+// tuple, qualified by [excludedAlias].
+func upsertConflictDesc(desc *TupleDesc, table string) *TupleDesc {
+	existing := desc.copy()
+	existing.setTableAlias(table)
+	excluded := desc.copy()
+	excluded.setTableAlias(excludedAlias)
+	return existing.merge(excluded)
+}
+
+type UpsertOp struct {
+	file         DBFile
+	table        string
+	child        Operator
+	keyFields    []int  // fields of file that must be unique
+	updateFields []int  // fields of file to set when a tuple conflicts
+	updateExprs  []Expr // new value of each of updateFields
+	doNothing    bool
+	returning    bool        // return the upserted tuples rather than their count
+	tableInfo    *Table      // the table of file, if set
+	bufPool      *BufferPool // holds the modifications until the transaction commits
+}
+
+// Construct an upsert operator, which inserts each tuple of child into file
+// unless file already contains a tuple with the same values of keyFields. In
+// that case, if doNothing is true, the new tuple is discarded; otherwise, the
+// ith of updateFields of the existing tuple is set to the value of the ith of
+// updateExprs, evaluated on a tuple with the descriptor returned by
+// [upsertConflictDesc] for table.
+//
+// The child's tuples must have the same fields as the file's, and keyFields
+// must be the file's unique key (see [HeapFile.setUniqueKey]).
+func NewUpsertOp(file DBFile, table string, child Operator, keyFields []FieldType, updateFields []FieldType, updateExprs []Expr, doNothing bool) (*UpsertOp, error) {
+	desc := file.Descriptor()
+	if len(child.Descriptor().Fields) != len(desc.Fields) {
+		return nil, GoDBError{TypeMismatchError, "inserted tuples must have the same number of fields as the table"}
+	}
+	if len(keyFields) == 0 {
+		return nil, GoDBError{IllegalOperationError, "upsert requires at least one key field"}
+	}
+	if len(updateFields) != len(updateExprs) {
+		return nil, GoDBError{IllegalOperationError, "upsert requires one expression per updated field"}
+	}
+	u := &UpsertOp{file: file, table: table, child: child, updateExprs: updateExprs, doNothing: doNothing}
+	for _, f := range keyFields {
+		i, err := findFieldInTd(f, desc)
+		if err != nil {
+			return nil, err
+		}
+		u.keyFields = append(u.keyFields, i)
+	}
+	if hf, ok := file.(*HeapFile); !ok || !hf.hasUniqueKey(u.keyFields) {
+		return nil, GoDBError{IllegalOperationError, "there is no unique or primary key constraint matching the upsert's key fields"}
+	}
+	for i, f := range updateFields {
+		fieldNo, err := findFieldInTd(f, desc)
+		if err != nil {
+			return nil, err
+		}
+		ftype := updateExprs[i].GetExprType().Ftype
+		if ftype != UnknownType && ftype != desc.Fields[fieldNo].Ftype {
+			return nil, GoDBError{TypeMismatchError, fmt.Sprintf("cannot assign a value of type %v to field %s of type %v", ftype, f.Fname, desc.Fields[fieldNo].Ftype)}
+		}
+		u.updateFields = append(u.updateFields, fieldNo)
+	}
+	return u, nil
+}
+
+// Return the inserted and updated tuples, rather than their count, from the
+// iterator.
+func (u *UpsertOp) setReturning() {
+	u.returning = true
+}
+
+// Record the inserted and updated tuples in the statistics of table, that of
+// file.
+func (u *UpsertOp) setTable(table *Table, bp *BufferPool) {
+	u.tableInfo = table
+	u.bufPool = bp
+}
+
+// The upsert TupleDesc is a one column descriptor with an integer field named
+// "count", or the DBFile's descriptor if returning the upserted tuples.
+func (u *UpsertOp) Descriptor() *TupleDesc {
+	return dmlDescriptor(u.file, u.returning)
+}
+
+// Return an iterator that upserts all of the tuples from the child iterator
+// and then returns a one-field tuple with a "count" field indicating the number
+// of tuples that were inserted or updated (or, if returning, each inserted
+// tuple and the new version of each updated one; discarded tuples are not
+// returned).
+//
+// Conflicts are found with the file's index of its unique key, and with the
+// tuples inserted or updated by earlier child tuples, so a later child tuple
+// may update a tuple inserted by an earlier one. All of the changes are
+// computed, and checked not to duplicate a key, before the file is modified,
+// so an upsert that fails has no effect.
+func (u *UpsertOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	childIter, err := u.child.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	desc := u.file.Descriptor()
+	conflictDesc := upsertConflictDesc(desc, u.table)
+
+	var results func() (*Tuple, error)
+	return func() (*Tuple, error) {
+		if results != nil {
+			return results()
+		}
+
+		// read the child first, since it may scan the file being modified
+		var proposed []*Tuple
+		for {
+			t, err := childIter()
+			if err != nil {
+				return nil, err
+			}
+			if t == nil {
+				break
+			}
+			proposed = append(proposed, &Tuple{Desc: *desc, Fields: t.Fields})
+		}
+
+		idx, err := fileKeyIndex(u.file, tid)
+		if err != nil {
+			return nil, err
+		}
+		//olds are the tuples of the file to replace with news, of which
+		//pending holds the index of the one with each key; replaced holds the
+		//keys of olds
+		var olds, news []*Tuple
+		pending := make(map[any]int)
+		replaced := make(map[any]bool)
+		//the tuple, of the file or of news, with the same key as t, if any
+		conflicting := func(t *Tuple) (*Tuple, error) {
+			if i, ok := pending[idx.key(t)]; ok {
+				return news[i], nil
+			}
+			rid, ok := idx.lookup(t)
+			if !ok || replaced[idx.key(t)] {
+				return nil, nil
+			}
+			return u.file.(*HeapFile).readTuple(rid, tid)
+		}
+
+		var count int64
+		var upserted []*Tuple
+		for _, t := range proposed {
+			k := idx.key(t)
+			existing, err := conflicting(t)
+			if err != nil {
+				return nil, err
+			}
+			if existing == nil {
+				pending[k] = len(news)
+				news = append(news, t)
+				count++
+				upserted = append(upserted, t)
+				continue
+			}
+			if u.doNothing {
+				continue
+			}
+
+			conflict := &Tuple{Desc: *conflictDesc, Fields: append(append([]DBValue{}, existing.Fields...), t.Fields...)}
+			fields := make([]DBValue, len(existing.Fields))
+			copy(fields, existing.Fields)
+			for i, e := range u.updateExprs {
+				v, err := e.EvalExpr(conflict)
+				if err != nil {
+					return nil, err
+				}
+				fields[u.updateFields[i]] = v
+			}
+			updated := &Tuple{Desc: *desc, Fields: fields}
+
+			//the updated key must not be that of another tuple
+			newKey := idx.key(updated)
+			if newKey != k {
+				other, err := conflicting(updated)
+				if err != nil {
+					return nil, err
+				}
+				if other != nil {
+					return nil, idx.duplicateKeyError(updated)
+				}
+			}
+			if i, ok := pending[k]; ok {
+				delete(pending, k)
+				news[i] = updated
+				pending[newKey] = i
+			} else {
+				olds = append(olds, existing)
+				replaced[k] = true
+				pending[newKey] = len(news)
+				news = append(news, updated)
+			}
+			count++
+			upserted = append(upserted, updated)
+		}
+
+		if err := idx.checkReplace(olds, news); err != nil {
+			return nil, err
+		}
+		for _, old := range olds {
+			if err := u.file.deleteTuple(old, tid); err != nil {
+				return nil, fmt.Errorf("failed to delete tuple: %v", err)
+			}
+		}
+		for _, t := range news {
+			if err := u.file.insertTuple(t, tid); err != nil {
+				return nil, fmt.Errorf("failed to insert tuple: %v", err)
+			}
+		}
+
+		u.bufPool.recordModifications(u.tableInfo, tid, count)
+		results = dmlResultIter(u.returning, count, upserted)
+		return results()
+	}, nil
+}
@@ -0,0 +1,239 @@
+package godb
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestUpsert(t *testing.T) {
+	td, t1, t2, hf, bp, tid := makeTestVars(t)
+	hf.setUniqueKey([]int{0})
+	insertTupleForTest(t, hf, &t1, tid)
+	insertTupleForTest(t, hf, &t2, tid)
+	bp.CommitTransaction(tid)
+
+	rows := [][]Expr{
+		{&ConstExpr{StringField{"sam"}, StringType}, &ConstExpr{IntField{30}, IntType}},
+		{&ConstExpr{StringField{"bob"}, StringType}, &ConstExpr{IntField{1}, IntType}},
+	}
+	conflictDesc := upsertConflictDesc(&td, "test")
+	sum := &FuncExpr{"+", []*Expr{exprPtr(&FieldExpr{conflictDesc.Fields[1]}), exprPtr(&FieldExpr{conflictDesc.Fields[3]})}}
+
+	upsert, err := NewUpsertOp(hf, "test", NewValueOp(rows), []FieldType{td.Fields[0]}, []FieldType{td.Fields[1]}, []Expr{sum}, false)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid = BeginTransactionForTest(t, bp)
+	if cnt := upsertCountForTest(t, upsert, tid); cnt != 2 {
+		t.Errorf("expected 2 upserted tuples, got %d", cnt)
+	}
+	bp.CommitTransaction(tid)
+	checkAgesForTest(t, hf, bp, map[string]int64{"sam": 55, "george jones": 999, "bob": 1})
+
+	ignore, err := NewUpsertOp(hf, "test", NewValueOp(rows), []FieldType{td.Fields[0]}, nil, nil, true)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tid = BeginTransactionForTest(t, bp)
+	if cnt := upsertCountForTest(t, ignore, tid); cnt != 0 {
+		t.Errorf("expected no tuples to be inserted, got %d", cnt)
+	}
+	bp.CommitTransaction(tid)
+	checkAgesForTest(t, hf, bp, map[string]int64{"sam": 55, "george jones": 999, "bob": 1})
+
+	if _, err := NewUpsertOp(hf, "test", NewValueOp(rows), nil, nil, nil, true); err == nil {
+		t.Errorf("expected error for upsert without a key")
+	}
+	if _, err := NewUpsertOp(hf, "test", NewValueOp(rows), []FieldType{td.Fields[1]}, nil, nil, true); err == nil {
+		t.Errorf("expected error for upsert on a field that is not the file's key")
+	}
+}
+
+func upsertCountForTest(t *testing.T, op Operator, tid TransactionID) int64 {
+	t.Helper()
+	iter, err := op.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	tup, err := iter()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return tup.Fields[0].(IntField).Value
+}
+
+// Check that the (name, age) tuples of hf are exactly those in expected.
+func checkAgesForTest(t *testing.T, hf DBFile, bp *BufferPool, expected map[string]int64) {
+	t.Helper()
+	tid := BeginTransactionForTest(t, bp)
+	defer bp.CommitTransaction(tid)
+	iter, err := hf.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	cnt := 0
+	for {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			break
+		}
+		cnt++
+		name := tup.Fields[0].(StringField).Value
+		if age := tup.Fields[1].(IntField).Value; age != expected[name] {
+			t.Errorf("expected age %d for %s, got %d", expected[name], name, age)
+		}
+	}
+	if cnt != len(expected) {
+		t.Errorf("expected %d tuples, got %d", len(expected), cnt)
+	}
+}
+
+func TestUpsertQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+	os.Remove(c.tableNameToFile("gse"))
+	defer os.Remove(c.tableNameToFile("gse"))
+	if _, _, err := Parse(c, "create table gse (station varchar(20), day int, entries int, primary key (station, day))"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !strings.Contains(c.String(), "primary key (station, day)") {
+		t.Errorf("expected primary key in catalog, got %s", c.String())
+	}
+
+	upserts := []struct {
+		sql      string
+		expected int64
+	}{
+		{"insert into gse values ('a', 1, 10), ('a', 2, 20), ('b', 1, 5)", 3},
+		{"insert into gse values ('a', 1, 15), ('c', 1, 7) on conflict (station, day) do update set entries = excluded.entries", 2},
+		{"insert into gse values ('a', 2, 1) on conflict do nothing", 0},
+		{"insert into gse values ('b', 1, 3) on duplicate key update entries = entries + values(entries)", 1},
+		{"insert into gse select station, day, entries from gse on conflict (station, day) do update set entries = gse.entries + excluded.entries", 4},
+		{"insert into gse values ('on conflict (x) do nothing', 1, 1)", 1},
+	}
+	for _, u := range upserts {
+		tups := runQueryForTest(t, c, bp, u.sql)
+		if len(tups) != 1 || tups[0].Fields[0].(IntField).Value != u.expected {
+			t.Errorf("q=%s: expected %d upserted tuples, got %v", u.sql, u.expected, tups)
+		}
+	}
+
+	expected := map[string]int64{"a1": 30, "a2": 40, "b1": 16, "c1": 14, "on conflict (x) do nothing1": 1}
+	tups := runQueryForTest(t, c, bp, "select station, day, entries from gse")
+	if len(tups) != len(expected) {
+		t.Errorf("expected %d tuples, got %d", len(expected), len(tups))
+	}
+	for _, tup := range tups {
+		key := tup.Fields[0].(StringField).Value + fmt.Sprint(tup.Fields[1].(IntField).Value)
+		if v := tup.Fields[2].(IntField).Value; v != expected[key] {
+			t.Errorf("expected %d entries for %s, got %d", expected[key], key, v)
+		}
+	}
+
+	for _, q := range []string{
+		"insert into t values ('x', 1) on duplicate key update age = 1",
+		"insert into gse values ('a', 1, 1) on conflict (nosuch) do nothing",
+		"insert into gse values ('a', 1, 1) on conflict (station, day) do update set entries = 'x'",
+	} {
+		if _, _, err := Parse(c, q); err == nil {
+			t.Errorf("q=%s: expected error", q)
+		}
+	}
+}
+
+func TestPrimaryKeyCatalog(t *testing.T) {
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	dir := t.TempDir()
+	c := NewCatalog("catalog.txt", bp, dir)
+	if _, _, err := Parse(c, "create table stations (id int primary key, name varchar(20))"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := c.SaveToFile("catalog.txt", dir); err != nil {
+		t.Fatalf(err.Error())
+	}
+	c2, err := NewCatalogFromFile("catalog.txt", bp, dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	table, err := c2.GetTableInfo("stations")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(table.primaryKey) != 1 || table.primaryKey[0] != "id" {
+		t.Errorf("expected primary key (id), got %v", table.primaryKey)
+	}
+}
+
+func TestPrimaryKeyEnforced(t *testing.T) {
+	bp, err := NewBufferPool(10)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	dir := t.TempDir()
+	c := NewCatalog("catalog.txt", bp, dir)
+	if _, _, err := Parse(c, "create table k (id int primary key, v int)"); err != nil {
+		t.Fatalf(err.Error())
+	}
+	runQueryForTest(t, c, bp, "insert into k values (1, 10), (2, 20), (3, 30)")
+
+	for _, q := range []string{
+		"insert into k values (1, 11)",
+		"insert into k values (4, 40), (5, 50), (4, 41)",
+		"update k set id = 1",
+		"update k set id = 3 where id = 2",
+		"insert into k values (4, 40) on conflict (v) do nothing",
+		"insert into k values (1, 40) on conflict (id) do update set id = 2",
+		"insert into k values (5, 50), (3, 31), (1, 40) on conflict (id) do update set id = 2",
+	} {
+		if err := queryErrorForTest(t, c, bp, q); err == nil {
+			t.Errorf("q=%s: expected error", q)
+		}
+	}
+	//statements that fail have no effect, even on the tuples before the
+	//duplicate key
+	if tups := runQueryForTest(t, c, bp, "select id, v from k where v >= 30"); len(tups) != 1 {
+		t.Errorf("expected failed statements to change no tuples, got %v", tups)
+	}
+
+	//keys may move onto those of tuples the same statement replaces
+	runQueryForTest(t, c, bp, "update k set id = id + 1")
+	runQueryForTest(t, c, bp, "delete from k where id = 4")
+	runQueryForTest(t, c, bp, "insert into k values (1, 11), (4, 41)")
+	tups := runQueryForTest(t, c, bp, "select id, v from k order by id")
+	expected := [][]int64{{1, 11}, {2, 10}, {3, 20}, {4, 41}}
+	if len(tups) != len(expected) {
+		t.Fatalf("expected %d tuples, got %d", len(expected), len(tups))
+	}
+	for i, tup := range tups {
+		if tup.Fields[0].(IntField).Value != expected[i][0] || tup.Fields[1].(IntField).Value != expected[i][1] {
+			t.Errorf("expected %v, got %v", expected[i], tup.Fields)
+		}
+	}
+
+	//the key of a table read from a saved catalog is enforced on its data
+	bp.FlushAllPages()
+	if err := c.SaveToFile("catalog.txt", dir); err != nil {
+		t.Fatalf(err.Error())
+	}
+	c2, err := NewCatalogFromFile("catalog.txt", bp, dir)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := queryErrorForTest(t, c2, bp, "insert into k values (4, 40)"); err == nil {
+		t.Errorf("expected error inserting a duplicate key into the saved table")
+	}
+	tups = runQueryForTest(t, c2, bp, "insert into k values (4, 40) on conflict (id) do update set v = k.v + excluded.v returning v")
+	if len(tups) != 1 || tups[0].Fields[0].(IntField).Value != 81 {
+		t.Errorf("expected the conflicting tuple to be updated to 81, got %v", tups)
+	}
+}
@@ -22,6 +22,12 @@ func NewValueOp(exprs []([]Expr)) *ValueOp {
 	return &ValueOp{&td, exprs}
 }
 
+// Construct a ValueOp that returns no tuples, with descriptor td, e.g., for a
+// table none of whose tuples satisfy a filter.
+func NewEmptyValueOp(td *TupleDesc) *ValueOp {
+	return &ValueOp{td, nil}
+}
+
 func (v *ValueOp) Descriptor() *TupleDesc {
 	return v.td
 }
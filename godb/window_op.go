@@ -0,0 +1,449 @@
+package godb
+
+import (
+	"fmt"
+	"sort"
+)
+
+// The kinds of bound of a window frame (see [WindowFrame]).
+type FrameBoundType int
+
+const (
+	UnboundedPreceding FrameBoundType = iota
+	Preceding          FrameBoundType = iota
+	CurrentRow         FrameBoundType = iota
+	Following          FrameBoundType = iota
+	UnboundedFollowing FrameBoundType = iota
+)
+
+// A bound of a window frame. Offset is the number of rows (for a ROWS frame) or
+// the difference in the value of the order by expression (for a RANGE frame)
+// of a Preceding or Following bound.
+type FrameBound struct {
+	Type   FrameBoundType
+	Offset int64
+}
+
+// The frame of a window function: the rows of the current row's partition that
+// the function (e.g., a running aggregate) is computed over. In a ROWS frame,
+// the bounds are numbers of rows before or after the current row; in a RANGE
+// frame, they are differences in the value of the window's order by expression,
+// and a CurrentRow bound includes all of the current row's peers (the rows with
+// the same order by values).
+type WindowFrame struct {
+	Rows       bool
+	Start, End FrameBound
+}
+
+// The default frame, RANGE BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW, which
+// is the whole partition if the window has no order by.
+var DefaultWindowFrame = WindowFrame{false, FrameBound{UnboundedPreceding, 0}, FrameBound{CurrentRow, 0}}
+
+// Return an error if the frame's bounds are invalid, e.g., if it ends before
+// it starts.
+func (f WindowFrame) validate() error {
+	if f.Start.Type == UnboundedFollowing || f.End.Type == UnboundedPreceding || f.Start.Type > f.End.Type {
+		return GoDBError{ParseError, "invalid window frame bounds"}
+	}
+	if f.Start.Offset < 0 || f.End.Offset < 0 {
+		return GoDBError{ParseError, "window frame offsets must not be negative"}
+	}
+	return nil
+}
+
+// Return true if the frame has a bound with an offset.
+func (f WindowFrame) hasOffset() bool {
+	return f.Start.Type == Preceding || f.Start.Type == Following || f.End.Type == Preceding || f.End.Type == Following
+}
+
+// A WindowFunc is a function computed by a [WindowOp] for each row: a ranking
+// function (ROW_NUMBER, RANK, DENSE_RANK), a function returning the value of an
+// expression in another row (LAG, LEAD, FIRST_VALUE, LAST_VALUE), or an
+// aggregate function computed over the row's frame.
+type WindowFunc struct {
+	name  string
+	args  []Expr
+	frame WindowFrame
+	agg   AggState // for aggregates, the initialized state of no rows
+	field FieldType
+}
+
+// Construct a window function name(args) whose result is the field fieldName.
+// The frame is only used by FIRST_VALUE, LAST_VALUE and aggregates; the
+// arguments of aggregates after the first must be constants, as must the
+// offset and default arguments of LAG and LEAD (the default default is the
+// zero value of the type, i.e., 0 or "", since GoDB has no NULL).
+func NewWindowFunc(name string, args []Expr, frame WindowFrame, fieldName string) (*WindowFunc, error) {
+	if err := frame.validate(); err != nil {
+		return nil, err
+	}
+	w := &WindowFunc{name: name, args: args, frame: frame}
+	nArgs := func(min, max int) error {
+		if len(args) < min || len(args) > max {
+			return GoDBError{ParseError, fmt.Sprintf("wrong number of arguments to window function %s", name)}
+		}
+		return nil
+	}
+	var err error
+	switch name {
+	case "row_number", "rank", "dense_rank":
+		err = nArgs(0, 0)
+		w.field = FieldType{fieldName, "", IntType}
+	case "lag", "lead":
+		if err = nArgs(1, 3); err != nil {
+			break
+		}
+		w.field = FieldType{fieldName, "", args[0].GetExprType().Ftype}
+		if len(args) > 1 {
+			if _, ok := args[1].(*ConstExpr); !ok || args[1].GetExprType().Ftype != IntType {
+				err = GoDBError{ParseError, fmt.Sprintf("expected a constant integer offset for %s", name)}
+			}
+		}
+		if len(args) > 2 {
+			if _, ok := args[2].(*ConstExpr); !ok || args[2].GetExprType().Ftype != w.field.Ftype {
+				err = GoDBError{ParseError, fmt.Sprintf("expected a constant default of the type of the value for %s", name)}
+			}
+		}
+	case "first_value", "last_value":
+		if err = nArgs(1, 1); err == nil {
+			w.field = FieldType{fieldName, "", args[0].GetExprType().Ftype}
+		}
+	default:
+		aggFn, ok := aggFuncs[name]
+		if !ok {
+			return nil, GoDBError{ParseError, fmt.Sprintf("unknown window function %s", name)}
+		}
+		if err = nArgs(aggFn.args+1, aggFn.args+1); err != nil {
+			break
+		}
+		var constArgs []DBValue
+		for _, arg := range args[1:] {
+			if _, ok := arg.(*ConstExpr); !ok {
+				return nil, GoDBError{ParseError, fmt.Sprintf("expected constant arguments after the first argument of aggregate %s", name)}
+			}
+			v, _ := arg.EvalExpr(nil)
+			constArgs = append(constArgs, v)
+		}
+		if w.agg, err = aggFn.newState(constArgs); err != nil {
+			break
+		}
+		if err = w.agg.Init(fieldName, args[0]); err != nil {
+			break
+		}
+		w.field = w.agg.GetTupleDesc().Fields[0]
+		w.field.Fname = fieldName
+	}
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// A WindowOp computes window functions that share a window, i.e., a partition
+// by and an order by: it sorts its child's tuples by the partition by
+// expressions and then the order by expressions (externally, if necessary, as
+// an OrderBy does), and returns each tuple followed by the values of the
+// functions for it. Each partition is held in memory while its functions are
+// computed.
+//
+// Functions with different windows are computed by a WindowOp each.
+type WindowOp struct {
+	partitionBy []Expr
+	orderBy     []Expr
+	ascending   []bool
+	funcs       []*WindowFunc
+	child       Operator
+}
+
+// Construct a window operator computing funcs over the partitions of child's
+// tuples by partitionBy, each ordered as specified by orderBy and ascending, as
+// for [NewOrderBy].
+//
+// Returns an error if a function has a RANGE frame with an offset and the
+// order by isn't a single integer expression.
+func NewWindowOp(partitionBy []Expr, orderBy []Expr, ascending []bool, funcs []*WindowFunc, child Operator) (*WindowOp, error) {
+	if len(orderBy) != len(ascending) {
+		return nil, fmt.Errorf("length of orderBy and ascending must match")
+	}
+	for _, f := range funcs {
+		if !f.frame.Rows && f.frame.hasOffset() && (len(orderBy) != 1 || orderBy[0].GetExprType().Ftype != IntType) {
+			return nil, GoDBError{ParseError, fmt.Sprintf("RANGE frame with an offset for %s requires ordering by one integer expression", f.name)}
+		}
+	}
+	return &WindowOp{partitionBy, orderBy, ascending, funcs, child}, nil
+}
+
+// The descriptor of the window operator is that of the child followed by a
+// field for each function.
+func (w *WindowOp) Descriptor() *TupleDesc {
+	return w.child.Descriptor().merge(w.funcsDesc())
+}
+
+// The descriptor of the values of the functions.
+func (w *WindowOp) funcsDesc() *TupleDesc {
+	td := &TupleDesc{}
+	for _, f := range w.funcs {
+		td.Fields = append(td.Fields, f.field)
+	}
+	return td
+}
+
+// Return an iterator over the child's tuples, with the values of the functions
+// appended, in order of their partition and then the order by expressions.
+func (w *WindowOp) Iterator(tid TransactionID) (func() (*Tuple, error), error) {
+	childIter, err := w.child.Iterator(tid)
+	if err != nil {
+		return nil, err
+	}
+	sortedIter := childIter
+	exprs := append(append([]Expr{}, w.partitionBy...), w.orderBy...)
+	if len(exprs) > 0 {
+		ascs := make([]bool, len(w.partitionBy), len(exprs))
+		for i := range ascs {
+			ascs[i] = true
+		}
+		ascs = append(ascs, w.ascending...)
+		sortedIter, err = externalSort(w.child.Descriptor(), childIter, func(t1, t2 *Tuple) (bool, error) {
+			return orderByLess(exprs, ascs, t1, t2)
+		}, SortBufferSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	funcsDesc := w.funcsDesc()
+	next, err := sortedIter() // the first tuple of the next partition
+	if err != nil {
+		return nil, err
+	}
+	var partition []*Tuple
+	var values [][]DBValue // the values of the functions for each tuple
+	i := 0
+	return func() (*Tuple, error) {
+		if i == len(partition) {
+			if next == nil {
+				return nil, nil
+			}
+			key, err := w.partitionKey(next)
+			if err != nil {
+				return nil, err
+			}
+			partition = partition[:0]
+			for next != nil {
+				nextKey, err := w.partitionKey(next)
+				if err != nil {
+					return nil, err
+				}
+				if nextKey != key {
+					break
+				}
+				partition = append(partition, next)
+				if next, err = sortedIter(); err != nil {
+					return nil, err
+				}
+			}
+			if values, err = w.evalPartition(partition); err != nil {
+				return nil, err
+			}
+			i = 0
+		}
+		i++
+		return joinTuples(partition[i-1], &Tuple{Desc: *funcsDesc, Fields: values[i-1]}), nil
+	}, nil
+}
+
+// Return a key identifying the partition of t.
+func (w *WindowOp) partitionKey(t *Tuple) (any, error) {
+	key := &Tuple{}
+	for _, e := range w.partitionBy {
+		v, err := e.EvalExpr(t)
+		if err != nil {
+			return nil, err
+		}
+		key.Fields = append(key.Fields, v)
+	}
+	return key.tupleKey(), nil
+}
+
+// The zero value of a type, returned where SQL would return NULL.
+func zeroValue(t DBType) DBValue {
+	if t == StringType {
+		return StringField{""}
+	}
+	return IntField{0}
+}
+
+// Return the values of the functions for each tuple of a sorted partition.
+func (w *WindowOp) evalPartition(part []*Tuple) ([][]DBValue, error) {
+	n := len(part)
+	// the order by values of each tuple, and the first and last of the
+	// tuple's peers
+	keys := make([][]DBValue, n)
+	peerStart, peerEnd, denseRank := make([]int, n), make([]int, n), make([]int, n)
+	for i, t := range part {
+		for _, e := range w.orderBy {
+			v, err := e.EvalExpr(t)
+			if err != nil {
+				return nil, err
+			}
+			keys[i] = append(keys[i], v)
+		}
+		peerStart[i], denseRank[i] = i, 1
+		if i > 0 {
+			denseRank[i] = denseRank[i-1]
+			if peers(keys[i-1], keys[i]) {
+				peerStart[i] = peerStart[i-1]
+			} else {
+				denseRank[i]++
+			}
+		}
+	}
+	for i := n - 1; i >= 0; i-- {
+		peerEnd[i] = i
+		if i < n-1 && peerStart[i+1] == peerStart[i] {
+			peerEnd[i] = peerEnd[i+1]
+		}
+	}
+
+	values := make([][]DBValue, n)
+	for i := range values {
+		values[i] = make([]DBValue, len(w.funcs))
+	}
+	for fi, f := range w.funcs {
+		frameBounds := func(i int) (int, int) {
+			return w.frameBounds(f.frame, i, keys, peerStart, peerEnd)
+		}
+		valueAt := func(j int, e Expr) (DBValue, error) {
+			if j < 0 || j >= n {
+				return zeroValue(f.field.Ftype), nil
+			}
+			return e.EvalExpr(part[j])
+		}
+		var state AggState // for running aggregates, the state of the rows so far
+		added := 0
+		for i := range part {
+			var v DBValue
+			var err error
+			switch f.name {
+			case "row_number":
+				v = IntField{int64(i + 1)}
+			case "rank":
+				v = IntField{int64(peerStart[i] + 1)}
+			case "dense_rank":
+				v = IntField{int64(denseRank[i])}
+			case "lag", "lead":
+				offset := int64(1)
+				if len(f.args) > 1 {
+					o, _ := f.args[1].EvalExpr(nil)
+					offset = o.(IntField).Value
+				}
+				if f.name == "lag" {
+					offset = -offset
+				}
+				j := int64(i) + offset
+				if (j < 0 || j >= int64(n)) && len(f.args) > 2 {
+					v, err = f.args[2].EvalExpr(nil)
+				} else {
+					v, err = valueAt(int(max(min(j, int64(n)), -1)), f.args[0])
+				}
+			case "first_value", "last_value":
+				lo, hi := frameBounds(i)
+				if lo > hi {
+					v = zeroValue(f.field.Ftype)
+				} else if f.name == "first_value" {
+					v, err = valueAt(lo, f.args[0])
+				} else {
+					v, err = valueAt(hi, f.args[0])
+				}
+			default:
+				lo, hi := frameBounds(i)
+				if f.frame.Start.Type == UnboundedPreceding {
+					// the end of the frame never moves backwards, so
+					// add the rows that have entered it
+					if state == nil {
+						state = f.agg.Copy()
+					}
+					for ; added <= hi; added++ {
+						state.AddTuple(part[added])
+					}
+					var t *Tuple
+					if t, err = finalizeAggState(state); err == nil {
+						v = t.Fields[0]
+					}
+				} else {
+					s := f.agg.Copy()
+					for j := lo; j <= hi; j++ {
+						s.AddTuple(part[j])
+					}
+					var t *Tuple
+					if t, err = finalizeAggState(s); err == nil {
+						v = t.Fields[0]
+					}
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+			values[i][fi] = v
+		}
+	}
+	return values, nil
+}
+
+// Return true if the order by values k1 and k2 are equal.
+func peers(k1, k2 []DBValue) bool {
+	for i, v := range k1 {
+		if !v.EvalPred(k2[i], OpEq) {
+			return false
+		}
+	}
+	return true
+}
+
+// Return the positions of the first and last rows of the frame of row i of a
+// partition, which is empty if the first is after the last.
+func (w *WindowOp) frameBounds(f WindowFrame, i int, keys [][]DBValue, peerStart, peerEnd []int) (int, int) {
+	n := len(keys)
+	bound := func(b FrameBound, start bool) int {
+		switch b.Type {
+		case UnboundedPreceding:
+			return 0
+		case UnboundedFollowing:
+			return n - 1
+		case CurrentRow:
+			if f.Rows {
+				return i
+			} else if start {
+				return peerStart[i]
+			}
+			return peerEnd[i]
+		}
+		offset := b.Offset
+		if b.Type == Preceding {
+			offset = -offset
+		}
+		if f.Rows {
+			return int(max(min(int64(i)+offset, int64(n)), -1))
+		}
+		// the rows whose value is within offset of the current row's,
+		// in the direction of the order
+		asc := w.ascending[0]
+		if !asc {
+			offset = -offset
+		}
+		target := keys[i][0].(IntField).Value + offset
+		after := func(j int, orEqual bool) bool {
+			v := keys[j][0].(IntField).Value
+			if v == target {
+				return orEqual
+			}
+			return (v > target) == asc
+		}
+		if start {
+			return sort.Search(n, func(j int) bool { return after(j, true) })
+		}
+		return sort.Search(n, func(j int) bool { return after(j, false) }) - 1
+	}
+	lo, hi := bound(f.Start, true), bound(f.End, false)
+	return max(lo, 0), min(hi, n-1)
+}
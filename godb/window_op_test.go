@@ -0,0 +1,233 @@
+package godb
+
+import (
+	"strings"
+	"testing"
+)
+
+// check the values of each kind of window function, over two partitions with
+// ties in the order by
+func TestWindowOp(t *testing.T) {
+	td, _, _, _, _, tid := makeTestVars(t)
+	child := &MemFile{desc: &td}
+	for _, r := range []struct {
+		name string
+		age  int64
+	}{{"b", 7}, {"a", 2}, {"a", 5}, {"b", 3}, {"a", 1}, {"a", 2}} {
+		child.insertTuple(&Tuple{Desc: td, Fields: []DBValue{StringField{r.name}, IntField{r.age}}}, tid)
+	}
+	name, age := &FieldExpr{td.Fields[0]}, &FieldExpr{td.Fields[1]}
+
+	rows := func(start, end FrameBound) WindowFrame { return WindowFrame{true, start, end} }
+	funcs := []struct {
+		name  string
+		args  []Expr
+		frame WindowFrame
+	}{
+		{"row_number", nil, DefaultWindowFrame},
+		{"rank", nil, DefaultWindowFrame},
+		{"dense_rank", nil, DefaultWindowFrame},
+		{"lag", []Expr{age}, DefaultWindowFrame},
+		{"lead", []Expr{age, &ConstExpr{IntField{1}, IntType}, &ConstExpr{IntField{-1}, IntType}}, DefaultWindowFrame},
+		{"first_value", []Expr{age}, DefaultWindowFrame},
+		{"sum", []Expr{age}, DefaultWindowFrame},
+		{"sum", []Expr{age}, rows(FrameBound{Preceding, 1}, FrameBound{Following, 1})},
+		{"count", []Expr{age}, WindowFrame{false, FrameBound{Preceding, 2}, FrameBound{CurrentRow, 0}}},
+		{"last_value", []Expr{age}, rows(FrameBound{CurrentRow, 0}, FrameBound{UnboundedFollowing, 0})},
+	}
+	var windowFuncs []*WindowFunc
+	for _, f := range funcs {
+		wf, err := NewWindowFunc(f.name, f.args, f.frame, f.name)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		windowFuncs = append(windowFuncs, wf)
+	}
+	w, err := NewWindowOp([]Expr{name}, []Expr{age}, []bool{true}, windowFuncs, child)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if n := len(w.Descriptor().Fields); n != 2+len(funcs) {
+		t.Fatalf("expected %d fields, got %d", 2+len(funcs), n)
+	}
+
+	expected := [][]int64{
+		// age, row_number, rank, dense_rank, lag, lead, first_value, running
+		// sum, rows sum, range count, last_value
+		{1, 1, 1, 1, 0, 2, 1, 1, 3, 1, 5},
+		{2, 2, 2, 2, 1, 2, 1, 5, 5, 3, 5},
+		{2, 3, 2, 2, 2, 5, 1, 5, 9, 3, 5},
+		{5, 4, 4, 3, 2, -1, 1, 10, 7, 1, 5},
+		{3, 1, 1, 1, 0, 7, 3, 3, 10, 1, 7},
+		{7, 2, 2, 2, 3, -1, 3, 10, 10, 1, 7},
+	}
+	iter, err := w.Iterator(tid)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for i := 0; ; i++ {
+		tup, err := iter()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if tup == nil {
+			if i != len(expected) {
+				t.Fatalf("expected %d tuples, got %d", len(expected), i)
+			}
+			break
+		}
+		if i >= len(expected) {
+			t.Fatalf("too many tuples")
+		}
+		for j, e := range expected[i] {
+			if v := tup.Fields[j+1].(IntField).Value; v != e {
+				t.Errorf("tuple %d: expected %d for field %s, got %d", i, e, tup.Desc.Fields[j+1].Fname, v)
+			}
+		}
+	}
+}
+
+func TestWindowErrors(t *testing.T) {
+	td, _, _, _, _, _ := makeTestVars(t)
+	name, age := &FieldExpr{td.Fields[0]}, &FieldExpr{td.Fields[1]}
+	child := &MemFile{desc: &td}
+
+	frames := []WindowFrame{
+		{true, FrameBound{UnboundedFollowing, 0}, FrameBound{UnboundedFollowing, 0}},
+		{true, FrameBound{CurrentRow, 0}, FrameBound{Preceding, 1}},
+		{false, FrameBound{Preceding, -1}, FrameBound{CurrentRow, 0}},
+	}
+	for _, f := range frames {
+		if _, err := NewWindowFunc("sum", []Expr{age}, f, "s"); err == nil {
+			t.Errorf("expected error for frame %v", f)
+		}
+	}
+	funcs := []struct {
+		name string
+		args []Expr
+	}{
+		{"nosuchfunc", nil},
+		{"rank", []Expr{age}},
+		{"lag", nil},
+		{"lag", []Expr{age, age}},
+		{"lead", []Expr{age, &ConstExpr{IntField{1}, IntType}, &ConstExpr{StringField{"x"}, StringType}}},
+		{"percentile_cont", []Expr{age, age}},
+	}
+	for _, f := range funcs {
+		if _, err := NewWindowFunc(f.name, f.args, DefaultWindowFrame, "f"); err == nil {
+			t.Errorf("expected error for window function %s with %d args", f.name, len(f.args))
+		}
+	}
+
+	// a RANGE frame with an offset needs a single integer order by
+	rangeFrame := WindowFrame{false, FrameBound{Preceding, 1}, FrameBound{CurrentRow, 0}}
+	wf, err := NewWindowFunc("sum", []Expr{age}, rangeFrame, "s")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, orderBy := range [][]Expr{{name}, {age, name}, nil} {
+		if _, err := NewWindowOp(nil, orderBy, make([]bool, len(orderBy)), []*WindowFunc{wf}, child); err == nil {
+			t.Errorf("expected error for range frame with offset ordered by %d expressions", len(orderBy))
+		}
+	}
+}
+
+func TestWindowRewrite(t *testing.T) {
+	queries := []struct{ query, expected string }{
+		{"select rank() over (order by a) from t",
+			"select godb_window(rank(), godb_order_by(a, 'asc')) from t"},
+		{"select sum(a) OVER(partition by b, c order by d desc, e rows unbounded preceding) from t",
+			"select godb_window(sum(a), godb_partition_by(b, c), godb_order_by(d, 'desc', e, 'asc'), godb_frame('rows', 'unbounded preceding', 'current row')) from t"},
+		{"select lag(a, 1) over (order by f(a, b) range between 2 preceding and 3 following) + 1 from t",
+			"select godb_window(lag(a, 1), godb_order_by(f(a, b), 'asc'), godb_frame('range', '2 preceding', '3 following')) + 1 from t"},
+		{"select count(*) over () from t",
+			"select godb_window(count(*)) from t"},
+		// strings and named windows aren't rewritten
+		{"select 'f() over (x)' from t", "select 'f() over (x)' from t"},
+		{"select rank() over w from t", "select rank() over w from t"},
+	}
+	for _, q := range queries {
+		if got := rewriteWindows(q.query); got != q.expected {
+			t.Errorf("rewriting %s: expected %s, got %s", q.query, q.expected, got)
+		}
+	}
+}
+
+func TestWindowQueries(t *testing.T) {
+	bp, c, err := MakeParserTestDatabase(1000)
+	if err != nil {
+		t.Fatalf("failed to create test database, %s", err.Error())
+	}
+
+	tups := runQueryForTest(t, c, bp, "select name, age, row_number() over (partition by name order by age desc) as rn from t")
+	if len(tups) != 12 {
+		t.Fatalf("expected 12 tuples, got %d", len(tups))
+	}
+	for _, tup := range tups {
+		name, age, rn := tup.Fields[0].(StringField).Value, tup.Fields[1].(IntField).Value, tup.Fields[2].(IntField).Value
+		expected := int64(1)
+		if (name == "riza" && age == 22) || (name == "sam" && age == 25) {
+			expected = 2
+		}
+		if rn != expected {
+			t.Errorf("expected row number %d for %s %d, got %d", expected, name, age, rn)
+		}
+	}
+
+	// running totals include the current row's peers
+	tups = runQueryForTest(t, c, bp, "select age, sum(age) over (order by age), count(*) over (order by age rows between 1 preceding and current row) from t order by age")
+	expectedSums := []int64{44, 44, 69, 99, 137, 177, 220, 265, 315, 375, 573, 573}
+	for i, tup := range tups {
+		if v := tup.Fields[1].(IntField).Value; v != expectedSums[i] {
+			t.Errorf("expected running sum %d for tuple %d, got %d", expectedSums[i], i, v)
+		}
+		expectedCount := int64(2)
+		if i == 0 {
+			expectedCount = 1
+		}
+		if v := tup.Fields[2].(IntField).Value; v != expectedCount {
+			t.Errorf("expected count %d for tuple %d, got %d", expectedCount, i, v)
+		}
+	}
+
+	// windows are computed after aggregation, and may be used in expressions
+	tups = runQueryForTest(t, c, bp, "select name, rank() over (order by count(*) desc) as r, sum(count(*)) over () - count(*) as others from t group by name")
+	if len(tups) != 10 {
+		t.Fatalf("expected 10 groups, got %d", len(tups))
+	}
+	for _, tup := range tups {
+		name, r, others := tup.Fields[0].(StringField).Value, tup.Fields[1].(IntField).Value, tup.Fields[2].(IntField).Value
+		expectedRank, expectedOthers := int64(3), int64(11)
+		if name == "riza" || name == "sam" {
+			expectedRank, expectedOthers = 1, 10
+		}
+		if r != expectedRank || others != expectedOthers {
+			t.Errorf("expected rank %d and %d others for %s, got %d and %d", expectedRank, expectedOthers, name, r, others)
+		}
+	}
+
+	// functions with the same window share an operator
+	_, plan, err := Parse(c, "select rank() over (order by age), lag(name) over (order by age), max(age) over (partition by name) from t")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var explain strings.Builder
+	OutputPhysicalPlan(func(format string, a ...any) {
+		explain.WriteString(format)
+	}, plan, "")
+	if n := strings.Count(explain.String(), "Window"); n != 2 {
+		t.Errorf("expected 2 window operators, got %d", n)
+	}
+
+	for _, q := range []string{
+		"select rank() over w from t",
+		"select nosuchfunc(age) over (order by age) from t",
+		"select name from t where rank() over (order by age) = 1",
+		"select sum(age) over (order by name range between 1 preceding and current row) from t",
+		"select count(distinct age) over () from t",
+	} {
+		if _, _, err := Parse(c, q); err == nil {
+			t.Errorf("expected error for %s", q)
+		}
+	}
+}
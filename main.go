@@ -15,16 +15,19 @@ import (
 )
 
 var helpText = `Enter a SQL query terminated by a ; to process it.  Commands prefixed with \ are processed as shell commands.
+Prefix a query with EXPLAIN to show its plan, or with EXPLAIN ANALYZE to run it and show the actual cardinality,
+time and pages read of each operator of its plan.
 
 Available shell commands:
 	\h : This help
 	\c path/to/catalog : Change the current database to a specified catalog file
 	\d : List tables and fields in the current database
-	\f : List available functions for use in queries
+	\f : List available functions and aggregates for use in queries
 	\a : Toggle aligned vs csv output
     \o : Toggle query optimization
+	\b : Toggle bushy join plans, in which both inputs of a join may be joins
 	\l table path/to/file [sep] [hasHeader]: Append csv file to end of table.  Default to sep = ',', hasHeader = 'true'
-	\z : Compute statistics for the database`
+	\z : Compute statistics for the database, as ANALYZE does`
 
 func printCatalog(c *godb.Catalog) {
 	s := c.CatalogString()
@@ -88,6 +91,7 @@ func main() {
 	var autocommit bool = true
 	var tid godb.TransactionID
 	aligned := true
+	staleWarned := make(map[string]bool)
 	for {
 		text, err := rl.Readline()
 		if err != nil { // io.EOF
@@ -120,6 +124,8 @@ func main() {
 			case 'f':
 				fmt.Println("Available functions:")
 				fmt.Print(godb.ListOfFunctions())
+				fmt.Println("Available aggregates:")
+				fmt.Print(godb.ListOfAggregates())
 			case 'a':
 				aligned = !aligned
 				if aligned {
@@ -134,9 +140,22 @@ func main() {
 				} else {
 					fmt.Println("\033[32;1mOptimization disabled\033[0m\n\n")
 				}
+			case 'b':
+				godb.EnableBushyJoins = !godb.EnableBushyJoins
+				if godb.EnableBushyJoins {
+					fmt.Println("\033[32;1mBushy join plans enabled\033[0m\n\n")
+				} else {
+					fmt.Println("\033[32;1mBushy join plans disabled\033[0m\n\n")
+				}
 			case 'z':
-				c.ComputeTableStats()
-				fmt.Printf("\033[32;1mAnalysis Complete\033[0m\n\n")
+				if err := c.ComputeTableStats(); err != nil {
+					fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+				} else if err := c.SaveToFile(catName, catPath); err != nil {
+					fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+				} else {
+					clear(staleWarned)
+					fmt.Printf("\033[32;1mAnalysis Complete\033[0m\n\n")
+				}
 			case '?':
 				fallthrough
 			case 'h':
@@ -184,11 +203,15 @@ func main() {
 		}
 		query = strings.TrimSpace(query + " " + text[0:len(text)-1])
 
-		explain := false
+		explain, analyze := false, false
 		if strings.HasPrefix(strings.ToLower(query), "explain") {
 			queryParts := strings.Split(query, " ")
 			query = strings.Join(queryParts[1:], " ")
 			explain = true
+			if len(queryParts) > 2 && strings.ToLower(queryParts[1]) == "analyze" {
+				query = strings.Join(queryParts[2:], " ")
+				analyze = true
+			}
 		}
 
 		queryType, plan, err := godb.Parse(c, query)
@@ -223,7 +246,7 @@ func main() {
 			continue
 
 		case godb.IteratorType:
-			if explain {
+			if explain && !analyze {
 				fmt.Printf("\033[32m")
 				godb.PrintPhysicalPlan(plan, "")
 				fmt.Printf("\033[0m\n")
@@ -239,18 +262,41 @@ func main() {
 			}
 			start := time.Now()
 
+			if analyze {
+				nresults, err = godb.ExplainAnalyze(plan, bp, tid)
+				if err != nil {
+					fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+				}
+				if autocommit && err != nil {
+					bp.AbortTransaction(tid)
+				} else if autocommit {
+					bp.CommitTransaction(tid)
+				}
+				fmt.Printf("\033[32m")
+				godb.PrintPhysicalPlan(plan, "")
+				fmt.Printf("\033[0m\n")
+				fmt.Printf("\033[32;1m(%d results)\033[0m\n", nresults)
+				fmt.Printf("\033[32;1m%v\033[0m\n\n", time.Since(start))
+				break
+			}
+
 			iter, err := plan.Iterator(tid)
 			if err != nil {
 				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+				if autocommit {
+					bp.AbortTransaction(tid)
+				}
 				continue
 			}
 
 			fmt.Printf("\033[32;4m%s\033[0m\n", plan.Descriptor().HeaderString(aligned))
 
+			failed := false
 			for {
 				tup, err := iter()
 				if err != nil {
 					fmt.Printf("%s\n", err.Error())
+					failed = true
 					break
 				}
 				if tup == nil {
@@ -266,9 +312,17 @@ func main() {
 				default:
 				}
 			}
-			if autocommit {
+			if autocommit && failed {
+				bp.AbortTransaction(tid)
+			} else if autocommit {
 				bp.CommitTransaction(tid)
 			}
+			for _, table := range c.StaleTables() {
+				if !staleWarned[table] {
+					fmt.Printf("\033[33mStatistics of %s are stale; run ANALYZE %s\033[0m\n", table, table)
+					staleWarned[table] = true
+				}
+			}
 		outer:
 			fmt.Printf("\033[32;1m(%d results)\033[0m\n", nresults)
 			duration := time.Since(start)
@@ -316,6 +370,20 @@ func main() {
 			if err != nil {
 				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
 			}
+		case godb.AnalyzeQueryType:
+			fmt.Printf("\033[32;1mANALYZE\033[0m\n\n")
+			clear(staleWarned)
+			err := c.SaveToFile(catName, catPath)
+			if err != nil {
+				fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
+			}
+		}
+	}
+	//save the statistics, which record the tuples modified since they were
+	//computed, unless the session changed neither them nor the schema
+	if c.Unsaved() {
+		if err := c.SaveToFile(catName, catPath); err != nil {
+			fmt.Printf("\033[31;1m%s\033[0m\n", err.Error())
 		}
 	}
 }